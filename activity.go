@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/silentsokolov/go-sleep/log"
+	"github.com/silentsokolov/go-sleep/provider"
+)
+
+// Activity source types
+const (
+	activityCPU         = "cpu"
+	activitySSH         = "ssh"
+	activityConnections = "connections"
+	activityHTTP        = "http"
+)
+
+const (
+	defaultActivityWindow  = 5 * time.Minute
+	defaultActivityTimeout = 5 * time.Second
+	defaultAgentPort       = 9922
+	defaultAgentPath       = "/sessions"
+	defaultBusyPath        = "/busy"
+)
+
+// ActivitySource reports whether an instance is busy besides proxied requests
+type ActivitySource interface {
+	String() string
+	Active(instance *ComputeInstance) (bool, error)
+}
+
+func newActivitySource(conf *ActivityConfig, p provider.Provider) ActivitySource {
+	timeout := defaultActivityTimeout
+	if conf.Timeout > 0 {
+		timeout = time.Duration(conf.Timeout) * time.Second
+	}
+	client := &http.Client{Timeout: timeout}
+
+	switch conf.Type {
+	case activityCPU:
+		reporter, ok := p.(provider.CPUReporter)
+		if !ok {
+			log.Fatalf("Activity %s: %s does not report CPU utilization", conf.Type, p)
+		}
+		window := defaultActivityWindow
+		if conf.Window > 0 {
+			window = time.Duration(conf.Window) * time.Second
+		}
+		return &cpuSource{reporter: reporter, threshold: conf.Threshold, window: window}
+	case activitySSH:
+		src := &agentSource{port: conf.Port, path: conf.Path, threshold: conf.Threshold, client: client}
+		if src.port == 0 {
+			src.port = defaultAgentPort
+		}
+		if len(src.path) == 0 {
+			src.path = defaultAgentPath
+		}
+		return src
+	case activityConnections:
+		return &connectionsSource{threshold: conf.Threshold}
+	case activityHTTP:
+		src := &probeSource{port: conf.Port, path: conf.Path, status: conf.Status, client: client}
+		if len(src.path) == 0 {
+			src.path = defaultBusyPath
+		}
+		if src.status == 0 {
+			src.status = http.StatusOK
+		}
+		return src
+	default:
+		log.Fatalf("Unknown activity type %q of %s", conf.Type, p)
+		return nil
+	}
+}
+
+// activitySources returns sources of conf, open TCP connections
+// keep an instance awake unless the connections source is configured
+func activitySources(confs []*ActivityConfig, p provider.Provider) []ActivitySource {
+	sources := make([]ActivitySource, 0, len(confs)+1)
+	connections := false
+
+	for _, conf := range confs {
+		sources = append(sources, newActivitySource(conf, p))
+		connections = connections || conf.Type == activityConnections
+	}
+
+	if !connections {
+		sources = append(sources, &connectionsSource{})
+	}
+
+	return sources
+}
+
+// SetActivitySources ...
+func (instance *ComputeInstance) SetActivitySources(sources []ActivitySource) {
+	instance.Lock()
+	defer instance.Unlock()
+	instance.activity = sources
+}
+
+// busy reports whether any activity source is active, a source which fails
+// to report has no opinion, e.g. CloudWatch without datapoints
+func (instance *ComputeInstance) busy() bool {
+	instance.RLock()
+	sources := instance.activity
+	instance.RUnlock()
+
+	for _, src := range sources {
+		active, err := src.Active(instance)
+		if err != nil {
+			log.Printf("Activity %s of %s raise error: %s", src, instance.Provider, err)
+			continue
+		}
+		if active {
+			log.Debugf("Activity %s of %s is active", src, instance.Provider)
+			return true
+		}
+	}
+	return false
+}
+
+// cpuSource is active while CPU utilization is above threshold percent
+type cpuSource struct {
+	reporter  provider.CPUReporter
+	threshold float64
+	window    time.Duration
+}
+
+func (src *cpuSource) String() string {
+	return fmt.Sprintf("CPU above %g%%", src.threshold)
+}
+
+func (src *cpuSource) Active(instance *ComputeInstance) (bool, error) {
+	var cpu float64
+	err := provider.Call(instance.ctx, instance.calls(), func(ctx context.Context) error {
+		var err error
+		cpu, err = src.reporter.CPUUtilization(ctx, src.window)
+		return err
+	})
+	return cpu > src.threshold, err
+}
+
+// agentSessions is the response of the go-sleep agent
+type agentSessions struct {
+	Sessions int `json:"sessions"`
+}
+
+// agentSource is active while the agent on the instance reports
+// more SSH sessions than threshold
+type agentSource struct {
+	port      int
+	path      string
+	threshold float64
+	client    *http.Client
+}
+
+func (src *agentSource) String() string {
+	return fmt.Sprintf("SSH sessions on :%d%s", src.port, src.path)
+}
+
+func (src *agentSource) Active(instance *ComputeInstance) (bool, error) {
+	resp, err := src.client.Get(instanceURL(instance, src.port, src.path))
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	sessions := agentSessions{}
+	if err := json.NewDecoder(resp.Body).Decode(&sessions); err != nil {
+		return false, err
+	}
+
+	return float64(sessions.Sessions) > src.threshold, nil
+}
+
+// connectionsSource is active while TCP routes have more open connections than threshold
+type connectionsSource struct {
+	threshold float64
+}
+
+func (src *connectionsSource) String() string {
+	return fmt.Sprintf("TCP connections above %g", src.threshold)
+}
+
+func (src *connectionsSource) Active(instance *ComputeInstance) (bool, error) {
+	return float64(instance.ActiveConnections()) > src.threshold, nil
+}
+
+// probeSource is active while the backend answers the probe with status
+type probeSource struct {
+	port   int
+	path   string
+	status int
+	client *http.Client
+}
+
+func (src *probeSource) String() string {
+	return fmt.Sprintf("HTTP probe %s", src.path)
+}
+
+func (src *probeSource) Active(instance *ComputeInstance) (bool, error) {
+	port := src.port
+	if port == 0 {
+		port = instance.healthPort
+	}
+	if port == 0 {
+		return false, fmt.Errorf("no port to probe")
+	}
+
+	resp, err := src.client.Get(instanceURL(instance, port, src.path))
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode == src.status, nil
+}
+
+func instanceURL(instance *ComputeInstance, port int, path string) string {
+	return fmt.Sprintf("http://%s%s", net.JoinHostPort(instance.Address(), strconv.Itoa(port)), path)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type fakeCPUReporter struct {
+	cpu float64
+	err error
+}
+
+func (r *fakeCPUReporter) CPUUtilization(ctx context.Context, window time.Duration) (float64, error) {
+	return r.cpu, r.err
+}
+
+func newActivityInstance(handler http.HandlerFunc) (*ComputeInstance, int, func()) {
+	server := httptest.NewServer(handler)
+
+	host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+
+	instance := NewComputeInstance(newDummyProvider("test", false), time.Minute)
+	instance.SetIPs([]string{host})
+
+	return instance, portNumber, server.Close
+}
+
+func TestActivitySources(t *testing.T) {
+	var sourceTable = []struct {
+		in  []*ActivityConfig
+		out int
+	}{
+		{nil, 1},
+		{[]*ActivityConfig{{Type: activitySSH}, {Type: activityHTTP}}, 3},
+		{[]*ActivityConfig{{Type: activityConnections, Threshold: 2}}, 1},
+	}
+
+	for _, test := range sourceTable {
+		sources := activitySources(test.in, newDummyProvider("test", false))
+		if len(sources) != test.out {
+			t.Errorf("activitySources returned %v, want %d sources", sources, test.out)
+		}
+	}
+}
+
+func TestAgentSource(t *testing.T) {
+	sessions := "0"
+	instance, port, closeServer := newActivityInstance(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != defaultAgentPath {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"sessions": ` + sessions + `}`))
+	})
+	defer closeServer()
+
+	src := newActivitySource(&ActivityConfig{Type: activitySSH, Port: port}, instance.Provider)
+
+	if active, err := src.Active(instance); err != nil || active {
+		t.Errorf("agentSource.Active returned %v (%v), want false", active, err)
+	}
+
+	sessions = "2"
+	if active, err := src.Active(instance); err != nil || !active {
+		t.Errorf("agentSource.Active returned %v (%v), want true", active, err)
+	}
+}
+
+func TestProbeSource(t *testing.T) {
+	status := http.StatusNoContent
+	instance, port, closeServer := newActivityInstance(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	})
+	defer closeServer()
+
+	src := newActivitySource(&ActivityConfig{Type: activityHTTP}, instance.Provider)
+	if _, err := src.Active(instance); err == nil {
+		t.Error("probeSource.Active returned no error without port")
+	}
+
+	instance.healthPort = port
+	if active, err := src.Active(instance); err != nil || active {
+		t.Errorf("probeSource.Active returned %v (%v), want false", active, err)
+	}
+
+	status = http.StatusOK
+	if active, err := src.Active(instance); err != nil || !active {
+		t.Errorf("probeSource.Active returned %v (%v), want true", active, err)
+	}
+}
+
+func TestComputeInstance_busy(t *testing.T) {
+	instance := NewComputeInstance(newDummyProvider("test", false), time.Minute)
+	reporter := &fakeCPUReporter{cpu: 5}
+
+	instance.SetActivitySources([]ActivitySource{
+		&cpuSource{reporter: reporter, threshold: 10, window: time.Minute},
+		&connectionsSource{},
+	})
+
+	if instance.busy() {
+		t.Error("ComputeInstance.busy returned true for idle sources")
+	}
+
+	instance.AddConnection(1)
+	if !instance.busy() {
+		t.Error("ComputeInstance.busy returned false for open connection")
+	}
+	instance.AddConnection(-1)
+
+	reporter.cpu = 50
+	if !instance.busy() {
+		t.Error("ComputeInstance.busy returned false for high CPU")
+	}
+
+	reporter.cpu, reporter.err = 0, errors.New("no datapoints")
+	if instance.busy() {
+		t.Error("ComputeInstance.busy returned true for failed source")
+	}
+
+	instance.AddConnection(1)
+	if !instance.busy() {
+		t.Error("ComputeInstance.busy returned false for open connection and failed source")
+	}
+}
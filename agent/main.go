@@ -0,0 +1,99 @@
+// Activity agent of go-sleep. It runs on the instance and reports the number
+// of established connections to the local SSH port, read from /proc/net/tcp
+// and /proc/net/tcp6, so go-sleep keeps the instance awake during SSH sessions.
+//
+//	[[gce.activity]]
+//	type = "ssh"
+//	port = 9922
+//
+// Run on the instance: go-sleep-agent -listen=:9922 -ssh-port=22
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// tcpEstablished is the state of an established socket in /proc/net/tcp
+const tcpEstablished = "01"
+
+var procFiles = []string{"/proc/net/tcp", "/proc/net/tcp6"}
+
+// countSessions returns the number of established connections to port
+func countSessions(r io.Reader, port int) (int, error) {
+	var count int
+
+	scanner := bufio.NewScanner(r)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		// sl local_address rem_address st ...
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[3] != tcpEstablished {
+			continue
+		}
+
+		i := strings.LastIndex(fields[1], ":")
+		if i < 0 {
+			continue
+		}
+		localPort, err := strconv.ParseUint(fields[1][i+1:], 16, 16)
+		if err != nil {
+			continue
+		}
+
+		if int(localPort) == port {
+			count++
+		}
+	}
+
+	return count, scanner.Err()
+}
+
+func sessions(port int) (int, error) {
+	var total int
+
+	for _, name := range procFiles {
+		f, err := os.Open(name)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return 0, err
+		}
+
+		count, err := countSessions(f, port)
+		f.Close()
+		if err != nil {
+			return 0, err
+		}
+		total += count
+	}
+
+	return total, nil
+}
+
+func main() {
+	listen := flag.String("listen", ":9922", "address to serve on")
+	sshPort := flag.Int("ssh-port", 22, "local SSH port")
+	flag.Parse()
+
+	http.HandleFunc("/sessions", func(w http.ResponseWriter, r *http.Request) {
+		count, err := sessions(*sshPort)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int{"sessions": count})
+	})
+
+	log.Printf("Serving SSH sessions of :%d on %s", *sshPort, *listen)
+	log.Fatal(http.ListenAndServe(*listen, nil))
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const exampleProcNetTCP = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:0016 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 13847 1 0000000000000000 100 0 0 10 0
+   1: 0A000002:0016 0A000001:D431 01 00000000:00000000 02:0009E6B2 00000000     0        0 49216 4 0000000000000000 20 4 1 10 -1
+   2: 0A000002:0016 0A000001:D432 06 00000000:00000000 03:00000B7E 00000000     0        0 0 3 0000000000000000
+   3: 0A000002:C350 0A000001:0016 01 00000000:00000000 00:00000000 00000000  1000        0 52117 1 0000000000000000 20 4 30 10 -1
+`
+
+const exampleProcNetTCP6 = `  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 0000000000000000FFFF00000200000A:0016 0000000000000000FFFF00000100000A:D433 01 00000000:00000000 02:000A7214 00000000     0        0 49333 2 0000000000000000 20 4 31 10 -1
+`
+
+func TestCountSessions(t *testing.T) {
+	var procTable = []struct {
+		in   string
+		port int
+		out  int
+	}{
+		{exampleProcNetTCP, 22, 1},
+		{exampleProcNetTCP, 2222, 0},
+		{exampleProcNetTCP6, 22, 1},
+		{"", 22, 0},
+	}
+
+	for _, test := range procTable {
+		count, err := countSessions(strings.NewReader(test.in), test.port)
+		if err != nil || count != test.out {
+			t.Errorf("countSessions returned %v (%v), want %v", count, err, test.out)
+		}
+	}
+}
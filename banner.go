@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/silentsokolov/go-sleep/log"
+)
+
+// bannerPrefix is the path prefix of go-sleep endpoints on proxied hosts
+const bannerPrefix = "/.go-sleep"
+
+// maxBannerBody is the largest response the banner is injected into
+const maxBannerBody = 5 << 20
+
+type bannerContext struct {
+	Prefix  string
+	Warning int64
+	SleepIn int64
+}
+
+type sleepStatus struct {
+	SleepIn int64 `json:"sleep_in"`
+}
+
+// SleepIn returns the time left until the instance goes to sleep
+func (instance *ComputeInstance) SleepIn() time.Duration {
+	leaseLeft := time.Until(instance.leaseExpiry())
+
+	instance.RLock()
+	defer instance.RUnlock()
+
+	left := instance.sleepAfter - time.Since(instance.lastAccess)
+	if leaseLeft > left {
+		left = leaseLeft
+	}
+	if left < 0 {
+		return 0
+	}
+	return left
+}
+
+// middlewareBanner serves the endpoints used by the sleep warning banner,
+// the status endpoint doesn't extend the idle timer
+func (server *Server) middlewareBanner(next http.Handler, address string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, bannerPrefix+"/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		route, computer, err := server.routeComputer(r.Host, address)
+		if err != nil || route.SleepWarning <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		switch {
+		case r.URL.Path == bannerPrefix+"/status" && r.Method == http.MethodGet:
+		case r.URL.Path == bannerPrefix+"/keep-awake" && r.Method == http.MethodPost:
+			computer.SetLastAccess()
+		default:
+			http.NotFound(w, r)
+			return
+		}
+
+		responseJSON(w, http.StatusOK, sleepStatus{SleepIn: int64(computer.SleepIn().Seconds())})
+	})
+}
+
+// modifyResponse injects the sleep warning banner into HTML responses
+// of routes with sleep_warning
+func (server *Server) modifyResponse(address string) func(*http.Response) error {
+	return func(resp *http.Response) error {
+		route, computer, err := server.routeComputer(resp.Request.Host, address)
+		if err != nil || route.SleepWarning <= 0 || !computer.ToggleOnRequest() {
+			return nil
+		}
+
+		banner, err := renderTemplate("banner.html", bannerContext{
+			Prefix:  bannerPrefix,
+			Warning: int64(route.SleepWarning.Seconds()),
+			SleepIn: int64(computer.SleepIn().Seconds()),
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := injectHTML(resp, banner); err != nil {
+			log.Printf("Sleep warning banner of %s raise error: %s", resp.Request.Host, err)
+		}
+		return nil
+	}
+}
+
+// injectHTML inserts snippet before </body> of a text/html response,
+// gzip and deflate encoded bodies are decoded and encoded again
+func injectHTML(resp *http.Response, snippet []byte) error {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" || resp.Request.Method == http.MethodHead || resp.StatusCode != http.StatusOK {
+		return nil
+	}
+
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	if encoding != "" && encoding != "identity" && encoding != "gzip" && encoding != "deflate" {
+		return nil
+	}
+
+	raw, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBannerBody+1))
+	if err != nil {
+		return err
+	}
+
+	if len(raw) > maxBannerBody {
+		// too large, pass the response untouched
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(raw), resp.Body), resp.Body}
+		return nil
+	}
+	resp.Body.Close()
+
+	body, err := decodeBody(raw, encoding)
+	if err != nil {
+		// the body is not changed on invalid encoding
+		setBody(resp, raw)
+		return err
+	}
+
+	if len(body) > maxBannerBody {
+		// decoded too large, pass the response untouched
+		setBody(resp, raw)
+		return nil
+	}
+
+	body = insertBeforeBodyEnd(body, snippet)
+
+	encoded, err := encodeBody(body, encoding)
+	if err != nil {
+		setBody(resp, raw)
+		return err
+	}
+
+	setBody(resp, encoded)
+	// the content is changed, validators of the original one are invalid
+	resp.Header.Del("ETag")
+	resp.Header.Del("Content-MD5")
+	return nil
+}
+
+func setBody(resp *http.Response, body []byte) {
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	resp.TransferEncoding = nil
+}
+
+func insertBeforeBodyEnd(body, snippet []byte) []byte {
+	i := bytes.LastIndex(bytes.ToLower(body), []byte("</body>"))
+	if i < 0 {
+		i = len(body)
+	}
+
+	out := make([]byte, 0, len(body)+len(snippet))
+	out = append(out, body[:i]...)
+	out = append(out, snippet...)
+	return append(out, body[i:]...)
+}
+
+func decodeBody(raw []byte, encoding string) ([]byte, error) {
+	var r io.ReadCloser
+	var err error
+
+	switch encoding {
+	case "gzip":
+		r, err = gzip.NewReader(bytes.NewReader(raw))
+	case "deflate":
+		r, err = zlib.NewReader(bytes.NewReader(raw))
+	default:
+		return raw, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(io.LimitReader(r, maxBannerBody+1))
+}
+
+func encodeBody(body []byte, encoding string) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	default:
+		return body, nil
+	}
+
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newHTMLResponse(body []byte, header http.Header) *http.Response {
+	if header == nil {
+		header = http.Header{}
+	}
+	if header.Get("Content-Type") == "" {
+		header.Set("Content-Type", "text/html; charset=utf-8")
+	}
+
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       httptest.NewRequest(http.MethodGet, "http://app.example.org/", nil),
+	}
+}
+
+func gzipBytes(body []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(body)
+	w.Close()
+	return buf.Bytes()
+}
+
+func TestInjectHTML(t *testing.T) {
+	resp := newHTMLResponse([]byte("<html><BODY>Hello</BODY></html>"), http.Header{"Etag": {`"abc"`}})
+
+	if err := injectHTML(resp, []byte("<b>banner</b>")); err != nil {
+		t.Fatalf("injectHTML returned unexpected error: %v", err)
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	want := "<html><BODY>Hello<b>banner</b></BODY></html>"
+	if string(body) != want {
+		t.Errorf("injectHTML returned %q, want %q", body, want)
+	}
+
+	if resp.ContentLength != int64(len(want)) || resp.Header.Get("Content-Length") != strconv.Itoa(len(want)) {
+		t.Errorf("injectHTML set Content-Length %d (%s), want %d", resp.ContentLength, resp.Header.Get("Content-Length"), len(want))
+	}
+
+	if resp.Header.Get("Etag") != "" {
+		t.Error("injectHTML kept ETag of the original content")
+	}
+}
+
+func TestInjectHTML_gzip(t *testing.T) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write([]byte("<html><body>Hello</body></html>"))
+	w.Close()
+
+	resp := newHTMLResponse(buf.Bytes(), http.Header{"Content-Encoding": {"gzip"}})
+	if err := injectHTML(resp, []byte("<b>banner</b>")); err != nil {
+		t.Fatalf("injectHTML returned unexpected error: %v", err)
+	}
+
+	raw, _ := ioutil.ReadAll(resp.Body)
+	if resp.Header.Get("Content-Length") != strconv.Itoa(len(raw)) {
+		t.Errorf("injectHTML set Content-Length %s, want %d", resp.Header.Get("Content-Length"), len(raw))
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("injectHTML returned invalid gzip: %v", err)
+	}
+	body, _ := ioutil.ReadAll(r)
+	if want := "<html><body>Hello<b>banner</b></body></html>"; string(body) != want {
+		t.Errorf("injectHTML returned %q, want %q", body, want)
+	}
+}
+
+func TestInjectHTML_skipped(t *testing.T) {
+	var responseTable = []*http.Response{
+		newHTMLResponse([]byte(`{"a": 1}`), http.Header{"Content-Type": {"application/json"}}),
+		newHTMLResponse([]byte("<body></body>"), http.Header{"Content-Encoding": {"br"}}),
+		newHTMLResponse(bytes.Repeat([]byte("a"), maxBannerBody+10), nil),
+		newHTMLResponse(gzipBytes(bytes.Repeat([]byte("a"), maxBannerBody+10)), http.Header{"Content-Encoding": {"gzip"}}),
+	}
+
+	for _, resp := range responseTable {
+		length := resp.ContentLength
+		if err := injectHTML(resp, []byte("<b>banner</b>")); err != nil {
+			t.Errorf("injectHTML returned unexpected error: %v", err)
+		}
+
+		body, _ := ioutil.ReadAll(resp.Body)
+		if int64(len(body)) != length || bytes.Contains(body, []byte("banner")) {
+			t.Errorf("injectHTML changed %s response", resp.Header.Get("Content-Type"))
+		}
+	}
+}
+
+func TestServer_middlewareBanner(t *testing.T) {
+	server := NewServer(&Config{})
+	defer server.Close()
+
+	instance := NewComputeInstance(newDummyProvider("test", false), 20*time.Minute)
+	server.InstanceStore.Set(instance.Hash(), instance)
+	server.serverRoutes[":80"] = map[string]*serverRoute{
+		"app.example.org": {Hostname: "app.example.org", InstanceName: instance.Hash(), SleepWarning: 5 * time.Minute},
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("proxied"))
+	})
+	handler := server.middlewareBanner(next, ":80")
+
+	instance.lastAccess = time.Now().Add(-18 * time.Minute)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://app.example.org:80/.go-sleep/status", nil))
+	if !strings.Contains(w.Body.String(), `"sleep_in":119`) && !strings.Contains(w.Body.String(), `"sleep_in":120`) {
+		t.Errorf("status returned %s, want sleep_in 120", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "http://app.example.org:80/.go-sleep/keep-awake", nil))
+	if !strings.Contains(w.Body.String(), `"sleep_in":1199`) && !strings.Contains(w.Body.String(), `"sleep_in":1200`) {
+		t.Errorf("keep-awake returned %s, want sleep_in 1200", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://app.example.org:80/index.html", nil))
+	if w.Body.String() != "proxied" {
+		t.Errorf("middlewareBanner returned %s, want proxied response", w.Body.String())
+	}
+}
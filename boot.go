@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/silentsokolov/go-sleep/log"
+	"github.com/silentsokolov/go-sleep/provider"
+)
+
+// BootPolicy limits the time from a start until the instance passes health,
+// a failed boot is restarted up to Restarts times
+type BootPolicy struct {
+	Timeout  time.Duration
+	Restarts int
+}
+
+func bootPolicy(conf BaseConfig) BootPolicy {
+	policy := BootPolicy{Restarts: conf.BootRestarts}
+
+	if conf.BootTimeout > 0 {
+		policy.Timeout = time.Duration(conf.BootTimeout) * time.Second
+	}
+
+	if policy.Restarts < 0 {
+		policy.Restarts = 0
+	}
+
+	return policy
+}
+
+// SetBootPolicy ...
+func (instance *ComputeInstance) SetBootPolicy(policy BootPolicy) {
+	instance.Lock()
+	defer instance.Unlock()
+	instance.bootPolicy = policy
+}
+
+// booting reports whether the instance was started and has not passed health yet
+func (instance *ComputeInstance) booting() bool {
+	instance.RLock()
+	defer instance.RUnlock()
+
+	switch instance.currentStatus {
+	case provider.StatusInstanceStarting, provider.StatusInstanceRunning, provider.StatusInstanceError:
+	default:
+		return false
+	}
+
+	return !instance.startRequest.IsZero() && !instance.HTTPHealth && !instance.bootRestarting
+}
+
+// checkBoot probes health of a booting instance and handles an expired boot timeout
+func (instance *ComputeInstance) checkBoot() {
+	if !instance.booting() {
+		return
+	}
+
+	if instance.Status() == provider.StatusInstanceRunning || instance.BootFailed() {
+		instance.probeHealth()
+	}
+
+	instance.Lock()
+	policy := instance.bootPolicy
+	elapsed := since(instance.startRequest)
+	if policy.Timeout <= 0 || elapsed < policy.Timeout || instance.HTTPHealth || instance.bootGaveUp {
+		instance.Unlock()
+		return
+	}
+
+	instance.bootFailures++
+	failures := instance.bootFailures
+	err := fmt.Errorf("The server did not pass health within %s (attempt %d of %d)", policy.Timeout, failures, policy.Restarts+1)
+	restart := failures <= policy.Restarts
+	instance.bootRestarting = restart
+	instance.bootGaveUp = !restart
+	if !restart {
+		instance.lastError = err
+	}
+	instance.Unlock()
+
+	log.Printf("Boot of %s failed: %s", instance.Provider, err)
+	instance.emitError(EventBootFailed, elapsed, err)
+
+	if restart {
+		log.Printf("Restarting %s", instance.Provider)
+		instance.Stop()
+		return
+	}
+
+	instance.SetStatus(provider.StatusInstanceError)
+}
+
+// probeHealth checks the backend port of the first route, with an HTTP
+// request for HTTP routes and a connection for TCP routes
+func (instance *ComputeInstance) probeHealth() {
+	instance.RLock()
+	port, healthHTTP := instance.healthPort, instance.healthHTTP
+	instance.RUnlock()
+
+	if port == 0 {
+		return
+	}
+
+	address := net.JoinHostPort(instance.BackendIP(), strconv.Itoa(port))
+	if healthHTTP {
+		status, err := ping(fmt.Sprintf("http://%s", address), 3*time.Second)
+		if err != nil || status > http.StatusInternalServerError {
+			return
+		}
+	} else {
+		conn, err := net.DialTimeout("tcp", address, 3*time.Second)
+		if err != nil {
+			return
+		}
+		conn.Close()
+	}
+
+	instance.SetHTTPHealth()
+}
+
+// finishBootRestart is called when the instance is stopped and reports
+// whether it should be started again after a failed boot
+func (instance *ComputeInstance) finishBootRestart() bool {
+	instance.Lock()
+	defer instance.Unlock()
+
+	restart := instance.bootRestarting
+	instance.bootRestarting = false
+	instance.bootGaveUp = false
+	if !restart {
+		instance.bootFailures = 0
+	}
+	return restart
+}
+
+// bootRestartFailed gives up the boot when the instance can't be stopped for restart
+func (instance *ComputeInstance) bootRestartFailed(err error) {
+	instance.Lock()
+	restarting := instance.bootRestarting
+	if restarting {
+		instance.bootRestarting = false
+		instance.bootGaveUp = true
+		instance.lastError = err
+	}
+	instance.Unlock()
+
+	if restarting {
+		instance.SetStatus(provider.StatusInstanceError)
+	}
+}
+
+// BootRestarting reports whether the instance is restarted after a failed boot
+func (instance *ComputeInstance) BootRestarting() bool {
+	instance.RLock()
+	defer instance.RUnlock()
+	return instance.bootRestarting
+}
+
+// BootFailed reports whether the instance did not boot after all restarts
+func (instance *ComputeInstance) BootFailed() bool {
+	instance.RLock()
+	defer instance.RUnlock()
+	return instance.bootGaveUp
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/silentsokolov/go-sleep/provider"
+)
+
+func TestBootPolicy(t *testing.T) {
+	var policyTable = []struct {
+		in  BaseConfig
+		out BootPolicy
+	}{
+		{BaseConfig{}, BootPolicy{}},
+		{BaseConfig{BootTimeout: 300, BootRestarts: 2}, BootPolicy{Timeout: 5 * time.Minute, Restarts: 2}},
+		{BaseConfig{BootTimeout: 300, BootRestarts: -1}, BootPolicy{Timeout: 5 * time.Minute}},
+	}
+
+	for _, test := range policyTable {
+		if policy := bootPolicy(test.in); policy != test.out {
+			t.Errorf("bootPolicy returned %+v, want %+v", policy, test.out)
+		}
+	}
+}
+
+func newBootingInstance() *ComputeInstance {
+	instance := NewComputeInstance(newDummyProvider("test", false), time.Minute)
+	instance.SetBootPolicy(BootPolicy{Timeout: time.Minute, Restarts: 1})
+	instance.Reset()
+	instance.SetStatus(provider.StatusInstanceStarting)
+	instance.startRequest = time.Now().Add(-2 * time.Minute)
+	return instance
+}
+
+func TestComputeInstance_checkBoot(t *testing.T) {
+	instance := newBootingInstance()
+
+	instance.checkBoot()
+	if !instance.BootRestarting() {
+		t.Fatal("ComputeInstance.checkBoot did not restart instance after boot timeout")
+	}
+
+	select {
+	case status := <-instance.statusChan:
+		if status != provider.StatusInstanceStopping {
+			t.Errorf("ComputeInstance.checkBoot sent %v, want %v", status, provider.StatusInstanceStopping)
+		}
+	default:
+		t.Error("ComputeInstance.checkBoot did not stop instance")
+	}
+
+	history := instance.History()
+	if len(history) == 0 || history[len(history)-1].Event != EventBootFailed || history[len(history)-1].Error == "" {
+		t.Errorf("ComputeInstance.History returned %+v, want boot_failed with error", history)
+	}
+
+	if !instance.finishBootRestart() {
+		t.Error("ComputeInstance.finishBootRestart returned false for restarting instance")
+	}
+
+	// the restarted instance fails to boot again
+	instance.SetStatus(provider.StatusInstanceRunning)
+	instance.startRequest = time.Now().Add(-2 * time.Minute)
+	instance.checkBoot()
+
+	if !instance.BootFailed() || instance.Status() != provider.StatusInstanceError || instance.lastError == nil {
+		t.Errorf("ComputeInstance.checkBoot did not give up after restarts, status %v, error %v", instance.Status(), instance.lastError)
+	}
+}
+
+func TestComputeInstance_checkBoot_passed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	instance := newBootingInstance()
+	instance.SetBootPolicy(BootPolicy{Timeout: time.Minute})
+	instance.SetStatus(provider.StatusInstanceRunning)
+	instance.SetIPs([]string{host})
+
+	instance.checkBoot()
+	if !instance.BootFailed() {
+		t.Fatal("ComputeInstance.checkBoot did not fail boot without health port")
+	}
+
+	instance.healthPort, _ = strconv.Atoi(port)
+	instance.healthHTTP = true
+	instance.checkBoot()
+
+	if instance.BootFailed() || !instance.HTTPHealth || instance.lastError != nil {
+		t.Errorf("ComputeInstance.checkBoot did not recover slow boot, error %v", instance.lastError)
+	}
+}
@@ -0,0 +1,642 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// checkTimeout limits the status call of each provider by check -providers
+const checkTimeout = 15 * time.Second
+
+// Problem is an error in the config file File, Line is 0 when unknown
+type Problem struct {
+	File    string
+	Line    int
+	Message string
+}
+
+var (
+	tomlKey       = `(?:"[^"]*"|'[^']*'|[A-Za-z0-9_-]+)`
+	tomlKeyPath   = tomlKey + `(?:\s*\.\s*` + tomlKey + `)*`
+	tomlKeyLine   = regexp.MustCompile(`^(` + tomlKeyPath + `)\s*=`)
+	tomlTableLine = regexp.MustCompile(`^\[\s*(` + tomlKeyPath + `)\s*\]`)
+	tomlArrayLine = regexp.MustCompile(`^\[\[\s*(` + tomlKeyPath + `)\s*\]\]`)
+	tomlKeyPart   = regexp.MustCompile(tomlKey)
+	tomlErrorLine = regexp.MustCompile(`line (\d+)`)
+)
+
+// configLines maps table headers and keys of a TOML file,
+// as dotted paths, to the lines they appear on
+type configLines map[string][]int
+
+// scanConfigLines indexes data and reports array tables which
+// belong to another section than the one they are written under
+func scanConfigLines(data []byte) (configLines, []Problem) {
+	lines := make(configLines)
+	var problems []Problem
+
+	var table, multiline, section string
+	sections := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		if len(multiline) > 0 {
+			if strings.Count(line, multiline)%2 == 1 {
+				multiline = ""
+			}
+			continue
+		}
+
+		if m := tomlArrayLine.FindStringSubmatch(line); m != nil {
+			table = tomlPath(m[1])
+			lines[table] = append(lines[table], n)
+
+			parts := strings.SplitN(table, ".", 2)
+			if len(parts) == 1 {
+				section = table
+				sections[table] = true
+			} else if parts[0] != section && sections[parts[0]] {
+				problems = append(problems, Problem{Line: n, Message: fmt.Sprintf("[[%s]] belongs to the last [[%s]], not to [[%s]] above it", table, parts[0], section)})
+			}
+			continue
+		}
+
+		if m := tomlTableLine.FindStringSubmatch(line); m != nil {
+			table = tomlPath(m[1])
+			lines[table] = append(lines[table], n)
+			continue
+		}
+
+		if m := tomlKeyLine.FindStringSubmatch(line); m != nil {
+			key := tomlPath(m[1])
+			if len(table) > 0 {
+				key = table + "." + key
+			}
+			lines[key] = append(lines[key], n)
+
+			value := line[len(m[0]):]
+			for _, quote := range []string{`"""`, `'''`} {
+				if strings.Count(value, quote)%2 == 1 {
+					multiline = quote
+				}
+			}
+		}
+	}
+
+	return lines, problems
+}
+
+// tomlPath returns the dotted path of a key without quotes
+func tomlPath(key string) string {
+	parts := tomlKeyPart.FindAllString(key, -1)
+	for i, part := range parts {
+		parts[i] = strings.Trim(part, `"'`)
+	}
+	return strings.Join(parts, ".")
+}
+
+// position is where a key is set in the config files, seq orders
+// positions across files and line is 0 when unknown
+type position struct {
+	file string
+	line int
+	seq  int
+}
+
+// at returns a problem at p
+func (p position) at(format string, args ...interface{}) Problem {
+	return Problem{p.file, p.line, fmt.Sprintf(format, args...)}
+}
+
+// where describes p in a problem reported at other
+func (p position) where(other position) string {
+	switch {
+	case p.line == 0:
+		return p.file
+	case p.file == other.file:
+		return fmt.Sprintf("line %d", p.line)
+	}
+	return fmt.Sprintf("%s:%d", p.file, p.line)
+}
+
+// configIndex maps keys of all config files, as dotted paths,
+// to the positions they appear at in the order files are merged
+type configIndex map[string][]position
+
+// indexConfig indexes files, keys of YAML and JSON files have no lines
+func indexConfig(files []*configFile) (configIndex, []Problem) {
+	index := make(configIndex)
+	var problems []Problem
+
+	seq := 0
+	add := func(path string, p position) {
+		seq++
+		p.seq = seq
+		index[path] = append(index[path], p)
+	}
+
+	for _, file := range files {
+		if file.format != "toml" {
+			walkConfig(file.values, "", func(path string) { add(path, position{file: file.path}) })
+			continue
+		}
+
+		lines, scanned := scanConfigLines(file.data)
+		for _, p := range scanned {
+			p.File = file.path
+			problems = append(problems, p)
+		}
+
+		var keys []position
+		for path, ns := range lines {
+			for _, n := range ns {
+				keys = append(keys, position{file: path, line: n})
+			}
+		}
+		sort.Slice(keys, func(i, j int) bool { return keys[i].line < keys[j].line })
+
+		for _, key := range keys {
+			add(key.file, position{file: file.path, line: key.line})
+		}
+	}
+
+	return index, problems
+}
+
+// walkConfig calls fn with the path of each key of values, for
+// lists of tables once per table, before keys of nested tables
+func walkConfig(values map[string]interface{}, prefix string, fn func(path string)) {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		path := key
+		if len(prefix) > 0 {
+			path = prefix + "." + key
+		}
+
+		switch value := values[key].(type) {
+		case map[string]interface{}:
+			fn(path)
+			walkConfig(value, path, fn)
+		case []interface{}:
+			if !isTableArray(value) {
+				fn(path)
+				continue
+			}
+			for _, item := range value {
+				fn(path)
+				walkConfig(item.(map[string]interface{}), path, fn)
+			}
+		default:
+			fn(path)
+		}
+	}
+}
+
+// nth returns the position of the i-th occurrence of path
+func (index configIndex) nth(path string, i int) position {
+	if i < len(index[path]) {
+		return index[path][i]
+	}
+	return position{}
+}
+
+// between returns positions of path after from and before to, no limit when to is zero
+func (index configIndex) between(path string, from, to position) []position {
+	var result []position
+	for _, p := range index[path] {
+		if p.seq > from.seq && (to.seq == 0 || p.seq < to.seq) {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// first returns the first position of path after from and before to
+func (index configIndex) first(path string, from, to position) position {
+	if found := index.between(path, from, to); len(found) > 0 {
+		return found[0]
+	}
+	return from
+}
+
+// locate returns the position of a key path like ec2[1].route[0].address,
+// the position of the closest parent is returned for keys not found
+func (index configIndex) locate(path string) position {
+	var start, end position
+	prefix := ""
+
+	for _, part := range strings.Split(path, ".") {
+		name, i := part, 0
+		if n := strings.Index(part, "["); n > 0 {
+			name = part[:n]
+			i, _ = strconv.Atoi(strings.Trim(part[n:], "[]"))
+		}
+		if len(prefix) > 0 {
+			name = prefix + "." + name
+		}
+		prefix = name
+
+		// items of lists of tables are repeated keys, items of other lists are not
+		found := index.between(name, start, end)
+		switch {
+		case i < len(found):
+			start = found[i]
+			if i+1 < len(found) {
+				end = found[i+1]
+			}
+		case len(found) > 0:
+			start = found[0]
+		}
+	}
+
+	return start
+}
+
+// checkConfig returns problems of the config file path, with providers
+// it also calls each provider to check credentials and access
+func checkConfig(path string, providers bool) ([]Problem, error) {
+	data, files, err := readConfig(path)
+	if cerr, ok := err.(*configError); ok {
+		return []Problem{errorProblem(cerr.path, true, cerr.err)}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	md, err := toml.Decode(string(data), &config)
+	if err != nil {
+		// lines of a merged config are lines of the generated document
+		if len(files) == 1 && files[0].format == "toml" {
+			return []Problem{errorProblem(files[0].path, true, err)}, nil
+		}
+		return []Problem{errorProblem(path, false, err)}, nil
+	}
+
+	lines, problems := indexConfig(files)
+	problems = append(problems, checkUndecoded(md.Undecoded(), lines)...)
+
+	for _, err := range resolveSecrets(&config, !providers) {
+		problems = append(problems, lines.locate(err.path).at("%s", err.err))
+	}
+	problems = append(problems, checkInstances(&config, lines)...)
+
+	if providers {
+		problems = append(problems, checkProviders(&config, lines)...)
+	}
+
+	order := make(map[string]int)
+	for i, file := range files {
+		order[file.path] = i + 1
+	}
+	sort.SliceStable(problems, func(i, j int) bool {
+		if order[problems[i].File] != order[problems[j].File] {
+			return order[problems[i].File] < order[problems[j].File]
+		}
+		return problems[i].Line < problems[j].Line
+	})
+	return problems, nil
+}
+
+// errorProblem returns a problem of the file path for a decode error,
+// with lines the line is taken from the error message
+func errorProblem(path string, lines bool, err error) Problem {
+	line := 0
+	if m := tomlErrorLine.FindStringSubmatch(err.Error()); m != nil && lines {
+		line, _ = strconv.Atoi(m[1])
+	}
+	return Problem{path, line, err.Error()}
+}
+
+// checkUndecoded reports keys which are not part of the config,
+// keys of an unknown table are reported once with the table
+func checkUndecoded(keys []toml.Key, lines configIndex) []Problem {
+	var problems []Problem
+	seen := make(map[string]int)
+	unknown := make(map[string]bool)
+
+	for _, key := range keys {
+		path := strings.Join(key, ".")
+		at := lines.nth(path, seen[path])
+		seen[path]++
+
+		if len(key) > 1 && unknown[strings.Join(key[:len(key)-1], ".")] {
+			unknown[path] = true
+			continue
+		}
+		unknown[path] = true
+
+		problems = append(problems, at.at("unknown key %q", path))
+	}
+
+	return problems
+}
+
+// checkInstances reports problems of instances and their routes
+// which otherwise stop go-sleep at start or are silently ignored
+func checkInstances(config *Config, lines configIndex) []Problem {
+	var problems []Problem
+	report := func(at position, format string, args ...interface{}) {
+		problems = append(problems, at.at(format, args...))
+	}
+
+	for name, group := range config.AuthBasic {
+		if _, err := parserBasicUsers(group.Users); err != nil {
+			report(lines.nth("auth."+name, 0), "auth group %s: %s", name, err)
+		}
+	}
+
+	if _, err := parseTrustedProxies(config.Trusted); err != nil {
+		report(lines.nth("trusted_proxies", 0), "%s", err)
+	}
+
+	ids := make(map[string]bool)
+	for _, inst := range config.instances() {
+		if len(inst.base.ID) > 0 {
+			ids[inst.base.ID] = true
+		}
+	}
+
+	hostnames := make(map[string]position)
+	tcpAddresses := make(map[string]position)
+	dependsOn := make(map[string]position)
+	idLines := make(map[string]position)
+	defaults := make(map[string]position)
+	count := make(map[string]int)
+
+	// checkRoute checks the route of the section between routeStart and
+	// routeEnd, prefix is the key of routes in the section
+	checkRoute := func(name, prefix string, route *RouteConfig, routeStart, routeEnd position) {
+		at := func(key string) position {
+			return lines.first(prefix+"."+key, routeStart, routeEnd)
+		}
+
+		switch route.Protocol {
+		case protocolTCP:
+			if len(route.Address) == 0 {
+				report(routeStart, "%s: TCP route requires address", name)
+				return
+			}
+			if used, ok := tcpAddresses[route.Address]; ok {
+				first, dup := ordered(used, at("address"))
+				report(dup, "TCP address %s is already used at %s", route.Address, first.where(dup))
+			} else {
+				tcpAddresses[route.Address] = at("address")
+			}
+		case "", protocolHTTP:
+		default:
+			report(at("protocol"), "%s: unknown protocol %q", name, route.Protocol)
+			return
+		}
+
+		address := route.Address
+		if len(address) == 0 {
+			address = defaultAddress
+		}
+
+		if _, port, err := net.SplitHostPort(address); err != nil {
+			report(at("address"), "%s: invalid address %q: %s", name, address, err)
+		} else if _, err := strconv.Atoi(strings.Replace(address, ":", "", -1)); err != nil && route.BackendPort == 0 && route.Protocol != protocolTCP {
+			report(at("address"), "%s: address %q is not a port, backend_port is required", name, address)
+		} else if _, err := strconv.Atoi(port); err != nil {
+			report(at("address"), "%s: invalid port of address %q", name, address)
+		}
+
+		if route.Protocol != protocolTCP {
+			for _, hostname := range route.Hostnames {
+				if _, err := hostPattern(hostname); err != nil {
+					report(at("hostnames"), "%s: invalid hostname %q: %s", name, hostname, err)
+					continue
+				}
+				key := address + " " + hostname
+				if used, ok := hostnames[key]; ok {
+					first, dup := ordered(used, at("hostnames"))
+					report(dup, "hostname %s on %s is already used at %s", hostname, address, first.where(dup))
+				} else {
+					hostnames[key] = at("hostnames")
+				}
+			}
+
+			if route.Default {
+				if used, ok := defaults[address]; ok {
+					first, dup := ordered(used, at("default"))
+					report(dup, "default route on %s is already set at %s", address, first.where(dup))
+				} else {
+					defaults[address] = at("default")
+				}
+			}
+		}
+
+		switch route.BackendProxy {
+		case "", proxyProtocolV1, proxyProtocolV2:
+		default:
+			report(at("backend_proxy_protocol"), "%s: unknown backend_proxy_protocol %q, want v1 or v2", name, route.BackendProxy)
+		}
+
+		if len(route.AuthGroup) > 0 {
+			if _, ok := config.AuthBasic[route.AuthGroup]; !ok {
+				report(at("auth_group"), "%s: unknown auth_group %q", name, route.AuthGroup)
+			}
+		}
+
+		certLines := lines.between(prefix+".certificate", routeStart, routeEnd)
+		for k, cert := range route.Certificates {
+			at := routeStart
+			if k < len(certLines) {
+				at = certLines[k]
+			}
+			if _, err := tls.LoadX509KeyPair(cert.CertFile, cert.KeyFile); err != nil {
+				report(at, "%s: certificate %s: %s", name, cert.CertFile, err)
+			}
+		}
+	}
+
+	// checkRoutes checks routes of the section between start and end
+	checkRoutes := func(name, prefix string, routes []*RouteConfig, start, end position) {
+		routeLines := lines.between(prefix, start, end)
+		for j, route := range routes {
+			routeStart := start
+			if j < len(routeLines) {
+				routeStart = routeLines[j]
+			}
+			routeEnd := end
+			if j+1 < len(routeLines) {
+				routeEnd = routeLines[j+1]
+			}
+			checkRoute(name, prefix, route, routeStart, routeEnd)
+		}
+	}
+
+	for _, inst := range config.instances() {
+		i := count[inst.section]
+		count[inst.section]++
+
+		start, end := lines.nth(inst.section, i), lines.nth(inst.section, i+1)
+		name := fmt.Sprintf("[[%s]] #%d", inst.section, i+1)
+
+		if inst.base.SleepAfter < -1 || inst.base.SleepAfter > int64(math.MaxInt64/time.Second) {
+			report(lines.first(inst.section+".sleep_after", start, end), "%s: invalid sleep_after %d, want seconds, 0 for the default or -1 to disable", name, inst.base.SleepAfter)
+		}
+
+		if len(inst.base.ID) > 0 {
+			at := lines.first(inst.section+".id", start, end)
+			if used, ok := idLines[inst.base.ID]; ok {
+				first, dup := ordered(used, at)
+				report(dup, "id %q is already used at %s", inst.base.ID, first.where(dup))
+			} else {
+				idLines[inst.base.ID] = at
+			}
+		}
+
+		for _, dep := range inst.base.DependsOn {
+			if !ids[dep] {
+				report(lines.first(inst.section+".depends_on", start, end), "%s: depends_on unknown id %q", name, dep)
+			}
+		}
+		if len(inst.base.ID) > 0 && len(inst.base.DependsOn) > 0 {
+			dependsOn[inst.base.ID] = lines.first(inst.section+".depends_on", start, end)
+		}
+
+		for _, file := range inst.files {
+			if len(file) == 0 {
+				report(start, "%s: credentials file is not set", name)
+			} else if _, err := os.Stat(file); err != nil {
+				report(start, "%s: %s", name, err)
+			}
+		}
+
+		checkRoutes(name, inst.section+".route", inst.base.Routes, start, end)
+	}
+
+	// the cycle is reported at its first depends_on, with the others
+	if cycle := findDependencyCycle(config.dependencyGraph()); cycle != nil {
+		cycle = cycle[:len(cycle)-1]
+		first := 0
+		for i, id := range cycle {
+			if dependsOn[id].seq < dependsOn[cycle[first]].seq {
+				first = i
+			}
+		}
+		cycle = append(append([]string{}, cycle[first:]...), cycle[:first]...)
+
+		at := dependsOn[cycle[0]]
+		message := fmt.Sprintf("dependency cycle %s -> %s", strings.Join(cycle, " -> "), cycle[0])
+		for i, id := range cycle[1:] {
+			if i == 0 {
+				message += ", depends_on of "
+			} else {
+				message += ", "
+			}
+			message += fmt.Sprintf("%s at %s", id, dependsOn[id].where(at))
+		}
+		report(at, "%s", message)
+	}
+
+	routeLines := lines.between("route", position{}, position{})
+	for j, route := range config.Routes {
+		routeStart, routeEnd := position{}, position{}
+		if j < len(routeLines) {
+			routeStart = routeLines[j]
+		}
+		if j+1 < len(routeLines) {
+			routeEnd = routeLines[j+1]
+		}
+		name := fmt.Sprintf("[[route]] #%d", j+1)
+
+		switch {
+		case len(route.Instance) == 0:
+			report(routeStart, "%s: instance is required", name)
+		case !strings.Contains(route.Instance, "$") && !ids[route.Instance]:
+			report(lines.first("route.instance", routeStart, routeEnd), "%s: unknown instance %q", name, route.Instance)
+		}
+		checkRoute(name, "route", route, routeStart, routeEnd)
+	}
+
+	return problems
+}
+
+// ordered returns the earlier and the later position, sections are
+// checked by type and not in the order of the files
+func ordered(a, b position) (position, position) {
+	if a.seq > b.seq {
+		return b, a
+	}
+	return a, b
+}
+
+// checkProviders calls Status of each provider, constructors of providers
+// still stop the check on errors they consider fatal
+func checkProviders(config *Config, lines configIndex) []Problem {
+	var problems []Problem
+	count := make(map[string]int)
+
+	for _, inst := range config.instances() {
+		i := count[inst.section]
+		count[inst.section]++
+
+		p := inst.newProvider()
+		ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+		_, err := p.Status(ctx)
+		cancel()
+
+		if closer, ok := p.(io.Closer); ok {
+			closer.Close()
+		}
+
+		if err != nil {
+			problems = append(problems, lines.nth(inst.section, i).at("[[%s]] #%d: %s: %s", inst.section, i+1, p, err))
+		}
+	}
+
+	return problems
+}
+
+// runCheck prints problems of the config file and returns the exit code
+func runCheck(w io.Writer, path string, providers bool) int {
+	problems, err := checkConfig(path, providers)
+	if err != nil {
+		fmt.Fprintln(w, err)
+		return 2
+	}
+
+	for _, p := range problems {
+		file := p.File
+		if len(file) == 0 {
+			file = path
+		}
+
+		if p.Line > 0 {
+			fmt.Fprintf(w, "%s:%d: %s\n", file, p.Line, p.Message)
+		} else {
+			fmt.Fprintf(w, "%s: %s\n", file, p.Message)
+		}
+	}
+
+	if len(problems) > 0 {
+		fmt.Fprintf(w, "%d problems found\n", len(problems))
+		return 1
+	}
+
+	fmt.Fprintf(w, "%s: OK\n", path)
+	return 0
+}
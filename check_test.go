@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeCheckFile(t *testing.T, dir, name string, data []byte) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// writeKeyPair writes a self-signed certificate and the key of another
+// certificate when mismatched
+func writeKeyPair(t *testing.T, dir string, mismatched bool) (string, string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if mismatched {
+		if key, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	prefix := "good"
+	if mismatched {
+		prefix = "bad"
+	}
+
+	certFile := writeCheckFile(t, dir, prefix+".crt", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	keyFile := writeCheckFile(t, dir, prefix+".key", pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+	return certFile, keyFile
+}
+
+func TestCheckConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "check")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	goodCert, goodKey := writeKeyPair(t, dir, false)
+	badCert, badKey := writeKeyPair(t, dir, true)
+
+	var checkTable = []struct {
+		config   string
+		problems []Problem
+	}{
+		{
+			`
+[auth.admins]
+users = ["test:test"]
+
+[[ec2]]
+id = "app"
+sleep_after = -1
+  [[ec2.route]]
+  address = ":443"
+  hostnames = ["example.com"]
+  auth_group = "admins"
+    [[ec2.route.certificate]]
+    cert_file = "` + goodCert + `"
+    key_file = "` + goodKey + `"
+
+[[ec2]]
+depends_on = ["app"]
+  [[ec2.route]]
+  address = "127.0.0.1:5432"
+  protocol = "tcp"
+`, nil,
+		},
+		{
+			`
+log_levle = "debug"
+[[ec2]]
+sleep_after = -20
+depends_on = ["db"]
+template = """
+hostnames = ["a"]
+"""
+  [[ec2.route]]
+  hostname = "example.com"
+`, []Problem{
+				{Line: 2, Message: `unknown key "log_levle"`},
+				{Line: 4, Message: "invalid sleep_after -20"},
+				{Line: 5, Message: `depends_on unknown id "db"`},
+				{Line: 6, Message: `unknown key "ec2.template"`},
+				{Line: 10, Message: `unknown key "ec2.route.hostname"`},
+			},
+		},
+		{
+			`
+[[ec2]]
+id = "app"
+depends_on = ["db"]
+
+[[ec2]]
+id = "db"
+depends_on = ["cache"]
+
+[[ec2]]
+id = "cache"
+depends_on = ["app"]
+`, []Problem{
+				{Line: 4, Message: "dependency cycle app -> db -> cache -> app, depends_on of db at line 8, cache at line 12"},
+			},
+		},
+		{
+			`
+[[ec2]]
+id = "app"
+
+[[gce]]
+jwt_path = "` + goodKey + `"
+id = "db"
+
+[[ec2]]
+id = "app"
+`, []Problem{
+				{Line: 10, Message: `id "app" is already used at line 3`},
+			},
+		},
+		{
+			`
+[[gce]]
+jwt_path = "` + goodKey + `"
+[[ec2]]
+  [[gce.route]]
+  hostnames = ["example.com"]
+  [[ec2.route]]
+  hostnames = ["example.com"]
+  [[ec2.route]]
+  address = "0.0.0.0:80"
+  hostnames = ["www.example.com"]
+  auth_group = "admins"
+    [[ec2.route.certificate]]
+    cert_file = "` + badCert + `"
+    key_file = "` + badKey + `"
+  [[ec2.route]]
+  address = "0.0.0.0:80"
+  backend_port = 8080
+  protocol = "udp"
+`, []Problem{
+				{Line: 5, Message: "[[gce.route]] belongs to the last [[gce]], not to [[ec2]] above it"},
+				{Line: 8, Message: "hostname example.com on :80 is already used at line 6"},
+				{Line: 10, Message: `address "0.0.0.0:80" is not a port, backend_port is required`},
+				{Line: 12, Message: `unknown auth_group "admins"`},
+				{Line: 13, Message: "private key does not match public key"},
+				{Line: 19, Message: `unknown protocol "udp"`},
+			},
+		},
+		{
+			`
+[[ec2]]
+  [[ec2.route]]
+  address = ":5432"
+  protocol = "tcp"
+[[ec2]]
+  [[ec2.route]]
+  address = ":5432"
+  protocol = "tcp"
+  [[ec2.route]]
+  protocol = "tcp"
+`, []Problem{
+				{Line: 8, Message: "TCP address :5432 is already used at line 4"},
+				{Line: 10, Message: "TCP route requires address"},
+			},
+		},
+		{
+			`
+[[ec2]]
+sleep_after = "20m"
+`, []Problem{
+				{Line: 0, Message: "cannot load TOML value of type string"},
+			},
+		},
+		{
+			`
+[[gce]]
+name = "app"
+`, []Problem{
+				{Line: 2, Message: "credentials file is not set"},
+			},
+		},
+	}
+
+	for i, tt := range checkTable {
+		path := writeCheckFile(t, dir, "config.toml", []byte(tt.config))
+
+		problems, err := checkConfig(path, false)
+		if err != nil {
+			t.Fatalf("checkConfig #%d returned unexpected error: %v", i, err)
+		}
+
+		if len(problems) != len(tt.problems) {
+			t.Errorf("checkConfig #%d returned %v, want %v", i, problems, tt.problems)
+			continue
+		}
+
+		for j, p := range problems {
+			if p.Line != tt.problems[j].Line || !strings.Contains(p.Message, tt.problems[j].Message) {
+				t.Errorf("checkConfig #%d returned %d: %q, want %d: %q", i, p.Line, p.Message, tt.problems[j].Line, tt.problems[j].Message)
+			}
+		}
+	}
+}
+
+func TestScanConfigLines(t *testing.T) {
+	lines, problems := scanConfigLines([]byte(`port = ":9090"
+[auth."my group"]
+users = ["a=b"]
+[[ec2]]
+template = '''
+id = "x"
+'''
+  [[ec2.route]]  # comment
+  hostnames = [
+    "example.com",
+  ]
+[[ec2]]
+id = "y"
+`))
+
+	want := configLines{
+		"port":                {1},
+		"auth.my group":       {2},
+		"auth.my group.users": {3},
+		"ec2":                 {4, 12},
+		"ec2.template":        {5},
+		"ec2.route":           {8},
+		"ec2.route.hostnames": {9},
+		"ec2.id":              {13},
+	}
+
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("scanConfigLines returned %v, want %v", lines, want)
+	}
+	if len(problems) != 0 {
+		t.Errorf("scanConfigLines returned problems %v", problems)
+	}
+}
+
+func TestRunCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "check")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	good := writeCheckFile(t, dir, "good.toml", []byte("port = \":9090\"\n"))
+	bad := writeCheckFile(t, dir, "bad.toml", []byte("prot = \":9090\"\n"))
+
+	var runTable = []struct {
+		path string
+		code int
+		out  string
+	}{
+		{good, 0, good + ": OK\n"},
+		{bad, 1, bad + ":1: unknown key \"prot\"\n1 problems found\n"},
+		{filepath.Join(dir, "missing.toml"), 2, ""},
+	}
+
+	for _, tt := range runTable {
+		var out bytes.Buffer
+		if code := runCheck(&out, tt.path, false); code != tt.code {
+			t.Errorf("runCheck(%s) returned %d, want %d", tt.path, code, tt.code)
+		}
+		if len(tt.out) > 0 && out.String() != tt.out {
+			t.Errorf("runCheck(%s) printed %q, want %q", tt.path, out.String(), tt.out)
+		}
+	}
+}
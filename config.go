@@ -7,9 +7,17 @@ import (
 	"github.com/BurntSushi/toml"
 
 	"github.com/silentsokolov/go-sleep/log"
+	"github.com/silentsokolov/go-sleep/provider"
 )
 
 const (
+	protocolHTTP = "http"
+	protocolTCP  = "tcp"
+)
+
+const (
+	defaultTCPWait     = 60 * time.Second
+	defaultDNSTTL      = 60
 	defaultAddress     = ":80"
 	defaultBackendPost = 80
 	defaultSleepAfter  = 20 * time.Minute
@@ -18,13 +26,61 @@ const (
 
 // Config ...
 type Config struct {
-	Port      string                `toml:"port"`
-	SecretKey string                `toml:"secret_key"`
-	LogLevel  string                `toml:"log_level"`
-	Dummy     []*DummyConfig        `toml:"dummy"`
-	GCE       []*GCEConfig          `toml:"gce"`
-	EC2       []*EC2Config          `toml:"ec2"`
-	AuthBasic map[string]*AuthGroup `toml:"auth"`
+	Include    []string              `toml:"include"`
+	Port       string                `toml:"port"`
+	SecretKey  string                `toml:"secret_key"`
+	APIKeys    []string              `toml:"api_keys"`
+	LogLevel   string                `toml:"log_level"`
+	RateLimit  float64               `toml:"api_rate_limit"`
+	RateBurst  int                   `toml:"api_burst"`
+	Dummy      []*DummyConfig        `toml:"dummy"`
+	GCE        []*GCEConfig          `toml:"gce"`
+	EC2        []*EC2Config          `toml:"ec2"`
+	Plugin     []*PluginConfig       `toml:"plugin"`
+	Exec       []*ExecConfig         `toml:"exec"`
+	WOL        []*WOLConfig          `toml:"wol"`
+	Kubernetes []*KubernetesConfig   `toml:"kubernetes"`
+	ASG        []*ASGConfig          `toml:"asg"`
+	MIG        []*MIGConfig          `toml:"mig"`
+	RDS        []*RDSConfig          `toml:"rds"`
+	CloudSQL   []*CloudSQLConfig     `toml:"cloudsql"`
+	Webhook    []*WebhookConfig      `toml:"webhook"`
+	Notify     *NotifyConfig         `toml:"notify"`
+	Vault      *VaultConfig          `toml:"vault"`
+	Routes     []*RouteConfig        `toml:"route"`
+	NotFound   string                `toml:"not_found_page"`
+	Trusted    []string              `toml:"trusted_proxies"`
+	AuthBasic  map[string]*AuthGroup `toml:"auth"`
+}
+
+// VaultConfig ...
+type VaultConfig struct {
+	Address     string `toml:"address"`
+	Token       string `toml:"token"`
+	RoleID      string `toml:"role_id"`
+	SecretID    string `toml:"secret_id"`
+	AppRolePath string `toml:"approle_path"`
+	Namespace   string `toml:"namespace"`
+	CACert      string `toml:"ca_cert"`
+}
+
+// NotifyConfig ...
+type NotifyConfig struct {
+	SNSTopics      []string `toml:"sns_topics"`
+	PubSubAudience string   `toml:"pubsub_audience"`
+	PubSubAccount  string   `toml:"pubsub_service_account"`
+}
+
+// WebhookConfig ...
+type WebhookConfig struct {
+	URL         string   `toml:"url"`
+	Format      string   `toml:"format"`
+	Template    string   `toml:"template"`
+	ContentType string   `toml:"content_type"`
+	Events      []string `toml:"events"`
+	Secret      string   `toml:"secret"`
+	Retries     int      `toml:"retries"`
+	Timeout     int64    `toml:"timeout"`
 }
 
 // AuthGroup ...
@@ -40,6 +96,13 @@ type RouteConfig struct {
 	AuthGroup    string               `toml:"auth_group"`
 	Certificates []*CertificateConfig `toml:"certificate"`
 	IsProxy      bool                 `toml:"proxy"`
+	SleepWarning int64                `toml:"sleep_warning"`
+	Protocol     string               `toml:"protocol"`
+	TCPWait      int64                `toml:"tcp_wait"`
+	Default      bool                 `toml:"default"`
+	Instance     string               `toml:"instance"`
+	ProxyProto   bool                 `toml:"proxy_protocol"`
+	BackendProxy string               `toml:"backend_proxy_protocol"`
 }
 
 // String ...
@@ -55,14 +118,46 @@ type CertificateConfig struct {
 
 // BaseConfig ...
 type BaseConfig struct {
-	SleepAfter    int64          `toml:"sleep_after"`
-	UseInternalIP bool           `toml:"use_internal_ip"`
-	Routes        []*RouteConfig `toml:"route"`
+	ID            string            `toml:"id"`
+	DependsOn     []string          `toml:"depends_on"`
+	DNS           []*DNSConfig      `toml:"dns"`
+	Activity      []*ActivityConfig `toml:"activity"`
+	SleepAfter    int64             `toml:"sleep_after"`
+	UseInternalIP bool              `toml:"use_internal_ip"`
+	CallTimeout   int64             `toml:"call_timeout"`
+	CallRetries   int               `toml:"call_retries"`
+	StartRetries  int               `toml:"start_retries"`
+	StartBackoff  int64             `toml:"start_backoff"`
+	StartCooldown int64             `toml:"start_cooldown"`
+	BootTimeout   int64             `toml:"boot_timeout"`
+	BootRestarts  int               `toml:"boot_restarts"`
+	PollInterval  int64             `toml:"poll_interval"`
+	PollFast      int64             `toml:"poll_fast_interval"`
+	Routes        []*RouteConfig    `toml:"route"`
+}
+
+// ActivityConfig ...
+type ActivityConfig struct {
+	Type      string  `toml:"type"`
+	Threshold float64 `toml:"threshold"`
+	Window    int64   `toml:"window"`
+	Port      int     `toml:"port"`
+	Path      string  `toml:"path"`
+	Status    int     `toml:"status"`
+	Timeout   int64   `toml:"timeout"`
+}
+
+// IPSelectorConfig ...
+type IPSelectorConfig struct {
+	NetworkInterface int  `toml:"network_interface"`
+	IPv6             bool `toml:"ipv6"`
+	UseDNSName       bool `toml:"use_dns_name"`
 }
 
 // GCEConfig ...
 type GCEConfig struct {
 	BaseConfig
+	IPSelectorConfig
 	JWTPath   string `toml:"jwt_path"`
 	ProjectID string `toml:"project_id"`
 	Zone      string `toml:"zone"`
@@ -72,12 +167,129 @@ type GCEConfig struct {
 // EC2Config ...
 type EC2Config struct {
 	BaseConfig
+	IPSelectorConfig
 	AccessKeyID     string `toml:"access_key_id"`
 	SecretAccessKey string `toml:"secret_access_key"`
 	Region          string `toml:"region"`
 	InstanceID      string `toml:"instance_id"`
 }
 
+// PluginConfig ...
+type PluginConfig struct {
+	BaseConfig
+	Name    string                 `toml:"name"`
+	Command string                 `toml:"command"`
+	Args    []string               `toml:"args"`
+	Env     map[string]string      `toml:"env"`
+	Options map[string]interface{} `toml:"options"`
+}
+
+// ExecConfig ...
+type ExecConfig struct {
+	BaseConfig
+	Name           string             `toml:"name"`
+	Shell          string             `toml:"shell"`
+	StartCommand   string             `toml:"start"`
+	StopCommand    string             `toml:"stop"`
+	StatusCommand  string             `toml:"status"`
+	IPCommand      string             `toml:"ip"`
+	CommandTimeout int64              `toml:"timeout"`
+	Env            map[string]string  `toml:"env"`
+	StatusMap      []*ExecStatusMatch `toml:"status_map"`
+}
+
+// ExecStatusMatch ...
+type ExecStatusMatch struct {
+	Match  string `toml:"match"`
+	Status string `toml:"status"`
+}
+
+// WOLConfig ...
+type WOLConfig struct {
+	BaseConfig
+	Name        string `toml:"name"`
+	MAC         string `toml:"mac"`
+	Broadcast   string `toml:"broadcast"`
+	IP          string `toml:"ip"`
+	Check       string `toml:"check"`
+	CheckPort   int    `toml:"check_port"`
+	StopCommand string `toml:"stop_command"`
+	StopURL     string `toml:"stop_url"`
+	BootTime    int64  `toml:"boot_time"`
+}
+
+// KubernetesConfig ...
+type KubernetesConfig struct {
+	BaseConfig
+	Kubeconfig   string `toml:"kubeconfig"`
+	Context      string `toml:"context"`
+	Namespace    string `toml:"namespace"`
+	Kind         string `toml:"kind"`
+	Name         string `toml:"name"`
+	Replicas     int    `toml:"replicas"`
+	Service      string `toml:"service"`
+	UseEndpoints bool   `toml:"use_endpoints"`
+}
+
+// ASGConfig ...
+type ASGConfig struct {
+	BaseConfig
+	AccessKeyID     string `toml:"access_key_id"`
+	SecretAccessKey string `toml:"secret_access_key"`
+	Region          string `toml:"region"`
+	Name            string `toml:"name"`
+	Size            int    `toml:"size"`
+	MinHealthy      int    `toml:"min_healthy"`
+}
+
+// MIGConfig ...
+type MIGConfig struct {
+	BaseConfig
+	JWTPath    string `toml:"jwt_path"`
+	ProjectID  string `toml:"project_id"`
+	Zone       string `toml:"zone"`
+	Name       string `toml:"name"`
+	Size       int    `toml:"size"`
+	MinHealthy int    `toml:"min_healthy"`
+}
+
+// DNSConfig ...
+type DNSConfig struct {
+	Type            string `toml:"type"`
+	Name            string `toml:"name"`
+	TTL             int64  `toml:"ttl"`
+	SleepTarget     string `toml:"sleep_target"`
+	AccessKeyID     string `toml:"access_key_id"`
+	SecretAccessKey string `toml:"secret_access_key"`
+	ZoneID          string `toml:"zone_id"`
+	JWTPath         string `toml:"jwt_path"`
+	ProjectID       string `toml:"project_id"`
+	ManagedZone     string `toml:"managed_zone"`
+	Server          string `toml:"server"`
+	Zone            string `toml:"zone"`
+	TSIGName        string `toml:"tsig_name"`
+	TSIGSecret      string `toml:"tsig_secret"`
+	TSIGAlgorithm   string `toml:"tsig_algorithm"`
+}
+
+// RDSConfig ...
+type RDSConfig struct {
+	BaseConfig
+	AccessKeyID     string `toml:"access_key_id"`
+	SecretAccessKey string `toml:"secret_access_key"`
+	Region          string `toml:"region"`
+	Identifier      string `toml:"identifier"`
+	Cluster         bool   `toml:"cluster"`
+}
+
+// CloudSQLConfig ...
+type CloudSQLConfig struct {
+	BaseConfig
+	JWTPath   string `toml:"jwt_path"`
+	ProjectID string `toml:"project_id"`
+	Name      string `toml:"name"`
+}
+
 // DummyConfig ...
 type DummyConfig struct {
 	BaseConfig
@@ -86,16 +298,138 @@ type DummyConfig struct {
 	UseInternalIP bool   `toml:"use_internal_ip"`
 }
 
-func loadConfig(filepath string) *Config {
-	var config Config
+// instanceConfig is an instance section of the config
+type instanceConfig struct {
+	section     string
+	base        BaseConfig
+	files       []string
+	newProvider func() provider.Provider
+}
+
+// instances returns instance sections in the order they are started
+func (config *Config) instances() []instanceConfig {
+	var instances []instanceConfig
+
+	for _, conf := range config.EC2 {
+		conf := conf
+		instances = append(instances, instanceConfig{"ec2", conf.BaseConfig, nil, func() provider.Provider {
+			log.Println("Initialization EC2 instances ...")
+			p := provider.NewEC2(conf.AccessKeyID, conf.SecretAccessKey, conf.Region, conf.InstanceID, conf.UseInternalIP)
+			p.Selector = ipSelector(conf.IPSelectorConfig)
+			return p
+		}})
+	}
+
+	for _, conf := range config.GCE {
+		conf := conf
+		instances = append(instances, instanceConfig{"gce", conf.BaseConfig, []string{conf.JWTPath}, func() provider.Provider {
+			log.Println("Initialization GCE instances ...")
+			p := provider.NewGCE(conf.JWTPath, conf.ProjectID, conf.Zone, conf.Name, conf.UseInternalIP)
+			p.Selector = ipSelector(conf.IPSelectorConfig)
+			return p
+		}})
+	}
+
+	for _, conf := range config.Plugin {
+		conf := conf
+		instances = append(instances, instanceConfig{"plugin", conf.BaseConfig, nil, func() provider.Provider {
+			log.Println("Initialization plugin instances ...")
+			return provider.NewPlugin(conf.Name, conf.Command, conf.Args, conf.Env, conf.Options)
+		}})
+	}
+
+	for _, conf := range config.Exec {
+		conf := conf
+		instances = append(instances, instanceConfig{"exec", conf.BaseConfig, nil, func() provider.Provider {
+			log.Println("Initialization exec instances ...")
+			return newExecProvider(conf)
+		}})
+	}
+
+	for _, conf := range config.WOL {
+		conf := conf
+		instances = append(instances, instanceConfig{"wol", conf.BaseConfig, nil, func() provider.Provider {
+			log.Println("Initialization Wake-on-LAN instances ...")
+			bootTime := time.Duration(conf.BootTime) * time.Second
+			return provider.NewWOL(conf.Name, conf.MAC, conf.Broadcast, conf.IP, conf.Check, conf.CheckPort, conf.StopCommand, conf.StopURL, bootTime)
+		}})
+	}
 
-	if _, err := toml.DecodeFile(filepath, &config); err != nil {
+	for _, conf := range config.Kubernetes {
+		conf := conf
+		var files []string
+		if len(conf.Kubeconfig) > 0 {
+			files = append(files, conf.Kubeconfig)
+		}
+		instances = append(instances, instanceConfig{"kubernetes", conf.BaseConfig, files, func() provider.Provider {
+			log.Println("Initialization Kubernetes workloads ...")
+			return provider.NewKubernetes(conf.Kubeconfig, conf.Context, conf.Namespace, conf.Kind, conf.Name, conf.Replicas, conf.Service, conf.UseEndpoints)
+		}})
+	}
+
+	for _, conf := range config.ASG {
+		conf := conf
+		instances = append(instances, instanceConfig{"asg", conf.BaseConfig, nil, func() provider.Provider {
+			log.Println("Initialization EC2 Auto Scaling Groups ...")
+			return provider.NewASG(conf.AccessKeyID, conf.SecretAccessKey, conf.Region, conf.Name, conf.Size, conf.MinHealthy, conf.UseInternalIP)
+		}})
+	}
+
+	for _, conf := range config.MIG {
+		conf := conf
+		instances = append(instances, instanceConfig{"mig", conf.BaseConfig, []string{conf.JWTPath}, func() provider.Provider {
+			log.Println("Initialization GCE Managed Instance Groups ...")
+			return provider.NewMIG(conf.JWTPath, conf.ProjectID, conf.Zone, conf.Name, conf.Size, conf.MinHealthy, conf.UseInternalIP)
+		}})
+	}
+
+	for _, conf := range config.RDS {
+		conf := conf
+		instances = append(instances, instanceConfig{"rds", conf.BaseConfig, nil, func() provider.Provider {
+			log.Println("Initialization RDS databases ...")
+			return provider.NewRDS(conf.AccessKeyID, conf.SecretAccessKey, conf.Region, conf.Identifier, conf.Cluster)
+		}})
+	}
+
+	for _, conf := range config.CloudSQL {
+		conf := conf
+		instances = append(instances, instanceConfig{"cloudsql", conf.BaseConfig, []string{conf.JWTPath}, func() provider.Provider {
+			log.Println("Initialization Cloud SQL databases ...")
+			return provider.NewCloudSQL(conf.JWTPath, conf.ProjectID, conf.Name, conf.UseInternalIP)
+		}})
+	}
+
+	return instances
+}
+
+func loadConfig(path string) *Config {
+	config, err := decodeConfig(path)
+	if err != nil {
 		log.Fatal(err)
 	}
+	return config
+}
+
+// decodeConfig reads the config of path and resolves its secrets
+func decodeConfig(path string) (*Config, error) {
+	var config Config
+
+	data, _, err := readConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := toml.Decode(string(data), &config); err != nil {
+		return nil, err
+	}
+
+	if errs := resolveSecrets(&config, false); len(errs) > 0 {
+		return nil, errs[0]
+	}
 
 	if config.LogLevel == "" {
 		config.LogLevel = defaultLogLevel
 	}
 
-	return &config
+	return &config, nil
 }
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// configFormats are formats of config files by extension,
+// files with other extensions are read as TOML
+var configFormats = map[string]string{
+	".toml": "toml",
+	".yaml": "yaml",
+	".yml":  "yaml",
+	".json": "json",
+}
+
+// configFile is one of the files the config is merged from
+type configFile struct {
+	path   string
+	format string
+	data   []byte
+	values map[string]interface{}
+}
+
+// configError is an error of the config file path
+type configError struct {
+	path string
+	err  error
+}
+
+func (err *configError) Error() string {
+	return fmt.Sprintf("%s: %s", err.path, err.err)
+}
+
+// readConfig reads the config file or directory path with its includes,
+// it returns the merged config as a TOML document and the files in the
+// order they are merged; a single TOML file is returned as is
+func readConfig(path string) ([]byte, []*configFile, error) {
+	reader := &configReader{seen: make(map[string]bool), reading: make(map[string]bool)}
+	if err := reader.readPath(path); err != nil {
+		return nil, nil, err
+	}
+
+	files := reader.files
+	if len(files) == 1 && files[0].format == "toml" {
+		return files[0].data, files, nil
+	}
+
+	merged := make(map[string]interface{})
+	owners := make(map[string]string)
+	ids := make(map[string]string)
+	for _, file := range files {
+		delete(file.values, "include")
+		if err := mergeConfig(merged, file.values, "", file.path, owners, ids); err != nil {
+			return nil, nil, &configError{file.path, err}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(merged); err != nil {
+		return nil, nil, &configError{path, err}
+	}
+	return buf.Bytes(), files, nil
+}
+
+// configReader reads config files, each file is read once
+type configReader struct {
+	files   []*configFile
+	seen    map[string]bool
+	reading map[string]bool
+}
+
+// readPath reads the file path or files of the directory path
+// sorted by name, subdirectories are not read
+func (reader *configReader) readPath(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return reader.readFile(path, "")
+	}
+
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || len(configFormats[filepath.Ext(name)]) == 0 {
+			continue
+		}
+		if err := reader.readFile(filepath.Join(path, name), ""); err != nil {
+			return err
+		}
+	}
+
+	if len(reader.files) == 0 {
+		return fmt.Errorf("%s: no config files found", path)
+	}
+	return nil
+}
+
+// readFile reads the file path, included by the file from, and then its includes
+func (reader *configReader) readFile(path, from string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	if reader.reading[abs] {
+		return &configError{from, fmt.Errorf("include %s: include cycle", path)}
+	}
+	if reader.seen[abs] {
+		return &configError{from, fmt.Errorf("include %s: file is already read", path)}
+	}
+	reader.seen[abs] = true
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if len(from) > 0 {
+			return &configError{from, err}
+		}
+		return err
+	}
+
+	format := configFormats[filepath.Ext(path)]
+	if len(format) == 0 {
+		format = "toml"
+	}
+
+	values, err := parseConfig(data, format)
+	if err != nil {
+		return &configError{path, err}
+	}
+
+	includes, err := configIncludes(values)
+	if err != nil {
+		return &configError{path, err}
+	}
+
+	reader.files = append(reader.files, &configFile{path, format, data, values})
+
+	reader.reading[abs] = true
+	defer delete(reader.reading, abs)
+
+	for _, pattern := range includes {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(path), pattern)
+		}
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return &configError{path, fmt.Errorf("include %s: %s", pattern, err)}
+		}
+		glob := strings.ContainsAny(pattern, `*?[\`)
+		if len(matches) == 0 && !glob {
+			return &configError{path, fmt.Errorf("include %s: no such file", pattern)}
+		}
+
+		sort.Strings(matches)
+		for _, match := range matches {
+			if info, err := os.Stat(match); err == nil && info.IsDir() {
+				continue
+			}
+			// patterns match only config files, a file named explicitly can have any name
+			if glob && len(configFormats[filepath.Ext(match)]) == 0 {
+				continue
+			}
+			if err := reader.readFile(match, path); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// configIncludes returns file patterns of the include directive
+func configIncludes(values map[string]interface{}) ([]string, error) {
+	value, ok := values["include"]
+	if !ok {
+		return nil, nil
+	}
+
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, errors.New("include must be a list of file patterns")
+	}
+
+	includes := make([]string, 0, len(list))
+	for _, item := range list {
+		pattern, ok := item.(string)
+		if !ok {
+			return nil, errors.New("include must be a list of file patterns")
+		}
+		includes = append(includes, pattern)
+	}
+	return includes, nil
+}
+
+// parseConfig parses data in format to generic values with TOML types
+func parseConfig(data []byte, format string) (map[string]interface{}, error) {
+	var value interface{}
+
+	switch format {
+	case "yaml":
+		if err := yaml.Unmarshal(data, &value); err != nil {
+			return nil, err
+		}
+	case "json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&value); err != nil {
+			return nil, err
+		}
+	default:
+		values := make(map[string]interface{})
+		if _, err := toml.Decode(string(data), &values); err != nil {
+			return nil, err
+		}
+		value = values
+	}
+
+	if value == nil {
+		return make(map[string]interface{}), nil
+	}
+
+	value, err := normalizeConfigValue(value)
+	if err != nil {
+		return nil, err
+	}
+
+	values, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("config must be a table of settings")
+	}
+
+	if format != "toml" {
+		coerceConfigValue(values, reflect.TypeOf(Config{}))
+	}
+	return values, nil
+}
+
+// normalizeConfigValue converts values decoded from YAML, JSON or TOML
+// to maps with string keys, []interface{} lists, int64 and float64
+func normalizeConfigValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		values := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			if item == nil {
+				continue
+			}
+			item, err := normalizeConfigValue(item)
+			if err != nil {
+				return nil, err
+			}
+			values[key] = item
+		}
+		return values, nil
+	case map[interface{}]interface{}:
+		values := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			values[fmt.Sprint(key)] = item
+		}
+		return normalizeConfigValue(values)
+	case []map[string]interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = item
+		}
+		return normalizeConfigValue(list)
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			if item == nil {
+				return nil, errors.New("null is not allowed in a list")
+			}
+			item, err := normalizeConfigValue(item)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = item
+		}
+		return list, nil
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n, nil
+		}
+		return v.Float64()
+	case int:
+		return int64(v), nil
+	}
+	return value, nil
+}
+
+// coerceConfigValue converts integers to floats where fields of t are
+// floats, YAML and JSON do not tell 1 from 1.0 as TOML does
+func coerceConfigValue(value interface{}, t reflect.Type) interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			switch t.Kind() {
+			case reflect.Map:
+				v[key] = coerceConfigValue(item, t.Elem())
+			case reflect.Struct:
+				if field, ok := configField(t, key); ok {
+					v[key] = coerceConfigValue(item, field)
+				}
+			}
+		}
+	case []interface{}:
+		if t.Kind() == reflect.Slice {
+			for i, item := range v {
+				v[i] = coerceConfigValue(item, t.Elem())
+			}
+		}
+	case int64:
+		if t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64 {
+			return float64(v)
+		}
+	}
+	return value
+}
+
+// configField returns the type of the field of struct t with the toml
+// tag key, fields of embedded structs like BaseConfig are searched too
+func configField(t reflect.Type, key string) (reflect.Type, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Tag.Get("toml") == key {
+			return field.Type, true
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if found, ok := configField(field.Type, key); ok {
+				return found, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// isTableArray reports whether value is a non-empty list of tables,
+// like [[ec2]] sections
+func isTableArray(value interface{}) bool {
+	list, ok := value.([]interface{})
+	if !ok || len(list) == 0 {
+		return false
+	}
+	for _, item := range list {
+		if _, ok := item.(map[string]interface{}); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeConfig merges values of the file path into dst: lists of tables
+// are appended, tables are merged and any other value is set only once;
+// owners and ids record the files which set keys and instance ids
+func mergeConfig(dst, values map[string]interface{}, prefix, path string, owners, ids map[string]string) error {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		full := key
+		if len(prefix) > 0 {
+			full = prefix + "." + key
+		}
+		value := values[key]
+		existing, set := dst[key]
+
+		switch {
+		case isTableArray(value):
+			if set && !isTableArray(existing) {
+				return fmt.Errorf("%q is already set in %s", full, owners[full])
+			}
+			if !set {
+				existing = []interface{}{}
+				owners[full] = path
+			}
+
+			for _, item := range value.([]interface{}) {
+				if id, ok := item.(map[string]interface{})["id"].(string); ok && len(prefix) == 0 && len(id) > 0 {
+					if owner, ok := ids[id]; ok && owner != path {
+						return fmt.Errorf("[[%s]] id %q is already used in %s", full, id, owner)
+					}
+					ids[id] = path
+				}
+			}
+			dst[key] = append(existing.([]interface{}), value.([]interface{})...)
+		case isConfigTable(value):
+			if set && !isConfigTable(existing) {
+				return fmt.Errorf("%q is already set in %s", full, owners[full])
+			}
+			if !set {
+				dst[key] = make(map[string]interface{})
+				owners[full] = path
+			}
+			if err := mergeConfig(dst[key].(map[string]interface{}), value.(map[string]interface{}), full, path, owners, ids); err != nil {
+				return err
+			}
+		default:
+			if set {
+				return fmt.Errorf("%q is already set in %s", full, owners[full])
+			}
+			dst[key] = value
+			owners[full] = path
+		}
+	}
+
+	return nil
+}
+
+func isConfigTable(value interface{}) bool {
+	_, ok := value.(map[string]interface{})
+	return ok
+}
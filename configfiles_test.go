@@ -0,0 +1,214 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+)
+
+// writeConfigFiles writes files by their path relative to a new temporary directory
+func writeConfigFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestReadConfig(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"config.toml": `
+include = ["conf.d/*"]
+port = ":9090"
+
+[auth.admins]
+users = ["test:test"]
+
+[[ec2]]
+id = "app"
+`,
+		"conf.d/20-db.json": `{
+  "ec2": [{"id": "db", "sleep_after": 600, "activity": [{"type": "cpu", "threshold": 5}]}]
+}`,
+		"conf.d/10-web.yaml": `
+auth:
+  devs:
+    users: ["dev:dev"]
+ec2:
+  - id: web
+    depends_on: [db]
+    route:
+      - address: ":443"
+        hostnames: [web.example.com]
+`,
+		"conf.d/README.md": "not a config",
+	})
+	defer os.RemoveAll(dir)
+
+	data, files, err := readConfig(filepath.Join(dir, "config.toml"))
+	if err != nil {
+		t.Fatalf("readConfig returned unexpected error: %v", err)
+	}
+
+	var names []string
+	for _, file := range files {
+		names = append(names, strings.TrimPrefix(file.path, dir+"/"))
+	}
+	if want := []string{"config.toml", "conf.d/10-web.yaml", "conf.d/20-db.json"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("readConfig read %v, want %v", names, want)
+	}
+
+	var config Config
+	if _, err := toml.Decode(string(data), &config); err != nil {
+		t.Fatalf("merged config does not decode: %v\n%s", err, data)
+	}
+
+	var ids []string
+	for _, ec2 := range config.EC2 {
+		ids = append(ids, ec2.ID)
+	}
+	if want := []string{"app", "web", "db"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("merged [[ec2]] ids %v, want %v", ids, want)
+	}
+
+	if config.Port != ":9090" || len(config.AuthBasic) != 2 {
+		t.Errorf("merged port %q and %d auth groups, want :9090 and 2", config.Port, len(config.AuthBasic))
+	}
+	if routes := config.EC2[1].Routes; len(routes) != 1 || routes[0].Hostnames[0] != "web.example.com" {
+		t.Errorf("merged web routes %v", routes)
+	}
+	if db := config.EC2[2]; db.SleepAfter != 600 || db.Activity[0].Threshold != 5 {
+		t.Errorf("merged db sleep_after %d and threshold %v, want 600 and 5", db.SleepAfter, db.Activity[0].Threshold)
+	}
+}
+
+func TestReadConfig_directory(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"b.toml":      "[[ec2]]\nid = \"b\"\n",
+		"a.yml":       "log_level: debug\nec2:\n  - id: a\n",
+		".hidden.yml": "ec2: broken",
+		"sub/c.toml":  "[[ec2]]\nid = \"c\"\n",
+	})
+	defer os.RemoveAll(dir)
+
+	config := loadConfig(dir)
+
+	if len(config.EC2) != 2 || config.EC2[0].ID != "a" || config.EC2[1].ID != "b" || config.LogLevel != "debug" {
+		t.Errorf("loadConfig(%s) returned %+v", dir, config)
+	}
+}
+
+func TestReadConfig_conflicts(t *testing.T) {
+	var conflictTable = []struct {
+		files map[string]string
+		err   string
+	}{
+		{
+			map[string]string{"config.toml": "port = \":80\"\ninclude = [\"a.yaml\"]", "a.yaml": "port: ':81'"},
+			`a.yaml: "port" is already set in `,
+		},
+		{
+			map[string]string{"config.toml": "include = [\"a.json\"]\n[auth.admins]\nusers = []", "a.json": `{"auth": {"admins": {"users": ["a:b"]}}}`},
+			`a.json: "auth.admins.users" is already set in `,
+		},
+		{
+			map[string]string{"config.toml": "include = [\"a.toml\"]\n[[ec2]]\nid = \"app\"", "a.toml": "[[gce]]\nid = \"app\""},
+			`a.toml: [[gce]] id "app" is already used in `,
+		},
+		{
+			map[string]string{"config.toml": "include = [\"a.toml\"]\n[notify]\nsns_topics = []", "a.toml": "[[notify]]\nsns_topics = []"},
+			`a.toml: "notify" is already set in `,
+		},
+		{
+			map[string]string{"config.toml": "include = [\"a.toml\"]", "a.toml": "include = [\"config.toml\"]"},
+			"a.toml: include " + "%s/config.toml: include cycle",
+		},
+		{
+			map[string]string{"config.toml": "include = [\"*.toml\"]", "a.toml": ""},
+			"config.toml: include %s/config.toml: include cycle",
+		},
+		{
+			map[string]string{"config.toml": "include = [\"missing.toml\"]"},
+			"config.toml: include %s/missing.toml: no such file",
+		},
+		{
+			map[string]string{"config.toml": "include = \"a.toml\""},
+			"config.toml: include must be a list of file patterns",
+		},
+		{
+			map[string]string{"config.toml": "include = [\"a.yaml\"]", "a.yaml": "- port"},
+			"a.yaml: config must be a table of settings",
+		},
+	}
+
+	for i, tt := range conflictTable {
+		dir := writeConfigFiles(t, tt.files)
+
+		_, _, err := readConfig(filepath.Join(dir, "config.toml"))
+		want := strings.Replace(tt.err, "%s", dir, -1)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("readConfig #%d returned %v, want %s", i, err, want)
+		}
+
+		os.RemoveAll(dir)
+	}
+}
+
+func TestCheckConfig_files(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"config.toml": `include = ["conf.d/*.toml", "conf.d/*.yaml"]
+
+[[ec2]]
+id = "app"
+  [[ec2.route]]
+  hostnames = ["example.com"]
+`,
+		"conf.d/a.toml": `[[ec2]]
+depends_on = ["db"]
+  [[ec2.route]]
+  hostnames = ["example.com"]
+`,
+		"conf.d/b.yaml": `
+ec2:
+  - sleep_after: -5
+    templat: x
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	problems, err := checkConfig(filepath.Join(dir, "config.toml"), false)
+	if err != nil {
+		t.Fatalf("checkConfig returned unexpected error: %v", err)
+	}
+
+	want := []Problem{
+		{filepath.Join(dir, "conf.d/a.toml"), 2, `depends_on unknown id "db"`},
+		{filepath.Join(dir, "conf.d/a.toml"), 4, "hostname example.com on :80 is already used at " + filepath.Join(dir, "config.toml") + ":6"},
+		{filepath.Join(dir, "conf.d/b.yaml"), 0, `unknown key "ec2.templat"`},
+		{filepath.Join(dir, "conf.d/b.yaml"), 0, "invalid sleep_after -5"},
+	}
+
+	if len(problems) != len(want) {
+		t.Fatalf("checkConfig returned %v, want %v", problems, want)
+	}
+	for i, p := range problems {
+		if p.File != want[i].File || p.Line != want[i].Line || !strings.Contains(p.Message, want[i].Message) {
+			t.Errorf("checkConfig returned %v, want %v", p, want[i])
+		}
+	}
+}
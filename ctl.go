@@ -0,0 +1,474 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	defaultCtlAddr    = "http://localhost:9090"
+	defaultCtlTimeout = 10 * time.Minute
+	defaultCtlLease   = "ctl"
+)
+
+// ctlPollInterval is how often wait-ready and logs -follow ask the server
+var ctlPollInterval = 2 * time.Second
+
+const ctlUsage = `Usage: go-sleep ctl [flags] <command> [args]
+
+Commands:
+  status [instance]             show instances and their status
+  start <instance>              start the instance
+  stop <instance>               stop the instance
+  keep-awake <instance> -for 2h start the instance and keep it awake with a lease
+  logs [instance]               show lifecycle events, -follow to wait for new ones
+  routes                        show routes of all instances
+  wait-ready <instance>         start the instance and wait until it serves requests
+
+An instance is its id, hash or one of its hostnames.
+
+Flags:
+`
+
+// ctlClient calls the management API of a running go-sleep
+type ctlClient struct {
+	addr   string
+	key    string
+	user   string
+	client *http.Client
+}
+
+type ctlStatusError struct {
+	status  int
+	message string
+}
+
+func (err *ctlStatusError) Error() string {
+	return fmt.Sprintf("%d %s: %s", err.status, http.StatusText(err.status), err.message)
+}
+
+func (c *ctlClient) do(method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		js, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(js)
+	}
+
+	req, err := http.NewRequest(method, strings.TrimRight(c.addr, "/")+apiPrefix+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Go-Sleep-Key", c.key)
+	if len(c.user) > 0 {
+		req.Header.Set("X-Go-Sleep-User", c.user)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		apiErr := apiError{}
+		if err := json.NewDecoder(resp.Body).Decode(&apiErr); err != nil || len(apiErr.Error) == 0 {
+			apiErr.Error = "unexpected response"
+		}
+		return &ctlStatusError{resp.StatusCode, apiErr.Error}
+	}
+
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func instancePath(name string, resource ...string) string {
+	return strings.Join(append([]string{"instances", url.PathEscape(name)}, resource...), "/")
+}
+
+// parseInterleaved parses flags placed before, between and after positional args
+func parseInterleaved(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// runCtl runs a ctl command and returns the exit code,
+// 1 on errors of the command and 2 on usage errors
+func runCtl(args []string, stdout, stderr io.Writer) int {
+	addr := os.Getenv("GO_SLEEP_ADDR")
+	if len(addr) == 0 {
+		addr = defaultCtlAddr
+	}
+
+	fs := flag.NewFlagSet("ctl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, ctlUsage)
+		fs.PrintDefaults()
+	}
+
+	fs.StringVar(&addr, "addr", addr, "address of the go-sleep web port, $GO_SLEEP_ADDR")
+	key := fs.String("key", os.Getenv("GO_SLEEP_KEY"), "one of api_keys of go-sleep, $GO_SLEEP_KEY")
+	output := fs.String("o", "table", "output format: table or json")
+	timeout := fs.Duration("timeout", defaultCtlTimeout, "how long wait-ready waits")
+	duration := fs.Duration("for", 0, "how long keep-awake keeps the instance awake")
+	lease := fs.String("name", defaultCtlLease, "lease name of keep-awake")
+	follow := fs.Bool("follow", false, "logs waits for new events")
+
+	positional, err := parseInterleaved(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) == 0 {
+		fs.Usage()
+		return 2
+	}
+	if *output != "table" && *output != "json" {
+		fmt.Fprintf(stderr, "unknown output format %q\n", *output)
+		return 2
+	}
+
+	command, positional := positional[0], positional[1:]
+
+	arity := map[string][2]int{
+		"status":     {0, 1},
+		"start":      {1, 1},
+		"stop":       {1, 1},
+		"keep-awake": {1, 1},
+		"logs":       {0, 1},
+		"routes":     {0, 0},
+		"wait-ready": {1, 1},
+	}
+	n, ok := arity[command]
+	if !ok {
+		fmt.Fprintf(stderr, "unknown command %q\n", command)
+		fs.Usage()
+		return 2
+	}
+	if len(positional) < n[0] || len(positional) > n[1] {
+		fmt.Fprintf(stderr, "wrong number of arguments for %s\n", command)
+		fs.Usage()
+		return 2
+	}
+	if command == "keep-awake" && *duration <= 0 {
+		fmt.Fprintln(stderr, "keep-awake requires -for, for example -for 2h")
+		return 2
+	}
+
+	name := ""
+	if len(positional) > 0 {
+		name = positional[0]
+	}
+
+	ctl := &ctlOutput{stdout, *output == "json"}
+	c := &ctlClient{addr: addr, key: *key, user: ctlUser(), client: &http.Client{Timeout: 30 * time.Second}}
+
+	switch command {
+	case "status":
+		err = c.status(ctl, name)
+	case "start", "stop":
+		err = c.control(ctl, name, command)
+	case "keep-awake":
+		err = c.keepAwake(ctl, name, *lease, *duration)
+	case "logs":
+		err = c.logs(ctl, name, *follow)
+	case "routes":
+		err = c.routes(ctl)
+	case "wait-ready":
+		err = c.waitReady(ctl, stderr, name, *timeout)
+	}
+
+	if err != nil {
+		fmt.Fprintf(stderr, "go-sleep ctl %s: %s\n", command, err)
+		return 1
+	}
+	return 0
+}
+
+// ctlUser names the user of ctl in lifecycle events
+func ctlUser() string {
+	user := os.Getenv("USER")
+	if host, err := os.Hostname(); err == nil && len(user) > 0 {
+		return user + "@" + host
+	}
+	return user
+}
+
+func (c *ctlClient) status(ctl *ctlOutput, name string) error {
+	if len(name) > 0 {
+		state := instanceState{}
+		if err := c.do(http.MethodGet, instancePath(name), nil, &state); err != nil {
+			return err
+		}
+		return ctl.instances([]instanceState{state})
+	}
+
+	var states []instanceState
+	if err := c.do(http.MethodGet, "instances", nil, &states); err != nil {
+		return err
+	}
+	return ctl.instances(states)
+}
+
+func (c *ctlClient) control(ctl *ctlOutput, name, action string) error {
+	state := instanceState{}
+	if err := c.do(http.MethodPost, instancePath(name, action), nil, &state); err != nil {
+		return err
+	}
+	return ctl.instances([]instanceState{state})
+}
+
+func (c *ctlClient) keepAwake(ctl *ctlOutput, name, lease string, duration time.Duration) error {
+	acquired := Lease{}
+	req := leaseRequest{TTL: int64((duration + time.Second - 1) / time.Second), Holder: c.user}
+	if err := c.do(http.MethodPut, instancePath(name, "leases", lease), req, &acquired); err != nil {
+		return err
+	}
+
+	if err := c.do(http.MethodPost, instancePath(name, "start"), nil, nil); err != nil {
+		return err
+	}
+
+	if ctl.json {
+		return ctl.encode(acquired)
+	}
+	fmt.Fprintf(ctl.w, "%s is kept awake by lease %q until %s\n", name, acquired.Name, acquired.ExpiresAt.Local().Format(time.RFC3339))
+	return nil
+}
+
+// history returns events of the instance name or of all instances sorted by time
+func (c *ctlClient) history(name string) ([]Event, error) {
+	names := []string{name}
+	if len(name) == 0 {
+		var states []instanceState
+		if err := c.do(http.MethodGet, "instances", nil, &states); err != nil {
+			return nil, err
+		}
+		names = names[:0]
+		for _, state := range states {
+			names = append(names, state.Hash)
+		}
+	}
+
+	var events []Event
+	for _, name := range names {
+		var history []Event
+		if err := c.do(http.MethodGet, instancePath(name, "history"), nil, &history); err != nil {
+			return nil, err
+		}
+		events = append(events, history...)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+	return events, nil
+}
+
+func (c *ctlClient) logs(ctl *ctlOutput, name string, follow bool) error {
+	events, err := c.history(name)
+	if err != nil {
+		return err
+	}
+	if err := ctl.events(events, true); err != nil || !follow {
+		return err
+	}
+
+	var last time.Time
+	if len(events) > 0 {
+		last = events[len(events)-1].Time
+	}
+
+	for {
+		time.Sleep(ctlPollInterval)
+
+		events, err := c.history(name)
+		if err != nil {
+			return err
+		}
+
+		var fresh []Event
+		for _, event := range events {
+			if event.Time.After(last) {
+				fresh = append(fresh, event)
+				last = event.Time
+			}
+		}
+		if err := ctl.events(fresh, false); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *ctlClient) routes(ctl *ctlOutput) error {
+	var routes []routeState
+	if err := c.do(http.MethodGet, "routes", nil, &routes); err != nil {
+		return err
+	}
+	return ctl.routes(routes)
+}
+
+// waitReady starts the instance and waits until it is running and healthy
+func (c *ctlClient) waitReady(ctl *ctlOutput, stderr io.Writer, name string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	state := instanceState{}
+	if err := c.do(http.MethodPost, instancePath(name, "start"), nil, &state); err != nil {
+		return err
+	}
+
+	status := ""
+	for !state.Ready {
+		if state.Status != status {
+			status = state.Status
+			fmt.Fprintf(stderr, "%s: %s\n", name, status)
+		}
+
+		if time.Now().Add(ctlPollInterval).After(deadline) {
+			return fmt.Errorf("%s is not ready after %s, last status %s", name, timeout, state.Status)
+		}
+		time.Sleep(ctlPollInterval)
+
+		if err := c.do(http.MethodGet, instancePath(name), nil, &state); err != nil {
+			if _, ok := err.(*ctlStatusError); ok {
+				return err
+			}
+			// the server may restart while a pipeline waits
+			fmt.Fprintf(stderr, "%s: %s\n", name, err)
+		}
+	}
+
+	return ctl.instances([]instanceState{state})
+}
+
+// ctlOutput prints results of ctl as tables or as JSON
+type ctlOutput struct {
+	w    io.Writer
+	json bool
+}
+
+func (ctl *ctlOutput) encode(v interface{}) error {
+	enc := json.NewEncoder(ctl.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func (ctl *ctlOutput) instances(states []instanceState) error {
+	if ctl.json {
+		if len(states) == 1 {
+			return ctl.encode(states[0])
+		}
+		return ctl.encode(states)
+	}
+
+	tw := tabwriter.NewWriter(ctl.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tPROVIDER\tSTATUS\tREADY\tHOSTNAMES\tSLEEP IN\tLEASES")
+	for _, state := range states {
+		id := state.ID
+		if len(id) == 0 {
+			id = state.Hash
+		}
+
+		sleepIn := "-"
+		if state.SleepIn != nil {
+			sleepIn = (time.Duration(*state.SleepIn) * time.Second).String()
+		}
+
+		leases := make([]string, 0, len(state.Leases))
+		for _, lease := range state.Leases {
+			leases = append(leases, lease.Name)
+		}
+
+		status := state.Status
+		if len(state.Error) > 0 {
+			status += " (" + state.Error + ")"
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%t\t%s\t%s\t%s\n", id, state.Provider, status, state.Ready, orDash(strings.Join(state.Hostnames, ",")), sleepIn, orDash(strings.Join(leases, ",")))
+	}
+	return tw.Flush()
+}
+
+func (ctl *ctlOutput) events(events []Event, header bool) error {
+	if ctl.json {
+		// one event per line to keep -follow output streamable
+		for _, event := range events {
+			if err := json.NewEncoder(ctl.w).Encode(event); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(ctl.w, 0, 4, 2, ' ', 0)
+	if header {
+		fmt.Fprintln(tw, "TIME\tINSTANCE\tEVENT\tDETAILS")
+	}
+	for _, event := range events {
+		var details []string
+		if len(event.Hostname) > 0 {
+			details = append(details, "hostname="+event.Hostname)
+		}
+		if len(event.User) > 0 {
+			details = append(details, "user="+event.User)
+		}
+		if event.Duration > 0 {
+			details = append(details, fmt.Sprintf("duration=%.1fs", event.Duration))
+		}
+		if len(event.Error) > 0 {
+			details = append(details, "error="+event.Error)
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", event.Time.Local().Format(time.RFC3339), event.Instance, event.Event, orDash(strings.Join(details, " ")))
+	}
+	return tw.Flush()
+}
+
+func (ctl *ctlOutput) routes(routes []routeState) error {
+	if ctl.json {
+		return ctl.encode(routes)
+	}
+
+	tw := tabwriter.NewWriter(ctl.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ADDRESS\tHOSTNAME\tPROTOCOL\tBACKEND PORT\tINSTANCE")
+	for _, route := range routes {
+		hostname := orDash(route.Hostname)
+		if route.Default {
+			hostname = "(default)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\n", route.Address, hostname, route.Protocol, route.BackendPort, route.Instance)
+	}
+	return tw.Flush()
+}
+
+func orDash(s string) string {
+	if len(s) == 0 {
+		return "-"
+	}
+	return s
+}
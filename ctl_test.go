@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseInterleaved(t *testing.T) {
+	var parseTable = []struct {
+		args       []string
+		positional []string
+		output     string
+	}{
+		{[]string{"status"}, []string{"status"}, "table"},
+		{[]string{"-o", "json", "status", "app"}, []string{"status", "app"}, "json"},
+		{[]string{"status", "-o", "json", "app"}, []string{"status", "app"}, "json"},
+		{[]string{"status", "app", "--o=json"}, []string{"status", "app"}, "json"},
+	}
+
+	for _, tt := range parseTable {
+		fs := flag.NewFlagSet("ctl", flag.ContinueOnError)
+		output := fs.String("o", "table", "")
+
+		positional, err := parseInterleaved(fs, tt.args)
+		if err != nil {
+			t.Fatalf("parseInterleaved(%v) returned unexpected error: %v", tt.args, err)
+		}
+		if !reflect.DeepEqual(positional, tt.positional) || *output != tt.output {
+			t.Errorf("parseInterleaved(%v) returned %v and -o %s, want %v and -o %s", tt.args, positional, *output, tt.positional, tt.output)
+		}
+	}
+}
+
+func TestRunCtl(t *testing.T) {
+	server := NewServer(&Config{})
+	defer server.Close()
+	server.apiKeys = []string{"secret"}
+
+	instance := NewComputeInstance(newDummyProvider("test", false), time.Minute)
+	instance.ID = "app"
+	server.InstanceStore.Set(instance.Hash(), instance)
+	server.serverRoutes[":80"] = map[string]*serverRoute{
+		"app.example.com": {Hostname: "app.example.com", BackendPort: 8080, InstanceName: instance.Hash()},
+	}
+	instance.emit(EventRunning, 0)
+
+	ts := httptest.NewServer(server.apiHandler())
+	defer ts.Close()
+
+	defer func(interval time.Duration) { ctlPollInterval = interval }(ctlPollInterval)
+	ctlPollInterval = 10 * time.Millisecond
+
+	var ctlTable = []struct {
+		args []string
+		code int
+		out  string
+	}{
+		{[]string{"status"}, 0, "app  [dummyProvider] ID: test  running  true   app.example.com"},
+		{[]string{"status", "app.example.com", "-o", "json"}, 0, `"hostnames": [`},
+		{[]string{"status", "db"}, 1, ""},
+		{[]string{"routes"}, 0, ":80      app.example.com  http      8080          app"},
+		{[]string{"logs", "app", "-o", "json"}, 0, `"event":"running"`},
+		{[]string{"logs"}, 0, "dummy-test  running"},
+		{[]string{"keep-awake", "app"}, 2, ""},
+		{[]string{"keep-awake", "app", "--for", "2h", "-name", "ci"}, 0, `app is kept awake by lease "ci"`},
+		{[]string{"start"}, 2, ""},
+		{[]string{"restart", "app"}, 2, ""},
+		{[]string{"status", "-o", "yaml"}, 2, ""},
+		{[]string{"wait-ready", "app.example.com"}, 0, "app"},
+		{[]string{"-key", "wrong", "status"}, 1, ""},
+	}
+
+	for _, tt := range ctlTable {
+		var stdout, stderr bytes.Buffer
+		args := append([]string{"-addr", ts.URL, "-key", "secret"}, tt.args...)
+
+		if code := runCtl(args, &stdout, &stderr); code != tt.code {
+			t.Errorf("ctl %v returned %d, want %d: %s", tt.args, code, tt.code, stderr.String())
+		}
+		if !strings.Contains(stdout.String(), tt.out) {
+			t.Errorf("ctl %v printed %q, want %q", tt.args, stdout.String(), tt.out)
+		}
+	}
+
+	if leases := instance.Leases(); len(leases) != 1 || leases[0].Name != "ci" || time.Until(leases[0].ExpiresAt) < time.Hour {
+		t.Errorf("keep-awake left leases %v, want ci for 2h", leases)
+	}
+}
+
+func TestRunCtl_waitReadyTimeout(t *testing.T) {
+	server := NewServer(&Config{})
+	defer server.Close()
+	server.apiKeys = []string{"secret"}
+
+	instance := NewComputeInstance(newDummyProvider("test", false), time.Minute)
+	instance.ID = "app"
+	instance.HTTPHealth = false
+	server.InstanceStore.Set(instance.Hash(), instance)
+
+	ts := httptest.NewServer(server.apiHandler())
+	defer ts.Close()
+
+	defer func(interval time.Duration) { ctlPollInterval = interval }(ctlPollInterval)
+	ctlPollInterval = 10 * time.Millisecond
+
+	var stderr bytes.Buffer
+	code := runCtl([]string{"-addr", ts.URL, "-key", "secret", "wait-ready", "app", "-timeout", "50ms"}, ioutil.Discard, &stderr)
+	if code != 1 {
+		t.Errorf("wait-ready returned %d, want 1", code)
+	}
+	if !strings.Contains(stderr.String(), "is not ready after 50ms") {
+		t.Errorf("wait-ready printed %q", stderr.String())
+	}
+
+	instance.HTTPHealth = true
+
+	var stdout bytes.Buffer
+	code = runCtl([]string{"-addr", ts.URL, "-key", "secret", "-o", "json", "wait-ready", "app"}, &stdout, ioutil.Discard)
+	if code != 0 {
+		t.Errorf("wait-ready returned %d, want 0", code)
+	}
+
+	state := instanceState{}
+	if err := json.Unmarshal(stdout.Bytes(), &state); err != nil || !state.Ready {
+		t.Errorf("wait-ready printed %s, want a ready instance", stdout.String())
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/silentsokolov/go-sleep/log"
+	"github.com/silentsokolov/go-sleep/provider"
+)
+
+// dependencyTimeout is the time to wait for healthy dependencies
+const dependencyTimeout = 10 * time.Minute
+
+// dependencyPollInterval is the interval of dependency health checks
+var dependencyPollInterval = 5 * time.Second
+
+// linkDependencies resolves depends_on of all instances
+func (server *Server) linkDependencies() {
+	graph := make(map[string][]string)
+
+	for key, instance := range server.InstanceStore.values {
+		for _, id := range instance.dependsOn {
+			dep, ok := server.InstanceStore.Find(id)
+			if !ok {
+				log.Fatalf("%s depends on unknown instance %q", instance.Provider, id)
+			}
+			instance.AddDependency(dep)
+			graph[key] = append(graph[key], dep.Hash())
+		}
+	}
+
+	if cycle := findDependencyCycle(graph); cycle != nil {
+		log.Fatalf("Dependency cycle: %s", strings.Join(cycle, " -> "))
+	}
+}
+
+// duplicateID returns an id used by more than one instance
+func (config *Config) duplicateID() string {
+	ids := make(map[string]bool)
+	for _, inst := range config.instances() {
+		if len(inst.base.ID) == 0 {
+			continue
+		}
+		if ids[inst.base.ID] {
+			return inst.base.ID
+		}
+		ids[inst.base.ID] = true
+	}
+	return ""
+}
+
+// dependencyGraph returns depends_on of the configured instances by id,
+// instances without id can't be depended on and so are not part of cycles
+func (config *Config) dependencyGraph() map[string][]string {
+	graph := make(map[string][]string)
+	for _, inst := range config.instances() {
+		if len(inst.base.ID) > 0 {
+			graph[inst.base.ID] = append(graph[inst.base.ID], inst.base.DependsOn...)
+		}
+	}
+	return graph
+}
+
+// findDependencyCycle returns a cycle of graph or nil
+func findDependencyCycle(graph map[string][]string) []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make(map[string]int)
+	var path []string
+
+	var visit func(node string) []string
+	visit = func(node string) []string {
+		state[node] = visiting
+		path = append(path, node)
+
+		for _, next := range graph[node] {
+			switch state[next] {
+			case visiting:
+				for i, n := range path {
+					if n == next {
+						return append(append([]string{}, path[i:]...), next)
+					}
+				}
+			case unvisited:
+				if cycle := visit(next); cycle != nil {
+					return cycle
+				}
+			}
+		}
+
+		path = path[:len(path)-1]
+		state[node] = visited
+		return nil
+	}
+
+	for node := range graph {
+		if state[node] == unvisited {
+			if cycle := visit(node); cycle != nil {
+				return cycle
+			}
+		}
+	}
+
+	return nil
+}
+
+// AddDependency ...
+func (instance *ComputeInstance) AddDependency(dep *ComputeInstance) {
+	instance.Lock()
+	instance.dependencies = append(instance.dependencies, dep)
+	instance.Unlock()
+
+	dep.Lock()
+	dep.dependents = append(dep.dependents, instance)
+	dep.Unlock()
+}
+
+// startDependencies starts all dependencies and waits until they are healthy
+func (instance *ComputeInstance) startDependencies(timeout time.Duration) error {
+	instance.RLock()
+	dependencies := instance.dependencies
+	hostname, user := instance.wakeHost, instance.wakeUser
+	instance.RUnlock()
+
+	for _, dep := range dependencies {
+		switch dep.Status() {
+		case provider.StatusInstanceNotRun, provider.StatusInstanceError:
+			log.Printf("Starting dependency %s of %s", dep, instance.Provider)
+			dep.RequestStart(hostname, user)
+		}
+	}
+
+	deadline := time.Now().Add(timeout)
+	for _, dep := range dependencies {
+		for !dep.Healthy() {
+			if time.Now().After(deadline) {
+				return fmt.Errorf("Dependency %s is not healthy after %s", dep.Provider, timeout)
+			}
+			time.Sleep(dependencyPollInterval)
+		}
+	}
+
+	return nil
+}
+
+// WaitingDependencies reports whether the instance waits for its dependencies
+func (instance *ComputeInstance) WaitingDependencies() bool {
+	return atomic.LoadInt32(&instance.waitingDeps) == 1
+}
+
+// Healthy reports whether the instance is running and accepts connections
+// on the backend port of its first route
+func (instance *ComputeInstance) Healthy() bool {
+	instance.RLock()
+	healthy := instance.currentStatus == provider.StatusInstanceRunning && instance.lastError == nil
+	port := instance.healthPort
+	instance.RUnlock()
+
+	if !healthy || port == 0 {
+		return healthy
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(instance.BackendIP(), strconv.Itoa(port)), 3*time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// idle reports whether the instance was not accessed for sleepAfter
+func (instance *ComputeInstance) idle() bool {
+	instance.RLock()
+	defer instance.RUnlock()
+	return !instance.lastAccess.IsZero() && time.Since(instance.lastAccess) >= instance.sleepAfter
+}
+
+// dependenciesIdle reports whether all dependencies are idle or stopped
+func (instance *ComputeInstance) dependenciesIdle() bool {
+	instance.RLock()
+	dependencies := instance.dependencies
+	instance.RUnlock()
+
+	for _, dep := range dependencies {
+		if dep.Status() == provider.StatusInstanceRunning && (!dep.idle() || dep.HasLeases() || !dep.dependenciesIdle()) {
+			return false
+		}
+	}
+	return true
+}
+
+// dependentAwake reports whether an instance depending on this one
+// is not stopped yet
+func (instance *ComputeInstance) dependentAwake() bool {
+	instance.RLock()
+	dependents := instance.dependents
+	instance.RUnlock()
+
+	for _, d := range dependents {
+		switch d.Status() {
+		case provider.StatusInstanceRunning, provider.StatusInstanceStarting, provider.StatusInstanceStopping:
+			return true
+		}
+		if d.WaitingDependencies() {
+			return true
+		}
+	}
+	return false
+}
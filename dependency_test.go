@@ -0,0 +1,122 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/silentsokolov/go-sleep/provider"
+)
+
+func TestFindDependencyCycle(t *testing.T) {
+	var graphTable = []struct {
+		in  map[string][]string
+		out int
+	}{
+		{map[string][]string{"app": {"db", "cache"}, "db": {"disk"}, "cache": {"disk"}}, 0},
+		{map[string][]string{"app": {"app"}}, 2},
+		{map[string][]string{"app": {"db"}, "db": {"cache"}, "cache": {"app"}}, 4},
+	}
+
+	for _, test := range graphTable {
+		cycle := findDependencyCycle(test.in)
+		if len(cycle) != test.out {
+			t.Errorf("findDependencyCycle returned %v, want cycle of %d", cycle, test.out)
+		}
+		if len(cycle) > 0 && cycle[0] != cycle[len(cycle)-1] {
+			t.Errorf("findDependencyCycle returned %v, want closed cycle", cycle)
+		}
+	}
+}
+
+func TestConfig_dependencyGraph(t *testing.T) {
+	config := &Config{
+		EC2: []*EC2Config{
+			{BaseConfig: BaseConfig{ID: "app", DependsOn: []string{"db"}}},
+			{BaseConfig: BaseConfig{DependsOn: []string{"app"}}},
+		},
+		GCE: []*GCEConfig{
+			{BaseConfig: BaseConfig{ID: "db", DependsOn: []string{"cache"}}},
+			{BaseConfig: BaseConfig{ID: "cache", DependsOn: []string{"app"}}},
+		},
+	}
+
+	cycle := findDependencyCycle(config.dependencyGraph())
+	if len(cycle) != 4 {
+		t.Errorf("findDependencyCycle of the config returned %v, want cycle of app, db and cache", cycle)
+	}
+
+	config.GCE[1].DependsOn = nil
+	if cycle := findDependencyCycle(config.dependencyGraph()); cycle != nil {
+		t.Errorf("findDependencyCycle of the config returned %v, want no cycle", cycle)
+	}
+}
+
+func TestConfig_duplicateID(t *testing.T) {
+	config := &Config{
+		EC2: []*EC2Config{{BaseConfig: BaseConfig{ID: "app"}}, {}},
+		GCE: []*GCEConfig{{}, {BaseConfig: BaseConfig{ID: "db"}}},
+	}
+	if id := config.duplicateID(); id != "" {
+		t.Errorf("Config.duplicateID returned %q, want none", id)
+	}
+
+	config.GCE[0].ID = "app"
+	if id := config.duplicateID(); id != "app" {
+		t.Errorf("Config.duplicateID returned %q, want %q", id, "app")
+	}
+}
+
+func newTestDependency() (*ComputeInstance, *ComputeInstance) {
+	app := NewComputeInstance(newDummyProvider("app", false), time.Duration(100)*time.Second)
+	db := NewComputeInstance(newDummyProvider("db", false), time.Duration(100)*time.Second)
+	app.AddDependency(db)
+	return app, db
+}
+
+func TestComputeInstance_startDependencies(t *testing.T) {
+	dependencyPollInterval = 10 * time.Millisecond
+	app, db := newTestDependency()
+	db.SetStatus(provider.StatusInstanceNotRun)
+
+	if err := app.startDependencies(50 * time.Millisecond); err == nil {
+		t.Error("ComputeInstance.startDependencies returned no error for stopped dependency")
+	}
+
+	select {
+	case status := <-db.statusChan:
+		if status != provider.StatusInstanceStarting {
+			t.Errorf("ComputeInstance.startDependencies sent %v, want %v", status, provider.StatusInstanceStarting)
+		}
+	default:
+		t.Error("ComputeInstance.startDependencies did not start dependency")
+	}
+
+	db.SetStatus(provider.StatusInstanceRunning)
+	if err := app.startDependencies(50 * time.Millisecond); err != nil {
+		t.Errorf("ComputeInstance.startDependencies returned unexpected error: %v", err)
+	}
+}
+
+func TestComputeInstance_GroupIdle(t *testing.T) {
+	app, db := newTestDependency()
+	app.sleepAfter = time.Minute
+	db.sleepAfter = time.Minute
+
+	if app.dependenciesIdle() {
+		t.Error("ComputeInstance.dependenciesIdle returned true for accessed dependency")
+	}
+
+	db.lastAccess = time.Now().Add(-2 * time.Minute)
+	if !app.dependenciesIdle() {
+		t.Error("ComputeInstance.dependenciesIdle returned false for idle dependency")
+	}
+
+	if !db.dependentAwake() {
+		t.Error("ComputeInstance.dependentAwake returned false for running dependent")
+	}
+
+	app.SetStatus(provider.StatusInstanceNotRun)
+	if db.dependentAwake() {
+		t.Error("ComputeInstance.dependentAwake returned true for stopped dependent")
+	}
+}
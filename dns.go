@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"github.com/silentsokolov/go-sleep/dnsupdate"
+	"github.com/silentsokolov/go-sleep/log"
+	"github.com/silentsokolov/go-sleep/provider"
+)
+
+func newDNSUpdater(conf *DNSConfig) dnsupdate.Updater {
+	if len(conf.SleepTarget) == 0 {
+		log.Fatalf("DNS %s: sleep_target is required", conf.Name)
+	}
+
+	ttl := conf.TTL
+	if ttl <= 0 {
+		ttl = defaultDNSTTL
+	}
+
+	switch conf.Type {
+	case "route53":
+		return dnsupdate.NewRoute53(conf.AccessKeyID, conf.SecretAccessKey, conf.ZoneID, conf.Name, ttl)
+	case "clouddns":
+		return dnsupdate.NewCloudDNS(conf.JWTPath, conf.ProjectID, conf.ManagedZone, conf.Name, ttl)
+	case "rfc2136":
+		return dnsupdate.NewRFC2136(conf.Server, conf.Zone, conf.Name, ttl, conf.TSIGName, conf.TSIGSecret, conf.TSIGAlgorithm)
+	default:
+		log.Fatalf("DNS %s: unknown type %q", conf.Name, conf.Type)
+		return nil
+	}
+}
+
+// watchDNS points the record of updater at the instance while it is running
+// and at sleepTarget, the address of go-sleep, while it is stopped
+func watchDNS(instance *ComputeInstance, updater dnsupdate.Updater, sleepTarget string) {
+	var mu sync.Mutex
+	targets := make(chan string, 1)
+
+	// only the latest target matters, a pending one is replaced
+	push := func(target string) {
+		if len(target) == 0 {
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		select {
+		case <-targets:
+		default:
+		}
+		targets <- target
+	}
+
+	follow := func(status provider.StatusInstance) {
+		switch status {
+		case provider.StatusInstanceRunning:
+			push(instance.Address())
+		case provider.StatusInstanceNotRun:
+			push(sleepTarget)
+		}
+	}
+
+	go func() {
+		for {
+			select {
+			case target := <-targets:
+				err := provider.Call(instance.ctx, instance.calls(), func(ctx context.Context) error {
+					return updater.Update(ctx, target)
+				})
+				if err != nil {
+					log.Printf("Update DNS %s raise error: %s", updater, err)
+				} else {
+					log.Printf("DNS %s points at %s", updater, target)
+				}
+			case <-instance.ctx.Done():
+				return
+			}
+		}
+	}()
+
+	instance.OnStatusChange(follow)
+	instance.OnIPChange(func() {
+		follow(instance.Status())
+	})
+	follow(instance.Status())
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/silentsokolov/go-sleep/provider"
+)
+
+type dummyUpdater struct {
+	targets chan string
+}
+
+func (u *dummyUpdater) String() string {
+	return "[dummyUpdater]"
+}
+
+func (u *dummyUpdater) Update(ctx context.Context, target string) error {
+	u.targets <- target
+	return nil
+}
+
+func TestWatchDNS(t *testing.T) {
+	ci := NewComputeInstance(newDummyProvider("test", false), time.Duration(100)*time.Second)
+	defer ci.cancel()
+	updater := &dummyUpdater{targets: make(chan string, 10)}
+
+	watchDNS(ci, updater, "go-sleep.example.org")
+
+	next := func() string {
+		select {
+		case target := <-updater.targets:
+			return target
+		case <-time.After(time.Second):
+			return ""
+		}
+	}
+
+	if target := next(); target != "www.example.org" {
+		t.Errorf("watchDNS updated %q, want %q", target, "www.example.org")
+	}
+
+	ci.Reset()
+	ci.SetStatus(provider.StatusInstanceNotRun)
+	if target := next(); target != "go-sleep.example.org" {
+		t.Errorf("watchDNS updated %q, want %q", target, "go-sleep.example.org")
+	}
+
+	ci.SetIPs([]string{"10.0.0.1"})
+	ci.SetStatus(provider.StatusInstanceRunning)
+	if target := next(); target != "10.0.0.1" {
+		t.Errorf("watchDNS updated %q, want %q", target, "10.0.0.1")
+	}
+
+	ci.SetIPs([]string{"10.0.0.2"})
+	if target := next(); target != "10.0.0.2" {
+		t.Errorf("watchDNS updated %q after drift, want %q", target, "10.0.0.2")
+	}
+}
@@ -0,0 +1,81 @@
+package dnsupdate
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+
+	"golang.org/x/oauth2/google"
+	dns "google.golang.org/api/dns/v1"
+
+	"github.com/silentsokolov/go-sleep/log"
+)
+
+// CloudDNS updates a record of a Cloud DNS managed zone
+type CloudDNS struct {
+	JWTPath     string
+	ProjectID   string
+	ManagedZone string
+	Name        string
+	TTL         int64
+	dnsService  *dns.Service
+}
+
+// NewCloudDNS ..
+func NewCloudDNS(JWTPath, ProjectID, ManagedZone, Name string, TTL int64) *CloudDNS {
+	data, err := ioutil.ReadFile(JWTPath)
+	if err != nil {
+		log.Fatalf("Cloud DNS %s: Unable to read key: %v", Name, err)
+	}
+
+	conf, err := google.JWTConfigFromJSON(data, dns.NdevClouddnsReadwriteScope)
+	if err != nil {
+		log.Fatalf("Cloud DNS %s: Unable to parse key: %v", Name, err)
+	}
+
+	dnsService, err := dns.New(conf.Client(context.Background()))
+	if err != nil {
+		log.Fatalf("Cloud DNS %s: Unable to create DNS service: %v", Name, err)
+	}
+
+	return &CloudDNS{
+		JWTPath:     JWTPath,
+		ProjectID:   ProjectID,
+		ManagedZone: ManagedZone,
+		Name:        fqdn(Name),
+		TTL:         TTL,
+		dnsService:  dnsService,
+	}
+}
+
+// String ...
+func (u *CloudDNS) String() string {
+	return fmt.Sprintf("[Cloud DNS] %s in %s-%s", u.Name, u.ProjectID, u.ManagedZone)
+}
+
+// Update ...
+func (u *CloudDNS) Update(ctx context.Context, target string) error {
+	recordType := RecordType(target)
+
+	list, err := u.dnsService.ResourceRecordSets.List(u.ProjectID, u.ManagedZone).Name(u.Name).Context(ctx).Do()
+	if err != nil {
+		return err
+	}
+
+	change := &dns.Change{}
+	for _, set := range list.Rrsets {
+		if set.Type == TypeA || set.Type == TypeAAAA || set.Type == TypeCNAME {
+			change.Deletions = append(change.Deletions, set)
+		}
+	}
+
+	change.Additions = []*dns.ResourceRecordSet{{
+		Name:    u.Name,
+		Type:    recordType,
+		Ttl:     u.TTL,
+		Rrdatas: []string{recordValue(target, recordType)},
+	}}
+
+	_, err = u.dnsService.Changes.Create(u.ProjectID, u.ManagedZone, change).Context(ctx).Do()
+	return err
+}
@@ -0,0 +1,56 @@
+package dnsupdate
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	dns "google.golang.org/api/dns/v1"
+)
+
+func TestCloudDNS_Update(t *testing.T) {
+	var change dns.Change
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/rrsets"):
+			w.Write([]byte(`{"rrsets": [
+				{"name": "app.example.org.", "type": "A", "ttl": 60, "rrdatas": ["10.0.0.1"]},
+				{"name": "app.example.org.", "type": "TXT", "ttl": 60, "rrdatas": ["v=spf1"]}
+			]}`))
+		case strings.HasSuffix(r.URL.Path, "/changes"):
+			json.NewDecoder(r.Body).Decode(&change)
+			w.Write([]byte(`{"status": "pending"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	dnsService, _ := dns.New(http.DefaultClient)
+	dnsService.BasePath = server.URL + "/"
+
+	u := &CloudDNS{
+		ProjectID:   "my-project",
+		ManagedZone: "example",
+		Name:        "app.example.org.",
+		TTL:         60,
+		dnsService:  dnsService,
+	}
+
+	if err := u.Update(context.Background(), "go-sleep.example.org"); err != nil {
+		t.Fatalf("CloudDNS.Update returned unexpected error: %v", err)
+	}
+
+	if len(change.Deletions) != 1 || change.Deletions[0].Type != TypeA {
+		t.Errorf("CloudDNS.Update deleted %+v, want the A record", change.Deletions)
+	}
+
+	want := []string{"go-sleep.example.org."}
+	if len(change.Additions) != 1 || change.Additions[0].Type != TypeCNAME || !reflect.DeepEqual(change.Additions[0].Rrdatas, want) {
+		t.Errorf("CloudDNS.Update added %+v, want CNAME %v", change.Additions, want)
+	}
+}
@@ -0,0 +1,52 @@
+// Package dnsupdate writes addresses of instances into DNS records
+package dnsupdate
+
+import (
+	"context"
+	"net"
+	"strings"
+)
+
+// Record types
+const (
+	TypeA     = "A"
+	TypeAAAA  = "AAAA"
+	TypeCNAME = "CNAME"
+)
+
+// Updater replaces the address record of a single name
+type Updater interface {
+	String() string
+	// Update points the name at target, an IP address or a hostname.
+	// A, AAAA and CNAME records of the name are replaced.
+	Update(ctx context.Context, target string) error
+}
+
+// RecordType returns the record type for target
+func RecordType(target string) string {
+	ip := net.ParseIP(target)
+	switch {
+	case ip == nil:
+		return TypeCNAME
+	case ip.To4() != nil:
+		return TypeA
+	default:
+		return TypeAAAA
+	}
+}
+
+// fqdn returns name with the trailing dot
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+// recordValue returns the value of a record of type for target
+func recordValue(target, recordType string) string {
+	if recordType == TypeCNAME {
+		return fqdn(target)
+	}
+	return target
+}
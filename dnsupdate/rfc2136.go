@@ -0,0 +1,285 @@
+package dnsupdate
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/silentsokolov/go-sleep/log"
+)
+
+// DNS constants of RFC 1035, RFC 2136 and RFC 8945
+const (
+	dnsTypeA     = 1
+	dnsTypeCNAME = 5
+	dnsTypeSOA   = 6
+	dnsTypeAAAA  = 28
+	dnsTypeTSIG  = 250
+
+	dnsClassIN  = 1
+	dnsClassANY = 255
+
+	dnsOpcodeUpdate = 5
+	dnsFlagTC       = 1 << 9
+
+	tsigFudge = 300
+)
+
+var tsigAlgorithms = map[string]func() hash.Hash{
+	"hmac-sha1.":   sha1.New,
+	"hmac-sha256.": sha256.New,
+	"hmac-sha512.": sha512.New,
+}
+
+var dnsRcodes = map[int]string{
+	1:  "FORMERR",
+	2:  "SERVFAIL",
+	3:  "NXDOMAIN",
+	4:  "NOTIMP",
+	5:  "REFUSED",
+	6:  "YXDOMAIN",
+	7:  "YXRRSET",
+	8:  "NXRRSET",
+	9:  "NOTAUTH",
+	10: "NOTZONE",
+}
+
+// RFC2136 updates a record with a DNS UPDATE message,
+// signed with TSIG when a key is set
+type RFC2136 struct {
+	Server        string
+	Zone          string
+	Name          string
+	TTL           int64
+	TSIGName      string
+	TSIGAlgorithm string
+	tsigSecret    []byte
+}
+
+// NewRFC2136 ..
+func NewRFC2136(Server, Zone, Name string, TTL int64, TSIGName, TSIGSecret, TSIGAlgorithm string) *RFC2136 {
+	if _, _, err := net.SplitHostPort(Server); err != nil {
+		Server = net.JoinHostPort(Server, "53")
+	}
+
+	if len(TSIGAlgorithm) == 0 {
+		TSIGAlgorithm = "hmac-sha256"
+	}
+	TSIGAlgorithm = fqdn(strings.ToLower(TSIGAlgorithm))
+	if _, ok := tsigAlgorithms[TSIGAlgorithm]; !ok {
+		log.Fatalf("RFC 2136 %s: Unknown TSIG algorithm %s", Name, TSIGAlgorithm)
+	}
+
+	secret, err := base64.StdEncoding.DecodeString(TSIGSecret)
+	if err != nil {
+		log.Fatalf("RFC 2136 %s: Unable to decode TSIG secret: %v", Name, err)
+	}
+
+	if len(TSIGName) != 0 {
+		TSIGName = fqdn(strings.ToLower(TSIGName))
+	}
+
+	return &RFC2136{
+		Server:        Server,
+		Zone:          fqdn(Zone),
+		Name:          fqdn(Name),
+		TTL:           TTL,
+		TSIGName:      TSIGName,
+		TSIGAlgorithm: TSIGAlgorithm,
+		tsigSecret:    secret,
+	}
+}
+
+// String ...
+func (u *RFC2136) String() string {
+	return fmt.Sprintf("[RFC 2136] %s on %s", u.Name, u.Server)
+}
+
+// Update ...
+func (u *RFC2136) Update(ctx context.Context, target string) error {
+	msg := u.message(target, time.Now())
+
+	resp, err := exchange(ctx, "udp", u.Server, msg)
+	if err == nil && binary.BigEndian.Uint16(resp[2:])&dnsFlagTC != 0 {
+		resp, err = exchange(ctx, "tcp", u.Server, msg)
+	}
+	if err != nil {
+		return err
+	}
+
+	if binary.BigEndian.Uint16(resp) != binary.BigEndian.Uint16(msg) {
+		return errors.New("DNS response ID does not match")
+	}
+
+	if rcode := int(resp[3] & 0x0f); rcode != 0 {
+		name, ok := dnsRcodes[rcode]
+		if !ok {
+			name = fmt.Sprintf("RCODE%d", rcode)
+		}
+		return fmt.Errorf("DNS update of %s failed: %s", u.Name, name)
+	}
+
+	return nil
+}
+
+// message builds an UPDATE message replacing A, AAAA and CNAME records of the name
+func (u *RFC2136) message(target string, now time.Time) []byte {
+	recordType := RecordType(target)
+
+	var rtype uint16
+	var rdata []byte
+	switch recordType {
+	case TypeA:
+		rtype, rdata = dnsTypeA, net.ParseIP(target).To4()
+	case TypeAAAA:
+		rtype, rdata = dnsTypeAAAA, net.ParseIP(target).To16()
+	default:
+		rtype, rdata = dnsTypeCNAME, packName(fqdn(target))
+	}
+
+	msg := make([]byte, 12)
+	binary.BigEndian.PutUint16(msg[0:], uint16(rand.Intn(0x10000)))
+	binary.BigEndian.PutUint16(msg[2:], dnsOpcodeUpdate<<11)
+	binary.BigEndian.PutUint16(msg[4:], 1) // zone
+	binary.BigEndian.PutUint16(msg[8:], 4) // updates
+
+	// zone section
+	msg = append(msg, packName(u.Zone)...)
+	msg = appendUint16(msg, dnsTypeSOA, dnsClassIN)
+
+	// delete RRsets of all address types
+	for _, t := range []uint16{dnsTypeA, dnsTypeAAAA, dnsTypeCNAME} {
+		msg = appendRR(msg, u.Name, t, dnsClassANY, 0, nil)
+	}
+
+	msg = appendRR(msg, u.Name, rtype, dnsClassIN, uint32(u.TTL), rdata)
+
+	if len(u.TSIGName) != 0 {
+		msg = u.sign(msg, now)
+	}
+
+	return msg
+}
+
+// sign appends a TSIG record to msg
+func (u *RFC2136) sign(msg []byte, now time.Time) []byte {
+	timeSigned := make([]byte, 6)
+	signed := uint64(now.Unix())
+	binary.BigEndian.PutUint16(timeSigned, uint16(signed>>32))
+	binary.BigEndian.PutUint32(timeSigned[2:], uint32(signed))
+
+	// TSIG variables, RFC 8945 section 4.3.3
+	vars := packName(u.TSIGName)
+	vars = appendUint16(vars, dnsClassANY)
+	vars = append(vars, 0, 0, 0, 0) // TTL
+	vars = append(vars, packName(u.TSIGAlgorithm)...)
+	vars = append(vars, timeSigned...)
+	vars = appendUint16(vars, tsigFudge, 0, 0) // fudge, error, other len
+
+	mac := hmac.New(tsigAlgorithms[u.TSIGAlgorithm], u.tsigSecret)
+	mac.Write(msg)
+	mac.Write(vars)
+	sum := mac.Sum(nil)
+
+	rdata := packName(u.TSIGAlgorithm)
+	rdata = append(rdata, timeSigned...)
+	rdata = appendUint16(rdata, tsigFudge, uint16(len(sum)))
+	rdata = append(rdata, sum...)
+	rdata = append(rdata, msg[0], msg[1]) // original ID
+	rdata = appendUint16(rdata, 0, 0)     // error, other len
+
+	signedMsg := appendRR(append([]byte{}, msg...), u.TSIGName, dnsTypeTSIG, dnsClassANY, 0, rdata)
+	binary.BigEndian.PutUint16(signedMsg[10:], binary.BigEndian.Uint16(msg[10:])+1)
+
+	return signedMsg
+}
+
+func exchange(ctx context.Context, network, server string, msg []byte) ([]byte, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(10 * time.Second)
+	}
+	conn.SetDeadline(deadline)
+
+	if network == "tcp" {
+		if _, err := conn.Write(appendUint16(nil, uint16(len(msg)))); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := conn.Write(msg); err != nil {
+		return nil, err
+	}
+
+	var resp []byte
+	if network == "tcp" {
+		size := make([]byte, 2)
+		if _, err := io.ReadFull(conn, size); err != nil {
+			return nil, err
+		}
+		resp = make([]byte, binary.BigEndian.Uint16(size))
+		if _, err := io.ReadFull(conn, resp); err != nil {
+			return nil, err
+		}
+	} else {
+		resp = make([]byte, 512)
+		n, err := conn.Read(resp)
+		if err != nil {
+			return nil, err
+		}
+		resp = resp[:n]
+	}
+
+	if len(resp) < 12 {
+		return nil, errors.New("DNS response is too short")
+	}
+
+	return resp, nil
+}
+
+// packName encodes a domain name without compression
+func packName(name string) []byte {
+	var b []byte
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if len(label) == 0 {
+			continue
+		}
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0)
+}
+
+func appendUint16(b []byte, values ...uint16) []byte {
+	for _, v := range values {
+		b = append(b, byte(v>>8), byte(v))
+	}
+	return b
+}
+
+func appendRR(b []byte, name string, rtype, class uint16, ttl uint32, rdata []byte) []byte {
+	b = append(b, packName(name)...)
+	b = appendUint16(b, rtype, class)
+	b = append(b, byte(ttl>>24), byte(ttl>>16), byte(ttl>>8), byte(ttl))
+	b = appendUint16(b, uint16(len(rdata)))
+	return append(b, rdata...)
+}
@@ -0,0 +1,164 @@
+package dnsupdate
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDNSServer is a stand-in of a DNS server accepting dynamic updates
+type fakeDNSServer struct {
+	sync.Mutex
+	conn     net.PacketConn
+	rcode    byte
+	messages [][]byte
+}
+
+func newFakeDNSServer(t *testing.T, rcode byte) *fakeDNSServer {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &fakeDNSServer{conn: conn, rcode: rcode}
+	go server.serve()
+	return server
+}
+
+func (s *fakeDNSServer) serve() {
+	buf := make([]byte, 1024)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		msg := append([]byte{}, buf[:n]...)
+		s.Lock()
+		s.messages = append(s.messages, msg)
+		s.Unlock()
+
+		resp := make([]byte, 12)
+		copy(resp, msg[:2])
+		resp[2] = 0x80 | msg[2]&0x78 // QR and opcode
+		resp[3] = s.rcode
+		s.conn.WriteTo(resp, addr)
+	}
+}
+
+func (s *fakeDNSServer) lastMessage() []byte {
+	s.Lock()
+	defer s.Unlock()
+	return s.messages[len(s.messages)-1]
+}
+
+func TestRFC2136_Update(t *testing.T) {
+	server := newFakeDNSServer(t, 0)
+	defer server.conn.Close()
+
+	u := NewRFC2136(server.conn.LocalAddr().String(), "example.org", "app.example.org", 60, "", "", "")
+
+	if err := u.Update(context.Background(), "10.0.0.5"); err != nil {
+		t.Fatalf("RFC2136.Update returned unexpected error: %v", err)
+	}
+
+	msg := server.lastMessage()
+
+	if opcode := msg[2] >> 3 & 0x0f; opcode != dnsOpcodeUpdate {
+		t.Errorf("RFC2136.Update sent opcode %d, want %d", opcode, dnsOpcodeUpdate)
+	}
+
+	if updates := binary.BigEndian.Uint16(msg[8:]); updates != 4 {
+		t.Errorf("RFC2136.Update sent %d updates, want %d", updates, 4)
+	}
+
+	if !bytes.Contains(msg, packName("example.org.")) {
+		t.Error("RFC2136.Update sent no zone")
+	}
+
+	add := appendRR(nil, "app.example.org.", dnsTypeA, dnsClassIN, 60, []byte{10, 0, 0, 5})
+	if !bytes.HasSuffix(msg, add) {
+		t.Errorf("RFC2136.Update sent %x, want suffix %x", msg, add)
+	}
+}
+
+func TestRFC2136_UpdateRefused(t *testing.T) {
+	server := newFakeDNSServer(t, 5)
+	defer server.conn.Close()
+
+	u := NewRFC2136(server.conn.LocalAddr().String(), "example.org", "app.example.org", 60, "", "", "")
+
+	err := u.Update(context.Background(), "10.0.0.5")
+	if err == nil || err.Error() != "DNS update of app.example.org. failed: REFUSED" {
+		t.Errorf("RFC2136.Update returned %v, want REFUSED error", err)
+	}
+}
+
+func TestRFC2136_TSIG(t *testing.T) {
+	secret := []byte("0123456789abcdef")
+	u := NewRFC2136("127.0.0.1", "example.org", "app.example.org", 60, "go-sleep", base64.StdEncoding.EncodeToString(secret), "")
+	now := time.Unix(1500000000, 0)
+
+	msg := u.message("app.example.com", now)
+
+	if arcount := binary.BigEndian.Uint16(msg[10:]); arcount != 1 {
+		t.Fatalf("RFC2136.message has %d additional records, want 1", arcount)
+	}
+
+	start := bytes.LastIndex(msg, append(packName("go-sleep."), 0, dnsTypeTSIG))
+	if start < 0 {
+		t.Fatal("RFC2136.message has no TSIG record")
+	}
+
+	unsigned := append([]byte{}, msg[:start]...)
+	binary.BigEndian.PutUint16(unsigned[10:], 0)
+
+	rdata := msg[start+len(packName("go-sleep."))+10:]
+	alg := packName("hmac-sha256.")
+	if !bytes.HasPrefix(rdata, alg) {
+		t.Fatalf("TSIG algorithm is %x, want %x", rdata[:len(alg)], alg)
+	}
+	timeSigned := rdata[len(alg) : len(alg)+6]
+	macSize := binary.BigEndian.Uint16(rdata[len(alg)+8:])
+	mac := rdata[len(alg)+10 : len(alg)+10+int(macSize)]
+
+	vars := append(packName("go-sleep."), 0, dnsClassANY, 0, 0, 0, 0)
+	vars = append(vars, alg...)
+	vars = append(vars, timeSigned...)
+	vars = append(vars, 1, 44, 0, 0, 0, 0)
+
+	h := hmac.New(sha256.New, secret)
+	h.Write(unsigned)
+	h.Write(vars)
+	if !hmac.Equal(mac, h.Sum(nil)) {
+		t.Error("TSIG MAC is invalid")
+	}
+
+	if !bytes.Contains(msg, appendRR(nil, "app.example.org.", dnsTypeCNAME, dnsClassIN, 60, packName("app.example.com."))) {
+		t.Error("RFC2136.message has no CNAME record")
+	}
+}
+
+func TestRecordType(t *testing.T) {
+	var recordTable = []struct {
+		in  string
+		out string
+	}{
+		{"10.0.0.1", TypeA},
+		{"2600:1f14::1", TypeAAAA},
+		{"go-sleep.example.org", TypeCNAME},
+	}
+
+	for _, test := range recordTable {
+		if s := RecordType(test.in); s != test.out {
+			t.Errorf("RecordType(%q) is %v, want %v", test.in, s, test.out)
+		}
+	}
+}
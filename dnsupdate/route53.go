@@ -0,0 +1,91 @@
+package dnsupdate
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/route53"
+
+	"github.com/silentsokolov/go-sleep/log"
+)
+
+// Route53 updates a record of a Route 53 hosted zone
+type Route53 struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	ZoneID          string
+	Name            string
+	TTL             int64
+	route53Service  *route53.Route53
+}
+
+// NewRoute53 ..
+func NewRoute53(AccessKeyID, SecretAccessKey, ZoneID, Name string, TTL int64) *Route53 {
+	config := aws.NewConfig().WithCredentials(credentials.NewStaticCredentials(AccessKeyID, SecretAccessKey, ""))
+	session, err := session.NewSession(config)
+	if err != nil {
+		log.Fatalf("Route 53 %s: Unable to session: %v", Name, err)
+	}
+
+	return &Route53{
+		AccessKeyID:     AccessKeyID,
+		SecretAccessKey: SecretAccessKey,
+		ZoneID:          ZoneID,
+		Name:            fqdn(Name),
+		TTL:             TTL,
+		route53Service:  route53.New(session),
+	}
+}
+
+// String ...
+func (u *Route53) String() string {
+	return fmt.Sprintf("[Route 53] %s in %s", u.Name, u.ZoneID)
+}
+
+// Update ...
+func (u *Route53) Update(ctx context.Context, target string) error {
+	recordType := RecordType(target)
+
+	// records of other types must be deleted, e.g. a CNAME can't coexist with A
+	list, err := u.route53Service.ListResourceRecordSetsWithContext(ctx, &route53.ListResourceRecordSetsInput{
+		HostedZoneId:    aws.String(u.ZoneID),
+		StartRecordName: aws.String(u.Name),
+		MaxItems:        aws.String("10"),
+	})
+	if err != nil {
+		return err
+	}
+
+	var changes []*route53.Change
+	for _, set := range list.ResourceRecordSets {
+		setType := aws.StringValue(set.Type)
+		if aws.StringValue(set.Name) != u.Name || setType == recordType {
+			continue
+		}
+		if setType == TypeA || setType == TypeAAAA || setType == TypeCNAME {
+			changes = append(changes, &route53.Change{Action: aws.String(route53.ChangeActionDelete), ResourceRecordSet: set})
+		}
+	}
+
+	changes = append(changes, &route53.Change{
+		Action: aws.String(route53.ChangeActionUpsert),
+		ResourceRecordSet: &route53.ResourceRecordSet{
+			Name:            aws.String(u.Name),
+			Type:            aws.String(recordType),
+			TTL:             aws.Int64(u.TTL),
+			ResourceRecords: []*route53.ResourceRecord{{Value: aws.String(recordValue(target, recordType))}},
+		},
+	})
+
+	_, err = u.route53Service.ChangeResourceRecordSetsWithContext(ctx, &route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(u.ZoneID),
+		ChangeBatch: &route53.ChangeBatch{
+			Comment: aws.String("go-sleep"),
+			Changes: changes,
+		},
+	})
+	return err
+}
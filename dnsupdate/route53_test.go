@@ -0,0 +1,74 @@
+package dnsupdate
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/awstesting/unit"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+var exampleListResourceRecordSetsResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<ListResourceRecordSetsResponse xmlns="https://route53.amazonaws.com/doc/2013-04-01/">
+	<ResourceRecordSets>
+		<ResourceRecordSet>
+			<Name>app.example.org.</Name>
+			<Type>CNAME</Type>
+			<TTL>60</TTL>
+			<ResourceRecords><ResourceRecord><Value>go-sleep.example.org.</Value></ResourceRecord></ResourceRecords>
+		</ResourceRecordSet>
+		<ResourceRecordSet>
+			<Name>db.example.org.</Name>
+			<Type>A</Type>
+			<TTL>60</TTL>
+			<ResourceRecords><ResourceRecord><Value>10.0.0.9</Value></ResourceRecord></ResourceRecords>
+		</ResourceRecordSet>
+	</ResourceRecordSets>
+	<IsTruncated>false</IsTruncated>
+	<MaxItems>10</MaxItems>
+</ListResourceRecordSetsResponse>`
+
+var exampleChangeResourceRecordSetsResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<ChangeResourceRecordSetsResponse xmlns="https://route53.amazonaws.com/doc/2013-04-01/">
+	<ChangeInfo><Id>/change/C1</Id><Status>PENDING</Status></ChangeInfo>
+</ChangeResourceRecordSetsResponse>`
+
+func TestRoute53_Update(t *testing.T) {
+	var change string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			body, _ := ioutil.ReadAll(r.Body)
+			change = string(body)
+			w.Write([]byte(exampleChangeResourceRecordSetsResponse))
+			return
+		}
+		w.Write([]byte(exampleListResourceRecordSetsResponse))
+	}))
+	defer server.Close()
+
+	u := &Route53{
+		ZoneID:         "Z1",
+		Name:           "app.example.org.",
+		TTL:            60,
+		route53Service: route53.New(unit.Session, &aws.Config{Endpoint: aws.String(server.URL + "/")}),
+	}
+
+	if err := u.Update(context.Background(), "10.0.0.5"); err != nil {
+		t.Fatalf("Route53.Update returned unexpected error: %v", err)
+	}
+
+	for _, s := range []string{"<Action>DELETE</Action>", "<Type>CNAME</Type>", "<Action>UPSERT</Action>", "<Value>10.0.0.5</Value>"} {
+		if !strings.Contains(change, s) {
+			t.Errorf("Route53.Update sent %s, want %s", change, s)
+		}
+	}
+
+	if strings.Contains(change, "db.example.org.") {
+		t.Error("Route53.Update deleted a record of another name")
+	}
+}
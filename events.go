@@ -0,0 +1,129 @@
+package main
+
+import (
+	"time"
+
+	"github.com/silentsokolov/go-sleep/provider"
+)
+
+// Lifecycle events of an instance
+const (
+	EventWakeRequested = "wake_requested"
+	EventRunning       = "running"
+	EventHealthPassed  = "health_passed"
+	EventSleeping      = "sleeping"
+	EventStopped       = "stopped"
+	EventError         = "error"
+	EventBootFailed    = "boot_failed"
+)
+
+var allEvents = []string{EventWakeRequested, EventRunning, EventHealthPassed, EventSleeping, EventStopped, EventError, EventBootFailed}
+
+// historySize is the number of recent events kept per instance
+const historySize = 100
+
+// Event is a lifecycle event of an instance
+type Event struct {
+	Event    string    `json:"event"`
+	Instance string    `json:"instance"`
+	Provider string    `json:"provider"`
+	Hostname string    `json:"hostname,omitempty"`
+	User     string    `json:"user,omitempty"`
+	Duration float64   `json:"duration,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// OnEvent registers fn to call on lifecycle events
+func (instance *ComputeInstance) OnEvent(fn func(Event)) {
+	instance.Lock()
+	defer instance.Unlock()
+	instance.eventHandlers = append(instance.eventHandlers, fn)
+}
+
+// emit records the event in history and calls event handlers, duration is
+// the time spent for the event, e.g. from the wake request till running
+func (instance *ComputeInstance) emit(name string, duration time.Duration) {
+	instance.emitError(name, duration, nil)
+}
+
+// emitError emits the event with err, the last error of the instance by default
+func (instance *ComputeInstance) emitError(name string, duration time.Duration, err error) {
+	instance.Lock()
+	event := Event{
+		Event:    name,
+		Instance: instance.Provider.Hash(),
+		Provider: instance.Provider.String(),
+		Hostname: instance.wakeHost,
+		User:     instance.wakeUser,
+		Duration: duration.Seconds(),
+		Time:     time.Now(),
+	}
+	if err == nil {
+		err = instance.lastError
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	instance.history = append(instance.history, event)
+	if len(instance.history) > historySize {
+		instance.history = instance.history[len(instance.history)-historySize:]
+	}
+	handlers := instance.eventHandlers
+	instance.Unlock()
+
+	for _, fn := range handlers {
+		fn(event)
+	}
+}
+
+// emitStatus emits the event of status
+func (instance *ComputeInstance) emitStatus(status provider.StatusInstance) {
+	instance.RLock()
+	wakeRequest, stopRequest := instance.wakeRequest, instance.stopRequest
+	if wakeRequest.IsZero() {
+		wakeRequest = instance.startRequest
+	}
+	instance.RUnlock()
+
+	switch status {
+	case provider.StatusInstanceRunning:
+		instance.emit(EventRunning, since(wakeRequest))
+	case provider.StatusInstanceNotRun:
+		instance.emit(EventStopped, since(stopRequest))
+	case provider.StatusInstanceError:
+		instance.emit(EventError, 0)
+	}
+}
+
+// History returns recent events of the instance, oldest first
+func (instance *ComputeInstance) History() []Event {
+	instance.RLock()
+	defer instance.RUnlock()
+	return append([]Event{}, instance.history...)
+}
+
+// RequestStart starts the instance on behalf of a client of hostname
+func (instance *ComputeInstance) RequestStart(hostname, user string) {
+	instance.Lock()
+	first := instance.wakeRequest.IsZero()
+	if first {
+		instance.wakeRequest = time.Now()
+		instance.wakeHost = hostname
+		instance.wakeUser = user
+	}
+	instance.Unlock()
+
+	if first {
+		instance.emit(EventWakeRequested, 0)
+	}
+
+	instance.Start()
+}
+
+func since(t time.Time) time.Duration {
+	if t.IsZero() {
+		return 0
+	}
+	return time.Since(t)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/silentsokolov/go-sleep/provider"
+)
+
+func TestComputeInstance_emit(t *testing.T) {
+	ci := NewComputeInstance(newDummyProvider("test", false), time.Duration(100)*time.Second)
+	ci.SetStatus(provider.StatusInstanceNotRun)
+	ci.Reset()
+
+	var events []Event
+	ci.OnEvent(func(e Event) { events = append(events, e) })
+
+	ci.RequestStart("app.example.org", "alice")
+	ci.RequestStart("app.example.org", "bob")
+	<-ci.statusChan
+	<-ci.statusChan
+
+	ci.SetStatus(provider.StatusInstanceRunning)
+	ci.SetHTTPHealth()
+	ci.SetHTTPHealth()
+	ci.SetError(errors.New("quota exceeded"))
+	ci.SetStatus(provider.StatusInstanceError)
+
+	var names []string
+	for _, e := range events {
+		names = append(names, e.Event)
+	}
+
+	want := []string{EventWakeRequested, EventRunning, EventHealthPassed, EventError}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("ComputeInstance emitted %v, want %v", names, want)
+	}
+
+	if events[1].User != "alice" || events[1].Hostname != "app.example.org" || events[1].Instance != "dummy-test" {
+		t.Errorf("ComputeInstance emitted %+v, want user alice via app.example.org", events[1])
+	}
+
+	if events[3].Error != "quota exceeded" {
+		t.Errorf("ComputeInstance emitted error %q, want %q", events[3].Error, "quota exceeded")
+	}
+}
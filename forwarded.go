@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// forwardedKey is the context key of the forwarded client of a request
+type forwardedKey struct{}
+
+// forwardedClient is the client of a request behind trusted proxies
+type forwardedClient struct {
+	IP    string
+	Proto string
+}
+
+// trustedProxies are networks of proxies whose Forwarded, X-Forwarded-*
+// and PROXY protocol headers are trusted
+type trustedProxies []*net.IPNet
+
+// parseTrustedProxies parses CIDRs and IP addresses
+func parseTrustedProxies(values []string) (trustedProxies, error) {
+	var proxies trustedProxies
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q, want CIDR or IP address", value)
+			}
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q, want CIDR or IP address", value)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+// contains reports whether ip is an address of a trusted proxy
+func (proxies trustedProxies) contains(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range proxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeHost returns the lowercased hostname of a Host header without
+// the port, the trailing dot and brackets of IPv6 literals
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	} else if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		host = host[1 : len(host)-1]
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// addrIP returns the IP of a host:port or an IP address
+func addrIP(addr string) net.IP {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	return net.ParseIP(strings.Trim(addr, "[]"))
+}
+
+// forwardedHop is an element of the Forwarded header
+type forwardedHop struct {
+	For   string
+	Proto string
+}
+
+// parseForwarded parses Forwarded header values of RFC 7239
+func parseForwarded(values []string) []forwardedHop {
+	var hops []forwardedHop
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			var hop forwardedHop
+			for _, pair := range strings.Split(element, ";") {
+				split := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+				if len(split) != 2 {
+					continue
+				}
+				v := strings.Trim(split[1], `"`)
+				switch strings.ToLower(split[0]) {
+				case "for":
+					hop.For = v
+				case "proto":
+					hop.Proto = strings.ToLower(v)
+				}
+			}
+			hops = append(hops, hop)
+		}
+	}
+	return hops
+}
+
+// headerList returns comma separated values of the header key
+func headerList(header http.Header, key string) []string {
+	var list []string
+	for _, value := range header[key] {
+		for _, item := range strings.Split(value, ",") {
+			list = append(list, strings.TrimSpace(item))
+		}
+	}
+	return list
+}
+
+// forwardedFor returns the client of r: hops of the Forwarded header, or
+// X-Forwarded-For, are walked from the peer while they are trusted
+func (proxies trustedProxies) forwardedFor(r *http.Request) forwardedClient {
+	client := forwardedClient{IP: r.RemoteAddr, Proto: "http"}
+	if r.TLS != nil {
+		client.Proto = "https"
+	}
+	if ip := addrIP(r.RemoteAddr); ip != nil {
+		client.IP = ip.String()
+	}
+
+	if !proxies.contains(addrIP(r.RemoteAddr)) {
+		return client
+	}
+
+	var hops []forwardedHop
+	if _, ok := r.Header["Forwarded"]; ok {
+		hops = parseForwarded(r.Header["Forwarded"])
+	} else {
+		for _, ip := range headerList(r.Header, "X-Forwarded-For") {
+			hops = append(hops, forwardedHop{For: ip})
+		}
+		// X-Forwarded-Proto is set by the first proxy
+		if protos := headerList(r.Header, "X-Forwarded-Proto"); len(protos) > 0 {
+			if proto := strings.ToLower(protos[0]); proto == "http" || proto == "https" {
+				client.Proto = proto
+			}
+		}
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := addrIP(hops[i].For)
+		if ip == nil {
+			// unknown or obfuscated hops end the chain
+			break
+		}
+		client.IP = ip.String()
+		if hops[i].Proto == "http" || hops[i].Proto == "https" {
+			client.Proto = hops[i].Proto
+		}
+		if !proxies.contains(ip) {
+			break
+		}
+	}
+
+	return client
+}
+
+// middlewareForwarded sets the forwarded client of a request, forwarding
+// headers of untrusted peers are removed
+func (server *Server) middlewareForwarded(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !server.trustedProxies.contains(addrIP(r.RemoteAddr)) {
+			for _, key := range []string{"Forwarded", "X-Forwarded-For", "X-Forwarded-Proto", "X-Forwarded-Host"} {
+				r.Header.Del(key)
+			}
+		}
+
+		client := server.trustedProxies.forwardedFor(r)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), forwardedKey{}, client)))
+	})
+}
+
+// requestClient returns the forwarded client of r, or its peer
+func requestClient(r *http.Request) forwardedClient {
+	if client, ok := r.Context().Value(forwardedKey{}).(forwardedClient); ok {
+		return client
+	}
+	return trustedProxies(nil).forwardedFor(r)
+}
+
+// setForwarded sets forwarding headers of a request to a backend, the peer
+// is appended to X-Forwarded-For by the reverse proxy
+func setForwarded(r *http.Request, client forwardedClient) {
+	r.Header.Set("X-Forwarded-Proto", client.Proto)
+	if len(r.Header.Get("X-Forwarded-Host")) == 0 {
+		r.Header.Set("X-Forwarded-Host", r.Host)
+	}
+
+	peer := "unknown"
+	if ip := addrIP(r.RemoteAddr); ip != nil {
+		peer = ip.String()
+		if ip.To4() == nil {
+			peer = `"[` + peer + `]"`
+		}
+	}
+	proto := "http"
+	if r.TLS != nil {
+		proto = "https"
+	}
+	hop := fmt.Sprintf("for=%s;host=%q;proto=%s", peer, r.Host, proto)
+	if _, ok := r.Header["Forwarded"]; ok {
+		hop = strings.Join(r.Header["Forwarded"], ", ") + ", " + hop
+	}
+	r.Header.Set("Forwarded", hop)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNormalizeHost(t *testing.T) {
+	var hostTable = []struct {
+		in  string
+		out string
+	}{
+		{"example.com:80", "example.com"},
+		{"example.com", "example.com"},
+		{"Example.COM.", "example.com"},
+		{"[2001:db8::1]:8080", "2001:db8::1"},
+		{"[2001:db8::1]", "2001:db8::1"},
+		{"10.0.0.1", "10.0.0.1"},
+		{"", ""},
+	}
+
+	for _, test := range hostTable {
+		if host := normalizeHost(test.in); host != test.out {
+			t.Errorf("normalizeHost(%q) returned %q, want %q", test.in, host, test.out)
+		}
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies, err := parseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1", "2001:db8::/32"})
+	if err != nil {
+		t.Fatalf("parseTrustedProxies returned unexpected error: %v", err)
+	}
+
+	var ipTable = []struct {
+		ip      string
+		trusted bool
+	}{
+		{"10.1.2.3", true},
+		{"192.168.1.1", true},
+		{"192.168.1.2", false},
+		{"2001:db8::5", true},
+		{"2001:db9::5", false},
+	}
+
+	for _, test := range ipTable {
+		if trusted := proxies.contains(addrIP(test.ip)); trusted != test.trusted {
+			t.Errorf("trustedProxies.contains(%s) returned %v, want %v", test.ip, trusted, test.trusted)
+		}
+	}
+
+	for _, value := range []string{"10.0.0.0/33", "proxy.example.com"} {
+		if _, err := parseTrustedProxies([]string{value}); err == nil {
+			t.Errorf("parseTrustedProxies(%q) returned no error", value)
+		}
+	}
+}
+
+func TestTrustedProxies_forwardedFor(t *testing.T) {
+	proxies, _ := parseTrustedProxies([]string{"10.0.0.0/8", "2001:db8::/32"})
+
+	var forwardedTable = []struct {
+		remote string
+		header http.Header
+		client forwardedClient
+	}{
+		{"203.0.113.7:5000", http.Header{}, forwardedClient{"203.0.113.7", "http"}},
+		{"203.0.113.7:5000", http.Header{"X-Forwarded-For": {"198.51.100.1"}}, forwardedClient{"203.0.113.7", "http"}},
+		{"10.0.0.2:5000", http.Header{"X-Forwarded-For": {"198.51.100.1"}, "X-Forwarded-Proto": {"https"}}, forwardedClient{"198.51.100.1", "https"}},
+		{"10.0.0.2:5000", http.Header{"X-Forwarded-For": {"1.1.1.1, 198.51.100.1, 10.0.0.3"}}, forwardedClient{"198.51.100.1", "http"}},
+		{"10.0.0.2:5000", http.Header{"X-Forwarded-For": {"10.0.0.4", "10.0.0.3"}}, forwardedClient{"10.0.0.4", "http"}},
+		{"10.0.0.2:5000", http.Header{"Forwarded": {`for=198.51.100.1;proto=https, for="[2001:db8::1]:4711"`}, "X-Forwarded-For": {"1.1.1.1"}}, forwardedClient{"198.51.100.1", "https"}},
+		{"[2001:db8::2]:5000", http.Header{"Forwarded": {`for="[2001:db9::1]"`}}, forwardedClient{"2001:db9::1", "http"}},
+		{"10.0.0.2:5000", http.Header{"Forwarded": {"for=unknown, for=10.0.0.3"}}, forwardedClient{"10.0.0.3", "http"}},
+	}
+
+	for _, test := range forwardedTable {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = test.remote
+		r.Header = test.header
+
+		if client := proxies.forwardedFor(r); client != test.client {
+			t.Errorf("forwardedFor(%s, %v) returned %+v, want %+v", test.remote, test.header, client, test.client)
+		}
+	}
+}
+
+func TestServer_middlewareForwarded(t *testing.T) {
+	server := NewServer(&Config{})
+	defer server.Close()
+	server.trustedProxies, _ = parseTrustedProxies([]string{"10.0.0.0/8"})
+
+	var client forwardedClient
+	var header http.Header
+	handler := server.middlewareForwarded(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client = requestClient(r)
+		header = r.Header
+	}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "203.0.113.7:5000"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+	r.Header.Set("Forwarded", "for=198.51.100.1")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	if client.IP != "203.0.113.7" {
+		t.Errorf("middlewareForwarded set client %s, want 203.0.113.7", client.IP)
+	}
+	if len(header.Get("X-Forwarded-For")) > 0 || len(header.Get("Forwarded")) > 0 {
+		t.Errorf("middlewareForwarded kept headers of an untrusted peer: %v", header)
+	}
+}
+
+func TestSetForwarded(t *testing.T) {
+	r := httptest.NewRequest("GET", "http://app.example.com/", nil)
+	r.RemoteAddr = "[2001:db8::2]:5000"
+	r.Header.Set("Forwarded", "for=198.51.100.1;proto=https")
+
+	setForwarded(r, forwardedClient{"198.51.100.1", "https"})
+
+	var headerTable = []struct {
+		key   string
+		value string
+	}{
+		{"X-Forwarded-Proto", "https"},
+		{"X-Forwarded-Host", "app.example.com"},
+		{"Forwarded", `for=198.51.100.1;proto=https, for="[2001:db8::2]";host="app.example.com";proto=http`},
+	}
+
+	for _, test := range headerTable {
+		if value := r.Header.Get(test.key); value != test.value {
+			t.Errorf("setForwarded set %s to %s, want %s", test.key, value, test.value)
+		}
+	}
+}
+
+func TestServer_middlewareAuth_hostWithoutPort(t *testing.T) {
+	server := NewServer(&Config{})
+	defer server.Close()
+
+	instance := NewComputeInstance(newDummyProvider("test", false), time.Minute)
+	server.InstanceStore.Set(instance.Hash(), instance)
+	server.buildServerRoutes([]*RouteConfig{{Address: ":80", Hostnames: []string{"App.example.com"}}}, instance.Hash(), nil)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := server.middlewareAuth(server.middlewareWakeup(next, ":80"), ":80")
+
+	for _, host := range []string{"app.example.com", "APP.example.com.:80", "[2001:db8::1]"} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Host = host
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		want := http.StatusOK
+		if host == "[2001:db8::1]" {
+			want = http.StatusNotFound
+		}
+		if w.Code != want {
+			t.Errorf("GET %s returned status %d, want %d", host, w.Code, want)
+		}
+	}
+}
+
+func TestCheckConfig_proxies(t *testing.T) {
+	dir, err := ioutil.TempDir("", "check")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeCheckFile(t, dir, "config.toml", []byte(`
+trusted_proxies = ["10.0.0.0/8", "lb.example.com"]
+
+[[ec2]]
+  [[ec2.route]]
+  hostnames = ["example.com"]
+  proxy_protocol = true
+  backend_proxy_protocol = "v3"
+`))
+
+	problems, err := checkConfig(path, false)
+	if err != nil {
+		t.Fatalf("checkConfig returned unexpected error: %v", err)
+	}
+
+	want := []Problem{
+		{File: path, Line: 2, Message: `invalid trusted proxy "lb.example.com"`},
+		{File: path, Line: 8, Message: `unknown backend_proxy_protocol "v3"`},
+	}
+	if len(problems) != len(want) {
+		t.Fatalf("checkConfig returned %v, want %v", problems, want)
+	}
+	for i, p := range problems {
+		if p.File != want[i].File || p.Line != want[i].Line || !strings.Contains(p.Message, want[i].Message) {
+			t.Errorf("checkConfig returned %v, want %v", p, want[i])
+		}
+	}
+}
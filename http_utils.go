@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"html/template"
 	"net/http"
@@ -25,7 +26,7 @@ var (
 )
 
 func loadTemplates() {
-	filenames := []string{"wait.html"}
+	filenames := []string{"wait.html", "banner.html", "not_found.html"}
 
 	for _, filename := range filenames {
 		name := filepath.Base(filename)
@@ -37,6 +38,19 @@ func loadTemplates() {
 	}
 }
 
+// renderTemplate executes the template nameTmp into a buffer
+func renderTemplate(nameTmp string, context interface{}) ([]byte, error) {
+	if len(templates) == 0 {
+		loadTemplates()
+	}
+
+	var buf bytes.Buffer
+	if err := templates[nameTmp].Execute(&buf, context); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
 func responseJSON(w http.ResponseWriter, status int, context interface{}) {
 	w.WriteHeader(status)
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/silentsokolov/go-sleep/log"
+)
+
+// keepAwakeHeader acquires a lease on the instance of a proxied request,
+// the value is "name=<name>; ttl=<seconds>; key=<secret_key>"
+const keepAwakeHeader = "X-Go-Sleep-Keep-Awake"
+
+const (
+	defaultLeaseName = "default"
+	defaultLeaseTTL  = time.Hour
+)
+
+// Lease keeps an instance awake until it expires or is revoked
+type Lease struct {
+	Name      string    `json:"name"`
+	Holder    string    `json:"holder,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// AcquireLease creates or renews the lease name for ttl
+func (instance *ComputeInstance) AcquireLease(name, holder string, ttl time.Duration) Lease {
+	instance.Lock()
+	defer instance.Unlock()
+
+	if instance.leases == nil {
+		instance.leases = make(map[string]Lease)
+	}
+
+	lease := Lease{Name: name, Holder: holder, ExpiresAt: time.Now().Add(ttl)}
+	instance.leases[name] = lease
+
+	log.Printf("Lease %q on %s acquired until %s", name, instance.Provider, lease.ExpiresAt.Format(time.RFC3339))
+
+	return lease
+}
+
+// RevokeLease removes the lease name and reports whether it was live
+func (instance *ComputeInstance) RevokeLease(name string) bool {
+	instance.Lock()
+	defer instance.Unlock()
+
+	lease, ok := instance.leases[name]
+	delete(instance.leases, name)
+
+	if ok && time.Now().Before(lease.ExpiresAt) {
+		log.Printf("Lease %q on %s revoked", name, instance.Provider)
+		return true
+	}
+	return false
+}
+
+// Leases returns live leases sorted by name, expired ones are dropped
+func (instance *ComputeInstance) Leases() []Lease {
+	instance.Lock()
+	defer instance.Unlock()
+
+	now := time.Now()
+	leases := make([]Lease, 0, len(instance.leases))
+	for name, lease := range instance.leases {
+		if now.Before(lease.ExpiresAt) {
+			leases = append(leases, lease)
+		} else {
+			delete(instance.leases, name)
+		}
+	}
+
+	sort.Slice(leases, func(i, j int) bool { return leases[i].Name < leases[j].Name })
+	return leases
+}
+
+// leaseExpiry returns the time the last live lease expires
+func (instance *ComputeInstance) leaseExpiry() time.Time {
+	var expiry time.Time
+	for _, lease := range instance.Leases() {
+		if lease.ExpiresAt.After(expiry) {
+			expiry = lease.ExpiresAt
+		}
+	}
+	return expiry
+}
+
+// HasLeases reports whether the instance has live leases
+func (instance *ComputeInstance) HasLeases() bool {
+	return len(instance.Leases()) > 0
+}
+
+// middlewareKeepAwake acquires the lease of keepAwakeHeader,
+// the header is never passed to the backend
+func (server *Server) middlewareKeepAwake(next http.Handler, address string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value := r.Header.Get(keepAwakeHeader)
+		if len(value) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		r.Header.Del(keepAwakeHeader)
+
+		name, ttl, key, err := parseKeepAwake(value)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if !server.validKey(key) {
+			log.Printf("Keep-awake of %s with invalid key", r.Host)
+			http.Error(w, "Invalid key", http.StatusForbidden)
+			return
+		}
+
+		_, computer, err := server.routeComputer(r.Host, address)
+		if err == nil {
+			computer.AcquireLease(name, requestClient(r).IP, ttl)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// parseKeepAwake parses the value of keepAwakeHeader
+func parseKeepAwake(value string) (string, time.Duration, string, error) {
+	name, ttl, key := defaultLeaseName, defaultLeaseTTL, ""
+
+	for _, param := range strings.Split(value, ";") {
+		param = strings.TrimSpace(param)
+		if len(param) == 0 {
+			continue
+		}
+
+		split := strings.SplitN(param, "=", 2)
+		if len(split) != 2 {
+			return "", 0, "", fmt.Errorf("Invalid %s parameter: %q", keepAwakeHeader, param)
+		}
+
+		switch strings.ToLower(strings.TrimSpace(split[0])) {
+		case "name":
+			name = strings.TrimSpace(split[1])
+		case "ttl":
+			seconds, err := strconv.ParseInt(strings.TrimSpace(split[1]), 10, 64)
+			if err != nil || seconds <= 0 {
+				return "", 0, "", fmt.Errorf("Invalid %s ttl: %q", keepAwakeHeader, split[1])
+			}
+			ttl = time.Duration(seconds) * time.Second
+		case "key":
+			key = strings.TrimSpace(split[1])
+		default:
+			return "", 0, "", fmt.Errorf("Unknown %s parameter: %q", keepAwakeHeader, split[0])
+		}
+	}
+
+	if len(name) == 0 {
+		return "", 0, "", fmt.Errorf("Empty %s name", keepAwakeHeader)
+	}
+
+	return name, ttl, key, nil
+}
+
+// validKey reports whether key matches secret_key, nothing matches an empty secret_key
+func (server *Server) validKey(key string) bool {
+	secretKey := server.backendKey()
+	return len(secretKey) > 0 && subtle.ConstantTimeCompare([]byte(key), []byte(secretKey)) == 1
+}
+
+// validAPIKey reports whether key is one of api_keys, secret_key is sent to
+// backends and so never authenticates the management API
+func (server *Server) validAPIKey(key string) bool {
+	server.keysMu.RLock()
+	apiKeys := server.apiKeys
+	server.keysMu.RUnlock()
+
+	for _, apiKey := range apiKeys {
+		if len(apiKey) > 0 && subtle.ConstantTimeCompare([]byte(key), []byte(apiKey)) == 1 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseKeepAwake(t *testing.T) {
+	var headerTable = []struct {
+		in   string
+		name string
+		ttl  time.Duration
+		key  string
+		err  bool
+	}{
+		{"key=secret", defaultLeaseName, defaultLeaseTTL, "secret", false},
+		{"name=backup; ttl=600; key=secret", "backup", 10 * time.Minute, "secret", false},
+		{" TTL = 60 ;name=job", "job", time.Minute, "", false},
+		{"ttl=-1; key=secret", "", 0, "", true},
+		{"ttl=soon", "", 0, "", true},
+		{"owner=me", "", 0, "", true},
+		{"secret", "", 0, "", true},
+		{"name=; key=secret", "", 0, "", true},
+	}
+
+	for _, test := range headerTable {
+		name, ttl, key, err := parseKeepAwake(test.in)
+		if (err != nil) != test.err {
+			t.Errorf("parseKeepAwake(%q) returned error %v, want error %v", test.in, err, test.err)
+			continue
+		}
+		if name != test.name || ttl != test.ttl || key != test.key {
+			t.Errorf("parseKeepAwake(%q) returned %q, %v, %q, want %q, %v, %q", test.in, name, ttl, key, test.name, test.ttl, test.key)
+		}
+	}
+}
+
+func TestComputeInstance_Leases(t *testing.T) {
+	instance := NewComputeInstance(newDummyProvider("test", false), time.Minute)
+
+	instance.AcquireLease("backup", "cron", time.Hour)
+	instance.AcquireLease("expired", "cron", -time.Second)
+
+	leases := instance.Leases()
+	if len(leases) != 1 || leases[0].Name != "backup" || leases[0].Holder != "cron" {
+		t.Errorf("ComputeInstance.Leases returned %+v, want only backup", leases)
+	}
+
+	if left := instance.SleepIn(); left < 59*time.Minute {
+		t.Errorf("ComputeInstance.SleepIn returned %v, want lease expiry", left)
+	}
+
+	if instance.RevokeLease("expired") {
+		t.Error("ComputeInstance.RevokeLease returned true for expired lease")
+	}
+
+	if !instance.RevokeLease("backup") {
+		t.Error("ComputeInstance.RevokeLease returned false for live lease")
+	}
+
+	if instance.HasLeases() {
+		t.Error("ComputeInstance.HasLeases returned true after revoke")
+	}
+}
+
+func TestServer_middlewareKeepAwake(t *testing.T) {
+	server := NewServer(&Config{})
+	defer server.Close()
+	server.secretKey = "secret"
+
+	instance := NewComputeInstance(newDummyProvider("test", false), time.Minute)
+	server.InstanceStore.Set(instance.Hash(), instance)
+	server.serverRoutes[":80"] = map[string]*serverRoute{
+		"app.example.org": {Hostname: "app.example.org", InstanceName: instance.Hash()},
+	}
+
+	var passed http.Header
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		passed = r.Header
+	})
+	handler := server.middlewareKeepAwake(next, ":80")
+
+	var headerTable = []struct {
+		in     string
+		status int
+		leases int
+	}{
+		{"name=job; key=wrong", http.StatusForbidden, 0},
+		{"name=job; ttl=0; key=secret", http.StatusBadRequest, 0},
+		{"name=job; ttl=600; key=secret", http.StatusOK, 1},
+	}
+
+	for _, test := range headerTable {
+		r := httptest.NewRequest(http.MethodGet, "http://app.example.org:80/", nil)
+		r.Header.Set(keepAwakeHeader, test.in)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.status {
+			t.Errorf("middlewareKeepAwake(%q) returned status %d, want %d", test.in, w.Code, test.status)
+		}
+		if leases := instance.Leases(); len(leases) != test.leases {
+			t.Errorf("middlewareKeepAwake(%q) acquired %+v, want %d leases", test.in, leases, test.leases)
+		}
+	}
+
+	if passed == nil || passed.Get(keepAwakeHeader) != "" {
+		t.Errorf("middlewareKeepAwake passed header %v to the backend", passed)
+	}
+}
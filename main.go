@@ -2,6 +2,7 @@ package main
 
 import (
 	"flag"
+	"os"
 	"strings"
 
 	"github.com/Sirupsen/logrus"
@@ -14,11 +15,24 @@ var (
 )
 
 func init() {
-	flag.StringVar(&configFilePath, "config", "config.toml", "filepath to config file")
+	flag.StringVar(&configFilePath, "config", "config.toml", "config file (TOML, YAML or JSON) or directory")
 }
 
 func main() {
 	flag.Parse()
+
+	if flag.Arg(0) == "check" {
+		check := flag.NewFlagSet("check", flag.ExitOnError)
+		check.StringVar(&configFilePath, "config", configFilePath, "config file (TOML, YAML or JSON) or directory")
+		providers := check.Bool("providers", false, "call each provider to check credentials")
+		check.Parse(flag.Args()[1:])
+		os.Exit(runCheck(os.Stdout, configFilePath, *providers))
+	}
+
+	if flag.Arg(0) == "ctl" {
+		os.Exit(runCtl(flag.Args()[1:], os.Stdout, os.Stderr))
+	}
+
 	config := loadConfig(configFilePath)
 
 	level, err := logrus.ParseLevel(strings.ToLower(config.LogLevel))
@@ -29,6 +43,7 @@ func main() {
 
 	server := NewServer(config)
 	server.loadConfig(config)
+	server.listenReload(configFilePath)
 	server.Start()
 
 	defer server.Close()
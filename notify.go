@@ -0,0 +1,535 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rsa"
+	_ "crypto/sha1" // SHA1 signatures of SNS messages
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/silentsokolov/go-sleep/log"
+	"github.com/silentsokolov/go-sleep/provider"
+)
+
+// notifyPrefix is the path prefix of cloud state-change notifications
+const notifyPrefix = "/notify/"
+
+const (
+	maxNotifyBody     = 1 << 20
+	ec2StateChange    = "EC2 Instance State-change Notification"
+	googleKeysTTL     = time.Hour
+	googleKeysRefresh = time.Minute
+)
+
+var (
+	// snsHost matches hosts of SNS signing certificates and subscribe URLs
+	snsHost = regexp.MustCompile(`^sns\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`)
+
+	googleCertsURL = "https://www.googleapis.com/oauth2/v3/certs"
+	googleIssuers  = map[string]bool{"accounts.google.com": true, "https://accounts.google.com": true}
+)
+
+// notifier verifies state-change notifications of clouds: SNS messages
+// by their signature and allowed topics, Pub/Sub pushes by the OIDC token
+// of the subscription service account
+type notifier struct {
+	sync.Mutex
+	snsTopics   map[string]bool
+	audience    string
+	account     string
+	client      *http.Client
+	certs       map[string]*x509.Certificate
+	keys        map[string]*rsa.PublicKey
+	keysFetched time.Time
+}
+
+func newNotifier(conf *NotifyConfig) *notifier {
+	if len(conf.PubSubAudience) > 0 && len(conf.PubSubAccount) == 0 {
+		log.Fatalf("Notify: pubsub_service_account is required with pubsub_audience")
+	}
+
+	n := &notifier{
+		snsTopics: make(map[string]bool),
+		audience:  conf.PubSubAudience,
+		account:   conf.PubSubAccount,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		certs:     make(map[string]*x509.Certificate),
+	}
+
+	for _, topic := range conf.SNSTopics {
+		n.snsTopics[topic] = true
+	}
+
+	return n
+}
+
+// Notify passes a status reported by a cloud to the monitor, the
+// notification is dropped when the monitor is behind, polling catches up
+func (instance *ComputeInstance) Notify(status provider.StatusInstance) {
+	select {
+	case instance.notifyChan <- status:
+	default:
+		log.Printf("Notification of %s dropped", instance.Provider)
+	}
+}
+
+// notifyHandler accepts state-change notifications of instances
+// started or stopped outside go-sleep
+func (server *Server) notifyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if server.notifier == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxNotifyBody))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var status int
+		switch strings.Trim(strings.TrimPrefix(r.URL.Path, notifyPrefix), "/") {
+		case "ec2":
+			status, err = server.notifyEC2(r, body)
+		case "gce":
+			status, err = server.notifyGCE(r, body)
+		default:
+			http.NotFound(w, r)
+			return
+		}
+
+		if err != nil {
+			log.Printf("Notification %s rejected: %s", r.URL.Path, err)
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		w.WriteHeader(status)
+	})
+}
+
+// notifyStatus passes status to the instance of hash, notifications
+// of unknown instances are acknowledged and ignored
+func (server *Server) notifyStatus(hash string, status provider.StatusInstance) {
+	instance, ok := server.InstanceStore.Get(hash)
+	if !ok {
+		log.Debugf("Notification of unknown instance %s", hash)
+		return
+	}
+	instance.Notify(status)
+}
+
+// snsMessage is an SNS HTTP(S) delivery
+type snsMessage struct {
+	Type             string
+	MessageID        string `json:"MessageId"`
+	Token            string
+	TopicArn         string
+	Subject          string
+	Message          string
+	Timestamp        string
+	SignatureVersion string
+	Signature        string
+	SigningCertURL   string
+	SubscribeURL     string
+}
+
+// ec2Event is an EventBridge event of an EC2 instance
+type ec2Event struct {
+	DetailType string `json:"detail-type"`
+	Region     string `json:"region"`
+	Detail     struct {
+		InstanceID string `json:"instance-id"`
+		State      string `json:"state"`
+	} `json:"detail"`
+}
+
+// notifyEC2 accepts EventBridge events delivered by an SNS topic,
+// or by an API destination with the X-Go-Sleep-Key header
+func (server *Server) notifyEC2(r *http.Request, body []byte) (int, error) {
+	event := body
+
+	if len(r.Header.Get("X-Amz-Sns-Message-Type")) > 0 {
+		msg := &snsMessage{}
+		if err := json.Unmarshal(body, msg); err != nil {
+			return http.StatusBadRequest, err
+		}
+
+		if err := server.notifier.verifySNS(msg); err != nil {
+			return http.StatusForbidden, err
+		}
+
+		switch msg.Type {
+		case "SubscriptionConfirmation":
+			if err := server.notifier.confirmSNS(msg); err != nil {
+				return http.StatusBadGateway, err
+			}
+			log.Printf("Subscribed to %s", msg.TopicArn)
+			return http.StatusOK, nil
+		case "Notification":
+			event = []byte(msg.Message)
+		default:
+			return http.StatusOK, nil
+		}
+	} else if !server.validAPIKey(r.Header.Get("X-Go-Sleep-Key")) {
+		return http.StatusUnauthorized, fmt.Errorf("Invalid key")
+	}
+
+	e := ec2Event{}
+	if err := json.Unmarshal(event, &e); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if e.DetailType != ec2StateChange || len(e.Detail.InstanceID) == 0 {
+		return http.StatusNoContent, nil
+	}
+
+	p := &provider.EC2{InstanceID: e.Detail.InstanceID, Region: e.Region}
+	server.notifyStatus(p.Hash(), provider.NormalizeEC2Status(e.Detail.State))
+	return http.StatusNoContent, nil
+}
+
+// pubsubPush is a Pub/Sub push delivery
+type pubsubPush struct {
+	Message struct {
+		Data []byte `json:"data"`
+	} `json:"message"`
+	Subscription string `json:"subscription"`
+}
+
+// gceAuditEntry is a Cloud Audit Logs entry of a Compute Engine operation
+type gceAuditEntry struct {
+	Severity     string `json:"severity"`
+	ProtoPayload struct {
+		MethodName   string `json:"methodName"`
+		ResourceName string `json:"resourceName"`
+	} `json:"protoPayload"`
+	Operation struct {
+		First bool `json:"first"`
+		Last  bool `json:"last"`
+	} `json:"operation"`
+}
+
+// notifyGCE accepts audit log entries pushed by a Pub/Sub subscription
+// of a log sink, authenticated by the OIDC token of the subscription or,
+// without pubsub_audience, by one of api_keys in the key query parameter
+func (server *Server) notifyGCE(r *http.Request, body []byte) (int, error) {
+	if len(server.notifier.audience) > 0 {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if err := server.notifier.verifyGoogleToken(token); err != nil {
+			return http.StatusUnauthorized, err
+		}
+	} else if !server.validAPIKey(r.URL.Query().Get("key")) {
+		return http.StatusUnauthorized, fmt.Errorf("Invalid key")
+	}
+
+	push := pubsubPush{}
+	if err := json.Unmarshal(body, &push); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	entry := gceAuditEntry{}
+	if err := json.Unmarshal(push.Message.Data, &entry); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	p, status, ok := gceAuditStatus(entry)
+	if ok {
+		server.notifyStatus(p.Hash(), status)
+	}
+	return http.StatusNoContent, nil
+}
+
+// gceAuditStatus returns the instance of an audit entry and its status,
+// ok is false for entries which don't change the status
+func gceAuditStatus(entry gceAuditEntry) (*provider.GCE, provider.StatusInstance, bool) {
+	// projects/<project>/zones/<zone>/instances/<name>
+	parts := strings.Split(entry.ProtoPayload.ResourceName, "/")
+	if len(parts) != 6 || parts[0] != "projects" || parts[2] != "zones" || parts[4] != "instances" || entry.Severity == "ERROR" {
+		return nil, provider.StatusInstanceNotAvailable, false
+	}
+	p := &provider.GCE{ProjectID: parts[1], Zone: parts[3], Name: parts[5]}
+
+	// v1.compute.instances.start, beta.compute.instances.stop, ...
+	method := entry.ProtoPayload.MethodName
+	method = method[strings.LastIndex(method, ".")+1:]
+	last := entry.Operation.Last
+
+	switch {
+	case (method == "start" || method == "resume") && last:
+		return p, provider.StatusInstanceRunning, true
+	case method == "start" || method == "resume":
+		return p, provider.StatusInstanceStarting, true
+	case (method == "stop" || method == "suspend" || method == "delete") && last:
+		return p, provider.StatusInstanceNotRun, true
+	case method == "stop" || method == "suspend" || method == "delete":
+		return p, provider.StatusInstanceStopping, true
+	}
+
+	return nil, provider.StatusInstanceNotAvailable, false
+}
+
+// signedString returns the string an SNS message signature is made of
+func (msg *snsMessage) signedString() string {
+	fields := []string{"Message", msg.Message, "MessageId", msg.MessageID}
+
+	if msg.Type == "Notification" {
+		if len(msg.Subject) > 0 {
+			fields = append(fields, "Subject", msg.Subject)
+		}
+		fields = append(fields, "Timestamp", msg.Timestamp, "TopicArn", msg.TopicArn, "Type", msg.Type)
+	} else {
+		fields = append(fields, "SubscribeURL", msg.SubscribeURL, "Timestamp", msg.Timestamp, "Token", msg.Token, "TopicArn", msg.TopicArn, "Type", msg.Type)
+	}
+
+	return strings.Join(fields, "\n") + "\n"
+}
+
+// verifySNS checks the topic and the signature of msg
+func (n *notifier) verifySNS(msg *snsMessage) error {
+	if !n.snsTopics[msg.TopicArn] {
+		return fmt.Errorf("Not allowed topic %q", msg.TopicArn)
+	}
+
+	var hash crypto.Hash
+	switch msg.SignatureVersion {
+	case "1":
+		hash = crypto.SHA1
+	case "2":
+		hash = crypto.SHA256
+	default:
+		return fmt.Errorf("Unknown signature version %q", msg.SignatureVersion)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(msg.Signature)
+	if err != nil {
+		return err
+	}
+
+	cert, err := n.snsCert(msg.SigningCertURL)
+	if err != nil {
+		return err
+	}
+
+	key, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("Unsupported key of %s", msg.SigningCertURL)
+	}
+
+	h := hash.New()
+	h.Write([]byte(msg.signedString()))
+	return rsa.VerifyPKCS1v15(key, hash, h.Sum(nil), signature)
+}
+
+// snsCert returns the signing certificate of rawURL, fetched once
+func (n *notifier) snsCert(rawURL string) (*x509.Certificate, error) {
+	if err := checkSNSURL(rawURL); err != nil {
+		return nil, err
+	}
+
+	n.Lock()
+	cert, ok := n.certs[rawURL]
+	n.Unlock()
+	if ok && time.Now().Before(cert.NotAfter) {
+		return cert, nil
+	}
+
+	data, err := n.get(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("No certificate in %s", rawURL)
+	}
+
+	cert, err = x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	n.Lock()
+	n.certs[rawURL] = cert
+	n.Unlock()
+
+	return cert, nil
+}
+
+// confirmSNS confirms the subscription of a verified message
+func (n *notifier) confirmSNS(msg *snsMessage) error {
+	if err := checkSNSURL(msg.SubscribeURL); err != nil {
+		return err
+	}
+
+	_, err := n.get(msg.SubscribeURL)
+	return err
+}
+
+// checkSNSURL allows only HTTPS URLs of SNS
+func checkSNSURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+
+	if u.Scheme != "https" || !snsHost.MatchString(u.Hostname()) {
+		return fmt.Errorf("Not allowed SNS URL %q", rawURL)
+	}
+	return nil
+}
+
+// googleTokenHeader is the header of a Google OIDC token
+type googleTokenHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// googleToken is the claims of a Google OIDC token
+type googleToken struct {
+	Iss           string `json:"iss"`
+	Aud           string `json:"aud"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Exp           int64  `json:"exp"`
+}
+
+// verifyGoogleToken checks the signature, the audience
+// and the service account of an OIDC token
+func (n *notifier) verifyGoogleToken(raw string) error {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("Invalid token")
+	}
+
+	header, token := googleTokenHeader{}, googleToken{}
+	for i, v := range []interface{}{&header, &token} {
+		data, err := base64.RawURLEncoding.DecodeString(parts[i])
+		if err != nil {
+			return fmt.Errorf("Invalid token: %s", err)
+		}
+		if err := json.Unmarshal(data, v); err != nil {
+			return fmt.Errorf("Invalid token: %s", err)
+		}
+	}
+
+	if header.Alg != "RS256" {
+		return fmt.Errorf("Unsupported token algorithm %q", header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return fmt.Errorf("Invalid token: %s", err)
+	}
+
+	key, err := n.googleKey(header.Kid)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], signature); err != nil {
+		return err
+	}
+
+	switch {
+	case !googleIssuers[token.Iss]:
+		return fmt.Errorf("Invalid token issuer %q", token.Iss)
+	case token.Aud != n.audience:
+		return fmt.Errorf("Invalid token audience %q", token.Aud)
+	case token.Email != n.account || !token.EmailVerified:
+		return fmt.Errorf("Invalid token account %q", token.Email)
+	case time.Now().Unix() > token.Exp:
+		return fmt.Errorf("Token expired")
+	}
+
+	return nil
+}
+
+// googleKey returns the Google signing key kid, keys are fetched
+// again after googleKeysTTL or for an unknown kid
+func (n *notifier) googleKey(kid string) (*rsa.PublicKey, error) {
+	n.Lock()
+	key, ok := n.keys[kid]
+	age := time.Since(n.keysFetched)
+	n.Unlock()
+
+	if ok && age < googleKeysTTL {
+		return key, nil
+	}
+	if !ok && age < googleKeysRefresh {
+		return nil, fmt.Errorf("Unknown token key %q", kid)
+	}
+
+	data, err := n.get(googleCertsURL)
+	if err != nil {
+		return nil, err
+	}
+
+	jwks := struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}{}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(jwks.Keys))
+	for _, k := range jwks.Keys {
+		modulus, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		exponent, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(modulus), E: int(new(big.Int).SetBytes(exponent).Int64())}
+	}
+
+	n.Lock()
+	n.keys = keys
+	n.keysFetched = time.Now()
+	n.Unlock()
+
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("Unknown token key %q", kid)
+}
+
+func (n *notifier) get(rawURL string) ([]byte, error) {
+	resp, err := n.client.Get(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", rawURL, resp.Status)
+	}
+
+	return ioutil.ReadAll(io.LimitReader(resp.Body, maxNotifyBody))
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/silentsokolov/go-sleep/provider"
+)
+
+const testTopic = "arn:aws:sns:us-west-2:123456789012:go-sleep"
+
+func testNotifyServer(conf *NotifyConfig) (*Server, *ComputeInstance, *ComputeInstance) {
+	server := NewServer(&Config{})
+	server.apiKeys = []string{"secret"}
+	server.notifier = newNotifier(conf)
+
+	ec2 := &ComputeInstance{notifyChan: make(chan provider.StatusInstance, 5)}
+	gce := &ComputeInstance{notifyChan: make(chan provider.StatusInstance, 5)}
+	server.InstanceStore.values[(&provider.EC2{InstanceID: "i-0", Region: "us-west-2"}).Hash()] = ec2
+	server.InstanceStore.values[(&provider.GCE{ProjectID: "my-project", Zone: "europe-west1-b", Name: "app"}).Hash()] = gce
+
+	return server, ec2, gce
+}
+
+func notified(instance *ComputeInstance) (provider.StatusInstance, bool) {
+	select {
+	case status := <-instance.notifyChan:
+		return status, true
+	default:
+		return provider.StatusInstanceNotAvailable, false
+	}
+}
+
+func ec2StateEvent(state string) string {
+	return fmt.Sprintf(`{"detail-type": %q, "source": "aws.ec2", "region": "us-west-2", "detail": {"instance-id": "i-0", "state": %q}}`, ec2StateChange, state)
+}
+
+// testSNS serves a self-signed SNS signing certificate and counts subscribe calls
+func testSNS(t *testing.T, n *notifier) (*httptest.Server, *rsa.PrivateKey, *int32) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sns.amazonaws.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	subscribed := new(int32)
+	sns := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/subscribe" {
+			atomic.AddInt32(subscribed, 1)
+			return
+		}
+		w.Write(certPEM)
+	}))
+
+	n.client = sns.Client()
+	return sns, key, subscribed
+}
+
+func signSNS(t *testing.T, key *rsa.PrivateKey, msg *snsMessage) string {
+	var digest []byte
+	hash := crypto.SHA256
+	if msg.SignatureVersion == "1" {
+		sum := sha1.Sum([]byte(msg.signedString()))
+		digest, hash = sum[:], crypto.SHA1
+	} else {
+		sum := sha256.Sum256([]byte(msg.signedString()))
+		digest = sum[:]
+	}
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, hash, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg.Signature = base64.StdEncoding.EncodeToString(signature)
+
+	body, _ := json.Marshal(msg)
+	return string(body)
+}
+
+func TestServer_notifyHandler_ec2(t *testing.T) {
+	server, instance, _ := testNotifyServer(&NotifyConfig{SNSTopics: []string{testTopic}})
+	defer server.Close()
+
+	sns, key, subscribed := testSNS(t, server.notifier)
+	defer sns.Close()
+
+	defer func(host *regexp.Regexp) { snsHost = host }(snsHost)
+	snsHost = regexp.MustCompile(`^127\.0\.0\.1$`)
+
+	message := func(typ, topic, version, event string) *snsMessage {
+		return &snsMessage{
+			Type:             typ,
+			MessageID:        "1",
+			TopicArn:         topic,
+			Message:          event,
+			Timestamp:        "2026-01-01T00:00:00.000Z",
+			SignatureVersion: version,
+			SigningCertURL:   sns.URL + "/cert.pem",
+			SubscribeURL:     sns.URL + "/subscribe",
+		}
+	}
+
+	tampered := signSNS(t, key, message("Notification", testTopic, "2", ec2StateEvent("running")))
+	tampered = strings.Replace(tampered, "running", "stopped", 1)
+
+	var requestTable = []struct {
+		snsType string
+		key     string
+		body    string
+		code    int
+		status  provider.StatusInstance
+	}{
+		{"", "", ec2StateEvent("running"), http.StatusUnauthorized, provider.StatusInstanceNotAvailable},
+		{"", "secret", ec2StateEvent("running"), http.StatusNoContent, provider.StatusInstanceRunning},
+		{"", "secret", `{"detail-type": "EC2 Spot Instance Interruption Warning"}`, http.StatusNoContent, provider.StatusInstanceNotAvailable},
+		{"Notification", "", signSNS(t, key, message("Notification", testTopic, "2", ec2StateEvent("stopping"))), http.StatusNoContent, provider.StatusInstanceStopping},
+		{"Notification", "", signSNS(t, key, message("Notification", testTopic, "1", ec2StateEvent("stopped"))), http.StatusNoContent, provider.StatusInstanceNotRun},
+		{"Notification", "", tampered, http.StatusForbidden, provider.StatusInstanceNotAvailable},
+		{"Notification", "", signSNS(t, key, message("Notification", "arn:aws:sns:us-west-2:1:other", "2", ec2StateEvent("running"))), http.StatusForbidden, provider.StatusInstanceNotAvailable},
+		{"SubscriptionConfirmation", "", signSNS(t, key, message("SubscriptionConfirmation", testTopic, "2", "")), http.StatusOK, provider.StatusInstanceNotAvailable},
+	}
+
+	handler := server.notifyHandler()
+	for _, tt := range requestTable {
+		req := httptest.NewRequest("POST", "/notify/ec2", strings.NewReader(tt.body))
+		if len(tt.snsType) > 0 {
+			req.Header.Set("X-Amz-Sns-Message-Type", tt.snsType)
+		}
+		if len(tt.key) > 0 {
+			req.Header.Set("X-Go-Sleep-Key", tt.key)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		if recorder.Code != tt.code {
+			t.Errorf("notifyHandler(%s) returned %d, want %d: %s", tt.snsType, recorder.Code, tt.code, recorder.Body)
+		}
+
+		status, ok := notified(instance)
+		if !ok {
+			status = provider.StatusInstanceNotAvailable
+		}
+		if status != tt.status {
+			t.Errorf("notifyHandler(%s) notified %s, want %s", tt.snsType, status, tt.status)
+		}
+	}
+
+	if n := atomic.LoadInt32(subscribed); n != 1 {
+		t.Errorf("notifyHandler confirmed %d subscriptions, want 1", n)
+	}
+}
+
+func pubsubBody(entry string) string {
+	return fmt.Sprintf(`{"message": {"data": %q, "messageId": "1"}, "subscription": "projects/my-project/subscriptions/go-sleep"}`, base64.StdEncoding.EncodeToString([]byte(entry)))
+}
+
+func auditEntry(method string, last bool) string {
+	return fmt.Sprintf(`{"protoPayload": {"methodName": %q, "resourceName": "projects/my-project/zones/europe-west1-b/instances/app"}, "operation": {"first": %t, "last": %t}}`, method, !last, last)
+}
+
+func signGoogleToken(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sum := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestServer_notifyHandler_gce(t *testing.T) {
+	const audience, account = "https://go-sleep.example.org/notify/gce", "pubsub@my-project.iam.gserviceaccount.com"
+
+	server, _, instance := testNotifyServer(&NotifyConfig{PubSubAudience: audience, PubSubAccount: account})
+	defer server.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	google := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"keys": [{"kid": "1", "kty": "RSA", "alg": "RS256", "n": %q, "e": %q}]}`,
+			base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+			base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.PublicKey.E)).Bytes()))
+	}))
+	defer google.Close()
+
+	defer func(url string) { googleCertsURL = url }(googleCertsURL)
+	googleCertsURL = google.URL
+
+	claims := func(aud, email string, exp time.Duration) map[string]interface{} {
+		return map[string]interface{}{
+			"iss":            "https://accounts.google.com",
+			"aud":            aud,
+			"email":          email,
+			"email_verified": true,
+			"exp":            time.Now().Add(exp).Unix(),
+		}
+	}
+
+	var requestTable = []struct {
+		token  string
+		body   string
+		code   int
+		status provider.StatusInstance
+	}{
+		{"", pubsubBody(auditEntry("v1.compute.instances.start", true)), http.StatusUnauthorized, provider.StatusInstanceNotAvailable},
+		{signGoogleToken(t, key, "1", claims(audience, account, time.Hour)), pubsubBody(auditEntry("v1.compute.instances.start", true)), http.StatusNoContent, provider.StatusInstanceRunning},
+		{signGoogleToken(t, key, "1", claims(audience, account, time.Hour)), pubsubBody(auditEntry("beta.compute.instances.stop", false)), http.StatusNoContent, provider.StatusInstanceStopping},
+		{signGoogleToken(t, key, "1", claims(audience, account, time.Hour)), pubsubBody(auditEntry("v1.compute.instances.setLabels", true)), http.StatusNoContent, provider.StatusInstanceNotAvailable},
+		{signGoogleToken(t, key, "1", claims("https://other.example.org", account, time.Hour)), pubsubBody(auditEntry("v1.compute.instances.start", true)), http.StatusUnauthorized, provider.StatusInstanceNotAvailable},
+		{signGoogleToken(t, key, "1", claims(audience, "other@example.org", time.Hour)), pubsubBody(auditEntry("v1.compute.instances.start", true)), http.StatusUnauthorized, provider.StatusInstanceNotAvailable},
+		{signGoogleToken(t, key, "1", claims(audience, account, -time.Hour)), pubsubBody(auditEntry("v1.compute.instances.start", true)), http.StatusUnauthorized, provider.StatusInstanceNotAvailable},
+		{signGoogleToken(t, key, "2", claims(audience, account, time.Hour)), pubsubBody(auditEntry("v1.compute.instances.start", true)), http.StatusUnauthorized, provider.StatusInstanceNotAvailable},
+	}
+
+	handler := server.notifyHandler()
+	for i, tt := range requestTable {
+		req := httptest.NewRequest("POST", "/notify/gce", strings.NewReader(tt.body))
+		if len(tt.token) > 0 {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		if recorder.Code != tt.code {
+			t.Errorf("notifyHandler #%d returned %d, want %d: %s", i, recorder.Code, tt.code, recorder.Body)
+		}
+
+		status, ok := notified(instance)
+		if !ok {
+			status = provider.StatusInstanceNotAvailable
+		}
+		if status != tt.status {
+			t.Errorf("notifyHandler #%d notified %s, want %s", i, status, tt.status)
+		}
+	}
+}
+
+func TestServer_notifyHandler_gceKey(t *testing.T) {
+	server, _, instance := testNotifyServer(&NotifyConfig{})
+	defer server.Close()
+
+	handler := server.notifyHandler()
+	body := pubsubBody(auditEntry("v1.compute.instances.stop", true))
+
+	for _, tt := range []struct {
+		key  string
+		code int
+	}{
+		{"", http.StatusUnauthorized},
+		{"wrong", http.StatusUnauthorized},
+		{"secret", http.StatusNoContent},
+	} {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("POST", "/notify/gce?key="+tt.key, strings.NewReader(body)))
+
+		if recorder.Code != tt.code {
+			t.Errorf("notifyHandler(key=%q) returned %d, want %d", tt.key, recorder.Code, tt.code)
+		}
+	}
+
+	if status, _ := notified(instance); status != provider.StatusInstanceNotRun {
+		t.Errorf("notifyHandler notified %s, want %s", status, provider.StatusInstanceNotRun)
+	}
+}
+
+func TestServer_notifyHandler_disabled(t *testing.T) {
+	server := NewServer(&Config{})
+	defer server.Close()
+
+	recorder := httptest.NewRecorder()
+	server.notifyHandler().ServeHTTP(recorder, httptest.NewRequest("POST", "/notify/ec2", strings.NewReader("{}")))
+
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("notifyHandler returned %d, want %d", recorder.Code, http.StatusNotFound)
+	}
+}
+
+func TestGCEAuditStatus(t *testing.T) {
+	var auditTable = []struct {
+		method   string
+		resource string
+		last     bool
+		severity string
+		status   provider.StatusInstance
+		ok       bool
+	}{
+		{"v1.compute.instances.start", "projects/p/zones/z/instances/app", false, "", provider.StatusInstanceStarting, true},
+		{"v1.compute.instances.start", "projects/p/zones/z/instances/app", true, "", provider.StatusInstanceRunning, true},
+		{"v1.compute.instances.resume", "projects/p/zones/z/instances/app", true, "", provider.StatusInstanceRunning, true},
+		{"v1.compute.instances.stop", "projects/p/zones/z/instances/app", false, "", provider.StatusInstanceStopping, true},
+		{"beta.compute.instances.suspend", "projects/p/zones/z/instances/app", true, "", provider.StatusInstanceNotRun, true},
+		{"v1.compute.instances.delete", "projects/p/zones/z/instances/app", true, "", provider.StatusInstanceNotRun, true},
+		{"v1.compute.instances.start", "projects/p/zones/z/instances/app", true, "ERROR", provider.StatusInstanceNotAvailable, false},
+		{"v1.compute.instances.insert", "projects/p/zones/z/instances/app", true, "", provider.StatusInstanceNotAvailable, false},
+		{"v1.compute.disks.delete", "projects/p/zones/z/disks/app", true, "", provider.StatusInstanceNotAvailable, false},
+	}
+
+	for _, tt := range auditTable {
+		entry := gceAuditEntry{Severity: tt.severity}
+		entry.ProtoPayload.MethodName = tt.method
+		entry.ProtoPayload.ResourceName = tt.resource
+		entry.Operation.Last = tt.last
+
+		p, status, ok := gceAuditStatus(entry)
+		if status != tt.status || ok != tt.ok {
+			t.Errorf("gceAuditStatus(%s, %s, %t) returned %s %t, want %s %t", tt.method, tt.resource, tt.last, status, ok, tt.status, tt.ok)
+		}
+		if ok && p.Hash() != "gce-p-z-app" {
+			t.Errorf("gceAuditStatus(%s) returned instance %s, want gce-p-z-app", tt.resource, p.Hash())
+		}
+	}
+}
+
+func TestCheckSNSURL(t *testing.T) {
+	var urlTable = []struct {
+		url string
+		ok  bool
+	}{
+		{"https://sns.us-west-2.amazonaws.com/SimpleNotificationService-1.pem", true},
+		{"https://sns.cn-north-1.amazonaws.com.cn/SimpleNotificationService-1.pem", true},
+		{"http://sns.us-west-2.amazonaws.com/SimpleNotificationService-1.pem", false},
+		{"https://sns.us-west-2.amazonaws.com.example.org/cert.pem", false},
+		{"https://example.org/sns.us-west-2.amazonaws.com/cert.pem", false},
+	}
+
+	for _, tt := range urlTable {
+		if err := checkSNSURL(tt.url); (err == nil) != tt.ok {
+			t.Errorf("checkSNSURL(%q) returned %v, want ok %t", tt.url, err, tt.ok)
+		}
+	}
+}
+
+func TestComputeInstance_Notify(t *testing.T) {
+	store := NewInstanceStore()
+	defer store.Close()
+
+	instance := NewComputeInstance(newDummyProvider("test", false), time.Minute)
+	changed := make(chan provider.StatusInstance, 1)
+	instance.OnStatusChange(func(s provider.StatusInstance) { changed <- s })
+	store.Set(instance.Hash(), instance)
+
+	instance.Notify(provider.StatusInstanceNotRun)
+
+	select {
+	case status := <-changed:
+		if status != provider.StatusInstanceNotRun {
+			t.Errorf("ComputeInstance.Notify changed status to %s, want %s", status, provider.StatusInstanceNotRun)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("ComputeInstance.Notify didn't change status")
+	}
+}
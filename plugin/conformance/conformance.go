@@ -0,0 +1,136 @@
+// Package conformance checks that a plugin executable follows the go-sleep
+// plugin protocol. Run it against your own plugin:
+//
+//	GO_SLEEP_PLUGIN=/path/to/plugin go test github.com/silentsokolov/go-sleep/plugin/conformance
+package conformance
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/silentsokolov/go-sleep/plugin"
+	"github.com/silentsokolov/go-sleep/provider"
+)
+
+// Run checks the protocol and the full start/stop lifecycle of the plugin,
+// the instance must be stopped before Run
+func Run(t *testing.T, command string, args []string, options map[string]interface{}, timeout time.Duration) {
+	t.Run("Protocol", func(t *testing.T) {
+		checkProtocol(t, command, args)
+	})
+	t.Run("Lifecycle", func(t *testing.T) {
+		checkLifecycle(t, command, args, options, timeout)
+	})
+}
+
+func checkProtocol(t *testing.T, command string, args []string) {
+	cmd := exec.Command(command, args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Unable to start plugin: %v", err)
+	}
+	defer cmd.Wait()
+	defer stdin.Close()
+
+	scanner := bufio.NewScanner(stdout)
+	roundTrip := func(req *plugin.Request) *plugin.Response {
+		if err := json.NewEncoder(stdin).Encode(req); err != nil {
+			t.Fatalf("Unable to send request: %v", err)
+		}
+		if !scanner.Scan() {
+			t.Fatalf("Plugin closed stdout: %v", scanner.Err())
+		}
+		var resp plugin.Response
+		if err := json.Unmarshal(scanner.Bytes(), &resp); err != nil {
+			t.Fatalf("Plugin returned invalid JSON %q: %v", scanner.Text(), err)
+		}
+		return &resp
+	}
+
+	resp := roundTrip(&plugin.Request{JSONRPC: plugin.Version, ID: 7, Method: "Unknown", Params: &plugin.Params{Name: "conformance"}})
+	if resp.ID != 7 {
+		t.Errorf("Response id is %d, want %d", resp.ID, 7)
+	}
+	if resp.JSONRPC != plugin.Version {
+		t.Errorf("Response jsonrpc is %q, want %q", resp.JSONRPC, plugin.Version)
+	}
+	if resp.Error == nil || resp.Error.Code != plugin.CodeMethodNotFound {
+		t.Errorf("Unknown method returned %+v, want error code %d", resp.Error, plugin.CodeMethodNotFound)
+	}
+
+	resp = roundTrip(&plugin.Request{JSONRPC: plugin.Version, ID: 8, Method: plugin.MethodStatus, Params: &plugin.Params{Name: "conformance"}})
+	if resp.Error != nil {
+		t.Fatalf("Status returned unexpected error: %v", resp.Error)
+	}
+	var result plugin.StatusResult
+	if err := json.Unmarshal(resp.Result, &result); err != nil {
+		t.Fatalf("Status returned invalid result %s: %v", resp.Result, err)
+	}
+	if _, err := provider.ParseStatusInstance(result.Status); err != nil {
+		t.Error(err)
+	}
+	if result.Status == "error" && len(result.Message) == 0 {
+		t.Errorf("Status returned %q without a message", result.Status)
+	}
+}
+
+func checkLifecycle(t *testing.T, command string, args []string, options map[string]interface{}, timeout time.Duration) {
+	p := provider.NewPlugin("conformance", command, args, nil, options)
+	defer p.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	waitStatus := func(want provider.StatusInstance) {
+		for {
+			status, err := p.Status(ctx)
+			if err != nil {
+				t.Fatalf("Status returned unexpected error: %v", err)
+			}
+			if status == want {
+				return
+			}
+			select {
+			case <-time.After(100 * time.Millisecond):
+			case <-ctx.Done():
+				t.Fatalf("Status is %s, want %s", status, want)
+			}
+		}
+	}
+
+	if status, err := p.Status(ctx); err != nil || status != provider.StatusInstanceNotRun {
+		t.Fatalf("Status returned %s (%v), want %s", status, err, provider.StatusInstanceNotRun)
+	}
+
+	if err := p.Start(ctx); err != nil {
+		t.Fatalf("Start returned unexpected error: %v", err)
+	}
+	waitStatus(provider.StatusInstanceRunning)
+
+	ip, err := p.IP(ctx)
+	if err != nil {
+		t.Fatalf("IP returned unexpected error: %v", err)
+	}
+	if net.ParseIP(ip) == nil {
+		if _, err := net.LookupHost(ip); err != nil {
+			t.Errorf("IP returned %q, neither an IP nor a resolvable host", ip)
+		}
+	}
+
+	if err := p.Stop(ctx); err != nil {
+		t.Fatalf("Stop returned unexpected error: %v", err)
+	}
+	waitStatus(provider.StatusInstanceNotRun)
+}
@@ -0,0 +1,36 @@
+package conformance
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestPlugin runs the harness against GO_SLEEP_PLUGIN or the reference plugin
+func TestPlugin(t *testing.T) {
+	command := os.Getenv("GO_SLEEP_PLUGIN")
+
+	if command == "" {
+		goBin, err := exec.LookPath("go")
+		if err != nil {
+			t.Skip("go tool not found, unable to build the reference plugin")
+		}
+
+		dir, err := ioutil.TempDir("", "go-sleep-plugin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		command = filepath.Join(dir, "example")
+		build := exec.Command(goBin, "build", "-o", command, "github.com/silentsokolov/go-sleep/plugin/example")
+		if out, err := build.CombinedOutput(); err != nil {
+			t.Fatalf("Unable to build the reference plugin: %v\n%s", err, out)
+		}
+	}
+
+	Run(t, command, nil, map[string]interface{}{"ip": "127.0.0.1"}, 30*time.Second)
+}
@@ -0,0 +1,104 @@
+// Reference go-sleep plugin. It simulates instances in memory: a started
+// instance boots for "boot_delay" seconds and gets the IP from the "ip" option.
+//
+//	[[plugin]]
+//	name = "simulated"
+//	command = "/path/to/example"
+//	  [plugin.options]
+//	  ip = "127.0.0.1"
+//	  boot_delay = 5
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/silentsokolov/go-sleep/plugin"
+)
+
+type instance struct {
+	status  string
+	changed time.Time
+}
+
+type handler struct {
+	sync.Mutex
+	instances map[string]*instance
+}
+
+func (h *handler) get(params *plugin.Params) *instance {
+	inst, ok := h.instances[params.Name]
+	if !ok {
+		inst = &instance{status: "not run"}
+		h.instances[params.Name] = inst
+	}
+
+	delay := 0 * time.Second
+	if v, ok := params.Options["boot_delay"].(float64); ok {
+		delay = time.Duration(v) * time.Second
+	}
+
+	if time.Since(inst.changed) >= delay {
+		switch inst.status {
+		case "starting":
+			inst.status = "running"
+		case "stopping":
+			inst.status = "not run"
+		}
+	}
+
+	return inst
+}
+
+func (h *handler) Status(params *plugin.Params) (string, error) {
+	h.Lock()
+	defer h.Unlock()
+	return h.get(params).status, nil
+}
+
+func (h *handler) IP(params *plugin.Params) (string, error) {
+	h.Lock()
+	defer h.Unlock()
+
+	if h.get(params).status != "running" {
+		return "", fmt.Errorf("instance %s is not running", params.Name)
+	}
+
+	if ip, ok := params.Options["ip"].(string); ok {
+		return ip, nil
+	}
+	return "127.0.0.1", nil
+}
+
+func (h *handler) Start(params *plugin.Params) error {
+	h.Lock()
+	defer h.Unlock()
+
+	inst := h.get(params)
+	if inst.status == "not run" {
+		inst.status = "starting"
+		inst.changed = time.Now()
+	}
+	return nil
+}
+
+func (h *handler) Stop(params *plugin.Params) error {
+	h.Lock()
+	defer h.Unlock()
+
+	inst := h.get(params)
+	if inst.status == "running" || inst.status == "starting" {
+		inst.status = "stopping"
+		inst.changed = time.Now()
+	}
+	return nil
+}
+
+func main() {
+	h := &handler{instances: make(map[string]*instance)}
+	if err := plugin.Serve(h); err != nil {
+		log.Fatal(err)
+	}
+}
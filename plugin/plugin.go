@@ -0,0 +1,218 @@
+// Package plugin describes the protocol between go-sleep and out-of-process
+// providers.
+//
+// A plugin is an executable which reads JSON-RPC 2.0 requests from stdin and
+// writes responses to stdout, one JSON document per line. Stderr is copied to
+// the go-sleep log. Methods:
+//
+//	Status -> {"status": "running"}
+//	           {"status": "error", "message": "disk is full"}
+//	IP     -> {"ip": "10.0.0.1"}
+//	Start  -> {}
+//	Stop   -> {}
+//
+// Every request carries the instance name and the options from the config.
+// Valid statuses are "not available", "starting", "not run", "stopping",
+// "running" and "error", an "error" status carries a message which is shown
+// to visitors and in the log. A plugin may answer with CodeThrottled to ask go-sleep
+// to retry the call with backoff, and with CodePermanent when retrying a failed
+// Start won't help, e.g. the instance does not exist.
+package plugin
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// Version of JSON-RPC
+const Version = "2.0"
+
+// Methods
+const (
+	MethodStatus = "Status"
+	MethodIP     = "IP"
+	MethodStart  = "Start"
+	MethodStop   = "Stop"
+)
+
+// Error codes
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInternalError  = -32603
+	CodeThrottled      = -32001
+	CodePermanent      = -32002
+)
+
+// Request ...
+type Request struct {
+	JSONRPC string  `json:"jsonrpc"`
+	ID      int64   `json:"id"`
+	Method  string  `json:"method"`
+	Params  *Params `json:"params,omitempty"`
+}
+
+// Params ...
+type Params struct {
+	Name    string                 `json:"name"`
+	Options map[string]interface{} `json:"options,omitempty"`
+}
+
+// Response ...
+type Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      int64           `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// StatusResult ...
+type StatusResult struct {
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// IPResult ...
+type IPResult struct {
+	IP string `json:"ip"`
+}
+
+// Error ...
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("plugin error %d: %s", e.Code, e.Message)
+}
+
+// Throttled ...
+func (e *Error) Throttled() bool {
+	return e.Code == CodeThrottled
+}
+
+// Permanent ...
+func (e *Error) Permanent() bool {
+	return e.Code == CodePermanent
+}
+
+// StatusError is returned by Handler.Status for an instance in the error
+// status, its message is sent with the status
+type StatusError struct {
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return e.Message
+}
+
+// Handler is implemented by plugins written in Go
+type Handler interface {
+	Status(params *Params) (string, error)
+	IP(params *Params) (string, error)
+	Start(params *Params) error
+	Stop(params *Params) error
+}
+
+// Serve handles requests from stdin until it is closed
+func Serve(h Handler) error {
+	return ServeConn(h, os.Stdin, os.Stdout)
+}
+
+// ServeConn handles requests from r and writes responses to w
+func ServeConn(h Handler, r io.Reader, w io.Writer) error {
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+
+	encoder := json.NewEncoder(w)
+	write := func(resp *Response) {
+		mu.Lock()
+		defer mu.Unlock()
+		encoder.Encode(resp)
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var req Request
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			write(&Response{JSONRPC: Version, Error: &Error{Code: CodeParseError, Message: err.Error()}})
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			write(handle(h, &req))
+		}()
+	}
+	wg.Wait()
+
+	return scanner.Err()
+}
+
+func handle(h Handler, req *Request) *Response {
+	var (
+		result interface{}
+		err    error
+	)
+
+	resp := &Response{JSONRPC: Version, ID: req.ID}
+	if req.JSONRPC != Version {
+		resp.Error = &Error{Code: CodeInvalidRequest, Message: "unsupported jsonrpc version"}
+		return resp
+	}
+
+	params := req.Params
+	if params == nil {
+		params = &Params{}
+	}
+
+	switch req.Method {
+	case MethodStatus:
+		var status string
+		status, err = h.Status(params)
+		if e, ok := err.(*StatusError); ok {
+			status, err = "error", nil
+			result = &StatusResult{Status: status, Message: e.Message}
+			break
+		}
+		result = &StatusResult{Status: status}
+	case MethodIP:
+		var ip string
+		ip, err = h.IP(params)
+		result = &IPResult{IP: ip}
+	case MethodStart:
+		err = h.Start(params)
+		result = struct{}{}
+	case MethodStop:
+		err = h.Stop(params)
+		result = struct{}{}
+	default:
+		resp.Error = &Error{Code: CodeMethodNotFound, Message: fmt.Sprintf("method %q not found", req.Method)}
+		return resp
+	}
+
+	if err != nil {
+		if e, ok := err.(*Error); ok {
+			resp.Error = e
+		} else {
+			resp.Error = &Error{Code: CodeInternalError, Message: err.Error()}
+		}
+		return resp
+	}
+
+	if resp.Result, err = json.Marshal(result); err != nil {
+		resp.Error = &Error{Code: CodeInternalError, Message: err.Error()}
+	}
+
+	return resp
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/silentsokolov/go-sleep/provider"
+)
+
+const (
+	defaultPollInterval     = time.Minute
+	defaultPollFastInterval = 5 * time.Second
+)
+
+// SetPollIntervals sets the status poll interval of a steady instance and
+// of a starting or stopping one, zero keeps the default
+func (instance *ComputeInstance) SetPollIntervals(steady, fast time.Duration) {
+	instance.Lock()
+	defer instance.Unlock()
+
+	if steady > 0 {
+		instance.pollSteady = steady
+	}
+	if fast > 0 {
+		instance.pollFast = fast
+	}
+}
+
+// pollInterval returns the delay until the next status poll: short while
+// the instance changes its status, and the steady one otherwise, cut down
+// to poll right after the idle timer expires
+func (instance *ComputeInstance) pollInterval() time.Duration {
+	booting := instance.booting()
+
+	instance.RLock()
+	defer instance.RUnlock()
+
+	steady, fast := instance.pollSteady, instance.pollFast
+	if steady <= 0 {
+		steady = defaultPollInterval
+	}
+	if fast <= 0 {
+		fast = defaultPollFastInterval
+	}
+
+	switch {
+	case booting, instance.currentStatus == provider.StatusInstanceStarting, instance.currentStatus == provider.StatusInstanceStopping:
+		return jitter(fast)
+	}
+
+	interval := jitter(steady)
+
+	if instance.currentStatus == provider.StatusInstanceRunning && instance.sleepAfter >= 0 && !instance.lastAccess.IsZero() {
+		// a second later, so the instance is idle at the poll
+		left := instance.sleepAfter - time.Since(instance.lastAccess) + time.Second
+		if left > 0 && left < interval {
+			interval = left
+		}
+	}
+
+	return interval
+}
+
+// pollNow fires timer immediately
+func pollNow(timer *time.Timer) {
+	pollIn(timer, 0)
+}
+
+// pollIn resets timer to fire after d
+func pollIn(timer *time.Timer, d time.Duration) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+	timer.Reset(d)
+}
+
+// jitter spreads d by ±10%, so instances don't poll in lockstep
+func jitter(d time.Duration) time.Duration {
+	spread := int64(d / 5)
+	if spread <= 0 {
+		return d
+	}
+	return d - d/10 + time.Duration(rand.Int63n(spread))
+}
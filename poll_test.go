@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/silentsokolov/go-sleep/provider"
+)
+
+func TestJitter(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		if d := jitter(time.Minute); d < 54*time.Second || d >= 66*time.Second {
+			t.Fatalf("jitter returned %v, want ±10%% of %v", d, time.Minute)
+		}
+	}
+
+	if d := jitter(0); d != 0 {
+		t.Errorf("jitter returned %v, want 0", d)
+	}
+}
+
+func TestComputeInstance_pollInterval(t *testing.T) {
+	instance := NewComputeInstance(newDummyProvider("test", false), 20*time.Minute)
+	instance.SetPollIntervals(2*time.Minute, 10*time.Second)
+
+	var statusTable = []struct {
+		status     provider.StatusInstance
+		lastAccess time.Duration
+		min        time.Duration
+		max        time.Duration
+	}{
+		{provider.StatusInstanceStarting, 0, 9 * time.Second, 11 * time.Second},
+		{provider.StatusInstanceStopping, 0, 9 * time.Second, 11 * time.Second},
+		{provider.StatusInstanceNotRun, 0, 108 * time.Second, 132 * time.Second},
+		{provider.StatusInstanceRunning, 0, 108 * time.Second, 132 * time.Second},
+		// the idle timer expires in 30 seconds
+		{provider.StatusInstanceRunning, 1170 * time.Second, 30 * time.Second, 32 * time.Second},
+	}
+
+	for _, test := range statusTable {
+		instance.SetStatus(test.status)
+		instance.lastAccess = time.Now().Add(-test.lastAccess)
+
+		if d := instance.pollInterval(); d < test.min || d > test.max {
+			t.Errorf("ComputeInstance.pollInterval of %v returned %v, want between %v and %v", test.status, d, test.min, test.max)
+		}
+	}
+}
+
+func TestPollNow(t *testing.T) {
+	timer := time.NewTimer(time.Hour)
+	pollNow(timer)
+
+	select {
+	case <-timer.C:
+	case <-time.After(time.Second):
+		t.Error("pollNow did not fire timer")
+	}
+}
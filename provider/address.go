@@ -0,0 +1,93 @@
+package provider
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	compute "google.golang.org/api/compute/v1"
+)
+
+// IPSelector chooses the backend address among the network interfaces
+// of an instance, the zero value selects the primary interface
+type IPSelector struct {
+	Interface int
+	IPv6      bool
+	DNSName   bool
+}
+
+// String ...
+func (s IPSelector) String() string {
+	kind := "IPv4 address"
+	if s.IPv6 {
+		kind = "IPv6 address"
+	} else if s.DNSName {
+		kind = "DNS name"
+	}
+	return fmt.Sprintf("%s of interface %d", kind, s.Interface)
+}
+
+func ec2InstanceIP(inst *ec2.Instance, internal bool, sel IPSelector) string {
+	if sel.Interface == 0 && !sel.IPv6 {
+		// the primary interface, also the only address of EC2-Classic instances
+		switch {
+		case internal && sel.DNSName:
+			return aws.StringValue(inst.PrivateDnsName)
+		case internal:
+			return aws.StringValue(inst.PrivateIpAddress)
+		case sel.DNSName:
+			return aws.StringValue(inst.PublicDnsName)
+		default:
+			return aws.StringValue(inst.PublicIpAddress)
+		}
+	}
+
+	var iface *ec2.InstanceNetworkInterface
+	for _, i := range inst.NetworkInterfaces {
+		if i.Attachment != nil && aws.Int64Value(i.Attachment.DeviceIndex) == int64(sel.Interface) {
+			iface = i
+			break
+		}
+	}
+
+	switch {
+	case iface == nil:
+		return ""
+	case sel.IPv6:
+		if len(iface.Ipv6Addresses) == 0 {
+			return ""
+		}
+		return aws.StringValue(iface.Ipv6Addresses[0].Ipv6Address)
+	case internal && sel.DNSName:
+		return aws.StringValue(iface.PrivateDnsName)
+	case internal:
+		return aws.StringValue(iface.PrivateIpAddress)
+	case iface.Association == nil:
+		return ""
+	case sel.DNSName:
+		return aws.StringValue(iface.Association.PublicDnsName)
+	default:
+		return aws.StringValue(iface.Association.PublicIp)
+	}
+}
+
+func gceInstanceIP(inst *compute.Instance, internal bool) string {
+	return gceInterfaceIP(inst, 0, internal)
+}
+
+func gceInterfaceIP(inst *compute.Instance, index int, internal bool) string {
+	if index < 0 || index >= len(inst.NetworkInterfaces) {
+		return ""
+	}
+
+	iface := inst.NetworkInterfaces[index]
+	if internal {
+		return iface.NetworkIP
+	}
+
+	if len(iface.AccessConfigs) == 0 {
+		return ""
+	}
+
+	return iface.AccessConfigs[0].NatIP
+}
@@ -0,0 +1,79 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	compute "google.golang.org/api/compute/v1"
+)
+
+func TestEC2InstanceIP(t *testing.T) {
+	inst := &ec2.Instance{
+		PublicIpAddress:  aws.String("54.0.0.1"),
+		PublicDnsName:    aws.String("ec2-54-0-0-1.compute.amazonaws.com"),
+		PrivateIpAddress: aws.String("10.0.0.1"),
+		PrivateDnsName:   aws.String("ip-10-0-0-1.internal"),
+		NetworkInterfaces: []*ec2.InstanceNetworkInterface{
+			{
+				Attachment:       &ec2.InstanceNetworkInterfaceAttachment{DeviceIndex: aws.Int64(0)},
+				PrivateIpAddress: aws.String("10.0.0.1"),
+				Ipv6Addresses:    []*ec2.InstanceIpv6Address{{Ipv6Address: aws.String("2600:1f14::1")}},
+			},
+			{
+				Attachment:       &ec2.InstanceNetworkInterfaceAttachment{DeviceIndex: aws.Int64(1)},
+				PrivateIpAddress: aws.String("10.1.0.1"),
+				Association:      &ec2.InstanceNetworkInterfaceAssociation{PublicIp: aws.String("54.1.0.1")},
+			},
+		},
+	}
+
+	var ipTable = []struct {
+		internal bool
+		sel      IPSelector
+		out      string
+	}{
+		{false, IPSelector{}, "54.0.0.1"},
+		{true, IPSelector{}, "10.0.0.1"},
+		{false, IPSelector{DNSName: true}, "ec2-54-0-0-1.compute.amazonaws.com"},
+		{true, IPSelector{DNSName: true}, "ip-10-0-0-1.internal"},
+		{false, IPSelector{IPv6: true}, "2600:1f14::1"},
+		{false, IPSelector{Interface: 1}, "54.1.0.1"},
+		{true, IPSelector{Interface: 1}, "10.1.0.1"},
+		{false, IPSelector{Interface: 1, IPv6: true}, ""},
+		{false, IPSelector{Interface: 2}, ""},
+	}
+
+	for _, test := range ipTable {
+		if ip := ec2InstanceIP(inst, test.internal, test.sel); ip != test.out {
+			t.Errorf("ec2InstanceIP(%v, %s) returned %q, want %q", test.internal, test.sel, ip, test.out)
+		}
+	}
+}
+
+func TestGCEInterfaceIP(t *testing.T) {
+	inst := &compute.Instance{
+		NetworkInterfaces: []*compute.NetworkInterface{
+			{NetworkIP: "10.0.0.1", AccessConfigs: []*compute.AccessConfig{{NatIP: "35.0.0.1"}}},
+			{NetworkIP: "10.1.0.1"},
+		},
+	}
+
+	var ipTable = []struct {
+		index    int
+		internal bool
+		out      string
+	}{
+		{0, false, "35.0.0.1"},
+		{0, true, "10.0.0.1"},
+		{1, false, ""},
+		{1, true, "10.1.0.1"},
+		{2, true, ""},
+	}
+
+	for _, test := range ipTable {
+		if ip := gceInterfaceIP(inst, test.index, test.internal); ip != test.out {
+			t.Errorf("gceInterfaceIP(%d, %v) returned %q, want %q", test.index, test.internal, ip, test.out)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/ec2"
+
+	"github.com/silentsokolov/go-sleep/log"
+)
+
+// asgMinSizeTag keeps the MinSize of a stopped group, it is restored on start
+const asgMinSizeTag = "go-sleep:min-size"
+
+// ASG scales an EC2 Auto Scaling Group between 0 and Size
+type ASG struct {
+	AccessKeyID        string
+	SecretAccessKey    string
+	Region             string
+	Name               string
+	Size               int
+	MinHealthy         int
+	UseInternalIP      bool
+	session            *session.Session
+	autoscalingService *autoscaling.AutoScaling
+	ec2Service         *ec2.EC2
+}
+
+// NewASG ..
+func NewASG(AccessKeyID, SecretAccessKey, Region, Name string, Size, MinHealthy int, UseInternalIP bool) *ASG {
+	session, err := getAWSSession(AccessKeyID, SecretAccessKey, Region)
+	if err != nil {
+		log.Fatalf("ASG %s: Unable to session: %v", Name, err)
+	}
+
+	if Size <= 0 {
+		Size = 1
+	}
+
+	if MinHealthy <= 0 || MinHealthy > Size {
+		MinHealthy = Size
+	}
+
+	return &ASG{
+		AccessKeyID:        AccessKeyID,
+		SecretAccessKey:    SecretAccessKey,
+		Region:             Region,
+		Name:               Name,
+		Size:               Size,
+		MinHealthy:         MinHealthy,
+		UseInternalIP:      UseInternalIP,
+		session:            session,
+		autoscalingService: autoscaling.New(session),
+		ec2Service:         ec2.New(session),
+	}
+}
+
+// String ...
+func (p *ASG) String() string {
+	return fmt.Sprintf("[ASG] Name: %s in %s", p.Name, p.Region)
+}
+
+// Hash ...
+func (p *ASG) Hash() string {
+	return fmt.Sprintf("asg-%s-%s", p.Name, p.Region)
+}
+
+// Status ...
+func (p *ASG) Status(ctx context.Context) (StatusInstance, error) {
+	group, err := p.getGroup(ctx)
+	if err != nil {
+		return StatusInstanceNotAvailable, err
+	}
+
+	return normalizeGroupStatus(int(aws.Int64Value(group.DesiredCapacity)), len(group.Instances), len(healthyASGInstances(group)), p.MinHealthy), nil
+}
+
+// IP returns the address of the first healthy member
+func (p *ASG) IP(ctx context.Context) (string, error) {
+	ips, err := p.IPs(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return ips[0], nil
+}
+
+// IPs returns the addresses of all healthy members
+func (p *ASG) IPs(ctx context.Context) ([]string, error) {
+	group, err := p.getGroup(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := healthyASGInstances(group)
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("ASG %s has no healthy instances", p.Name)
+	}
+
+	params := &ec2.DescribeInstancesInput{InstanceIds: ids}
+	resp, err := p.ec2Service.DescribeInstancesWithContext(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	ips := make([]string, 0, len(ids))
+	for _, r := range resp.Reservations {
+		for _, i := range r.Instances {
+			ip := aws.StringValue(i.PublicIpAddress)
+			if p.UseInternalIP {
+				ip = aws.StringValue(i.PrivateIpAddress)
+			}
+			if ip != "" {
+				ips = append(ips, ip)
+			}
+		}
+	}
+
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("ASG %s has no instances with IP", p.Name)
+	}
+
+	return ips, nil
+}
+
+// Start ...
+func (p *ASG) Start(ctx context.Context) error {
+	group, err := p.getGroup(ctx)
+	if err != nil {
+		return err
+	}
+
+	params := &autoscaling.UpdateAutoScalingGroupInput{
+		AutoScalingGroupName: aws.String(p.Name),
+		DesiredCapacity:      aws.Int64(int64(p.Size)),
+	}
+
+	tag, minSize := groupMinSizeTag(group)
+	if tag {
+		// the minimum can't be above the desired capacity
+		if minSize > int64(p.Size) {
+			minSize = int64(p.Size)
+		}
+		params.MinSize = aws.Int64(minSize)
+	}
+
+	if _, err := p.autoscalingService.UpdateAutoScalingGroupWithContext(ctx, params); err != nil {
+		return err
+	}
+
+	if tag {
+		_, err = p.autoscalingService.DeleteTagsWithContext(ctx, &autoscaling.DeleteTagsInput{
+			Tags: []*autoscaling.Tag{p.minSizeTag("")},
+		})
+	}
+	return err
+}
+
+// Stop records MinSize of the group in a tag and scales it to 0
+func (p *ASG) Stop(ctx context.Context) error {
+	group, err := p.getGroup(ctx)
+	if err != nil {
+		return err
+	}
+
+	// a group stopped before keeps the tag of its original MinSize
+	if minSize := aws.Int64Value(group.MinSize); minSize > 0 {
+		_, err := p.autoscalingService.CreateOrUpdateTagsWithContext(ctx, &autoscaling.CreateOrUpdateTagsInput{
+			Tags: []*autoscaling.Tag{p.minSizeTag(strconv.FormatInt(minSize, 10))},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	params := &autoscaling.UpdateAutoScalingGroupInput{
+		AutoScalingGroupName: aws.String(p.Name),
+		MinSize:              aws.Int64(0),
+		DesiredCapacity:      aws.Int64(0),
+	}
+
+	_, err = p.autoscalingService.UpdateAutoScalingGroupWithContext(ctx, params)
+	return err
+}
+
+func (p *ASG) minSizeTag(value string) *autoscaling.Tag {
+	return &autoscaling.Tag{
+		Key:               aws.String(asgMinSizeTag),
+		Value:             aws.String(value),
+		ResourceId:        aws.String(p.Name),
+		ResourceType:      aws.String("auto-scaling-group"),
+		PropagateAtLaunch: aws.Bool(false),
+	}
+}
+
+func (p *ASG) getGroup(ctx context.Context) (*autoscaling.Group, error) {
+	params := &autoscaling.DescribeAutoScalingGroupsInput{
+		AutoScalingGroupNames: []*string{aws.String(p.Name)},
+	}
+
+	resp, err := p.autoscalingService.DescribeAutoScalingGroupsWithContext(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.AutoScalingGroups) < 1 {
+		return nil, fmt.Errorf("ASG %s not found", p.Name)
+	}
+
+	return resp.AutoScalingGroups[0], nil
+}
+
+// groupMinSizeTag returns the MinSize recorded by Stop
+func groupMinSizeTag(group *autoscaling.Group) (bool, int64) {
+	for _, tag := range group.Tags {
+		if aws.StringValue(tag.Key) != asgMinSizeTag {
+			continue
+		}
+		minSize, err := strconv.ParseInt(aws.StringValue(tag.Value), 10, 64)
+		if err != nil || minSize < 0 {
+			log.Printf("ASG %s: invalid tag %s=%s", aws.StringValue(group.AutoScalingGroupName), asgMinSizeTag, aws.StringValue(tag.Value))
+			return false, 0
+		}
+		return true, minSize
+	}
+	return false, 0
+}
+
+func healthyASGInstances(group *autoscaling.Group) []*string {
+	ids := make([]*string, 0, len(group.Instances))
+	for _, i := range group.Instances {
+		if aws.StringValue(i.LifecycleState) == autoscaling.LifecycleStateInService && aws.StringValue(i.HealthStatus) == "Healthy" {
+			ids = append(ids, i.InstanceId)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,209 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/awstesting/unit"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+var exampleDescribeAutoScalingGroupsResponse = `
+<DescribeAutoScalingGroupsResponse xmlns="http://autoscaling.amazonaws.com/doc/2011-01-01/">
+	<DescribeAutoScalingGroupsResult>
+		<AutoScalingGroups>
+			<member>
+				<AutoScalingGroupName>web</AutoScalingGroupName>
+				<MinSize>%d</MinSize>
+				<DesiredCapacity>2</DesiredCapacity>%s
+				<Instances>
+					<member>
+						<InstanceId>i-0</InstanceId>
+						<HealthStatus>Healthy</HealthStatus>
+						<LifecycleState>InService</LifecycleState>
+					</member>
+					<member>
+						<InstanceId>i-1</InstanceId>
+						<HealthStatus>Healthy</HealthStatus>
+						<LifecycleState>Pending</LifecycleState>
+					</member>
+				</Instances>
+			</member>
+		</AutoScalingGroups>
+	</DescribeAutoScalingGroupsResult>
+</DescribeAutoScalingGroupsResponse>`
+
+var exampleUpdateAutoScalingGroupResponse = `
+<UpdateAutoScalingGroupResponse xmlns="http://autoscaling.amazonaws.com/doc/2011-01-01/">
+	<ResponseMetadata><RequestId>0</RequestId></ResponseMetadata>
+</UpdateAutoScalingGroupResponse>`
+
+var exampleASGMinSizeTag = `
+				<Tags>
+					<member>
+						<Key>go-sleep:min-size</Key>
+						<Value>%s</Value>
+					</member>
+				</Tags>`
+
+// fakeASG is the state of the group web
+type fakeASG struct {
+	minSize int
+	tag     string
+}
+
+func initTestASG(t *testing.T, minHealthy int) (*ASG, *httptest.Server, *[]string) {
+	p, server, actions, _ := initTestASGGroup(t, minHealthy)
+	return p, server, actions
+}
+
+func initTestASGGroup(t *testing.T, minHealthy int) (*ASG, *httptest.Server, *[]string, *fakeASG) {
+	actions := &[]string{}
+	group := &fakeASG{minSize: 1}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		*actions = append(*actions, r.Form.Get("Action")+":"+r.Form.Get("DesiredCapacity"))
+		switch r.Form.Get("Action") {
+		case "DescribeAutoScalingGroups":
+			tags := ""
+			if len(group.tag) > 0 {
+				tags = fmt.Sprintf(exampleASGMinSizeTag, group.tag)
+			}
+			fmt.Fprintf(w, exampleDescribeAutoScalingGroupsResponse, group.minSize, tags)
+		case "UpdateAutoScalingGroup":
+			if minSize := r.Form.Get("MinSize"); len(minSize) > 0 {
+				group.minSize, _ = strconv.Atoi(minSize)
+			}
+			w.Write([]byte(exampleUpdateAutoScalingGroupResponse))
+		case "CreateOrUpdateTags":
+			group.tag = r.Form.Get("Tags.member.1.Value")
+			w.Write([]byte("<CreateOrUpdateTagsResponse></CreateOrUpdateTagsResponse>"))
+		case "DeleteTags":
+			group.tag = ""
+			w.Write([]byte("<DeleteTagsResponse></DeleteTagsResponse>"))
+		default:
+			w.Write([]byte(exampleDescribeInstancesResponse))
+		}
+	}))
+
+	config := &aws.Config{Endpoint: aws.String(server.URL + "/")}
+	p := &ASG{
+		Region:             "us-west-2",
+		Name:               "web",
+		Size:               2,
+		MinHealthy:         minHealthy,
+		autoscalingService: autoscaling.New(unit.Session, config),
+		ec2Service:         ec2.New(unit.Session, config),
+	}
+
+	return p, server, actions, group
+}
+
+func TestNewASG(t *testing.T) {
+	p := NewASG("access", "secret", "us-west-2", "web", 3, 0, false)
+
+	if p.MinHealthy != 3 {
+		t.Errorf("NewASG.MinHealthy returned %+v, want %+v", p.MinHealthy, 3)
+	}
+
+	if p.autoscalingService == nil || p.ec2Service == nil {
+		t.Error("NewASG services not set")
+	}
+}
+
+func TestASG_Hash(t *testing.T) {
+	p := &ASG{Name: "web", Region: "us-west-2"}
+	s := "asg-web-us-west-2"
+
+	if p.Hash() != s {
+		t.Errorf("ASG.Hash returned %+v, want %+v", p.Hash(), s)
+	}
+}
+
+func TestASG_Status(t *testing.T) {
+	p, server, _ := initTestASG(t, 2)
+	defer server.Close()
+
+	status, err := p.Status(context.Background())
+	if err != nil || status != StatusInstanceStarting {
+		t.Errorf("ASG.Status returned %v (%v), want %v", status, err, StatusInstanceStarting)
+	}
+
+	p.MinHealthy = 1
+	status, err = p.Status(context.Background())
+	if err != nil || status != StatusInstanceRunning {
+		t.Errorf("ASG.Status returned %v (%v), want %v", status, err, StatusInstanceRunning)
+	}
+}
+
+func TestASG_IPs(t *testing.T) {
+	p, server, _ := initTestASG(t, 1)
+	defer server.Close()
+
+	ips, err := p.IPs(context.Background())
+	if err != nil {
+		t.Fatalf("ASG.IPs returned unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(ips, []string{"10.10.10.1"}) {
+		t.Errorf("ASG.IPs returned %+v, want %+v", ips, []string{"10.10.10.1"})
+	}
+}
+
+func TestASG_StartStop(t *testing.T) {
+	p, server, actions, group := initTestASGGroup(t, 1)
+	defer server.Close()
+
+	if err := p.Stop(context.Background()); err != nil {
+		t.Fatalf("ASG.Stop returned unexpected error: %v", err)
+	}
+	if group.minSize != 0 || group.tag != "1" {
+		t.Errorf("ASG.Stop left MinSize %d and tag %q, want 0 and %q", group.minSize, group.tag, "1")
+	}
+
+	// a second stop keeps the original MinSize
+	if err := p.Stop(context.Background()); err != nil {
+		t.Fatalf("ASG.Stop returned unexpected error: %v", err)
+	}
+
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatalf("ASG.Start returned unexpected error: %v", err)
+	}
+	if group.minSize != 1 || group.tag != "" {
+		t.Errorf("ASG.Start left MinSize %d and tag %q, want 1 without tag", group.minSize, group.tag)
+	}
+
+	want := []string{
+		"DescribeAutoScalingGroups:", "CreateOrUpdateTags:", "UpdateAutoScalingGroup:0",
+		"DescribeAutoScalingGroups:", "UpdateAutoScalingGroup:0",
+		"DescribeAutoScalingGroups:", "UpdateAutoScalingGroup:2", "DeleteTags:",
+	}
+	if !reflect.DeepEqual(*actions, want) {
+		t.Errorf("ASG called %+v, want %+v", *actions, want)
+	}
+}
+
+func TestNormalizeGroupStatus(t *testing.T) {
+	var statusTable = []struct {
+		desired, members, healthy, minHealthy int
+		out                                   StatusInstance
+	}{
+		{0, 0, 0, 1, StatusInstanceNotRun},
+		{0, 2, 1, 1, StatusInstanceStopping},
+		{2, 2, 1, 2, StatusInstanceStarting},
+		{2, 2, 1, 1, StatusInstanceRunning},
+	}
+
+	for _, test := range statusTable {
+		if s := normalizeGroupStatus(test.desired, test.members, test.healthy, test.minHealthy); s != test.out {
+			t.Errorf("normalizeGroupStatus is %v, want %v", s, test.out)
+		}
+	}
+}
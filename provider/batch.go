@@ -0,0 +1,145 @@
+package provider
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// batchTTL is how long a batched lookup answers for all instances
+var batchTTL = 3 * time.Second
+
+// batchFetch looks up keys with as few API calls as possible,
+// keys which are not found are missing from the result
+type batchFetch func(ctx context.Context, keys []string) (map[string]interface{}, error)
+
+// batchCache shares a single lookup of all registered keys between
+// instances of one account, concurrent callers wait for the same call
+type batchCache struct {
+	sync.Mutex
+	fetch   batchFetch
+	keys    map[string]bool
+	items   map[string]interface{}
+	fetched time.Time
+	call    *batchCall
+}
+
+type batchCall struct {
+	done chan struct{}
+	err  error
+}
+
+func newBatchCache(fetch batchFetch) *batchCache {
+	return &batchCache{fetch: fetch, keys: make(map[string]bool)}
+}
+
+var batches = struct {
+	sync.Mutex
+	caches map[string]*batchCache
+}{caches: make(map[string]*batchCache)}
+
+// sharedBatch returns the batch cache of account, fetch is used
+// only when the cache is created
+func sharedBatch(account string, fetch batchFetch) *batchCache {
+	batches.Lock()
+	defer batches.Unlock()
+
+	if cache, ok := batches.caches[account]; ok {
+		return cache
+	}
+
+	cache := newBatchCache(fetch)
+	batches.caches[account] = cache
+	return cache
+}
+
+// Register adds key to lookups
+func (c *batchCache) Register(key string) {
+	c.Lock()
+	defer c.Unlock()
+
+	if !c.keys[key] {
+		c.keys[key] = true
+		c.fetched = time.Time{}
+	}
+}
+
+// Get returns the item of key from a lookup not older than batchTTL
+func (c *batchCache) Get(ctx context.Context, key string) (interface{}, bool, error) {
+	c.Register(key)
+
+	for {
+		c.Lock()
+		if c.items != nil && time.Since(c.fetched) < batchTTL {
+			item, ok := c.items[key]
+			c.Unlock()
+			return item, ok, nil
+		}
+
+		if call := c.call; call != nil {
+			c.Unlock()
+
+			select {
+			case <-call.done:
+			case <-ctx.Done():
+				return nil, false, ctx.Err()
+			}
+
+			// a call canceled by its caller is repeated with our context
+			if call.err != nil && call.err != context.Canceled && call.err != context.DeadlineExceeded {
+				return nil, false, call.err
+			}
+			continue
+		}
+
+		call := &batchCall{done: make(chan struct{})}
+		c.call = call
+		keys := make([]string, 0, len(c.keys))
+		for k := range c.keys {
+			keys = append(keys, k)
+		}
+		c.Unlock()
+
+		sort.Strings(keys)
+		items, err := c.fetch(ctx, keys)
+
+		c.Lock()
+		c.call = nil
+		if err == nil {
+			c.items = items
+			c.fetched = time.Now()
+		}
+		c.Unlock()
+
+		call.err = err
+		close(call.done)
+
+		if err != nil {
+			return nil, false, err
+		}
+
+		item, ok := items[key]
+		return item, ok, nil
+	}
+}
+
+// Invalidate makes the next Get look up again, called after an instance changes
+func (c *batchCache) Invalidate() {
+	c.Lock()
+	defer c.Unlock()
+	c.fetched = time.Time{}
+}
+
+// chunks splits keys into slices of at most size
+func chunks(keys []string, size int) [][]string {
+	var result [][]string
+	for len(keys) > size {
+		result = append(result, keys[:size])
+		keys = keys[size:]
+	}
+	if len(keys) > 0 {
+		result = append(result, keys)
+	}
+	return result
+}
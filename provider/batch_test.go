@@ -0,0 +1,223 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/awstesting/unit"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	compute "google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+)
+
+func TestBatchCache_Get(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+
+	cache := newBatchCache(func(ctx context.Context, keys []string) (map[string]interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		items := make(map[string]interface{})
+		for _, key := range keys {
+			if key != "missing" {
+				items[key] = "item-" + key
+			}
+		}
+		return items, nil
+	})
+
+	keys := []string{"a", "b", "c", "missing"}
+	for _, key := range keys {
+		cache.Register(key)
+	}
+
+	var wg sync.WaitGroup
+	results := make([]interface{}, len(keys))
+	found := make([]bool, len(keys))
+	for i, key := range keys {
+		wg.Add(1)
+		go func(i int, key string) {
+			defer wg.Done()
+			item, ok, err := cache.Get(context.Background(), key)
+			if err != nil {
+				t.Errorf("batchCache.Get(%q) returned unexpected error: %v", key, err)
+			}
+			results[i], found[i] = item, ok
+		}(i, key)
+	}
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("batchCache.Get made %d calls, want 1", n)
+	}
+
+	want := []interface{}{"item-a", "item-b", "item-c", nil}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("batchCache.Get returned %v, want %v", results, want)
+	}
+	if !reflect.DeepEqual(found, []bool{true, true, true, false}) {
+		t.Errorf("batchCache.Get found %v, want %v", found, []bool{true, true, true, false})
+	}
+
+	cache.Get(context.Background(), "a")
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("batchCache.Get made %d calls within batchTTL, want 1", n)
+	}
+
+	cache.Invalidate()
+	cache.Get(context.Background(), "a")
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("batchCache.Get made %d calls after Invalidate, want 2", n)
+	}
+}
+
+func TestBatchCache_Get_error(t *testing.T) {
+	fail := errors.New("fail")
+	cache := newBatchCache(func(ctx context.Context, keys []string) (map[string]interface{}, error) {
+		return nil, fail
+	})
+
+	if _, _, err := cache.Get(context.Background(), "a"); err != fail {
+		t.Errorf("batchCache.Get returned %v, want %v", err, fail)
+	}
+}
+
+func TestChunks(t *testing.T) {
+	var chunksTable = []struct {
+		in   []string
+		size int
+		out  [][]string
+	}{
+		{nil, 2, nil},
+		{[]string{"a"}, 2, [][]string{{"a"}}},
+		{[]string{"a", "b"}, 2, [][]string{{"a", "b"}}},
+		{[]string{"a", "b", "c"}, 2, [][]string{{"a", "b"}, {"c"}}},
+	}
+
+	for _, tt := range chunksTable {
+		if out := chunks(tt.in, tt.size); !reflect.DeepEqual(out, tt.out) {
+			t.Errorf("chunks(%v, %d) returned %v, want %v", tt.in, tt.size, out, tt.out)
+		}
+	}
+}
+
+func TestEC2_Status_batch(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		r.ParseForm()
+		if r.Form.Get("Filter.1.Name") != "instance-id" || r.Form.Get("Filter.1.Value.1") != "i-0" {
+			t.Errorf("DescribeInstances got filter %v", r.Form)
+		}
+		w.Write([]byte(exampleDescribeInstancesResponse))
+	}))
+	defer server.Close()
+
+	svc := ec2.New(unit.Session, &aws.Config{Endpoint: aws.String(server.URL + "/")})
+	batch := newBatchCache(ec2Fetch(svc))
+	batch.Register("i-0")
+	batch.Register("i-1")
+
+	found := &EC2{InstanceID: "i-0", ec2Service: svc, batch: batch}
+	missing := &EC2{InstanceID: "i-1", ec2Service: svc, batch: batch}
+
+	status, err := found.Status(context.Background())
+	if err != nil {
+		t.Errorf("EC2.Status returned unexpected error: %v", err)
+	}
+	if status != StatusInstanceNotRun {
+		t.Errorf("EC2.Status returned %+v, want %+v", status, StatusInstanceNotRun)
+	}
+
+	_, err = missing.Status(context.Background())
+	if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != "InvalidInstanceID.NotFound" {
+		t.Errorf("EC2.Status returned %v, want InvalidInstanceID.NotFound", err)
+	}
+	if !IsPermanent(err) {
+		t.Errorf("IsPermanent(%v) returned false, want true", err)
+	}
+
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("DescribeInstances called %d times, want 1", n)
+	}
+}
+
+func TestGCE_Status_batch(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if filter := r.URL.Query().Get("filter"); filter != `name eq (instance-1|instance-2)` {
+			t.Errorf("AggregatedList got filter %q", filter)
+		}
+		fmt.Fprint(w, `{"items": {
+			"zones/europe-west1-a": {"instances": [{"name": "instance-1", "status": "TERMINATED"}]},
+			"zones/europe-west1-b": {"instances": [{"name": "instance-2", "status": "RUNNING"}]}
+		}}`)
+	}))
+	defer server.Close()
+
+	computeService, _ := compute.New(http.DefaultClient)
+	computeService.BasePath = server.URL + "/"
+
+	batch := newBatchCache(gceFetch(computeService, "my-project"))
+	var statusTable = []struct {
+		zone string
+		name string
+		out  StatusInstance
+		code int
+	}{
+		{"europe-west1-a", "instance-1", StatusInstanceNotRun, 0},
+		{"europe-west1-b", "instance-2", StatusInstanceRunning, 0},
+		{"europe-west1-a", "instance-2", StatusInstanceNotAvailable, http.StatusNotFound},
+	}
+
+	for _, tt := range statusTable {
+		batch.Register(gceKey(tt.zone, tt.name))
+	}
+
+	for _, tt := range statusTable {
+		inst := &GCE{ProjectID: "my-project", Zone: tt.zone, Name: tt.name, computeService: computeService, batch: batch}
+
+		status, err := inst.Status(context.Background())
+		if status != tt.out {
+			t.Errorf("GCE.Status(%s/%s) returned %+v, want %+v", tt.zone, tt.name, status, tt.out)
+		}
+
+		code := 0
+		if gerr, ok := err.(*googleapi.Error); ok {
+			code = gerr.Code
+		} else if err != nil {
+			t.Errorf("GCE.Status(%s/%s) returned unexpected error: %v", tt.zone, tt.name, err)
+		}
+		if code != tt.code {
+			t.Errorf("GCE.Status(%s/%s) returned error code %d, want %d", tt.zone, tt.name, code, tt.code)
+		}
+	}
+
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("AggregatedList called %d times, want 1", n)
+	}
+}
+
+func TestGetAWSSession_shared(t *testing.T) {
+	a, _ := getAWSSession("shared", "secret", "us-west-2")
+	b, _ := getAWSSession("shared", "secret", "us-west-2")
+	c, _ := getAWSSession("shared", "secret", "eu-west-1")
+
+	if a != b {
+		t.Errorf("getAWSSession returned different sessions for one account and region")
+	}
+	if a == c {
+		t.Errorf("getAWSSession returned one session for different regions")
+	}
+}
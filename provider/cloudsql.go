@@ -0,0 +1,145 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	sqladmin "google.golang.org/api/sqladmin/v1beta4"
+
+	"github.com/silentsokolov/go-sleep/log"
+)
+
+// CloudSQL toggles the activation policy of a Cloud SQL instance
+type CloudSQL struct {
+	JWTPath         string
+	ProjectID       string
+	Name            string
+	UseInternalIP   bool
+	client          *http.Client
+	sqladminService *sqladmin.Service
+}
+
+// NewCloudSQL ..
+func NewCloudSQL(JWTPath, ProjectID, Name string, UseInternalIP bool) *CloudSQL {
+	client, err := getGoogleClient(JWTPath, sqladmin.CloudPlatformScope, sqladmin.SqlserviceAdminScope)
+	if err != nil {
+		log.Fatalf("Cloud SQL %s: Unable to create HTTP client: %v", Name, err)
+	}
+
+	sqladminService, err := sqladmin.New(client)
+	if err != nil {
+		log.Fatalf("Cloud SQL %s: Unable to create SQL Admin service: %v", Name, err)
+	}
+
+	return &CloudSQL{
+		JWTPath:         JWTPath,
+		ProjectID:       ProjectID,
+		Name:            Name,
+		UseInternalIP:   UseInternalIP,
+		client:          client,
+		sqladminService: sqladminService,
+	}
+}
+
+// String ...
+func (p *CloudSQL) String() string {
+	return fmt.Sprintf("[Cloud SQL] Name: %s-%s", p.ProjectID, p.Name)
+}
+
+// Hash ...
+func (p *CloudSQL) Hash() string {
+	return fmt.Sprintf("cloudsql-%s-%s", p.ProjectID, p.Name)
+}
+
+// Status ...
+func (p *CloudSQL) Status(ctx context.Context) (StatusInstance, error) {
+	inst, err := p.sqladminService.Instances.Get(p.ProjectID, p.Name).Context(ctx).Do()
+	if err != nil {
+		return StatusInstanceNotAvailable, err
+	}
+
+	ops, err := p.sqladminService.Operations.List(p.ProjectID, p.Name).MaxResults(1).Context(ctx).Do()
+	if err != nil {
+		return StatusInstanceNotAvailable, err
+	}
+
+	// activation policy is changed by UPDATE operations
+	pending := len(ops.Items) > 0 && ops.Items[0].OperationType == "UPDATE" && ops.Items[0].Status != "DONE"
+
+	policy := ""
+	if inst.Settings != nil {
+		policy = inst.Settings.ActivationPolicy
+	}
+
+	status := normalizeCloudSQLStatus(inst.State, policy, pending)
+	if status == StatusInstanceError {
+		return status, &StateError{fmt.Sprintf("Cloud SQL %s is %s", p.Name, inst.State)}
+	}
+	return status, nil
+}
+
+// IP ...
+func (p *CloudSQL) IP(ctx context.Context) (string, error) {
+	inst, err := p.sqladminService.Instances.Get(p.ProjectID, p.Name).Context(ctx).Do()
+	if err != nil {
+		return "", err
+	}
+
+	ipType := "PRIMARY"
+	if p.UseInternalIP {
+		ipType = "PRIVATE"
+	}
+
+	for _, addr := range inst.IpAddresses {
+		if addr.Type == ipType {
+			return addr.IpAddress, nil
+		}
+	}
+
+	return "", fmt.Errorf("Cloud SQL %s has no %s IP address", p.Name, ipType)
+}
+
+// Start ...
+func (p *CloudSQL) Start(ctx context.Context) error {
+	return p.setActivationPolicy(ctx, "ALWAYS")
+}
+
+// Stop ...
+func (p *CloudSQL) Stop(ctx context.Context) error {
+	return p.setActivationPolicy(ctx, "NEVER")
+}
+
+func (p *CloudSQL) setActivationPolicy(ctx context.Context, policy string) error {
+	patch := &sqladmin.DatabaseInstance{
+		Settings: &sqladmin.Settings{ActivationPolicy: policy},
+	}
+
+	_, err := p.sqladminService.Instances.Patch(p.ProjectID, p.Name, patch).Context(ctx).Do()
+	return err
+}
+
+func normalizeCloudSQLStatus(state, policy string, pending bool) StatusInstance {
+	switch state {
+	case "RUNNABLE":
+	case "PENDING_CREATE", "MAINTENANCE":
+		return StatusInstanceStarting
+	case "SUSPENDED":
+		return StatusInstanceNotRun
+	case "FAILED":
+		return StatusInstanceError
+	default:
+		return StatusInstanceNotAvailable
+	}
+
+	switch {
+	case policy == "NEVER" && pending:
+		return StatusInstanceStopping
+	case policy == "NEVER":
+		return StatusInstanceNotRun
+	case pending:
+		return StatusInstanceStarting
+	default:
+		return StatusInstanceRunning
+	}
+}
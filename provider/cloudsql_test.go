@@ -0,0 +1,148 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	sqladmin "google.golang.org/api/sqladmin/v1beta4"
+)
+
+// fakeSQLAdmin is a minimal stand-in of the Cloud SQL Admin API
+type fakeSQLAdmin struct {
+	sync.Mutex
+	policy  string
+	pending bool
+}
+
+func (api *fakeSQLAdmin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	api.Lock()
+	defer api.Unlock()
+
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/operations"):
+		status := "DONE"
+		if api.pending {
+			status = "RUNNING"
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"items": []map[string]string{{"operationType": "UPDATE", "status": status}},
+		})
+	case strings.HasSuffix(r.URL.Path, "/instances/staging") && r.Method == http.MethodPatch:
+		var patch sqladmin.DatabaseInstance
+		json.NewDecoder(r.Body).Decode(&patch)
+		api.policy = patch.Settings.ActivationPolicy
+		api.pending = true
+		w.Write([]byte(`{"operationType": "UPDATE", "status": "PENDING"}`))
+	case strings.HasSuffix(r.URL.Path, "/instances/staging"):
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"state":    "RUNNABLE",
+			"settings": map[string]string{"activationPolicy": api.policy},
+			"ipAddresses": []map[string]string{
+				{"type": "PRIMARY", "ipAddress": "35.10.0.1"},
+				{"type": "PRIVATE", "ipAddress": "10.0.0.1"},
+			},
+		})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func initTestCloudSQL(server *httptest.Server) *CloudSQL {
+	sqladminService, _ := sqladmin.New(http.DefaultClient)
+	sqladminService.BasePath = server.URL + "/"
+
+	return &CloudSQL{
+		ProjectID:       "my-project",
+		Name:            "staging",
+		sqladminService: sqladminService,
+	}
+}
+
+func TestCloudSQL_Hash(t *testing.T) {
+	p := &CloudSQL{ProjectID: "my-project", Name: "staging"}
+	s := "cloudsql-my-project-staging"
+
+	if p.Hash() != s {
+		t.Errorf("CloudSQL.Hash returned %+v, want %+v", p.Hash(), s)
+	}
+}
+
+func TestCloudSQL_StartStop(t *testing.T) {
+	api := &fakeSQLAdmin{policy: "NEVER"}
+	server := httptest.NewServer(api)
+	defer server.Close()
+	p := initTestCloudSQL(server)
+	ctx := context.Background()
+
+	if status, err := p.Status(ctx); err != nil || status != StatusInstanceNotRun {
+		t.Errorf("CloudSQL.Status returned %v (%v), want %v", status, err, StatusInstanceNotRun)
+	}
+
+	if err := p.Start(ctx); err != nil {
+		t.Fatalf("CloudSQL.Start returned unexpected error: %v", err)
+	}
+
+	if api.policy != "ALWAYS" {
+		t.Errorf("CloudSQL.Start set policy %v, want %v", api.policy, "ALWAYS")
+	}
+
+	if status, _ := p.Status(ctx); status != StatusInstanceStarting {
+		t.Errorf("CloudSQL.Status returned %v, want %v", status, StatusInstanceStarting)
+	}
+
+	api.pending = false
+	if status, _ := p.Status(ctx); status != StatusInstanceRunning {
+		t.Errorf("CloudSQL.Status returned %v, want %v", status, StatusInstanceRunning)
+	}
+
+	if err := p.Stop(ctx); err != nil {
+		t.Fatalf("CloudSQL.Stop returned unexpected error: %v", err)
+	}
+
+	if status, _ := p.Status(ctx); status != StatusInstanceStopping {
+		t.Errorf("CloudSQL.Status returned %v, want %v", status, StatusInstanceStopping)
+	}
+}
+
+func TestCloudSQL_IP(t *testing.T) {
+	server := httptest.NewServer(&fakeSQLAdmin{policy: "ALWAYS"})
+	defer server.Close()
+	p := initTestCloudSQL(server)
+
+	ip, err := p.IP(context.Background())
+	if err != nil || ip != "35.10.0.1" {
+		t.Errorf("CloudSQL.IP returned %v (%v), want %v", ip, err, "35.10.0.1")
+	}
+
+	p.UseInternalIP = true
+	ip, err = p.IP(context.Background())
+	if err != nil || ip != "10.0.0.1" {
+		t.Errorf("CloudSQL.IP (UseInternalIP) returned %v (%v), want %v", ip, err, "10.0.0.1")
+	}
+}
+
+func TestNormalizeCloudSQLStatus(t *testing.T) {
+	var statusTable = []struct {
+		state, policy string
+		pending       bool
+		out           StatusInstance
+	}{
+		{"RUNNABLE", "ALWAYS", false, StatusInstanceRunning},
+		{"RUNNABLE", "ALWAYS", true, StatusInstanceStarting},
+		{"RUNNABLE", "NEVER", true, StatusInstanceStopping},
+		{"RUNNABLE", "NEVER", false, StatusInstanceNotRun},
+		{"SUSPENDED", "ALWAYS", false, StatusInstanceNotRun},
+		{"FAILED", "ALWAYS", false, StatusInstanceError},
+	}
+
+	for _, test := range statusTable {
+		if s := normalizeCloudSQLStatus(test.state, test.policy, test.pending); s != test.out {
+			t.Errorf("normalizeCloudSQLStatus(%q, %q, %v) is %v, want %v", test.state, test.policy, test.pending, s, test.out)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+)
+
+// CPUUtilization returns the highest average CPU utilization per minute
+// within window, from CloudWatch
+func (p *EC2) CPUUtilization(ctx context.Context, window time.Duration) (float64, error) {
+	end := time.Now()
+
+	out, err := p.cloudwatchService.GetMetricStatisticsWithContext(ctx, &cloudwatch.GetMetricStatisticsInput{
+		Namespace:  aws.String("AWS/EC2"),
+		MetricName: aws.String("CPUUtilization"),
+		Dimensions: []*cloudwatch.Dimension{
+			{Name: aws.String("InstanceId"), Value: aws.String(p.InstanceID)},
+		},
+		StartTime:  aws.Time(end.Add(-window)),
+		EndTime:    aws.Time(end),
+		Period:     aws.Int64(60),
+		Statistics: []*string{aws.String(cloudwatch.StatisticAverage)},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if len(out.Datapoints) == 0 {
+		return 0, fmt.Errorf("EC2 %s: no CPU utilization datapoints", p.InstanceID)
+	}
+
+	var max float64
+	for _, point := range out.Datapoints {
+		if point.Average != nil && *point.Average > max {
+			max = *point.Average
+		}
+	}
+
+	return max, nil
+}
+
+// CPUUtilization returns the highest CPU utilization within window,
+// from Cloud Monitoring
+func (p *GCE) CPUUtilization(ctx context.Context, window time.Duration) (float64, error) {
+	end := time.Now().UTC()
+	filter := fmt.Sprintf(`metric.type = "compute.googleapis.com/instance/cpu/utilization" AND metric.labels.instance_name = %q AND resource.labels.zone = %q`, p.Name, p.Zone)
+
+	call := p.monitoringService.Projects.TimeSeries.List("projects/" + p.ProjectID).
+		Filter(filter).
+		IntervalStartTime(end.Add(-window).Format(time.RFC3339)).
+		IntervalEndTime(end.Format(time.RFC3339)).
+		Context(ctx)
+
+	var max float64
+	var points int
+	for {
+		resp, err := call.Do()
+		if err != nil {
+			return 0, err
+		}
+
+		for _, series := range resp.TimeSeries {
+			for _, point := range series.Points {
+				if point.Value == nil || point.Value.DoubleValue == nil {
+					continue
+				}
+				points++
+				// utilization is reported as a fraction
+				if v := *point.Value.DoubleValue * 100; v > max {
+					max = v
+				}
+			}
+		}
+
+		if len(resp.NextPageToken) == 0 {
+			break
+		}
+		call.PageToken(resp.NextPageToken)
+	}
+
+	if points == 0 {
+		return 0, fmt.Errorf("GCE %s: no CPU utilization points", p.Name)
+	}
+
+	return max, nil
+}
@@ -0,0 +1,83 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/awstesting/unit"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	monitoring "google.golang.org/api/monitoring/v3"
+)
+
+const exampleGetMetricStatisticsResponse = `<GetMetricStatisticsResponse xmlns="http://monitoring.amazonaws.com/doc/2010-08-01/">
+	<GetMetricStatisticsResult>
+		<Datapoints>
+			<member><Average>3.5</Average><Unit>Percent</Unit></member>
+			<member><Average>42.25</Average><Unit>Percent</Unit></member>
+		</Datapoints>
+		<Label>CPUUtilization</Label>
+	</GetMetricStatisticsResult>
+</GetMetricStatisticsResponse>`
+
+func TestEC2_CPUUtilization(t *testing.T) {
+	var instanceID string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		instanceID = r.Form.Get("Dimensions.member.1.Value")
+		w.Write([]byte(exampleGetMetricStatisticsResponse))
+	}))
+	defer server.Close()
+
+	p := &EC2{
+		InstanceID:        "i-0123",
+		cloudwatchService: cloudwatch.New(unit.Session, &aws.Config{Endpoint: aws.String(server.URL + "/")}),
+	}
+
+	cpu, err := p.CPUUtilization(context.Background(), 5*time.Minute)
+	if err != nil || cpu != 42.25 {
+		t.Errorf("EC2.CPUUtilization returned %v (%v), want %v", cpu, err, 42.25)
+	}
+
+	if instanceID != "i-0123" {
+		t.Errorf("EC2.CPUUtilization requested %q, want %q", instanceID, "i-0123")
+	}
+}
+
+func TestGCE_CPUUtilization(t *testing.T) {
+	var filter string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		filter = r.URL.Query().Get("filter")
+		series := []map[string]interface{}{{
+			"points": []map[string]interface{}{
+				{"value": map[string]float64{"doubleValue": 0.125}},
+				{"value": map[string]float64{"doubleValue": 0.5}},
+			},
+		}}
+
+		if r.URL.Query().Get("pageToken") == "" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"timeSeries": series[:0], "nextPageToken": "2"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"timeSeries": series})
+	}))
+	defer server.Close()
+
+	monitoringService, _ := monitoring.New(http.DefaultClient)
+	monitoringService.BasePath = server.URL + "/"
+	p := &GCE{ProjectID: "my-project", Zone: "europe-west1-b", Name: "test1", monitoringService: monitoringService}
+
+	cpu, err := p.CPUUtilization(context.Background(), 5*time.Minute)
+	if err != nil || cpu != 50 {
+		t.Errorf("GCE.CPUUtilization returned %v (%v), want %v", cpu, err, 50)
+	}
+
+	want := `metric.type = "compute.googleapis.com/instance/cpu/utilization" AND metric.labels.instance_name = "test1" AND resource.labels.zone = "europe-west1-b"`
+	if filter != want {
+		t.Errorf("GCE.CPUUtilization filtered %q, want %q", filter, want)
+	}
+}
@@ -1,26 +1,37 @@
 package provider
 
 import (
+	"context"
 	"fmt"
+	"sync"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/silentsokolov/go-sleep/log"
 )
 
 // EC2 ..
 type EC2 struct {
-	AccessKeyID     string
-	SecretAccessKey string
-	Region          string
-	InstanceID      string
-	UseInternalIP   bool
-	session         *session.Session
-	ec2Service      *ec2.EC2
+	AccessKeyID       string
+	SecretAccessKey   string
+	Region            string
+	InstanceID        string
+	UseInternalIP     bool
+	Selector          IPSelector
+	session           *session.Session
+	ec2Service        *ec2.EC2
+	cloudwatchService *cloudwatch.CloudWatch
+	batch             *batchCache
 }
 
+// ec2BatchSize is the number of instance IDs in one DescribeInstances filter
+const ec2BatchSize = 200
+
 // NewEC2 ..
 func NewEC2(AccessKeyID, SecretAccessKey, Region, InstanceID string, UseInternalIP bool) *EC2 {
 	session, err := getAWSSession(AccessKeyID, SecretAccessKey, Region)
@@ -28,14 +39,20 @@ func NewEC2(AccessKeyID, SecretAccessKey, Region, InstanceID string, UseInternal
 		log.Fatalf("EC2 %s: Unable to session: %v", InstanceID, err)
 	}
 
+	svc := ec2.New(session)
+	batch := sharedBatch(fmt.Sprintf("ec2/%s/%s", AccessKeyID, Region), ec2Fetch(svc))
+	batch.Register(InstanceID)
+
 	return &EC2{
-		AccessKeyID:     AccessKeyID,
-		SecretAccessKey: SecretAccessKey,
-		Region:          Region,
-		InstanceID:      InstanceID,
-		UseInternalIP:   UseInternalIP,
-		session:         session,
-		ec2Service:      ec2.New(session),
+		AccessKeyID:       AccessKeyID,
+		SecretAccessKey:   SecretAccessKey,
+		Region:            Region,
+		InstanceID:        InstanceID,
+		UseInternalIP:     UseInternalIP,
+		session:           session,
+		ec2Service:        svc,
+		cloudwatchService: cloudwatch.New(session),
+		batch:             batch,
 	}
 }
 
@@ -50,38 +67,40 @@ func (p *EC2) Hash() string {
 }
 
 // Status ...
-func (p *EC2) Status() (StatusInstance, error) {
-	inst, err := p.getInstance()
+func (p *EC2) Status(ctx context.Context) (StatusInstance, error) {
+	inst, err := p.getInstance(ctx)
 	if err != nil {
 		return StatusInstanceNotAvailable, err
 	}
 
-	return normalizeEC2Status(*inst.State.Name), nil
+	return NormalizeEC2Status(*inst.State.Name), nil
 }
 
 // IP ...
-func (p *EC2) IP() (string, error) {
-	inst, err := p.getInstance()
+func (p *EC2) IP(ctx context.Context) (string, error) {
+	inst, err := p.getInstance(ctx)
 	if err != nil {
 		return "", err
 	}
 
-	if p.UseInternalIP {
-		return *inst.PrivateIpAddress, nil
+	ip := ec2InstanceIP(inst, p.UseInternalIP, p.Selector)
+	if ip == "" {
+		return "", fmt.Errorf("EC2 %s has no %s", p.InstanceID, p.Selector)
 	}
 
-	return *inst.PublicIpAddress, nil
+	return ip, nil
 }
 
 // Start ...
-func (p *EC2) Start() error {
+func (p *EC2) Start(ctx context.Context) error {
 	params := &ec2.StartInstancesInput{
 		InstanceIds: []*string{
 			aws.String(p.InstanceID),
 		},
 	}
 
-	_, err := p.ec2Service.StartInstances(params)
+	_, err := p.ec2Service.StartInstancesWithContext(ctx, params)
+	p.Invalidate()
 	if err != nil {
 		return err
 	}
@@ -90,14 +109,15 @@ func (p *EC2) Start() error {
 }
 
 // Stop ...
-func (p *EC2) Stop() error {
+func (p *EC2) Stop(ctx context.Context) error {
 	params := &ec2.StopInstancesInput{
 		InstanceIds: []*string{
 			aws.String(p.InstanceID),
 		},
 	}
 
-	_, err := p.ec2Service.StopInstances(params)
+	_, err := p.ec2Service.StopInstancesWithContext(ctx, params)
+	p.Invalidate()
 	if err != nil {
 		return err
 	}
@@ -105,34 +125,69 @@ func (p *EC2) Stop() error {
 	return nil
 }
 
-func (p *EC2) getInstance() (*ec2.Instance, error) {
-	instances := make([]*ec2.Instance, 0)
-
-	params := &ec2.DescribeInstancesInput{
-		InstanceIds: []*string{
-			aws.String(p.InstanceID),
-		},
+func (p *EC2) getInstance(ctx context.Context) (*ec2.Instance, error) {
+	if p.batch == nil {
+		items, err := ec2Fetch(p.ec2Service)(ctx, []string{p.InstanceID})
+		if err != nil {
+			return nil, err
+		}
+		return ec2Found(items[p.InstanceID], p.InstanceID)
 	}
 
-	resp, err := p.ec2Service.DescribeInstances(params)
+	item, _, err := p.batch.Get(ctx, p.InstanceID)
 	if err != nil {
 		return nil, err
 	}
+	return ec2Found(item, p.InstanceID)
+}
 
-	for _, r := range resp.Reservations {
-		for _, i := range r.Instances {
-			instances = append(instances, i)
-		}
+// Invalidate drops cached lookups of the account
+func (p *EC2) Invalidate() {
+	if p.batch != nil {
+		p.batch.Invalidate()
 	}
+}
 
-	if len(instances) < 1 {
-		return nil, fmt.Errorf("EC2 instance %s not found", p.InstanceID)
+func ec2Found(item interface{}, instanceID string) (*ec2.Instance, error) {
+	inst, ok := item.(*ec2.Instance)
+	if !ok {
+		return nil, awserr.New("InvalidInstanceID.NotFound", fmt.Sprintf("EC2 instance %s not found", instanceID), nil)
 	}
+	return inst, nil
+}
+
+// ec2Fetch describes instances by an instance-id filter, unlike
+// InstanceIds a missing instance doesn't fail the whole call
+func ec2Fetch(svc *ec2.EC2) batchFetch {
+	return func(ctx context.Context, ids []string) (map[string]interface{}, error) {
+		items := make(map[string]interface{}, len(ids))
+
+		for _, chunk := range chunks(ids, ec2BatchSize) {
+			params := &ec2.DescribeInstancesInput{
+				Filters: []*ec2.Filter{
+					{Name: aws.String("instance-id"), Values: aws.StringSlice(chunk)},
+				},
+			}
+
+			err := svc.DescribeInstancesPagesWithContext(ctx, params, func(resp *ec2.DescribeInstancesOutput, last bool) bool {
+				for _, r := range resp.Reservations {
+					for _, i := range r.Instances {
+						items[aws.StringValue(i.InstanceId)] = i
+					}
+				}
+				return true
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
 
-	return instances[0], nil
+		return items, nil
+	}
 }
 
-func normalizeEC2Status(originalStatus string) StatusInstance {
+// NormalizeEC2Status maps an EC2 instance state name to a status
+func NormalizeEC2Status(originalStatus string) StatusInstance {
 	switch originalStatus {
 	case "pending":
 		return StatusInstanceStarting
@@ -151,9 +206,37 @@ func normalizeEC2Status(originalStatus string) StatusInstance {
 	}
 }
 
+var awsSessions = struct {
+	sync.Mutex
+	sessions map[string]*session.Session
+}{sessions: make(map[string]*session.Session)}
+
+// getAWSSession returns the session shared by clients of one account and region,
+// requests of an account are limited by its rate limiter
 func getAWSSession(AccessKeyID, SecretAccessKey, Region string) (*session.Session, error) {
-	return session.NewSession(&aws.Config{
+	awsSessions.Lock()
+	defer awsSessions.Unlock()
+
+	key := fmt.Sprintf("%s/%s/%s", AccessKeyID, SecretAccessKey, Region)
+	if sess, ok := awsSessions.sessions[key]; ok {
+		return sess, nil
+	}
+
+	sess, err := session.NewSession(&aws.Config{
 		Region:      aws.String(Region),
 		Credentials: credentials.NewStaticCredentials(AccessKeyID, SecretAccessKey, ""),
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	limiter := accountLimiter("aws/" + AccessKeyID)
+	sess.Handlers.Sign.PushFront(func(r *request.Request) {
+		if err := limiter.Wait(r.Context()); err != nil {
+			r.Error = err
+		}
+	})
+
+	awsSessions.sessions[key] = sess
+	return sess, nil
 }
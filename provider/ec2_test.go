@@ -1,6 +1,7 @@
 package provider
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -84,7 +85,7 @@ func TestEC2_Status(t *testing.T) {
 		ec2Service:      svc,
 	}
 
-	status, err := inst.Status()
+	status, err := inst.Status(context.Background())
 	if err != nil {
 		t.Errorf("EC2.Status returned unexpected error: %v", err)
 	}
@@ -109,8 +110,8 @@ func TestNormalizeEC2Status(t *testing.T) {
 	}
 
 	for _, test := range statusTable {
-		if s := normalizeEC2Status(test.in); s != test.out {
-			t.Errorf("normalizeEC2Status is %v, want %v", s, test.out)
+		if s := NormalizeEC2Status(test.in); s != test.out {
+			t.Errorf("NormalizeEC2Status is %v, want %v", s, test.out)
 		}
 	}
 }
@@ -157,7 +158,7 @@ func TestEC2_Start(t *testing.T) {
 		ec2Service:      svc,
 	}
 
-	err := inst.Start()
+	err := inst.Start(context.Background())
 	if err != nil {
 		t.Errorf("EC2.Start returned unexpected error: %v", err)
 	}
@@ -177,7 +178,7 @@ func TestEC2_Stop(t *testing.T) {
 		ec2Service:      svc,
 	}
 
-	err := inst.Stop()
+	err := inst.Stop(context.Background())
 	if err != nil {
 		t.Errorf("EC2.Stop returned unexpected error: %v", err)
 	}
@@ -197,7 +198,7 @@ func TestEC2_IP(t *testing.T) {
 		ec2Service:      svc,
 	}
 
-	ip, err := inst.IP()
+	ip, err := inst.IP(context.Background())
 	if err != nil {
 		t.Errorf("EC2.IP returned unexpected error: %v", err)
 	}
@@ -222,7 +223,7 @@ func TestEC2_IP_withInternalIP(t *testing.T) {
 		ec2Service:      svc,
 	}
 
-	ip, err := inst.IP()
+	ip, err := inst.IP(context.Background())
 	if err != nil {
 		t.Errorf("EC2.IP returned unexpected error: %v", err)
 	}
@@ -0,0 +1,220 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/silentsokolov/go-sleep/log"
+)
+
+const (
+	defaultExecShell   = "/bin/sh"
+	defaultExecTimeout = 60 * time.Second
+)
+
+// ExecCommands ...
+type ExecCommands struct {
+	Start  string
+	Stop   string
+	Status string
+	IP     string
+}
+
+// ExecStatusMatch maps stdout of the status command to the status
+type ExecStatusMatch struct {
+	Match  *regexp.Regexp
+	Status StatusInstance
+}
+
+// Exec ..
+type Exec struct {
+	Name      string
+	Shell     string
+	Commands  ExecCommands
+	Timeout   time.Duration
+	Env       map[string]string
+	StatusMap []*ExecStatusMatch
+}
+
+// NewExec ..
+func NewExec(Name, Shell string, Commands ExecCommands, Timeout time.Duration, Env map[string]string, StatusMap []*ExecStatusMatch) *Exec {
+	if Commands.Status == "" || Commands.Start == "" || Commands.Stop == "" {
+		log.Fatalf("Exec %s: start, stop and status commands are required", Name)
+	}
+
+	if Shell == "" {
+		Shell = defaultExecShell
+	}
+
+	if Timeout <= 0 {
+		Timeout = defaultExecTimeout
+	}
+
+	return &Exec{
+		Name:      Name,
+		Shell:     Shell,
+		Commands:  Commands,
+		Timeout:   Timeout,
+		Env:       Env,
+		StatusMap: StatusMap,
+	}
+}
+
+// NewExecStatusMatch ..
+func NewExecStatusMatch(match, status string) (*ExecStatusMatch, error) {
+	re, err := regexp.Compile(match)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := ParseStatusInstance(status)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ExecStatusMatch{Match: re, Status: s}, nil
+}
+
+// String ...
+func (p *Exec) String() string {
+	return fmt.Sprintf("[Exec] Name: %s", p.Name)
+}
+
+// Hash ...
+func (p *Exec) Hash() string {
+	return fmt.Sprintf("exec-%s", p.Name)
+}
+
+// Status maps stdout of the status command, a non-zero exit code is a status
+// too, e.g. "systemctl is-active" prints inactive and exits with 3
+func (p *Exec) Status(ctx context.Context) (StatusInstance, error) {
+	out, err := p.run(ctx, p.Commands.Status)
+	if err != nil && out == "" {
+		return StatusInstanceNotAvailable, err
+	}
+
+	status, parseErr := p.parseStatus(out)
+	if parseErr != nil && err != nil {
+		return StatusInstanceNotAvailable, err
+	}
+	return status, parseErr
+}
+
+// IP ...
+func (p *Exec) IP(ctx context.Context) (string, error) {
+	if p.Commands.IP == "" {
+		return "", fmt.Errorf("Exec %s: ip command is not set", p.Name)
+	}
+
+	out, err := p.run(ctx, p.Commands.IP)
+	if err != nil {
+		return "", err
+	}
+
+	if out == "" {
+		return "", fmt.Errorf("Exec %s: ip command returned nothing", p.Name)
+	}
+
+	return strings.Fields(out)[0], nil
+}
+
+// Start ...
+func (p *Exec) Start(ctx context.Context) error {
+	_, err := p.run(ctx, p.Commands.Start)
+	return err
+}
+
+// Stop ...
+func (p *Exec) Stop(ctx context.Context) error {
+	_, err := p.run(ctx, p.Commands.Stop)
+	return err
+}
+
+func (p *Exec) parseStatus(out string) (StatusInstance, error) {
+	if len(p.StatusMap) == 0 {
+		return ParseStatusInstance(out)
+	}
+
+	for _, m := range p.StatusMap {
+		if m.Match.MatchString(out) {
+			return m.Status, nil
+		}
+	}
+
+	return StatusInstanceNotAvailable, fmt.Errorf("Exec %s: no status matches output %q", p.Name, out)
+}
+
+func (p *Exec) run(ctx context.Context, command string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+
+	out, err := runCommand(ctx, p.Shell, command, append(environ(p.Env), fmt.Sprintf("GO_SLEEP_NAME=%s", p.Name)))
+	if err != nil {
+		return out, fmt.Errorf("Exec %s: %v", p.Name, err)
+	}
+
+	return out, nil
+}
+
+// runCommand runs command by shell and returns trimmed stdout, stdout is
+// returned with the error of a non-zero exit code
+func runCommand(ctx context.Context, shell, command string, env []string) (string, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command(shell, "-c", command)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Env = env
+	// children of the shell may keep the output open after it is killed,
+	// so the whole group is killed on timeout
+	setProcessGroup(cmd)
+
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("%q: %v", command, err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		killProcessGroup(cmd)
+		<-done
+		return "", fmt.Errorf("%q: %v", command, ctx.Err())
+	}
+
+	if _, ok := err.(*exec.ExitError); ok {
+		return strings.TrimSpace(stdout.String()), fmt.Errorf("%q: %v: %s", command, err, strings.TrimSpace(stderr.String()))
+	} else if err != nil {
+		return "", fmt.Errorf("%q: %v", command, err)
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// environ returns the current environment extended with env
+func environ(env map[string]string) []string {
+	result := os.Environ()
+
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		result = append(result, fmt.Sprintf("%s=%s", k, env[k]))
+	}
+	return result
+}
@@ -0,0 +1,165 @@
+package provider
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func initTestExec(t *testing.T) (*Exec, string) {
+	dir, err := ioutil.TempDir("", "exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state := filepath.Join(dir, "state")
+	if err := ioutil.WriteFile(state, []byte("Chassis Power is off\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	running, _ := NewExecStatusMatch("is on$", "running")
+	stopped, _ := NewExecStatusMatch("is off$", "not run")
+
+	commands := ExecCommands{
+		Start:  `echo "Chassis Power is on" > "$STATE"`,
+		Stop:   `echo "Chassis Power is off" > "$STATE"`,
+		Status: `cat "$STATE"`,
+		IP:     `echo "$GO_SLEEP_NAME.local 10.10.10.1"`,
+	}
+
+	return NewExec("box", "", commands, time.Second, map[string]string{"STATE": state}, []*ExecStatusMatch{running, stopped}), dir
+}
+
+func TestExec_String(t *testing.T) {
+	p := &Exec{Name: "box"}
+	s := "[Exec] Name: box"
+
+	if p.String() != s {
+		t.Errorf("Exec.String returned %+v, want %+v", p.String(), s)
+	}
+}
+
+func TestExec_Hash(t *testing.T) {
+	p := &Exec{Name: "box"}
+	s := "exec-box"
+
+	if p.Hash() != s {
+		t.Errorf("Exec.Hash returned %+v, want %+v", p.Hash(), s)
+	}
+}
+
+func TestExec_StartStop(t *testing.T) {
+	p, dir := initTestExec(t)
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+
+	if status, err := p.Status(ctx); err != nil || status != StatusInstanceNotRun {
+		t.Errorf("Exec.Status returned %v (%v), want %v", status, err, StatusInstanceNotRun)
+	}
+
+	if err := p.Start(ctx); err != nil {
+		t.Fatalf("Exec.Start returned unexpected error: %v", err)
+	}
+
+	if status, err := p.Status(ctx); err != nil || status != StatusInstanceRunning {
+		t.Errorf("Exec.Status returned %v (%v), want %v", status, err, StatusInstanceRunning)
+	}
+
+	if err := p.Stop(ctx); err != nil {
+		t.Fatalf("Exec.Stop returned unexpected error: %v", err)
+	}
+
+	if status, err := p.Status(ctx); err != nil || status != StatusInstanceNotRun {
+		t.Errorf("Exec.Status returned %v (%v), want %v", status, err, StatusInstanceNotRun)
+	}
+}
+
+func TestExec_IP(t *testing.T) {
+	p, dir := initTestExec(t)
+	defer os.RemoveAll(dir)
+
+	ip, err := p.IP(context.Background())
+	if err != nil {
+		t.Fatalf("Exec.IP returned unexpected error: %v", err)
+	}
+
+	if ip != "box.local" {
+		t.Errorf("Exec.IP returned %+v, want %+v", ip, "box.local")
+	}
+}
+
+func TestExec_StatusDefaultMap(t *testing.T) {
+	p := NewExec("box", "", ExecCommands{Start: "true", Stop: "true", Status: "echo starting"}, time.Second, nil, nil)
+
+	status, err := p.Status(context.Background())
+	if err != nil || status != StatusInstanceStarting {
+		t.Errorf("Exec.Status returned %v (%v), want %v", status, err, StatusInstanceStarting)
+	}
+}
+
+func TestExec_StatusExitCode(t *testing.T) {
+	inactive, _ := NewExecStatusMatch("^inactive$", "not run")
+	p := NewExec("box", "", ExecCommands{Start: "true", Stop: "true", Status: "echo inactive; exit 3"}, time.Second, nil, []*ExecStatusMatch{inactive})
+
+	status, err := p.Status(context.Background())
+	if err != nil || status != StatusInstanceNotRun {
+		t.Errorf("Exec.Status returned %v (%v), want %v", status, err, StatusInstanceNotRun)
+	}
+
+	p.Commands.Status = "echo failed; exit 3"
+	if _, err := p.Status(context.Background()); err == nil || !strings.Contains(err.Error(), "exit status 3") {
+		t.Errorf("Exec.Status returned %v, want error with the exit code", err)
+	}
+
+	p.Commands.Status = "exit 3"
+	if _, err := p.Status(context.Background()); err == nil {
+		t.Error("Exec.Status expected error without output")
+	}
+}
+
+func TestExec_Errors(t *testing.T) {
+	p := NewExec("box", "", ExecCommands{Start: "echo denied >&2; exit 1", Stop: "sleep 5", Status: "echo unknown"}, 50*time.Millisecond, nil, nil)
+	ctx := context.Background()
+
+	if err := p.Start(ctx); err == nil || !strings.Contains(err.Error(), "denied") {
+		t.Errorf("Exec.Start returned %v, want error with stderr", err)
+	}
+
+	if err := p.Stop(ctx); err == nil || !strings.Contains(err.Error(), "deadline") {
+		t.Errorf("Exec.Stop returned %v, want timeout error", err)
+	}
+
+	if _, err := p.Status(ctx); err == nil {
+		t.Error("Exec.Status expected error for unknown status")
+	}
+
+	if _, err := p.IP(ctx); err == nil {
+		t.Error("Exec.IP expected error without ip command")
+	}
+}
+
+func TestExec_TimeoutChildren(t *testing.T) {
+	p := NewExec("box", "", ExecCommands{Start: "sleep 5 & sleep 5", Stop: "true", Status: "echo running"}, 50*time.Millisecond, nil, nil)
+
+	start := time.Now()
+	if err := p.Start(context.Background()); err == nil || !strings.Contains(err.Error(), "deadline") {
+		t.Errorf("Exec.Start returned %v, want timeout error", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Exec.Start returned after %v, children of the shell are not killed", elapsed)
+	}
+}
+
+func TestNewExecStatusMatch(t *testing.T) {
+	if _, err := NewExecStatusMatch("(", "running"); err == nil {
+		t.Error("NewExecStatusMatch expected error for invalid regexp")
+	}
+
+	if _, err := NewExecStatusMatch("on", "awake"); err == nil {
+		t.Error("NewExecStatusMatch expected error for invalid status")
+	}
+}
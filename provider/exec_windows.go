@@ -0,0 +1,11 @@
+package provider
+
+import "os/exec"
+
+// setProcessGroup is a no-op, children are not tracked on Windows
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills cmd
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
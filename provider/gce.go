@@ -1,28 +1,40 @@
 package provider
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"regexp"
+	"strings"
+	"sync"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	compute "google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+	monitoring "google.golang.org/api/monitoring/v3"
 
 	"github.com/silentsokolov/go-sleep/log"
 )
 
 // GCE ..
 type GCE struct {
-	JWTPath        string
-	ProjectID      string
-	Zone           string
-	Name           string
-	UseInternalIP  bool
-	client         *http.Client
-	computeService *compute.Service
+	JWTPath           string
+	ProjectID         string
+	Zone              string
+	Name              string
+	UseInternalIP     bool
+	Selector          IPSelector
+	client            *http.Client
+	computeService    *compute.Service
+	monitoringService *monitoring.Service
+	batch             *batchCache
 }
 
+// gceBatchSize is the number of names in one aggregated list filter
+const gceBatchSize = 100
+
 // NewGCE ..
 func NewGCE(JWTPath, ProjectID, Zone, Name string, UseInternalIP bool) *GCE {
 	client, err := getGoogleClient(JWTPath, compute.CloudPlatformScope, compute.ComputeScope)
@@ -35,14 +47,24 @@ func NewGCE(JWTPath, ProjectID, Zone, Name string, UseInternalIP bool) *GCE {
 		log.Fatalf("GCE  %s: Unable to create Compute service: %v", Name, err)
 	}
 
+	monitoringService, err := monitoring.New(client)
+	if err != nil {
+		log.Fatalf("GCE  %s: Unable to create Monitoring service: %v", Name, err)
+	}
+
+	batch := sharedBatch(fmt.Sprintf("gce/%s/%s", JWTPath, ProjectID), gceFetch(computeService, ProjectID))
+	batch.Register(gceKey(Zone, Name))
+
 	return &GCE{
-		JWTPath:        JWTPath,
-		ProjectID:      ProjectID,
-		Zone:           Zone,
-		Name:           Name,
-		UseInternalIP:  UseInternalIP,
-		client:         client,
-		computeService: computeService,
+		JWTPath:           JWTPath,
+		ProjectID:         ProjectID,
+		Zone:              Zone,
+		Name:              Name,
+		UseInternalIP:     UseInternalIP,
+		client:            client,
+		computeService:    computeService,
+		monitoringService: monitoringService,
+		batch:             batch,
 	}
 }
 
@@ -57,8 +79,8 @@ func (p *GCE) Hash() string {
 }
 
 // Status ...
-func (p *GCE) Status() (StatusInstance, error) {
-	inst, err := p.computeService.Instances.Get(p.ProjectID, p.Zone, p.Name).Do()
+func (p *GCE) Status(ctx context.Context) (StatusInstance, error) {
+	inst, err := p.getInstance(ctx)
 	if err != nil {
 		return StatusInstanceNotAvailable, err
 	}
@@ -67,21 +89,33 @@ func (p *GCE) Status() (StatusInstance, error) {
 }
 
 // IP ...
-func (p *GCE) IP() (string, error) {
-	inst, err := p.computeService.Instances.Get(p.ProjectID, p.Zone, p.Name).Do()
+func (p *GCE) IP(ctx context.Context) (string, error) {
+	inst, err := p.getInstance(ctx)
 	if err != nil {
 		return "", err
 	}
-	if p.UseInternalIP {
-		return inst.NetworkInterfaces[0].NetworkIP, nil
+
+	switch {
+	case p.Selector.IPv6:
+		return "", fmt.Errorf("GCE %s: IPv6 addresses are not supported", p.Name)
+	case p.Selector.DNSName && !p.UseInternalIP:
+		return "", fmt.Errorf("GCE %s: only internal DNS names are supported", p.Name)
+	case p.Selector.DNSName:
+		return fmt.Sprintf("%s.%s.c.%s.internal", p.Name, p.Zone, p.ProjectID), nil
+	}
+
+	ip := gceInterfaceIP(inst, p.Selector.Interface, p.UseInternalIP)
+	if ip == "" {
+		return "", fmt.Errorf("GCE %s has no %s", p.Name, p.Selector)
 	}
 
-	return inst.NetworkInterfaces[0].AccessConfigs[0].NatIP, nil
+	return ip, nil
 }
 
 // Start ...
-func (p *GCE) Start() error {
-	_, err := p.computeService.Instances.Start(p.ProjectID, p.Zone, p.Name).Do()
+func (p *GCE) Start(ctx context.Context) error {
+	_, err := p.computeService.Instances.Start(p.ProjectID, p.Zone, p.Name).Context(ctx).Do()
+	p.Invalidate()
 	if err != nil {
 		return err
 	}
@@ -89,14 +123,78 @@ func (p *GCE) Start() error {
 }
 
 // Stop ...
-func (p *GCE) Stop() error {
-	_, err := p.computeService.Instances.Stop(p.ProjectID, p.Zone, p.Name).Do()
+func (p *GCE) Stop(ctx context.Context) error {
+	_, err := p.computeService.Instances.Stop(p.ProjectID, p.Zone, p.Name).Context(ctx).Do()
+	p.Invalidate()
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+func (p *GCE) getInstance(ctx context.Context) (*compute.Instance, error) {
+	if p.batch == nil {
+		return p.computeService.Instances.Get(p.ProjectID, p.Zone, p.Name).Context(ctx).Do()
+	}
+
+	item, _, err := p.batch.Get(ctx, gceKey(p.Zone, p.Name))
+	if err != nil {
+		return nil, err
+	}
+
+	inst, ok := item.(*compute.Instance)
+	if !ok {
+		return nil, &googleapi.Error{Code: http.StatusNotFound, Message: fmt.Sprintf("GCE instance %s not found in %s", p.Name, p.Zone)}
+	}
+	return inst, nil
+}
+
+// Invalidate drops cached lookups of the project
+func (p *GCE) Invalidate() {
+	if p.batch != nil {
+		p.batch.Invalidate()
+	}
+}
+
+func gceKey(zone, name string) string {
+	return zone + "/" + name
+}
+
+// gceFetch lists instances of project in all zones filtered by name
+func gceFetch(svc *compute.Service, project string) batchFetch {
+	return func(ctx context.Context, keys []string) (map[string]interface{}, error) {
+		names := make([]string, 0, len(keys))
+		seen := make(map[string]bool, len(keys))
+		for _, key := range keys {
+			name := key[strings.Index(key, "/")+1:]
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, regexp.QuoteMeta(name))
+			}
+		}
+
+		items := make(map[string]interface{}, len(keys))
+		for _, chunk := range chunks(names, gceBatchSize) {
+			filter := fmt.Sprintf("name eq (%s)", strings.Join(chunk, "|"))
+
+			err := svc.Instances.AggregatedList(project).Filter(filter).Pages(ctx, func(list *compute.InstanceAggregatedList) error {
+				for scope, scoped := range list.Items {
+					zone := strings.TrimPrefix(scope, "zones/")
+					for _, inst := range scoped.Instances {
+						items[gceKey(zone, inst.Name)] = inst
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return items, nil
+	}
+}
+
 func normalizeGCEStatus(originalStatus string) StatusInstance {
 	switch originalStatus {
 	case "PROVISIONING":
@@ -118,7 +216,22 @@ func normalizeGCEStatus(originalStatus string) StatusInstance {
 	}
 }
 
+var googleClients = struct {
+	sync.Mutex
+	clients map[string]*http.Client
+}{clients: make(map[string]*http.Client)}
+
+// getGoogleClient returns the client shared by services of one account,
+// requests of an account are limited by its rate limiter
 func getGoogleClient(JWTpath string, scope ...string) (*http.Client, error) {
+	googleClients.Lock()
+	defer googleClients.Unlock()
+
+	key := JWTpath + " " + strings.Join(scope, " ")
+	if client, ok := googleClients.clients[key]; ok {
+		return client, nil
+	}
+
 	data, err := ioutil.ReadFile(JWTpath)
 
 	if err != nil {
@@ -130,5 +243,8 @@ func getGoogleClient(JWTpath string, scope ...string) (*http.Client, error) {
 		return nil, err
 	}
 
-	return conf.Client(oauth2.NoContext), nil
+	ctx := context.WithValue(oauth2.NoContext, oauth2.HTTPClient, limitedClient("google/"+JWTpath))
+	client := conf.Client(ctx)
+	googleClients.clients[key] = client
+	return client, nil
 }
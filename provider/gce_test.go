@@ -176,7 +176,7 @@ func TestGCE_Status(t *testing.T) {
 		computeService: computeService,
 	}
 
-	status, err := inst.Status()
+	status, err := inst.Status(context.Background())
 	if err != nil {
 		t.Fatalf("GCE.Status returned unexpected error: %v", err)
 	}
@@ -210,7 +210,7 @@ func TestGCE_Start(t *testing.T) {
 		computeService: computeService,
 	}
 
-	err = inst.Start()
+	err = inst.Start(context.Background())
 	if err != nil {
 		t.Errorf("GCE.Start returned unexpected error: %v", err)
 	}
@@ -240,7 +240,7 @@ func TestGCE_Stop(t *testing.T) {
 		computeService: computeService,
 	}
 
-	err = inst.Stop()
+	err = inst.Stop(context.Background())
 	if err != nil {
 		t.Errorf("GCE.Stop returned unexpected error: %v", err)
 	}
@@ -270,7 +270,7 @@ func TestGCE_IP(t *testing.T) {
 		computeService: computeService,
 	}
 
-	ip, err := inst.IP()
+	ip, err := inst.IP(context.Background())
 	if err != nil {
 		t.Errorf("GCE.IP returned unexpected error: %v", err)
 	}
@@ -305,7 +305,7 @@ func TestGCE_IP_withInternalIP(t *testing.T) {
 		computeService: computeService,
 	}
 
-	ip, err := inst.IP()
+	ip, err := inst.IP(context.Background())
 	if err != nil {
 		t.Fatalf("GCE.IP (UseInternalIP) returned unexpected error: %v", err)
 	}
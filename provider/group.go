@@ -0,0 +1,26 @@
+package provider
+
+import (
+	"context"
+)
+
+// MultiIPProvider is implemented by providers of instance groups,
+// requests are spread over all returned addresses
+type MultiIPProvider interface {
+	IPs(ctx context.Context) ([]string, error)
+}
+
+// normalizeGroupStatus aggregates the status of a group, it is running
+// when at least minHealthy members are healthy
+func normalizeGroupStatus(desired, members, healthy, minHealthy int) StatusInstance {
+	switch {
+	case desired == 0 && members == 0:
+		return StatusInstanceNotRun
+	case desired == 0:
+		return StatusInstanceStopping
+	case healthy >= minHealthy:
+		return StatusInstanceRunning
+	default:
+		return StatusInstanceStarting
+	}
+}
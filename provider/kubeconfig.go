@@ -0,0 +1,267 @@
+package provider
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	inClusterTokenFile     = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	inClusterCAFile        = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+	inClusterNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			Token                 string `yaml:"token"`
+			TokenFile             string `yaml:"tokenFile"`
+			ClientCertificate     string `yaml:"client-certificate"`
+			ClientCertificateData string `yaml:"client-certificate-data"`
+			ClientKey             string `yaml:"client-key"`
+			ClientKeyData         string `yaml:"client-key-data"`
+			Username              string `yaml:"username"`
+			Password              string `yaml:"password"`
+			Exec                  *struct {
+				Command string `yaml:"command"`
+			} `yaml:"exec"`
+			AuthProvider *struct {
+				Name string `yaml:"name"`
+			} `yaml:"auth-provider"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster   string `yaml:"cluster"`
+			User      string `yaml:"user"`
+			Namespace string `yaml:"namespace"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+}
+
+// kubeClient is a minimal client of the Kubernetes API
+type kubeClient struct {
+	host      string
+	token     string
+	tokenFile string
+	username  string
+	password  string
+	namespace string
+	client    *http.Client
+
+	tokenMu sync.Mutex
+}
+
+// newKubeClient loads credentials from the kubeconfig file, or from the
+// service account if the path is empty and go-sleep runs inside a cluster
+func newKubeClient(path, contextName string) (*kubeClient, error) {
+	if path == "" && os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		return newInClusterKubeClient()
+	}
+
+	if path == "" {
+		path = os.Getenv("KUBECONFIG")
+	}
+	if path == "" {
+		path = filepath.Join(os.Getenv("HOME"), ".kube", "config")
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var conf kubeconfig
+	if err := yaml.Unmarshal(data, &conf); err != nil {
+		return nil, fmt.Errorf("invalid kubeconfig %s: %v", path, err)
+	}
+	base := filepath.Dir(path)
+
+	if contextName == "" {
+		contextName = conf.CurrentContext
+	}
+
+	kc := &kubeClient{}
+	tlsConfig := &tls.Config{}
+	var clusterName, userName string
+
+	found := false
+	for _, c := range conf.Contexts {
+		if c.Name == contextName {
+			clusterName, userName, kc.namespace = c.Context.Cluster, c.Context.User, c.Context.Namespace
+			found = true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("context %q not found in %s", contextName, path)
+	}
+
+	found = false
+	for _, c := range conf.Clusters {
+		if c.Name != clusterName {
+			continue
+		}
+		found = true
+		kc.host = strings.TrimSuffix(c.Cluster.Server, "/")
+		tlsConfig.InsecureSkipVerify = c.Cluster.InsecureSkipTLSVerify
+
+		ca, err := readDataOrFile(c.Cluster.CertificateAuthorityData, c.Cluster.CertificateAuthority, base)
+		if err != nil {
+			return nil, err
+		}
+		if ca != nil {
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(ca) {
+				return nil, fmt.Errorf("invalid certificate authority of cluster %q", clusterName)
+			}
+			tlsConfig.RootCAs = pool
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("cluster %q not found in %s", clusterName, path)
+	}
+
+	found = false
+	for _, u := range conf.Users {
+		if u.Name != userName {
+			continue
+		}
+		found = true
+		// credential plugins of EKS, GKE and others are not supported
+		if u.User.Exec != nil {
+			return nil, fmt.Errorf("user %q of %s uses exec command %q, which is not supported, use a token or client certificate", userName, path, u.User.Exec.Command)
+		}
+		if u.User.AuthProvider != nil {
+			return nil, fmt.Errorf("user %q of %s uses auth-provider %q, which is not supported, use a token or client certificate", userName, path, u.User.AuthProvider.Name)
+		}
+
+		kc.token, kc.username, kc.password = u.User.Token, u.User.Username, u.User.Password
+
+		if kc.token == "" && u.User.TokenFile != "" {
+			kc.tokenFile = resolvePath(u.User.TokenFile, base)
+			if _, err := kc.bearerToken(); err != nil {
+				return nil, err
+			}
+		}
+
+		cert, err := readDataOrFile(u.User.ClientCertificateData, u.User.ClientCertificate, base)
+		if err != nil {
+			return nil, err
+		}
+		key, err := readDataOrFile(u.User.ClientKeyData, u.User.ClientKey, base)
+		if err != nil {
+			return nil, err
+		}
+		if cert != nil && key != nil {
+			pair, err := tls.X509KeyPair(cert, key)
+			if err != nil {
+				return nil, err
+			}
+			tlsConfig.Certificates = []tls.Certificate{pair}
+		}
+	}
+
+	if !found {
+		return nil, fmt.Errorf("user %q not found in %s", userName, path)
+	}
+
+	kc.client = newKubeHTTPClient(tlsConfig)
+
+	return kc, nil
+}
+
+func newInClusterKubeClient() (*kubeClient, error) {
+	kc := &kubeClient{tokenFile: inClusterTokenFile}
+	if _, err := kc.bearerToken(); err != nil {
+		return nil, err
+	}
+
+	ca, err := ioutil.ReadFile(inClusterCAFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca)
+
+	namespace, _ := ioutil.ReadFile(inClusterNamespaceFile)
+
+	kc.host = "https://" + net.JoinHostPort(os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT"))
+	kc.namespace = strings.TrimSpace(string(namespace))
+	kc.client = newKubeHTTPClient(&tls.Config{RootCAs: pool})
+
+	return kc, nil
+}
+
+// bearerToken returns the token of the client, a token file is read on every
+// call as service account tokens are rotated, the last token is kept if the
+// file can't be read
+func (c *kubeClient) bearerToken() (string, error) {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+
+	if c.tokenFile == "" {
+		return c.token, nil
+	}
+
+	token, err := ioutil.ReadFile(c.tokenFile)
+	if err != nil {
+		if c.token != "" {
+			return c.token, nil
+		}
+		return "", err
+	}
+	c.token = strings.TrimSpace(string(token))
+
+	return c.token, nil
+}
+
+func newKubeHTTPClient(tlsConfig *tls.Config) *http.Client {
+	return &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		},
+	}
+}
+
+func readDataOrFile(data, path, base string) ([]byte, error) {
+	if data != "" {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	if path != "" {
+		return ioutil.ReadFile(resolvePath(path, base))
+	}
+	return nil, nil
+}
+
+func resolvePath(path, base string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(base, path)
+}
@@ -0,0 +1,285 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/silentsokolov/go-sleep/log"
+)
+
+// Kubernetes kinds
+const (
+	KindDeployment  = "Deployment"
+	KindStatefulSet = "StatefulSet"
+)
+
+// KubernetesError ...
+type KubernetesError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *KubernetesError) Error() string {
+	return fmt.Sprintf("kubernetes API error %d: %s", e.StatusCode, e.Message)
+}
+
+// Throttled ...
+func (e *KubernetesError) Throttled() bool {
+	return e.StatusCode == http.StatusTooManyRequests
+}
+
+// Permanent ...
+func (e *KubernetesError) Permanent() bool {
+	switch e.StatusCode {
+	case http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusUnprocessableEntity:
+		return true
+	}
+	return false
+}
+
+// Kubernetes scales a Deployment or a StatefulSet between 0 and Replicas
+type Kubernetes struct {
+	Namespace    string
+	Kind         string
+	Name         string
+	Replicas     int
+	Service      string
+	UseEndpoints bool
+	client       *kubeClient
+}
+
+type kubeWorkload struct {
+	Spec struct {
+		Replicas *int `json:"replicas"`
+	} `json:"spec"`
+	Status struct {
+		Replicas      int `json:"replicas"`
+		ReadyReplicas int `json:"readyReplicas"`
+	} `json:"status"`
+}
+
+type kubeService struct {
+	Spec struct {
+		ClusterIP string `json:"clusterIP"`
+	} `json:"spec"`
+}
+
+type kubeEndpoints struct {
+	Subsets []struct {
+		Addresses []struct {
+			IP string `json:"ip"`
+		} `json:"addresses"`
+	} `json:"subsets"`
+}
+
+// NewKubernetes ..
+func NewKubernetes(Kubeconfig, Context, Namespace, Kind, Name string, Replicas int, Service string, UseEndpoints bool) *Kubernetes {
+	client, err := newKubeClient(Kubeconfig, Context)
+	if err != nil {
+		log.Fatalf("Kubernetes %s: Unable to create client: %v", Name, err)
+	}
+
+	if Namespace == "" {
+		Namespace = client.namespace
+	}
+	if Namespace == "" {
+		Namespace = "default"
+	}
+
+	switch strings.ToLower(Kind) {
+	case "", "deployment":
+		Kind = KindDeployment
+	case "statefulset":
+		Kind = KindStatefulSet
+	default:
+		log.Fatalf("Kubernetes %s: unsupported kind %q", Name, Kind)
+	}
+
+	if Replicas <= 0 {
+		Replicas = 1
+	}
+
+	if Service == "" {
+		Service = Name
+	}
+
+	return &Kubernetes{
+		Namespace:    Namespace,
+		Kind:         Kind,
+		Name:         Name,
+		Replicas:     Replicas,
+		Service:      Service,
+		UseEndpoints: UseEndpoints,
+		client:       client,
+	}
+}
+
+// String ...
+func (p *Kubernetes) String() string {
+	return fmt.Sprintf("[Kubernetes] %s: %s/%s", p.Kind, p.Namespace, p.Name)
+}
+
+// Hash ...
+func (p *Kubernetes) Hash() string {
+	return fmt.Sprintf("kubernetes-%s-%s-%s", strings.ToLower(p.Kind), p.Namespace, p.Name)
+}
+
+// Status ...
+func (p *Kubernetes) Status(ctx context.Context) (StatusInstance, error) {
+	var workload kubeWorkload
+	if err := p.client.do(ctx, http.MethodGet, p.workloadPath(), nil, &workload); err != nil {
+		return StatusInstanceNotAvailable, err
+	}
+
+	desired := 1
+	if workload.Spec.Replicas != nil {
+		desired = *workload.Spec.Replicas
+	}
+
+	return normalizeKubernetesStatus(desired, workload.Status.Replicas, workload.Status.ReadyReplicas), nil
+}
+
+// IP returns the service ClusterIP or the first ready endpoint
+func (p *Kubernetes) IP(ctx context.Context) (string, error) {
+	ips, err := p.IPs(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return ips[0], nil
+}
+
+// IPs returns the service ClusterIP or all ready endpoints
+func (p *Kubernetes) IPs(ctx context.Context) ([]string, error) {
+	if p.UseEndpoints {
+		var endpoints kubeEndpoints
+		path := fmt.Sprintf("/api/v1/namespaces/%s/endpoints/%s", p.Namespace, p.Service)
+		if err := p.client.do(ctx, http.MethodGet, path, nil, &endpoints); err != nil {
+			return nil, err
+		}
+
+		var ips []string
+		for _, subset := range endpoints.Subsets {
+			for _, addr := range subset.Addresses {
+				ips = append(ips, addr.IP)
+			}
+		}
+		if len(ips) == 0 {
+			return nil, fmt.Errorf("Kubernetes %s: service %s has no ready endpoints", p.Name, p.Service)
+		}
+		return ips, nil
+	}
+
+	var service kubeService
+	path := fmt.Sprintf("/api/v1/namespaces/%s/services/%s", p.Namespace, p.Service)
+	if err := p.client.do(ctx, http.MethodGet, path, nil, &service); err != nil {
+		return nil, err
+	}
+
+	if service.Spec.ClusterIP == "" || service.Spec.ClusterIP == "None" {
+		return nil, fmt.Errorf("Kubernetes %s: service %s has no cluster IP", p.Name, p.Service)
+	}
+
+	return []string{service.Spec.ClusterIP}, nil
+}
+
+// Start ...
+func (p *Kubernetes) Start(ctx context.Context) error {
+	return p.scale(ctx, p.Replicas)
+}
+
+// Stop ...
+func (p *Kubernetes) Stop(ctx context.Context) error {
+	return p.scale(ctx, 0)
+}
+
+func (p *Kubernetes) scale(ctx context.Context, replicas int) error {
+	body := map[string]interface{}{
+		"spec": map[string]interface{}{"replicas": replicas},
+	}
+	return p.client.do(ctx, http.MethodPatch, p.workloadPath()+"/scale", body, nil)
+}
+
+func (p *Kubernetes) workloadPath() string {
+	resource := "deployments"
+	if p.Kind == KindStatefulSet {
+		resource = "statefulsets"
+	}
+	return fmt.Sprintf("/apis/apps/v1/namespaces/%s/%s/%s", p.Namespace, resource, p.Name)
+}
+
+func normalizeKubernetesStatus(desired, current, ready int) StatusInstance {
+	switch {
+	case desired == 0 && current == 0:
+		return StatusInstanceNotRun
+	case desired == 0:
+		return StatusInstanceStopping
+	case ready >= desired:
+		return StatusInstanceRunning
+	default:
+		return StatusInstanceStarting
+	}
+}
+
+func (c *kubeClient) do(ctx context.Context, method, path string, body, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.host+path, reader)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+	}
+	token, err := c.bearerToken()
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		var status struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &status) != nil || status.Message == "" {
+			status.Message = resp.Status
+		}
+		return &KubernetesError{StatusCode: resp.StatusCode, Message: status.Message}
+	}
+
+	if result != nil {
+		return json.Unmarshal(data, result)
+	}
+
+	return nil
+}
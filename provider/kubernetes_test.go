@@ -0,0 +1,277 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var exampleKubeconfig = `
+apiVersion: v1
+kind: Config
+current-context: test
+clusters:
+- name: test-cluster
+  cluster:
+    server: %s
+contexts:
+- name: test
+  context:
+    cluster: test-cluster
+    user: test-user
+    namespace: tools
+users:
+- name: test-user
+  user:
+    token: test-token
+`
+
+// fakeKubeAPI is a minimal stand-in of the Kubernetes API server
+type fakeKubeAPI struct {
+	sync.Mutex
+	replicas int
+	ready    int
+}
+
+func (api *fakeKubeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	api.Lock()
+	defer api.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer test-token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"message": "Unauthorized"}`)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/apis/apps/v1/namespaces/tools/deployments/grafana":
+		fmt.Fprintf(w, `{"spec": {"replicas": %d}, "status": {"replicas": %d, "readyReplicas": %d}}`, api.replicas, api.ready, api.ready)
+	case r.Method == http.MethodPatch && r.URL.Path == "/apis/apps/v1/namespaces/tools/deployments/grafana/scale":
+		if r.Header.Get("Content-Type") != "application/merge-patch+json" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		var patch struct {
+			Spec struct {
+				Replicas int `json:"replicas"`
+			} `json:"spec"`
+		}
+		json.NewDecoder(r.Body).Decode(&patch)
+		api.replicas = patch.Spec.Replicas
+		fmt.Fprint(w, `{}`)
+	case r.URL.Path == "/api/v1/namespaces/tools/services/grafana":
+		fmt.Fprint(w, `{"spec": {"clusterIP": "10.96.0.10"}}`)
+	case r.URL.Path == "/api/v1/namespaces/tools/endpoints/grafana":
+		fmt.Fprint(w, `{"subsets": [{"addresses": [{"ip": "10.244.0.5"}, {"ip": "10.244.0.6"}], "notReadyAddresses": [{"ip": "10.244.0.9"}]}, {"addresses": [{"ip": "10.244.1.7"}]}]}`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"message": "not found"}`)
+	}
+}
+
+func initTestKubernetes(t *testing.T, api *fakeKubeAPI) (*Kubernetes, func()) {
+	server := httptest.NewServer(api)
+
+	tmpfile, err := ioutil.TempFile("", "kubeconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintf(tmpfile, exampleKubeconfig, server.URL)
+	tmpfile.Close()
+
+	p := NewKubernetes(tmpfile.Name(), "", "", "deployment", "grafana", 2, "", false)
+
+	return p, func() {
+		server.Close()
+		os.Remove(tmpfile.Name())
+	}
+}
+
+func TestNewKubernetes(t *testing.T) {
+	p, cleanup := initTestKubernetes(t, &fakeKubeAPI{})
+	defer cleanup()
+
+	if p.Namespace != "tools" {
+		t.Errorf("NewKubernetes.Namespace returned %+v, want %+v", p.Namespace, "tools")
+	}
+
+	if p.Kind != KindDeployment {
+		t.Errorf("NewKubernetes.Kind returned %+v, want %+v", p.Kind, KindDeployment)
+	}
+
+	if p.Service != "grafana" {
+		t.Errorf("NewKubernetes.Service returned %+v, want %+v", p.Service, "grafana")
+	}
+
+	if p.client.token != "test-token" {
+		t.Errorf("NewKubernetes.client.token returned %+v, want %+v", p.client.token, "test-token")
+	}
+}
+
+func TestKubernetes_Hash(t *testing.T) {
+	p := &Kubernetes{Namespace: "tools", Kind: KindStatefulSet, Name: "db"}
+	s := "kubernetes-statefulset-tools-db"
+
+	if p.Hash() != s {
+		t.Errorf("Kubernetes.Hash returned %+v, want %+v", p.Hash(), s)
+	}
+}
+
+func TestKubernetes_StartStop(t *testing.T) {
+	api := &fakeKubeAPI{}
+	p, cleanup := initTestKubernetes(t, api)
+	defer cleanup()
+	ctx := context.Background()
+
+	if status, err := p.Status(ctx); err != nil || status != StatusInstanceNotRun {
+		t.Errorf("Kubernetes.Status returned %v (%v), want %v", status, err, StatusInstanceNotRun)
+	}
+
+	if err := p.Start(ctx); err != nil {
+		t.Fatalf("Kubernetes.Start returned unexpected error: %v", err)
+	}
+
+	if api.replicas != 2 {
+		t.Errorf("Kubernetes.Start scaled to %d, want %d", api.replicas, 2)
+	}
+
+	if status, _ := p.Status(ctx); status != StatusInstanceStarting {
+		t.Errorf("Kubernetes.Status returned %v, want %v", status, StatusInstanceStarting)
+	}
+
+	api.ready = 2
+	if status, _ := p.Status(ctx); status != StatusInstanceRunning {
+		t.Errorf("Kubernetes.Status returned %v, want %v", status, StatusInstanceRunning)
+	}
+
+	if err := p.Stop(ctx); err != nil {
+		t.Fatalf("Kubernetes.Stop returned unexpected error: %v", err)
+	}
+
+	if status, _ := p.Status(ctx); status != StatusInstanceStopping {
+		t.Errorf("Kubernetes.Status returned %v, want %v", status, StatusInstanceStopping)
+	}
+}
+
+func TestKubernetes_IP(t *testing.T) {
+	p, cleanup := initTestKubernetes(t, &fakeKubeAPI{})
+	defer cleanup()
+
+	ip, err := p.IP(context.Background())
+	if err != nil || ip != "10.96.0.10" {
+		t.Errorf("Kubernetes.IP returned %v (%v), want %v", ip, err, "10.96.0.10")
+	}
+
+	p.UseEndpoints = true
+	ip, err = p.IP(context.Background())
+	if err != nil || ip != "10.244.0.5" {
+		t.Errorf("Kubernetes.IP (UseEndpoints) returned %v (%v), want %v", ip, err, "10.244.0.5")
+	}
+	ips, err := p.IPs(context.Background())
+	if want := []string{"10.244.0.5", "10.244.0.6", "10.244.1.7"}; err != nil || !reflect.DeepEqual(ips, want) {
+		t.Errorf("Kubernetes.IPs (UseEndpoints) returned %v (%v), want %v", ips, err, want)
+	}
+}
+
+func TestKubernetes_Error(t *testing.T) {
+	p, cleanup := initTestKubernetes(t, &fakeKubeAPI{})
+	defer cleanup()
+	p.Name = "unknown"
+
+	_, err := p.Status(context.Background())
+	if kErr, ok := err.(*KubernetesError); !ok || kErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Kubernetes.Status returned %v, want not found error", err)
+	}
+}
+
+func TestKubeClient_tokenFile(t *testing.T) {
+	api := &fakeKubeAPI{}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "kubeconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tokenFile := filepath.Join(dir, "token")
+	ioutil.WriteFile(tokenFile, []byte("old-token\n"), 0600)
+	kubeconfigFile := filepath.Join(dir, "config")
+	ioutil.WriteFile(kubeconfigFile, []byte(strings.Replace(fmt.Sprintf(exampleKubeconfig, server.URL), "token: test-token", "tokenFile: token", 1)), 0600)
+
+	p := NewKubernetes(kubeconfigFile, "", "", "deployment", "grafana", 2, "", false)
+	if _, err := p.Status(context.Background()); err == nil {
+		t.Fatal("Kubernetes.Status expected error for the old token")
+	}
+
+	// the token is rotated
+	ioutil.WriteFile(tokenFile, []byte("test-token\n"), 0600)
+	if _, err := p.Status(context.Background()); err != nil {
+		t.Errorf("Kubernetes.Status returned unexpected error after the token rotated: %v", err)
+	}
+}
+
+func TestNewKubeClient_unsupportedUser(t *testing.T) {
+	var userTable = []struct {
+		user    string
+		message string
+	}{
+		{"exec:\n      command: aws", `exec command "aws"`},
+		{"auth-provider:\n      name: gcp", `auth-provider "gcp"`},
+	}
+
+	tmpfile, err := ioutil.TempFile("", "kubeconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+	fmt.Fprint(tmpfile, strings.Replace(fmt.Sprintf(exampleKubeconfig, "https://127.0.0.1"), "- name: test-user", "- name: other-user", 1))
+	tmpfile.Close()
+
+	if _, err := newKubeClient(tmpfile.Name(), ""); err == nil || !strings.Contains(err.Error(), `user "test-user" not found`) {
+		t.Errorf("newKubeClient returned %v, want error for the missing user", err)
+	}
+
+	for _, test := range userTable {
+		tmpfile, err := ioutil.TempFile("", "kubeconfig")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprint(tmpfile, strings.Replace(fmt.Sprintf(exampleKubeconfig, "https://127.0.0.1"), "token: test-token", test.user, 1))
+		tmpfile.Close()
+
+		_, err = newKubeClient(tmpfile.Name(), "")
+		if err == nil || !strings.Contains(err.Error(), test.message) {
+			t.Errorf("newKubeClient returned %v, want error with %s", err, test.message)
+		}
+		os.Remove(tmpfile.Name())
+	}
+}
+
+func TestNormalizeKubernetesStatus(t *testing.T) {
+	var statusTable = []struct {
+		desired, current, ready int
+		out                     StatusInstance
+	}{
+		{0, 0, 0, StatusInstanceNotRun},
+		{0, 1, 1, StatusInstanceStopping},
+		{2, 1, 1, StatusInstanceStarting},
+		{2, 2, 2, StatusInstanceRunning},
+	}
+
+	for _, test := range statusTable {
+		if s := normalizeKubernetesStatus(test.desired, test.current, test.ready); s != test.out {
+			t.Errorf("normalizeKubernetesStatus is %v, want %v", s, test.out)
+		}
+	}
+}
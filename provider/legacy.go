@@ -0,0 +1,78 @@
+package provider
+
+import (
+	"context"
+)
+
+type legacyProvider struct {
+	provider LegacyProvider
+}
+
+// FromLegacy wraps a provider without context support. Calls keep running in
+// the background after the context is done, but the caller is released
+func FromLegacy(p LegacyProvider) Provider {
+	return &legacyProvider{provider: p}
+}
+
+// String ...
+func (p *legacyProvider) String() string {
+	return p.provider.String()
+}
+
+// Hash ...
+func (p *legacyProvider) Hash() string {
+	return p.provider.Hash()
+}
+
+// Status ...
+func (p *legacyProvider) Status(ctx context.Context) (StatusInstance, error) {
+	status := StatusInstanceNotAvailable
+	err := runWithContext(ctx, func() error {
+		var err error
+		status, err = p.provider.Status()
+		return err
+	})
+	if err != nil {
+		return StatusInstanceNotAvailable, err
+	}
+	return status, nil
+}
+
+// IP ...
+func (p *legacyProvider) IP(ctx context.Context) (string, error) {
+	var ip string
+	err := runWithContext(ctx, func() error {
+		var err error
+		ip, err = p.provider.IP()
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return ip, nil
+}
+
+// Start ...
+func (p *legacyProvider) Start(ctx context.Context) error {
+	return runWithContext(ctx, p.provider.Start)
+}
+
+// Stop ...
+func (p *legacyProvider) Stop(ctx context.Context) error {
+	return runWithContext(ctx, p.provider.Stop)
+}
+
+func runWithContext(ctx context.Context, fn func() error) error {
+	done := make(chan error, 1)
+
+	go func() {
+		done <- fn()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
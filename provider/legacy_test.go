@@ -0,0 +1,75 @@
+package provider
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type legacyTestProvider struct {
+	block chan bool
+}
+
+func (p *legacyTestProvider) String() string { return "legacy" }
+func (p *legacyTestProvider) Hash() string   { return "legacy-hash" }
+
+func (p *legacyTestProvider) Status() (StatusInstance, error) {
+	return StatusInstanceRunning, nil
+}
+
+func (p *legacyTestProvider) IP() (string, error) {
+	return "127.0.0.1", nil
+}
+
+func (p *legacyTestProvider) Start() error {
+	<-p.block
+	return nil
+}
+
+func (p *legacyTestProvider) Stop() error {
+	return nil
+}
+
+func TestFromLegacy(t *testing.T) {
+	p := FromLegacy(&legacyTestProvider{})
+
+	if p.String() != "legacy" || p.Hash() != "legacy-hash" {
+		t.Errorf("FromLegacy returned %s/%s, want legacy/legacy-hash", p.String(), p.Hash())
+	}
+
+	status, err := p.Status(context.Background())
+	if err != nil || status != StatusInstanceRunning {
+		t.Errorf("FromLegacy.Status returned %v (%v), want %v", status, err, StatusInstanceRunning)
+	}
+
+	ip, err := p.IP(context.Background())
+	if err != nil || ip != "127.0.0.1" {
+		t.Errorf("FromLegacy.IP returned %v (%v), want %v", ip, err, "127.0.0.1")
+	}
+}
+
+func TestFromLegacy_cancel(t *testing.T) {
+	block := make(chan bool)
+	defer close(block)
+
+	p := FromLegacy(&legacyTestProvider{block: block})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := p.Start(ctx); err != context.DeadlineExceeded {
+		t.Errorf("FromLegacy.Start returned %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestParseStatusInstance(t *testing.T) {
+	for _, status := range []StatusInstance{StatusInstanceNotAvailable, StatusInstanceStarting, StatusInstanceNotRun, StatusInstanceStopping, StatusInstanceRunning, StatusInstanceError} {
+		if s, err := ParseStatusInstance(status.String()); err != nil || s != status {
+			t.Errorf("ParseStatusInstance returned %v (%v), want %v", s, err, status)
+		}
+	}
+
+	if _, err := ParseStatusInstance("awake"); err == nil {
+		t.Error("ParseStatusInstance expected error for unknown status")
+	}
+}
@@ -0,0 +1,179 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+
+	compute "google.golang.org/api/compute/v1"
+
+	"github.com/silentsokolov/go-sleep/log"
+)
+
+// MIG resizes a GCE Managed Instance Group between 0 and Size
+type MIG struct {
+	JWTPath        string
+	ProjectID      string
+	Zone           string
+	Name           string
+	Size           int
+	MinHealthy     int
+	UseInternalIP  bool
+	client         *http.Client
+	computeService *compute.Service
+	batch          *batchCache
+}
+
+// NewMIG ..
+func NewMIG(JWTPath, ProjectID, Zone, Name string, Size, MinHealthy int, UseInternalIP bool) *MIG {
+	client, err := getGoogleClient(JWTPath, compute.CloudPlatformScope, compute.ComputeScope)
+	if err != nil {
+		log.Fatalf("MIG %s: Unable to create HTTP client: %v", Name, err)
+	}
+
+	computeService, err := compute.New(client)
+	if err != nil {
+		log.Fatalf("MIG %s: Unable to create Compute service: %v", Name, err)
+	}
+
+	if Size <= 0 {
+		Size = 1
+	}
+
+	if MinHealthy <= 0 || MinHealthy > Size {
+		MinHealthy = Size
+	}
+
+	batch := sharedBatch(fmt.Sprintf("gce/%s/%s", JWTPath, ProjectID), gceFetch(computeService, ProjectID))
+
+	return &MIG{
+		JWTPath:        JWTPath,
+		ProjectID:      ProjectID,
+		Zone:           Zone,
+		Name:           Name,
+		Size:           Size,
+		MinHealthy:     MinHealthy,
+		UseInternalIP:  UseInternalIP,
+		client:         client,
+		computeService: computeService,
+		batch:          batch,
+	}
+}
+
+// String ...
+func (p *MIG) String() string {
+	return fmt.Sprintf("[MIG] Name: %s-%s in %s", p.ProjectID, p.Name, p.Zone)
+}
+
+// Hash ...
+func (p *MIG) Hash() string {
+	return fmt.Sprintf("mig-%s-%s-%s", p.ProjectID, p.Zone, p.Name)
+}
+
+// Status ...
+func (p *MIG) Status(ctx context.Context) (StatusInstance, error) {
+	manager, err := p.computeService.InstanceGroupManagers.Get(p.ProjectID, p.Zone, p.Name).Context(ctx).Do()
+	if err != nil {
+		return StatusInstanceNotAvailable, err
+	}
+
+	members, healthy, err := p.members(ctx)
+	if err != nil {
+		return StatusInstanceNotAvailable, err
+	}
+
+	return normalizeGroupStatus(int(manager.TargetSize), len(members), len(healthy), p.MinHealthy), nil
+}
+
+// IP returns the address of the first healthy member
+func (p *MIG) IP(ctx context.Context) (string, error) {
+	ips, err := p.IPs(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return ips[0], nil
+}
+
+// IPs returns the addresses of all healthy members
+func (p *MIG) IPs(ctx context.Context) ([]string, error) {
+	_, healthy, err := p.members(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// members are looked up together with GCE instances of the project
+	for _, name := range healthy {
+		if p.batch != nil {
+			p.batch.Register(gceKey(p.Zone, name))
+		}
+	}
+
+	ips := make([]string, 0, len(healthy))
+	for _, name := range healthy {
+		inst, err := p.getInstance(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if inst == nil {
+			continue
+		}
+		if ip := gceInstanceIP(inst, p.UseInternalIP); ip != "" {
+			ips = append(ips, ip)
+		}
+	}
+
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("MIG %s has no healthy instances with IP", p.Name)
+	}
+
+	return ips, nil
+}
+
+// Start ...
+func (p *MIG) Start(ctx context.Context) error {
+	_, err := p.computeService.InstanceGroupManagers.Resize(p.ProjectID, p.Zone, p.Name, int64(p.Size)).Context(ctx).Do()
+	return err
+}
+
+// Stop ...
+func (p *MIG) Stop(ctx context.Context) error {
+	_, err := p.computeService.InstanceGroupManagers.Resize(p.ProjectID, p.Zone, p.Name, 0).Context(ctx).Do()
+	return err
+}
+
+// getInstance returns the member instance, nil if it is gone
+func (p *MIG) getInstance(ctx context.Context, name string) (*compute.Instance, error) {
+	if p.batch == nil {
+		return p.computeService.Instances.Get(p.ProjectID, p.Zone, name).Context(ctx).Do()
+	}
+
+	item, _, err := p.batch.Get(ctx, gceKey(p.Zone, name))
+	if err != nil {
+		return nil, err
+	}
+
+	inst, _ := item.(*compute.Instance)
+	return inst, nil
+}
+
+// members returns names of all members and of the running ones
+// without pending actions
+func (p *MIG) members(ctx context.Context) ([]string, []string, error) {
+	resp, err := p.computeService.InstanceGroupManagers.ListManagedInstances(p.ProjectID, p.Zone, p.Name).Context(ctx).Do()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var all, healthy []string
+	for _, i := range resp.ManagedInstances {
+		name := path.Base(i.Instance)
+		all = append(all, name)
+		if i.InstanceStatus == "RUNNING" && i.CurrentAction == "NONE" {
+			healthy = append(healthy, name)
+		}
+	}
+
+	return all, healthy, nil
+}
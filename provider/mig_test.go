@@ -0,0 +1,144 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	compute "google.golang.org/api/compute/v1"
+)
+
+func initTestMIGServer(targetSize int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/listManagedInstances"):
+			w.Write([]byte(`{"managedInstances": [
+				{"instance": "https://www.googleapis.com/compute/v1/projects/my-project/zones/europe-west1-a/instances/web-1", "instanceStatus": "RUNNING", "currentAction": "NONE"},
+				{"instance": "https://www.googleapis.com/compute/v1/projects/my-project/zones/europe-west1-a/instances/web-2", "instanceStatus": "STAGING", "currentAction": "CREATING"}
+			]}`))
+		case strings.HasSuffix(r.URL.Path, "/resize"):
+			w.Write([]byte(`{"status": "RUNNING"}`))
+		case strings.HasSuffix(r.URL.Path, "/aggregated/instances"):
+			atomic.AddInt32(&migAggregatedCalls, 1)
+			w.Write([]byte(`{"items": {"zones/europe-west1-a": {"instances": [
+				{"name": "web-1", "networkInterfaces": [{"accessConfigs": [{"natIP": "10.10.10.1"}], "networkIP": "192.168.1.88"}]}
+			]}}}`))
+		case strings.HasSuffix(r.URL.Path, "/instances/web-1"):
+			w.Write([]byte(exampleGCEInstancesResponse))
+		case strings.HasSuffix(r.URL.Path, "/instanceGroupManagers/web"):
+			if targetSize == 0 {
+				w.Write([]byte(`{"name": "web"}`))
+			} else {
+				w.Write([]byte(`{"name": "web", "targetSize": 2}`))
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+var migAggregatedCalls int32
+
+func initTestMIG(server *httptest.Server, minHealthy int) *MIG {
+	computeService, _ := compute.New(http.DefaultClient)
+	computeService.BasePath = server.URL + "/"
+
+	return &MIG{
+		ProjectID:      "my-project",
+		Zone:           "europe-west1-a",
+		Name:           "web",
+		Size:           2,
+		MinHealthy:     minHealthy,
+		computeService: computeService,
+	}
+}
+
+func TestMIG_Hash(t *testing.T) {
+	p := &MIG{ProjectID: "my-project", Zone: "europe-west1-a", Name: "web"}
+	s := "mig-my-project-europe-west1-a-web"
+
+	if p.Hash() != s {
+		t.Errorf("MIG.Hash returned %+v, want %+v", p.Hash(), s)
+	}
+}
+
+func TestMIG_Status(t *testing.T) {
+	server := initTestMIGServer(2)
+	defer server.Close()
+
+	p := initTestMIG(server, 2)
+	if status, err := p.Status(context.Background()); err != nil || status != StatusInstanceStarting {
+		t.Errorf("MIG.Status returned %v (%v), want %v", status, err, StatusInstanceStarting)
+	}
+
+	p.MinHealthy = 1
+	if status, err := p.Status(context.Background()); err != nil || status != StatusInstanceRunning {
+		t.Errorf("MIG.Status returned %v (%v), want %v", status, err, StatusInstanceRunning)
+	}
+}
+
+func TestMIG_StatusStopping(t *testing.T) {
+	server := initTestMIGServer(0)
+	defer server.Close()
+
+	p := initTestMIG(server, 1)
+	if status, err := p.Status(context.Background()); err != nil || status != StatusInstanceStopping {
+		t.Errorf("MIG.Status returned %v (%v), want %v", status, err, StatusInstanceStopping)
+	}
+}
+
+func TestMIG_IPs(t *testing.T) {
+	server := initTestMIGServer(2)
+	defer server.Close()
+
+	p := initTestMIG(server, 1)
+	ips, err := p.IPs(context.Background())
+	if err != nil {
+		t.Fatalf("MIG.IPs returned unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(ips, []string{"10.10.10.1"}) {
+		t.Errorf("MIG.IPs returned %+v, want %+v", ips, []string{"10.10.10.1"})
+	}
+}
+
+func TestMIG_IPsBatch(t *testing.T) {
+	server := initTestMIGServer(2)
+	defer server.Close()
+
+	p := initTestMIG(server, 1)
+	p.batch = newBatchCache(gceFetch(p.computeService, p.ProjectID))
+	atomic.StoreInt32(&migAggregatedCalls, 0)
+
+	for i := 0; i < 3; i++ {
+		ips, err := p.IPs(context.Background())
+		if err != nil {
+			t.Fatalf("MIG.IPs returned unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(ips, []string{"10.10.10.1"}) {
+			t.Errorf("MIG.IPs returned %+v, want %+v", ips, []string{"10.10.10.1"})
+		}
+	}
+
+	if n := atomic.LoadInt32(&migAggregatedCalls); n != 1 {
+		t.Errorf("MIG.IPs listed instances %d times, want 1", n)
+	}
+}
+
+func TestMIG_StartStop(t *testing.T) {
+	server := initTestMIGServer(2)
+	defer server.Close()
+
+	p := initTestMIG(server, 1)
+	if err := p.Start(context.Background()); err != nil {
+		t.Errorf("MIG.Start returned unexpected error: %v", err)
+	}
+
+	if err := p.Stop(context.Background()); err != nil {
+		t.Errorf("MIG.Stop returned unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,324 @@
+package provider
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/silentsokolov/go-sleep/log"
+	"github.com/silentsokolov/go-sleep/plugin"
+)
+
+const pluginRestartDelay = 5 * time.Second
+
+var errPluginExited = errors.New("plugin process exited")
+
+// Plugin ..
+type Plugin struct {
+	Name    string
+	Command string
+	Args    []string
+	Env     map[string]string
+	Options map[string]interface{}
+
+	sync.Mutex
+	conn      *pluginConn
+	lastStart time.Time
+	dial      func() (*pluginConn, error)
+}
+
+// NewPlugin ..
+func NewPlugin(Name, Command string, Args []string, Env map[string]string, Options map[string]interface{}) *Plugin {
+	p := &Plugin{
+		Name:    Name,
+		Command: Command,
+		Args:    Args,
+		Env:     Env,
+		Options: Options,
+	}
+	p.dial = p.startProcess
+
+	return p
+}
+
+// String ...
+func (p *Plugin) String() string {
+	return fmt.Sprintf("[Plugin] Name: %s (%s)", p.Name, p.Command)
+}
+
+// Hash ...
+func (p *Plugin) Hash() string {
+	return fmt.Sprintf("plugin-%s", p.Name)
+}
+
+// Status ...
+func (p *Plugin) Status(ctx context.Context) (StatusInstance, error) {
+	var result plugin.StatusResult
+	if err := p.call(ctx, plugin.MethodStatus, &result); err != nil {
+		return StatusInstanceNotAvailable, err
+	}
+
+	status, err := ParseStatusInstance(result.Status)
+	if err != nil || status != StatusInstanceError {
+		return status, err
+	}
+	if len(result.Message) == 0 {
+		return status, &StateError{fmt.Sprintf("plugin %s reports an error", p.Name)}
+	}
+	return status, &StateError{fmt.Sprintf("plugin %s: %s", p.Name, result.Message)}
+}
+
+// IP ...
+func (p *Plugin) IP(ctx context.Context) (string, error) {
+	var result plugin.IPResult
+	if err := p.call(ctx, plugin.MethodIP, &result); err != nil {
+		return "", err
+	}
+
+	return result.IP, nil
+}
+
+// Start ...
+func (p *Plugin) Start(ctx context.Context) error {
+	return p.call(ctx, plugin.MethodStart, nil)
+}
+
+// Stop ...
+func (p *Plugin) Stop(ctx context.Context) error {
+	return p.call(ctx, plugin.MethodStop, nil)
+}
+
+// Close stops the plugin process
+func (p *Plugin) Close() error {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.conn != nil {
+		p.conn.close()
+		p.conn = nil
+	}
+	return nil
+}
+
+func (p *Plugin) call(ctx context.Context, method string, result interface{}) error {
+	conn, err := p.connection()
+	if err != nil {
+		return err
+	}
+
+	resp, err := conn.call(ctx, &plugin.Request{
+		JSONRPC: plugin.Version,
+		Method:  method,
+		Params:  &plugin.Params{Name: p.Name, Options: p.Options},
+	})
+	if err != nil {
+		return err
+	}
+
+	if resp.Error != nil {
+		return resp.Error
+	}
+
+	if result != nil {
+		if err := json.Unmarshal(resp.Result, result); err != nil {
+			return fmt.Errorf("Plugin %s: invalid %s result: %v", p.Name, method, err)
+		}
+	}
+
+	return nil
+}
+
+// connection returns a running plugin process, the process is restarted
+// if it has exited, but not more often than pluginRestartDelay
+func (p *Plugin) connection() (*pluginConn, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.conn != nil && !p.conn.exited() {
+		return p.conn, nil
+	}
+
+	if p.conn != nil {
+		if wait := pluginRestartDelay - time.Since(p.lastStart); wait > 0 {
+			return nil, fmt.Errorf("Plugin %s: %v, restart in %s", p.Name, p.conn.err(), wait.Round(time.Second))
+		}
+		log.Printf("Plugin %s: restarting after: %v", p.Name, p.conn.err())
+	}
+
+	p.lastStart = time.Now()
+	conn, err := p.dial()
+	if err != nil {
+		return nil, err
+	}
+	p.conn = conn
+
+	return conn, nil
+}
+
+func (p *Plugin) startProcess() (*pluginConn, error) {
+	cmd := exec.Command(p.Command, p.Args...)
+	cmd.Env = environ(p.Env)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("Plugin %s: unable to start %s: %v", p.Name, p.Command, err)
+	}
+	log.Printf("Plugin %s: started %s (pid %d)", p.Name, p.Command, cmd.Process.Pid)
+
+	go func() {
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			log.WithField("plugin", p.Name).Warn(scanner.Text())
+		}
+	}()
+
+	conn := newPluginConn(stdout, stdin)
+	conn.kill = func() {
+		cmd.Process.Kill()
+	}
+	go func() {
+		<-conn.done
+		err := cmd.Wait()
+		log.Printf("Plugin %s: process exited: %v", p.Name, err)
+	}()
+
+	return conn, nil
+}
+
+type pluginConn struct {
+	sync.Mutex
+	writer  io.WriteCloser
+	encoder *json.Encoder
+	pending map[int64]chan *plugin.Response
+	nextID  int64
+	done    chan struct{}
+	lastErr error
+	kill    func()
+}
+
+func newPluginConn(r io.Reader, w io.WriteCloser) *pluginConn {
+	conn := &pluginConn{
+		writer:  w,
+		encoder: json.NewEncoder(w),
+		pending: make(map[int64]chan *plugin.Response),
+		done:    make(chan struct{}),
+	}
+	go conn.read(r)
+
+	return conn
+}
+
+func (conn *pluginConn) read(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var resp plugin.Response
+		if err := json.Unmarshal(scanner.Bytes(), &resp); err != nil {
+			log.Printf("Plugin: invalid response %q: %v", scanner.Text(), err)
+			continue
+		}
+
+		conn.Lock()
+		ch, ok := conn.pending[resp.ID]
+		delete(conn.pending, resp.ID)
+		conn.Unlock()
+
+		if ok {
+			ch <- &resp
+		}
+	}
+
+	err := scanner.Err()
+	if err == nil {
+		err = errPluginExited
+	}
+	conn.shutdown(err)
+}
+
+func (conn *pluginConn) call(ctx context.Context, req *plugin.Request) (*plugin.Response, error) {
+	ch := make(chan *plugin.Response, 1)
+
+	conn.Lock()
+	if conn.lastErr != nil {
+		conn.Unlock()
+		return nil, conn.lastErr
+	}
+	conn.nextID++
+	req.ID = conn.nextID
+	conn.pending[req.ID] = ch
+	err := conn.encoder.Encode(req)
+	conn.Unlock()
+
+	if err != nil {
+		conn.forget(req.ID)
+		return nil, err
+	}
+
+	select {
+	case resp := <-ch:
+		return resp, nil
+	case <-conn.done:
+		return nil, conn.err()
+	case <-ctx.Done():
+		conn.forget(req.ID)
+		return nil, ctx.Err()
+	}
+}
+
+func (conn *pluginConn) forget(id int64) {
+	conn.Lock()
+	defer conn.Unlock()
+	delete(conn.pending, id)
+}
+
+func (conn *pluginConn) shutdown(err error) {
+	conn.Lock()
+	defer conn.Unlock()
+
+	if conn.lastErr != nil {
+		return
+	}
+	conn.lastErr = err
+	close(conn.done)
+}
+
+func (conn *pluginConn) close() {
+	conn.writer.Close()
+	if conn.kill != nil {
+		conn.kill()
+	}
+	conn.shutdown(errPluginExited)
+}
+
+func (conn *pluginConn) exited() bool {
+	select {
+	case <-conn.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (conn *pluginConn) err() error {
+	conn.Lock()
+	defer conn.Unlock()
+	return conn.lastErr
+}
@@ -0,0 +1,159 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/silentsokolov/go-sleep/plugin"
+)
+
+type testPluginHandler struct {
+	status string
+	err    error
+	block  chan bool
+}
+
+func (h *testPluginHandler) Status(params *plugin.Params) (string, error) {
+	if params.Name != "test" {
+		return "", errors.New("unexpected name")
+	}
+	return h.status, h.err
+}
+
+func (h *testPluginHandler) IP(params *plugin.Params) (string, error) {
+	return params.Options["ip"].(string), nil
+}
+
+func (h *testPluginHandler) Start(params *plugin.Params) error {
+	<-h.block
+	return nil
+}
+
+func (h *testPluginHandler) Stop(params *plugin.Params) error {
+	return &plugin.Error{Code: plugin.CodeThrottled, Message: "slow down"}
+}
+
+func initTestPlugin(h plugin.Handler) *Plugin {
+	p := NewPlugin("test", "test-plugin", nil, nil, map[string]interface{}{"ip": "10.10.10.1"})
+	p.dial = func() (*pluginConn, error) {
+		reqReader, reqWriter := io.Pipe()
+		respReader, respWriter := io.Pipe()
+
+		go func() {
+			plugin.ServeConn(h, reqReader, respWriter)
+			respWriter.Close()
+		}()
+
+		return newPluginConn(respReader, reqWriter), nil
+	}
+	return p
+}
+
+func TestPlugin_String(t *testing.T) {
+	p := NewPlugin("test", "/bin/test", nil, nil, nil)
+	s := "[Plugin] Name: test (/bin/test)"
+
+	if p.String() != s {
+		t.Errorf("Plugin.String returned %+v, want %+v", p.String(), s)
+	}
+}
+
+func TestPlugin_Hash(t *testing.T) {
+	p := NewPlugin("test", "/bin/test", nil, nil, nil)
+	s := "plugin-test"
+
+	if p.Hash() != s {
+		t.Errorf("Plugin.Hash returned %+v, want %+v", p.Hash(), s)
+	}
+}
+
+func TestPlugin_Status(t *testing.T) {
+	p := initTestPlugin(&testPluginHandler{status: "starting"})
+	defer p.Close()
+
+	status, err := p.Status(context.Background())
+	if err != nil {
+		t.Fatalf("Plugin.Status returned unexpected error: %v", err)
+	}
+
+	if status != StatusInstanceStarting {
+		t.Errorf("Plugin.Status returned %+v, want %+v", status, StatusInstanceStarting)
+	}
+}
+
+func TestPlugin_StatusError(t *testing.T) {
+	var errorTable = []struct {
+		handler *testPluginHandler
+		message string
+	}{
+		{&testPluginHandler{err: &plugin.StatusError{Message: "disk is full"}}, "plugin test: disk is full"},
+		{&testPluginHandler{status: "error"}, "plugin test reports an error"},
+	}
+
+	for _, test := range errorTable {
+		p := initTestPlugin(test.handler)
+
+		status, err := p.Status(context.Background())
+		if _, ok := err.(*StateError); !ok || status != StatusInstanceError {
+			t.Errorf("Plugin.Status returned %v (%v), want %v with a state error", status, err, StatusInstanceError)
+		} else if err.Error() != test.message {
+			t.Errorf("Plugin.Status returned error %q, want %q", err, test.message)
+		}
+		p.Close()
+	}
+}
+
+func TestPlugin_IP(t *testing.T) {
+	p := initTestPlugin(&testPluginHandler{})
+	defer p.Close()
+
+	ip, err := p.IP(context.Background())
+	if err != nil {
+		t.Fatalf("Plugin.IP returned unexpected error: %v", err)
+	}
+
+	if ip != "10.10.10.1" {
+		t.Errorf("Plugin.IP returned %+v, want %+v", ip, "10.10.10.1")
+	}
+}
+
+func TestPlugin_StartCancel(t *testing.T) {
+	block := make(chan bool)
+	defer close(block)
+
+	p := initTestPlugin(&testPluginHandler{status: "running", block: block})
+	defer p.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := p.Start(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Plugin.Start returned %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// the connection is still usable after a cancelled call
+	if status, err := p.Status(context.Background()); err != nil || status != StatusInstanceRunning {
+		t.Errorf("Plugin.Status returned %v (%v), want %v", status, err, StatusInstanceRunning)
+	}
+}
+
+func TestPlugin_StopThrottled(t *testing.T) {
+	p := initTestPlugin(&testPluginHandler{})
+	defer p.Close()
+
+	err := p.Stop(context.Background())
+	if !IsThrottling(err) {
+		t.Errorf("Plugin.Stop returned %v, want throttling error", err)
+	}
+}
+
+func TestPlugin_Restart(t *testing.T) {
+	p := NewPlugin("test", "/nonexistent/go-sleep-plugin", nil, nil, nil)
+
+	if _, err := p.Status(context.Background()); err == nil {
+		t.Error("Plugin.Status expected error for missing executable")
+	}
+}
@@ -1,5 +1,11 @@
 package provider
 
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
 // StatusInstance ...
 type StatusInstance int
 
@@ -37,8 +43,65 @@ func (status StatusInstance) String() string {
 	return "unknown"
 }
 
+// ParseStatusInstance returns status by its string representation
+func ParseStatusInstance(s string) (StatusInstance, error) {
+	for _, status := range []StatusInstance{
+		StatusInstanceNotAvailable,
+		StatusInstanceStarting,
+		StatusInstanceNotRun,
+		StatusInstanceStopping,
+		StatusInstanceRunning,
+		StatusInstanceError,
+	} {
+		if status.String() == s {
+			return status, nil
+		}
+	}
+
+	return StatusInstanceNotAvailable, fmt.Errorf("Unknown instance status: %q", s)
+}
+
+// StateError is returned with StatusInstanceError by providers whose
+// instance is in a failed state, e.g. a database with full storage
+type StateError struct {
+	Message string
+}
+
+func (err *StateError) Error() string {
+	return err.Message
+}
+
 // Provider ..
 type Provider interface {
+	String() string
+	Hash() string
+	Status(ctx context.Context) (StatusInstance, error)
+	IP(ctx context.Context) (string, error)
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+}
+
+// AutoStarter is implemented by providers whose instances can be started
+// by the cloud itself
+type AutoStarter interface {
+	AutoStarted(ctx context.Context) (bool, error)
+}
+
+// CPUReporter is implemented by providers which report CPU utilization
+// of instances, in percent
+type CPUReporter interface {
+	CPUUtilization(ctx context.Context, window time.Duration) (float64, error)
+}
+
+// Cached is implemented by providers which cache status lookups,
+// Invalidate makes the next lookup ask the cloud
+type Cached interface {
+	Invalidate()
+}
+
+// LegacyProvider is the provider interface without context support,
+// use FromLegacy to adapt it to Provider
+type LegacyProvider interface {
 	String() string
 	Hash() string
 	Status() (StatusInstance, error)
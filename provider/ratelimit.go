@@ -0,0 +1,130 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRateLimit = 10
+	defaultRateBurst = 20
+)
+
+var rateLimits = struct {
+	sync.Mutex
+	rate     float64
+	burst    int
+	limiters map[string]*RateLimiter
+}{
+	rate:     defaultRateLimit,
+	burst:    defaultRateBurst,
+	limiters: make(map[string]*RateLimiter),
+}
+
+// SetRateLimit sets requests per second and the burst of every cloud
+// account, a negative rate disables the limit. It applies to providers
+// created after the call.
+func SetRateLimit(rate float64, burst int) {
+	rateLimits.Lock()
+	defer rateLimits.Unlock()
+
+	if rate != 0 {
+		rateLimits.rate = rate
+	}
+	if burst > 0 {
+		rateLimits.burst = burst
+	}
+}
+
+// accountLimiter returns the rate limiter shared by clients of account
+func accountLimiter(account string) *RateLimiter {
+	rateLimits.Lock()
+	defer rateLimits.Unlock()
+
+	if limiter, ok := rateLimits.limiters[account]; ok {
+		return limiter
+	}
+
+	limiter := NewRateLimiter(rateLimits.rate, rateLimits.burst)
+	rateLimits.limiters[account] = limiter
+	return limiter
+}
+
+// RateLimiter is a token bucket, a nil one doesn't limit
+type RateLimiter struct {
+	sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a full bucket refilled with rate tokens per second,
+// nil when rate is not positive
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &RateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait takes a token, waiting for it until ctx is done
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	for {
+		l.Lock()
+		now := time.Now()
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+		l.last = now
+
+		if l.tokens >= 1 {
+			l.tokens--
+			l.Unlock()
+			return nil
+		}
+
+		wait := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		l.Unlock()
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// limitedTransport waits for the limiter before each request
+type limitedTransport struct {
+	base    http.RoundTripper
+	limiter *RateLimiter
+}
+
+func (t *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
+
+// limitedClient returns an HTTP client limited by the limiter of account
+func limitedClient(account string) *http.Client {
+	return &http.Client{Transport: &limitedTransport{base: http.DefaultTransport, limiter: accountLimiter(account)}}
+}
@@ -0,0 +1,55 @@
+package provider
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Wait(t *testing.T) {
+	limiter := NewRateLimiter(50, 2)
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatalf("RateLimiter.Wait returned unexpected error: %v", err)
+		}
+	}
+
+	// the burst is free, two more tokens take 40ms
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("RateLimiter.Wait took %s, want at least 30ms", elapsed)
+	}
+}
+
+func TestRateLimiter_Wait_canceled(t *testing.T) {
+	limiter := NewRateLimiter(0.1, 1)
+	limiter.Wait(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := limiter.Wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("RateLimiter.Wait returned %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestRateLimiter_unlimited(t *testing.T) {
+	if limiter := NewRateLimiter(0, 10); limiter != nil {
+		t.Errorf("NewRateLimiter(0, 10) returned %v, want nil", limiter)
+	}
+
+	var limiter *RateLimiter
+	if err := limiter.Wait(context.Background()); err != nil {
+		t.Errorf("RateLimiter.Wait returned unexpected error: %v", err)
+	}
+}
+
+func TestAccountLimiter(t *testing.T) {
+	if accountLimiter("aws/a") != accountLimiter("aws/a") {
+		t.Errorf("accountLimiter returned different limiters for one account")
+	}
+	if accountLimiter("aws/a") == accountLimiter("aws/b") {
+		t.Errorf("accountLimiter returned one limiter for different accounts")
+	}
+}
@@ -0,0 +1,213 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/rds"
+
+	"github.com/silentsokolov/go-sleep/log"
+)
+
+// rdsAutoStartMessage is the event message of RDS when it starts a database
+// stopped for more than 7 days
+const rdsAutoStartMessage = "exceeding the maximum allowed time being stopped"
+
+// RDS controls a RDS database instance or an Aurora cluster
+type RDS struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	Region          string
+	Identifier      string
+	Cluster         bool
+	session         *session.Session
+	rdsService      *rds.RDS
+}
+
+// rdsClusterInput is the input of StartDBCluster and StopDBCluster,
+// these operations are missing in the vendored SDK
+type rdsClusterInput struct {
+	_ struct{} `type:"structure"`
+
+	DBClusterIdentifier *string `type:"string" required:"true"`
+}
+
+type rdsClusterOutput struct {
+	_ struct{} `type:"structure"`
+}
+
+// NewRDS ..
+func NewRDS(AccessKeyID, SecretAccessKey, Region, Identifier string, Cluster bool) *RDS {
+	session, err := getAWSSession(AccessKeyID, SecretAccessKey, Region)
+	if err != nil {
+		log.Fatalf("RDS %s: Unable to session: %v", Identifier, err)
+	}
+
+	return &RDS{
+		AccessKeyID:     AccessKeyID,
+		SecretAccessKey: SecretAccessKey,
+		Region:          Region,
+		Identifier:      Identifier,
+		Cluster:         Cluster,
+		session:         session,
+		rdsService:      rds.New(session),
+	}
+}
+
+// String ...
+func (p *RDS) String() string {
+	if p.Cluster {
+		return fmt.Sprintf("[RDS] Cluster: %s in %s", p.Identifier, p.Region)
+	}
+	return fmt.Sprintf("[RDS] ID: %s in %s", p.Identifier, p.Region)
+}
+
+// Hash ...
+func (p *RDS) Hash() string {
+	return fmt.Sprintf("rds-%s-%s", p.Identifier, p.Region)
+}
+
+// Status ...
+func (p *RDS) Status(ctx context.Context) (StatusInstance, error) {
+	status, _, err := p.describe(ctx)
+	if err != nil {
+		return StatusInstanceNotAvailable, err
+	}
+
+	normalized := normalizeRDSStatus(status)
+	if normalized == StatusInstanceError {
+		return normalized, &StateError{fmt.Sprintf("RDS %s is %s", p.Identifier, status)}
+	}
+	return normalized, nil
+}
+
+// IP returns the endpoint hostname of the database
+func (p *RDS) IP(ctx context.Context) (string, error) {
+	_, endpoint, err := p.describe(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if endpoint == "" {
+		return "", fmt.Errorf("RDS %s has no endpoint", p.Identifier)
+	}
+
+	return endpoint, nil
+}
+
+// Start ...
+func (p *RDS) Start(ctx context.Context) error {
+	if p.Cluster {
+		return p.clusterAction(ctx, "StartDBCluster")
+	}
+
+	params := &rds.StartDBInstanceInput{DBInstanceIdentifier: aws.String(p.Identifier)}
+	_, err := p.rdsService.StartDBInstanceWithContext(ctx, params)
+	return err
+}
+
+// Stop ...
+func (p *RDS) Stop(ctx context.Context) error {
+	if p.Cluster {
+		return p.clusterAction(ctx, "StopDBCluster")
+	}
+
+	params := &rds.StopDBInstanceInput{DBInstanceIdentifier: aws.String(p.Identifier)}
+	_, err := p.rdsService.StopDBInstanceWithContext(ctx, params)
+	return err
+}
+
+// AutoStarted reports whether RDS has started the database itself
+// during the last day, because it was stopped for 7 days
+func (p *RDS) AutoStarted(ctx context.Context) (bool, error) {
+	sourceType := rds.SourceTypeDbInstance
+	if p.Cluster {
+		sourceType = rds.SourceTypeDbCluster
+	}
+
+	params := &rds.DescribeEventsInput{
+		SourceIdentifier: aws.String(p.Identifier),
+		SourceType:       aws.String(sourceType),
+		Duration:         aws.Int64(int64((24 * time.Hour).Minutes())),
+	}
+	resp, err := p.rdsService.DescribeEventsWithContext(ctx, params)
+	if err != nil {
+		return false, err
+	}
+
+	for _, event := range resp.Events {
+		if strings.Contains(aws.StringValue(event.Message), rdsAutoStartMessage) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (p *RDS) describe(ctx context.Context) (string, string, error) {
+	if p.Cluster {
+		params := &rds.DescribeDBClustersInput{DBClusterIdentifier: aws.String(p.Identifier)}
+		resp, err := p.rdsService.DescribeDBClustersWithContext(ctx, params)
+		if err != nil {
+			return "", "", err
+		}
+		if len(resp.DBClusters) < 1 {
+			return "", "", fmt.Errorf("RDS cluster %s not found", p.Identifier)
+		}
+		cluster := resp.DBClusters[0]
+		return aws.StringValue(cluster.Status), aws.StringValue(cluster.Endpoint), nil
+	}
+
+	params := &rds.DescribeDBInstancesInput{DBInstanceIdentifier: aws.String(p.Identifier)}
+	resp, err := p.rdsService.DescribeDBInstancesWithContext(ctx, params)
+	if err != nil {
+		return "", "", err
+	}
+	if len(resp.DBInstances) < 1 {
+		return "", "", fmt.Errorf("RDS instance %s not found", p.Identifier)
+	}
+	inst := resp.DBInstances[0]
+
+	endpoint := ""
+	if inst.Endpoint != nil {
+		endpoint = aws.StringValue(inst.Endpoint.Address)
+	}
+	return aws.StringValue(inst.DBInstanceStatus), endpoint, nil
+}
+
+func (p *RDS) clusterAction(ctx context.Context, action string) error {
+	op := &request.Operation{
+		Name:       action,
+		HTTPMethod: "POST",
+		HTTPPath:   "/",
+	}
+
+	input := &rdsClusterInput{DBClusterIdentifier: aws.String(p.Identifier)}
+	req := p.rdsService.NewRequest(op, input, &rdsClusterOutput{})
+	req.SetContext(ctx)
+
+	return req.Send()
+}
+
+func normalizeRDSStatus(originalStatus string) StatusInstance {
+	switch originalStatus {
+	case "available", "backing-up", "modifying", "upgrading", "maintenance", "renaming",
+		"configuring-enhanced-monitoring", "configuring-iam-database-auth", "configuring-log-exports":
+		return StatusInstanceRunning
+	case "starting", "rebooting":
+		return StatusInstanceStarting
+	case "stopping":
+		return StatusInstanceStopping
+	case "stopped":
+		return StatusInstanceNotRun
+	case "failed", "inaccessible-encryption-credentials", "incompatible-network", "incompatible-parameters", "storage-full":
+		return StatusInstanceError
+	default:
+		return StatusInstanceNotAvailable
+	}
+}
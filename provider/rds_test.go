@@ -0,0 +1,201 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/awstesting/unit"
+	"github.com/aws/aws-sdk-go/service/rds"
+)
+
+var exampleDescribeDBInstancesResponse = `
+<DescribeDBInstancesResponse xmlns="http://rds.amazonaws.com/doc/2014-10-31/">
+	<DescribeDBInstancesResult>
+		<DBInstances>
+			<DBInstance>
+				<DBInstanceIdentifier>staging</DBInstanceIdentifier>
+				<DBInstanceStatus>available</DBInstanceStatus>
+				<Endpoint>
+					<Address>staging.abc.us-west-2.rds.amazonaws.com</Address>
+					<Port>5432</Port>
+				</Endpoint>
+			</DBInstance>
+		</DBInstances>
+	</DescribeDBInstancesResult>
+</DescribeDBInstancesResponse>`
+
+var exampleDescribeDBClustersResponse = `
+<DescribeDBClustersResponse xmlns="http://rds.amazonaws.com/doc/2014-10-31/">
+	<DescribeDBClustersResult>
+		<DBClusters>
+			<DBCluster>
+				<DBClusterIdentifier>aurora</DBClusterIdentifier>
+				<Status>stopped</Status>
+				<Endpoint>aurora.cluster-abc.us-west-2.rds.amazonaws.com</Endpoint>
+			</DBCluster>
+		</DBClusters>
+	</DescribeDBClustersResult>
+</DescribeDBClustersResponse>`
+
+var exampleDescribeEventsResponse = `
+<DescribeEventsResponse xmlns="http://rds.amazonaws.com/doc/2014-10-31/">
+	<DescribeEventsResult>
+		<Events>
+			<Event>
+				<SourceIdentifier>staging</SourceIdentifier>
+				<Message>DB instance is being started due to it exceeding the maximum allowed time being stopped.</Message>
+			</Event>
+		</Events>
+	</DescribeEventsResult>
+</DescribeEventsResponse>`
+
+func initTestRDS(t *testing.T, cluster bool) (*RDS, *httptest.Server, *[]string) {
+	actions := &[]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		action := r.Form.Get("Action")
+		*actions = append(*actions, action)
+		switch action {
+		case "DescribeDBInstances":
+			w.Write([]byte(exampleDescribeDBInstancesResponse))
+		case "DescribeDBClusters":
+			w.Write([]byte(exampleDescribeDBClustersResponse))
+		case "DescribeEvents":
+			w.Write([]byte(exampleDescribeEventsResponse))
+		default:
+			w.Write([]byte("<" + action + "Response><" + action + "Result></" + action + "Result></" + action + "Response>"))
+		}
+	}))
+
+	identifier := "staging"
+	if cluster {
+		identifier = "aurora"
+	}
+
+	config := &aws.Config{Endpoint: aws.String(server.URL + "/")}
+	p := &RDS{
+		Region:     "us-west-2",
+		Identifier: identifier,
+		Cluster:    cluster,
+		rdsService: rds.New(unit.Session, config),
+	}
+
+	return p, server, actions
+}
+
+func TestRDS_Hash(t *testing.T) {
+	p := &RDS{Identifier: "staging", Region: "us-west-2"}
+	s := "rds-staging-us-west-2"
+
+	if p.Hash() != s {
+		t.Errorf("RDS.Hash returned %+v, want %+v", p.Hash(), s)
+	}
+}
+
+func TestRDS_Instance(t *testing.T) {
+	p, server, actions := initTestRDS(t, false)
+	defer server.Close()
+	ctx := context.Background()
+
+	if status, err := p.Status(ctx); err != nil || status != StatusInstanceRunning {
+		t.Errorf("RDS.Status returned %v (%v), want %v", status, err, StatusInstanceRunning)
+	}
+
+	ip, err := p.IP(ctx)
+	if err != nil || ip != "staging.abc.us-west-2.rds.amazonaws.com" {
+		t.Errorf("RDS.IP returned %v (%v), want %v", ip, err, "staging.abc.us-west-2.rds.amazonaws.com")
+	}
+
+	if err := p.Stop(ctx); err != nil {
+		t.Fatalf("RDS.Stop returned unexpected error: %v", err)
+	}
+
+	if err := p.Start(ctx); err != nil {
+		t.Fatalf("RDS.Start returned unexpected error: %v", err)
+	}
+
+	want := []string{"DescribeDBInstances", "DescribeDBInstances", "StopDBInstance", "StartDBInstance"}
+	if !reflect.DeepEqual(*actions, want) {
+		t.Errorf("RDS called %v, want %v", *actions, want)
+	}
+}
+
+func TestRDS_Cluster(t *testing.T) {
+	p, server, actions := initTestRDS(t, true)
+	defer server.Close()
+	ctx := context.Background()
+
+	if status, err := p.Status(ctx); err != nil || status != StatusInstanceNotRun {
+		t.Errorf("RDS.Status returned %v (%v), want %v", status, err, StatusInstanceNotRun)
+	}
+
+	if err := p.Start(ctx); err != nil {
+		t.Fatalf("RDS.Start returned unexpected error: %v", err)
+	}
+
+	if err := p.Stop(ctx); err != nil {
+		t.Fatalf("RDS.Stop returned unexpected error: %v", err)
+	}
+
+	want := []string{"DescribeDBClusters", "StartDBCluster", "StopDBCluster"}
+	if !reflect.DeepEqual(*actions, want) {
+		t.Errorf("RDS called %v, want %v", *actions, want)
+	}
+}
+
+func TestRDS_AutoStarted(t *testing.T) {
+	p, server, _ := initTestRDS(t, false)
+	defer server.Close()
+
+	started, err := p.AutoStarted(context.Background())
+	if err != nil || !started {
+		t.Errorf("RDS.AutoStarted returned %v (%v), want %v", started, err, true)
+	}
+}
+
+func TestNormalizeRDSStatus(t *testing.T) {
+	var statusTable = []struct {
+		in  string
+		out StatusInstance
+	}{
+		{"available", StatusInstanceRunning},
+		{"backing-up", StatusInstanceRunning},
+		{"starting", StatusInstanceStarting},
+		{"stopping", StatusInstanceStopping},
+		{"stopped", StatusInstanceNotRun},
+		{"storage-full", StatusInstanceError},
+		{"creating", StatusInstanceNotAvailable},
+	}
+
+	for _, test := range statusTable {
+		if s := normalizeRDSStatus(test.in); s != test.out {
+			t.Errorf("normalizeRDSStatus(%q) is %v, want %v", test.in, s, test.out)
+		}
+	}
+}
+
+func TestRDS_StatusFailed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Replace(exampleDescribeDBInstancesResponse, ">available<", ">storage-full<", 1)))
+	}))
+	defer server.Close()
+
+	p := &RDS{
+		Region:     "us-west-2",
+		Identifier: "staging",
+		rdsService: rds.New(unit.Session, &aws.Config{Endpoint: aws.String(server.URL + "/")}),
+	}
+
+	status, err := p.Status(context.Background())
+	if _, ok := err.(*StateError); !ok || status != StatusInstanceError {
+		t.Fatalf("RDS.Status returned %v (%v), want %v with a state error", status, err, StatusInstanceError)
+	}
+	if want := "RDS staging is storage-full"; err.Error() != want {
+		t.Errorf("RDS.Status returned error %q, want %q", err, want)
+	}
+}
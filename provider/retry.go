@@ -0,0 +1,162 @@
+package provider
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	defaultCallTimeout = 30 * time.Second
+	defaultCallRetries = 3
+	defaultBackoff     = 1 * time.Second
+	defaultMaxBackoff  = 30 * time.Second
+)
+
+// CallOptions ...
+type CallOptions struct {
+	Timeout    time.Duration
+	Retries    int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// DefaultCallOptions ...
+var DefaultCallOptions = CallOptions{
+	Timeout:    defaultCallTimeout,
+	Retries:    defaultCallRetries,
+	Backoff:    defaultBackoff,
+	MaxBackoff: defaultMaxBackoff,
+}
+
+// Throttler can be implemented by errors of third-party providers
+// to mark them as rate limited
+type Throttler interface {
+	Throttled() bool
+}
+
+// Permanenter can be implemented by errors of third-party providers
+// to mark them as permanent
+type Permanenter interface {
+	Permanent() bool
+}
+
+// permanentAWSCodes are error codes of AWS which retrying doesn't fix
+var permanentAWSCodes = map[string]bool{
+	"AuthFailure":                 true,
+	"UnauthorizedOperation":       true,
+	"AccessDenied":                true,
+	"AccessDeniedException":       true,
+	"InvalidClientTokenId":        true,
+	"SignatureDoesNotMatch":       true,
+	"OptInRequired":               true,
+	"InvalidInstanceID.NotFound":  true,
+	"InvalidInstanceID.Malformed": true,
+	"InvalidParameterValue":       true,
+	"UnsupportedOperation":        true,
+	"DBInstanceNotFound":          true,
+	"DBClusterNotFoundFault":      true,
+	"ValidationError":             true,
+}
+
+// Call runs fn with a per-attempt timeout, throttling errors are retried
+// with exponential backoff until the retries are exhausted or ctx is done
+func Call(ctx context.Context, opts CallOptions, fn func(ctx context.Context) error) error {
+	var err error
+
+	backoff := opts.Backoff
+	for attempt := 0; ; attempt++ {
+		err = callWithTimeout(ctx, opts.Timeout, fn)
+		if err == nil || attempt >= opts.Retries || !IsThrottling(err) {
+			return err
+		}
+
+		select {
+		case <-time.After(jitter(backoff)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		backoff *= 2
+		if opts.MaxBackoff > 0 && backoff > opts.MaxBackoff {
+			backoff = opts.MaxBackoff
+		}
+	}
+}
+
+// IsThrottling reports whether err is a rate limit error of a cloud API
+func IsThrottling(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if t, ok := err.(Throttler); ok {
+		return t.Throttled()
+	}
+
+	if request.IsErrorThrottle(err) {
+		return true
+	}
+
+	if gErr, ok := err.(*googleapi.Error); ok {
+		if gErr.Code == http.StatusTooManyRequests {
+			return true
+		}
+		for _, item := range gErr.Errors {
+			if item.Reason == "rateLimitExceeded" || item.Reason == "userRateLimitExceeded" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func callWithTimeout(ctx context.Context, timeout time.Duration, fn func(ctx context.Context) error) error {
+	if timeout <= 0 {
+		return fn(ctx)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	return fn(ctx)
+}
+
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// IsPermanent reports whether err won't go away by retrying, e.g. invalid
+// credentials or a missing instance. Capacity, quota and network errors are
+// transient.
+func IsPermanent(err error) bool {
+	if err == nil || IsThrottling(err) {
+		return false
+	}
+
+	if p, ok := err.(Permanenter); ok {
+		return p.Permanent()
+	}
+
+	if aErr, ok := err.(awserr.Error); ok {
+		return permanentAWSCodes[aErr.Code()]
+	}
+
+	if gErr, ok := err.(*googleapi.Error); ok {
+		switch gErr.Code {
+		case http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+			return true
+		}
+	}
+
+	return false
+}
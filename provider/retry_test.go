@@ -0,0 +1,120 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"google.golang.org/api/googleapi"
+)
+
+type throttledError struct{}
+
+func (e throttledError) Error() string   { return "throttled" }
+func (e throttledError) Throttled() bool { return true }
+
+func TestIsThrottling(t *testing.T) {
+	var errorTable = []struct {
+		in  error
+		out bool
+	}{
+		{nil, false},
+		{errors.New("test error"), false},
+		{throttledError{}, true},
+		{awserr.New("RequestLimitExceeded", "limit", nil), true},
+		{awserr.New("InsufficientInstanceCapacity", "capacity", nil), false},
+		{&googleapi.Error{Code: http.StatusTooManyRequests}, true},
+		{&googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "rateLimitExceeded"}}}, true},
+		{&googleapi.Error{Code: http.StatusNotFound}, false},
+	}
+
+	for _, test := range errorTable {
+		if s := IsThrottling(test.in); s != test.out {
+			t.Errorf("IsThrottling(%v) returned %v, want %v", test.in, s, test.out)
+		}
+	}
+}
+
+func TestCall_retryThrottling(t *testing.T) {
+	opts := CallOptions{Timeout: time.Second, Retries: 3, Backoff: time.Millisecond}
+	attempts := 0
+
+	err := Call(context.Background(), opts, func(ctx context.Context) error {
+		attempts++
+		if attempts < 3 {
+			return throttledError{}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Call returned unexpected error: %v", err)
+	}
+
+	if attempts != 3 {
+		t.Errorf("Call made %d attempts, want %d", attempts, 3)
+	}
+}
+
+func TestCall_notRetryOtherErrors(t *testing.T) {
+	opts := CallOptions{Timeout: time.Second, Retries: 3, Backoff: time.Millisecond}
+	attempts := 0
+	want := errors.New("test error")
+
+	err := Call(context.Background(), opts, func(ctx context.Context) error {
+		attempts++
+		return want
+	})
+	if err != want {
+		t.Errorf("Call returned %v, want %v", err, want)
+	}
+
+	if attempts != 1 {
+		t.Errorf("Call made %d attempts, want %d", attempts, 1)
+	}
+}
+
+func TestCall_timeout(t *testing.T) {
+	opts := CallOptions{Timeout: 10 * time.Millisecond}
+
+	err := Call(context.Background(), opts, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if err != context.DeadlineExceeded {
+		t.Errorf("Call returned %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+type permanentError struct{}
+
+func (e permanentError) Error() string   { return "permanent" }
+func (e permanentError) Permanent() bool { return true }
+
+func TestIsPermanent(t *testing.T) {
+	var errorTable = []struct {
+		in  error
+		out bool
+	}{
+		{nil, false},
+		{errors.New("connection reset"), false},
+		{permanentError{}, true},
+		{throttledError{}, false},
+		{&KubernetesError{StatusCode: http.StatusNotFound}, true},
+		{&KubernetesError{StatusCode: http.StatusServiceUnavailable}, false},
+		{awserr.New("InsufficientInstanceCapacity", "capacity", nil), false},
+		{awserr.New("InvalidInstanceID.NotFound", "not found", nil), true},
+		{awserr.New("UnauthorizedOperation", "denied", nil), true},
+		{&googleapi.Error{Code: http.StatusNotFound}, true},
+		{&googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "rateLimitExceeded"}}}, false},
+		{&googleapi.Error{Code: http.StatusServiceUnavailable}, false},
+	}
+
+	for _, test := range errorTable {
+		if s := IsPermanent(test.in); s != test.out {
+			t.Errorf("IsPermanent(%v) returned %v, want %v", test.in, s, test.out)
+		}
+	}
+}
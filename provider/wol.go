@@ -0,0 +1,279 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+
+	"github.com/silentsokolov/go-sleep/log"
+)
+
+const (
+	defaultWOLBroadcast = "255.255.255.255:9"
+	defaultWOLBootTime  = 5 * time.Minute
+	wolCheckTimeout     = 2 * time.Second
+	icmpProtocolIPv4    = 1
+)
+
+// WOL checks
+const (
+	WOLCheckTCP  = "tcp"
+	WOLCheckICMP = "icmp"
+)
+
+// WOL ..
+type WOL struct {
+	Name        string
+	MAC         net.HardwareAddr
+	Broadcast   string
+	Address     string
+	Check       string
+	CheckPort   int
+	StopCommand string
+	StopURL     string
+	BootTime    time.Duration
+
+	sync.Mutex
+	wakeAt  time.Time
+	sleepAt time.Time
+	probe   func(ctx context.Context) bool
+}
+
+// NewWOL ..
+func NewWOL(Name, MAC, Broadcast, Address, Check string, CheckPort int, StopCommand, StopURL string, BootTime time.Duration) *WOL {
+	mac, err := net.ParseMAC(MAC)
+	if err != nil {
+		log.Fatalf("WOL %s: invalid MAC address: %v", Name, err)
+	}
+
+	if Address == "" {
+		log.Fatalf("WOL %s: ip is required", Name)
+	}
+
+	if Broadcast == "" {
+		Broadcast = defaultWOLBroadcast
+	} else if _, _, err := net.SplitHostPort(Broadcast); err != nil {
+		Broadcast = net.JoinHostPort(Broadcast, "9")
+	}
+
+	switch Check {
+	case "":
+		Check = WOLCheckTCP
+	case WOLCheckTCP, WOLCheckICMP:
+	default:
+		log.Fatalf("WOL %s: unknown check %q", Name, Check)
+	}
+
+	if Check == WOLCheckTCP && CheckPort == 0 {
+		CheckPort = 22
+	}
+
+	if BootTime <= 0 {
+		BootTime = defaultWOLBootTime
+	}
+
+	p := &WOL{
+		Name:        Name,
+		MAC:         mac,
+		Broadcast:   Broadcast,
+		Address:     Address,
+		Check:       Check,
+		CheckPort:   CheckPort,
+		StopCommand: StopCommand,
+		StopURL:     StopURL,
+		BootTime:    BootTime,
+	}
+	p.probe = p.reachable
+
+	return p
+}
+
+// String ...
+func (p *WOL) String() string {
+	return fmt.Sprintf("[WOL] Name: %s (%s)", p.Name, p.MAC)
+}
+
+// Hash ...
+func (p *WOL) Hash() string {
+	return fmt.Sprintf("wol-%s", p.Name)
+}
+
+// Status ...
+func (p *WOL) Status(ctx context.Context) (StatusInstance, error) {
+	up := p.probe(ctx)
+
+	p.Lock()
+	defer p.Unlock()
+
+	inBoot := !p.wakeAt.IsZero() && time.Since(p.wakeAt) < p.BootTime
+	inShutdown := !p.sleepAt.IsZero() && time.Since(p.sleepAt) < p.BootTime
+
+	switch {
+	case up && inShutdown:
+		return StatusInstanceStopping, nil
+	case up:
+		p.wakeAt = time.Time{}
+		return StatusInstanceRunning, nil
+	case inBoot:
+		return StatusInstanceStarting, nil
+	default:
+		p.sleepAt = time.Time{}
+		return StatusInstanceNotRun, nil
+	}
+}
+
+// IP ...
+func (p *WOL) IP(ctx context.Context) (string, error) {
+	return p.Address, nil
+}
+
+// Start sends the magic packet
+func (p *WOL) Start(ctx context.Context) error {
+	var d net.Dialer
+
+	conn, err := d.DialContext(ctx, "udp", p.Broadcast)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write(magicPacket(p.MAC)); err != nil {
+		return err
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	p.wakeAt = time.Now()
+	p.sleepAt = time.Time{}
+
+	return nil
+}
+
+// Stop ...
+func (p *WOL) Stop(ctx context.Context) error {
+	switch {
+	case p.StopCommand != "":
+		env := append(os.Environ(), fmt.Sprintf("GO_SLEEP_NAME=%s", p.Name), fmt.Sprintf("GO_SLEEP_IP=%s", p.Address))
+		if _, err := runCommand(ctx, defaultExecShell, p.StopCommand, env); err != nil {
+			return fmt.Errorf("WOL %s: %v", p.Name, err)
+		}
+	case p.StopURL != "":
+		req, err := http.NewRequest(http.MethodPost, p.StopURL, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= http.StatusBadRequest {
+			return fmt.Errorf("WOL %s: shutdown hook returned %s", p.Name, resp.Status)
+		}
+	default:
+		return fmt.Errorf("WOL %s: stop_command or stop_url is not set", p.Name)
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	p.sleepAt = time.Now()
+	p.wakeAt = time.Time{}
+
+	return nil
+}
+
+func (p *WOL) reachable(ctx context.Context) bool {
+	ctx, cancel := context.WithTimeout(ctx, wolCheckTimeout)
+	defer cancel()
+
+	if p.Check == WOLCheckICMP {
+		return pingICMP(ctx, p.Address)
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(p.Address, strconv.Itoa(p.CheckPort)))
+	if err != nil {
+		return false
+	}
+	conn.Close()
+
+	return true
+}
+
+func magicPacket(mac net.HardwareAddr) []byte {
+	packet := bytes.Repeat([]byte{0xff}, 6)
+	for i := 0; i < 16; i++ {
+		packet = append(packet, mac...)
+	}
+	return packet
+}
+
+// pingICMP sends an echo request, unprivileged datagram sockets are tried first
+func pingICMP(ctx context.Context, address string) bool {
+	ip, err := net.ResolveIPAddr("ip4", address)
+	if err != nil {
+		return false
+	}
+
+	var (
+		conn *icmp.PacketConn
+		dst  net.Addr = &net.UDPAddr{IP: ip.IP}
+	)
+	if conn, err = icmp.ListenPacket("udp4", "0.0.0.0"); err != nil {
+		if conn, err = icmp.ListenPacket("ip4:icmp", "0.0.0.0"); err != nil {
+			log.Printf("WOL: unable to open ICMP socket: %v", err)
+			return false
+		}
+		dst = ip
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	msg := icmp.Message{
+		Type: ipv4.ICMPTypeEcho,
+		Body: &icmp.Echo{ID: os.Getpid() & 0xffff, Seq: 1, Data: []byte("go-sleep")},
+	}
+	data, err := msg.Marshal(nil)
+	if err != nil {
+		return false
+	}
+
+	if _, err := conn.WriteTo(data, dst); err != nil {
+		return false
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			return false
+		}
+
+		reply, err := icmp.ParseMessage(icmpProtocolIPv4, buf[:n])
+		if err == nil && reply.Type == ipv4.ICMPTypeEchoReply && addrIP(peer).Equal(ip.IP) {
+			return true
+		}
+	}
+}
+
+func addrIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP
+	case *net.IPAddr:
+		return a.IP
+	}
+	return nil
+}
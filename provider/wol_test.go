@@ -0,0 +1,141 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestNewWOL(t *testing.T) {
+	p := NewWOL("gpu", "00:11:22:33:44:55", "192.168.1.255", "192.168.1.50", "", 0, "", "", 0)
+
+	if p.Broadcast != "192.168.1.255:9" {
+		t.Errorf("NewWOL.Broadcast returned %+v, want %+v", p.Broadcast, "192.168.1.255:9")
+	}
+
+	if p.Check != WOLCheckTCP || p.CheckPort != 22 {
+		t.Errorf("NewWOL.Check returned %s:%d, want %s:%d", p.Check, p.CheckPort, WOLCheckTCP, 22)
+	}
+
+	if p.BootTime != defaultWOLBootTime {
+		t.Errorf("NewWOL.BootTime returned %+v, want %+v", p.BootTime, defaultWOLBootTime)
+	}
+}
+
+func TestWOL_Hash(t *testing.T) {
+	p := NewWOL("gpu", "00:11:22:33:44:55", "", "192.168.1.50", "", 0, "", "", 0)
+	s := "wol-gpu"
+
+	if p.Hash() != s {
+		t.Errorf("WOL.Hash returned %+v, want %+v", p.Hash(), s)
+	}
+}
+
+func TestMagicPacket(t *testing.T) {
+	mac, _ := net.ParseMAC("00:11:22:33:44:55")
+	packet := magicPacket(mac)
+
+	if len(packet) != 102 {
+		t.Fatalf("magicPacket length is %d, want %d", len(packet), 102)
+	}
+
+	if !bytes.Equal(packet[:6], []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}) {
+		t.Errorf("magicPacket header is %x", packet[:6])
+	}
+
+	if !bytes.Equal(packet[96:], mac) {
+		t.Errorf("magicPacket tail is %x, want %x", packet[96:], []byte(mac))
+	}
+}
+
+func TestWOL_Start(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	p := NewWOL("gpu", "00:11:22:33:44:55", conn.LocalAddr().String(), "127.0.0.1", "", 0, "", "", time.Minute)
+	up := false
+	p.probe = func(ctx context.Context) bool { return up }
+
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatalf("WOL.Start returned unexpected error: %v", err)
+	}
+
+	buf := make([]byte, 200)
+	conn.SetDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil || !bytes.Equal(buf[:n], magicPacket(p.MAC)) {
+		t.Errorf("WOL.Start sent %x (%v), want magic packet", buf[:n], err)
+	}
+
+	if status, _ := p.Status(context.Background()); status != StatusInstanceStarting {
+		t.Errorf("WOL.Status returned %v, want %v", status, StatusInstanceStarting)
+	}
+
+	up = true
+	if status, _ := p.Status(context.Background()); status != StatusInstanceRunning {
+		t.Errorf("WOL.Status returned %v, want %v", status, StatusInstanceRunning)
+	}
+}
+
+func TestWOL_Stop(t *testing.T) {
+	called := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = r.Method == http.MethodPost
+	}))
+	defer server.Close()
+
+	p := NewWOL("gpu", "00:11:22:33:44:55", "", "127.0.0.1", "", 0, "", server.URL, time.Minute)
+	up := true
+	p.probe = func(ctx context.Context) bool { return up }
+
+	if err := p.Stop(context.Background()); err != nil {
+		t.Fatalf("WOL.Stop returned unexpected error: %v", err)
+	}
+
+	if !called {
+		t.Error("WOL.Stop did not call the shutdown hook")
+	}
+
+	if status, _ := p.Status(context.Background()); status != StatusInstanceStopping {
+		t.Errorf("WOL.Status returned %v, want %v", status, StatusInstanceStopping)
+	}
+
+	up = false
+	if status, _ := p.Status(context.Background()); status != StatusInstanceNotRun {
+		t.Errorf("WOL.Status returned %v, want %v", status, StatusInstanceNotRun)
+	}
+}
+
+func TestWOL_StopCommand(t *testing.T) {
+	p := NewWOL("gpu", "00:11:22:33:44:55", "", "127.0.0.1", "", 0, `test "$GO_SLEEP_IP" = 127.0.0.1`, "", time.Minute)
+
+	if err := p.Stop(context.Background()); err != nil {
+		t.Errorf("WOL.Stop returned unexpected error: %v", err)
+	}
+}
+
+func TestWOL_reachableTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	p := NewWOL("gpu", "00:11:22:33:44:55", "", "127.0.0.1", WOLCheckTCP, port, "", "", 0)
+	if !p.reachable(context.Background()) {
+		t.Errorf("WOL.reachable returned false for open port %s", strconv.Itoa(port))
+	}
+
+	listener.Close()
+	if p.reachable(context.Background()) {
+		t.Errorf("WOL.reachable returned true for closed port %s", strconv.Itoa(port))
+	}
+}
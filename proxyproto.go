@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/silentsokolov/go-sleep/log"
+)
+
+const (
+	proxyProtocolV1 = "v1"
+	proxyProtocolV2 = "v2"
+
+	// proxyHeaderTimeout is the timeout of reading a PROXY protocol header
+	proxyHeaderTimeout = 10 * time.Second
+	// proxyV1MaxLength is the longest v1 header with CRLF
+	proxyV1MaxLength = 107
+)
+
+// proxyV2Signature starts a PROXY protocol v2 header
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// proxyListener accepts connections with a PROXY protocol header,
+// headers are read from trusted proxies only, any peer without them
+type proxyListener struct {
+	net.Listener
+	trusted trustedProxies
+}
+
+// Accept returns the next connection, its header is read on the first use
+func (listener *proxyListener) Accept() (net.Conn, error) {
+	conn, err := listener.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	addr, _ := conn.RemoteAddr().(*net.TCPAddr)
+	if len(listener.trusted) > 0 && (addr == nil || !listener.trusted.contains(addr.IP)) {
+		return conn, nil
+	}
+	return &proxyConn{Conn: conn}, nil
+}
+
+// proxyConn is a connection with the addresses of its PROXY protocol header
+type proxyConn struct {
+	net.Conn
+	once   sync.Once
+	reader *bufio.Reader
+	remote net.Addr
+	local  net.Addr
+	err    error
+}
+
+// readHeader reads the header once, the connection is closed on errors
+func (conn *proxyConn) readHeader() {
+	conn.once.Do(func() {
+		conn.reader = bufio.NewReader(conn.Conn)
+		conn.Conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+		conn.remote, conn.local, conn.err = readProxyHeader(conn.reader)
+		conn.Conn.SetReadDeadline(time.Time{})
+
+		if conn.err != nil {
+			log.Printf("PROXY protocol header of %s raise error: %s", conn.Conn.RemoteAddr(), conn.err)
+			conn.Conn.Close()
+		}
+	})
+}
+
+func (conn *proxyConn) Read(b []byte) (int, error) {
+	conn.readHeader()
+	if conn.err != nil {
+		return 0, conn.err
+	}
+	return conn.reader.Read(b)
+}
+
+// CloseWrite half-closes the connection if it supports it
+func (conn *proxyConn) CloseWrite() error {
+	if c, ok := conn.Conn.(closeWriter); ok {
+		return c.CloseWrite()
+	}
+	return conn.Conn.Close()
+}
+
+// RemoteAddr returns the source address of the header
+func (conn *proxyConn) RemoteAddr() net.Addr {
+	conn.readHeader()
+	if conn.remote != nil {
+		return conn.remote
+	}
+	return conn.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the destination address of the header
+func (conn *proxyConn) LocalAddr() net.Addr {
+	conn.readHeader()
+	if conn.local != nil {
+		return conn.local
+	}
+	return conn.Conn.LocalAddr()
+}
+
+// readProxyHeader reads a v1 or v2 header, addresses are nil for
+// UNKNOWN and LOCAL connections
+func readProxyHeader(reader *bufio.Reader) (net.Addr, net.Addr, error) {
+	signature, err := reader.Peek(len(proxyV2Signature))
+	if err != nil && !bytes.HasPrefix(signature, []byte("PROXY ")) {
+		return nil, nil, errors.New("no PROXY protocol header")
+	}
+
+	switch {
+	case bytes.Equal(signature, proxyV2Signature):
+		return readProxyV2(reader)
+	case bytes.HasPrefix(signature, []byte("PROXY ")):
+		return readProxyV1(reader)
+	}
+	return nil, nil, errors.New("no PROXY protocol header")
+}
+
+// readProxyV1 reads "PROXY TCP4|TCP6 <src> <dst> <src port> <dst port>\r\n"
+func readProxyV1(reader *bufio.Reader) (net.Addr, net.Addr, error) {
+	var line []byte
+	for len(line) < proxyV1MaxLength {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return nil, nil, err
+		}
+		line = append(line, b)
+		if bytes.HasSuffix(line, []byte("\r\n")) {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, nil, errors.New("PROXY v1 header is too long")
+	}
+
+	fields := strings.Fields(string(line))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, nil, fmt.Errorf("invalid PROXY v1 header %q", strings.TrimSpace(string(line)))
+	}
+
+	src, err := proxyV1Addr(fields[2], fields[4])
+	if err != nil {
+		return nil, nil, err
+	}
+	dst, err := proxyV1Addr(fields[3], fields[5])
+	if err != nil {
+		return nil, nil, err
+	}
+	return src, dst, nil
+}
+
+func proxyV1Addr(ip, port string) (*net.TCPAddr, error) {
+	addr := &net.TCPAddr{IP: net.ParseIP(ip)}
+	if addr.IP == nil {
+		return nil, fmt.Errorf("invalid PROXY v1 address %q", ip)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PROXY v1 port %q", port)
+	}
+	addr.Port = int(p)
+	return addr, nil
+}
+
+// readProxyV2 reads the binary header, TLVs are skipped
+func readProxyV2(reader *bufio.Reader) (net.Addr, net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, nil, err
+	}
+	if header[12]>>4 != 2 {
+		return nil, nil, fmt.Errorf("invalid PROXY v2 version %d", header[12]>>4)
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:]))
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return nil, nil, err
+	}
+
+	// LOCAL connections, like health checks of the proxy, keep their addresses
+	if header[12]&0x0f == 0 {
+		return nil, nil, nil
+	}
+
+	var size int
+	switch header[13] {
+	case 0x11: // TCP over IPv4
+		size = net.IPv4len
+	case 0x21: // TCP over IPv6
+		size = net.IPv6len
+	default:
+		return nil, nil, nil
+	}
+	if len(payload) < 2*size+4 {
+		return nil, nil, errors.New("PROXY v2 addresses are too short")
+	}
+
+	src := &net.TCPAddr{IP: net.IP(payload[:size]), Port: int(binary.BigEndian.Uint16(payload[2*size:]))}
+	dst := &net.TCPAddr{IP: net.IP(payload[size : 2*size]), Port: int(binary.BigEndian.Uint16(payload[2*size+2:]))}
+	return src, dst, nil
+}
+
+// writeProxyHeader writes a header of version for a connection of src to dst,
+// UNKNOWN or LOCAL without TCP addresses
+func writeProxyHeader(w io.Writer, version string, src, dst net.Addr) error {
+	srcTCP, srcOK := src.(*net.TCPAddr)
+	dstTCP, dstOK := dst.(*net.TCPAddr)
+	known := srcOK && dstOK && (srcTCP.IP.To4() == nil) == (dstTCP.IP.To4() == nil)
+
+	if version == proxyProtocolV1 {
+		header := "PROXY UNKNOWN\r\n"
+		if known {
+			family := "TCP4"
+			if srcTCP.IP.To4() == nil {
+				family = "TCP6"
+			}
+			header = fmt.Sprintf("PROXY %s %s %s %d %d\r\n", family, srcTCP.IP, dstTCP.IP, srcTCP.Port, dstTCP.Port)
+		}
+		_, err := io.WriteString(w, header)
+		return err
+	}
+
+	header := append([]byte{}, proxyV2Signature...)
+	if !known {
+		header = append(header, 0x20, 0x00, 0, 0)
+		_, err := w.Write(header)
+		return err
+	}
+
+	family, srcIP, dstIP := byte(0x11), srcTCP.IP.To4(), dstTCP.IP.To4()
+	if srcIP == nil {
+		family, srcIP, dstIP = 0x21, srcTCP.IP.To16(), dstTCP.IP.To16()
+	}
+	header = append(header, 0x21, family, 0, 0)
+	binary.BigEndian.PutUint16(header[14:], uint16(2*len(srcIP)+4))
+	header = append(header, srcIP...)
+	header = append(header, dstIP...)
+	header = append(header, byte(srcTCP.Port>>8), byte(srcTCP.Port), byte(dstTCP.Port>>8), byte(dstTCP.Port))
+
+	_, err := w.Write(header)
+	return err
+}
+
+// proxyHeaderKey is the context key of the PROXY header of a backend request
+type proxyHeaderKey struct{}
+
+// proxyHeader is the PROXY protocol header sent to a backend
+type proxyHeader struct {
+	version  string
+	src, dst net.Addr
+}
+
+// newProxyTransport returns a transport which starts connections with the
+// PROXY header of the request, connections are not reused by other clients
+func newProxyTransport() *http.Transport {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+
+	transport := newTransport()
+	transport.DisableKeepAlives = true
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		if header, ok := ctx.Value(proxyHeaderKey{}).(proxyHeader); ok {
+			if err := writeProxyHeader(conn, header.version, header.src, header.dst); err != nil {
+				conn.Close()
+				return nil, err
+			}
+		}
+		return conn, nil
+	}
+	return transport
+}
+
+// backendTransport sends requests with a PROXY header by the proxy transport
+type backendTransport struct {
+	server *Server
+}
+
+func (t backendTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if _, ok := r.Context().Value(proxyHeaderKey{}).(proxyHeader); ok {
+		return t.server.proxyTransport.RoundTrip(r)
+	}
+	return t.server.transport.RoundTrip(r)
+}
+
+// requestProxyHeader returns the PROXY header of r for a backend
+func requestProxyHeader(r *http.Request, version string) proxyHeader {
+	header := proxyHeader{version: version}
+
+	client := requestClient(r)
+	src := &net.TCPAddr{IP: net.ParseIP(client.IP)}
+	if peer, ok := tcpAddr(r.RemoteAddr); ok && peer.IP.Equal(src.IP) {
+		src.Port = peer.Port
+	}
+	if src.IP != nil {
+		header.src = src
+	}
+	header.dst, _ = r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+
+	return header
+}
+
+// tcpAddr parses a host:port of an IP address
+func tcpAddr(addr string) (*net.TCPAddr, bool) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, false
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil || net.ParseIP(host) == nil {
+		return nil, false
+	}
+	return &net.TCPAddr{IP: net.ParseIP(host), Port: p}, true
+}
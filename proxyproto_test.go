@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProxyHeader(t *testing.T) {
+	var headerTable = []struct {
+		version string
+		src     net.Addr
+		dst     net.Addr
+	}{
+		{proxyProtocolV1, &net.TCPAddr{IP: net.ParseIP("198.51.100.1"), Port: 5000}, &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 443}},
+		{proxyProtocolV1, &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 5000}, &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 443}},
+		{proxyProtocolV2, &net.TCPAddr{IP: net.ParseIP("198.51.100.1"), Port: 5000}, &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 443}},
+		{proxyProtocolV2, &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 5000}, &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 443}},
+		{proxyProtocolV1, nil, nil},
+		{proxyProtocolV2, nil, nil},
+	}
+
+	for _, test := range headerTable {
+		var buf bytes.Buffer
+		if err := writeProxyHeader(&buf, test.version, test.src, test.dst); err != nil {
+			t.Fatalf("writeProxyHeader returned unexpected error: %v", err)
+		}
+		buf.WriteString("GET / HTTP/1.1\r\n")
+
+		reader := bufio.NewReader(&buf)
+		src, dst, err := readProxyHeader(reader)
+		if err != nil {
+			t.Errorf("readProxyHeader(%s, %v) returned unexpected error: %v", test.version, test.src, err)
+			continue
+		}
+		if addrString(src) != addrString(test.src) || addrString(dst) != addrString(test.dst) {
+			t.Errorf("readProxyHeader(%s) returned %v and %v, want %v and %v", test.version, src, dst, test.src, test.dst)
+		}
+		if rest, _ := ioutil.ReadAll(reader); string(rest) != "GET / HTTP/1.1\r\n" {
+			t.Errorf("readProxyHeader(%s) left %q", test.version, rest)
+		}
+	}
+}
+
+func addrString(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	return addr.String()
+}
+
+func TestReadProxyHeader_errors(t *testing.T) {
+	var errorTable = []string{
+		"GET / HTTP/1.1\r\n",
+		"PROXY TCP4 198.51.100.1 10.0.0.1 5000\r\n",
+		"PROXY TCP4 198.51.100.x 10.0.0.1 5000 443\r\n",
+		"PROXY TCP4 198.51.100.1 10.0.0.1 5000 " + strings.Repeat("4", 100) + "\r\n",
+		string(proxyV2Signature) + "\x11\x11\x00\x0c",
+	}
+
+	for _, header := range errorTable {
+		if _, _, err := readProxyHeader(bufio.NewReader(strings.NewReader(header))); err == nil {
+			t.Errorf("readProxyHeader(%q) returned no error", header)
+		}
+	}
+}
+
+func TestProxyListener(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var remoteAddr string
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remoteAddr = r.RemoteAddr
+	})}
+	go srv.Serve(&proxyListener{Listener: listener})
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	src := &net.TCPAddr{IP: net.ParseIP("198.51.100.1"), Port: 5000}
+	writeProxyHeader(conn, proxyProtocolV2, src, listener.Addr())
+	conn.Write([]byte("GET / HTTP/1.1\r\nHost: app.example.com\r\nConnection: close\r\n\r\n"))
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || remoteAddr != "198.51.100.1:5000" {
+		t.Errorf("request returned %d from %s, want 200 from 198.51.100.1:5000", resp.StatusCode, remoteAddr)
+	}
+}
+
+func TestProxyListener_untrusted(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trusted, _ := parseTrustedProxies([]string{"10.0.0.0/8"})
+	proxied := &proxyListener{Listener: listener, trusted: trusted}
+	defer proxied.Close()
+
+	go func() {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err == nil {
+			conn.Close()
+		}
+	}()
+
+	conn, err := proxied.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, ok := conn.(*proxyConn); ok {
+		t.Errorf("proxyListener reads headers of the untrusted peer %s", conn.RemoteAddr())
+	}
+}
+
+func TestServer_defaultReverseProxy_backendProxy(t *testing.T) {
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+
+	headers := make(chan string, 1)
+	go func() {
+		conn, err := backend.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		src, _, err := readProxyHeader(reader)
+		if err != nil {
+			headers <- err.Error()
+			return
+		}
+		r, err := http.ReadRequest(reader)
+		if err != nil {
+			headers <- err.Error()
+			return
+		}
+		headers <- addrString(src) + " " + r.Header.Get("X-Forwarded-For")
+		conn.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 0\r\nConnection: close\r\n\r\n"))
+	}()
+
+	server := NewServer(&Config{})
+	defer server.Close()
+	server.trustedProxies, _ = parseTrustedProxies([]string{"10.0.0.0/8"})
+
+	addr := backend.Addr().(*net.TCPAddr)
+	instance := NewComputeInstance(newDummyProvider("test", false), time.Minute)
+	instance.SetIPs([]string{"127.0.0.1"})
+	server.InstanceStore.Set(instance.Hash(), instance)
+	server.serverRoutes[":80"] = map[string]*serverRoute{
+		"app.example.com": {Hostname: "app.example.com", BackendPort: addr.Port, InstanceName: instance.Hash(), BackendProxy: proxyProtocolV1},
+	}
+
+	r := httptest.NewRequest("GET", "http://app.example.com/", nil)
+	r.RemoteAddr = "10.0.0.2:5000"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+	r = r.WithContext(context.WithValue(r.Context(), http.LocalAddrContextKey, &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 80}))
+	w := httptest.NewRecorder()
+	server.middlewareForwarded(server.defaultReverseProxy(":80")).ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("proxy returned status %d", w.Code)
+	}
+	if header, want := <-headers, "198.51.100.1:0 198.51.100.1, 10.0.0.2"; header != want {
+		t.Errorf("backend got %q, want %q", header, want)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os/signal"
+	"reflect"
+	"strings"
+	"syscall"
+
+	"github.com/silentsokolov/go-sleep/log"
+)
+
+// setKeys sets secret_key and api_keys
+func (server *Server) setKeys(secretKey string, apiKeys []string) {
+	server.keysMu.Lock()
+	defer server.keysMu.Unlock()
+	server.secretKey = secretKey
+	server.apiKeys = apiKeys
+}
+
+// backendKey returns secret_key, which is sent to backends
+func (server *Server) backendKey() string {
+	server.keysMu.RLock()
+	defer server.keysMu.RUnlock()
+	return server.secretKey
+}
+
+// listenReload reloads the config of path on SIGHUP until the server is closed
+func (server *Server) listenReload(path string) {
+	signal.Notify(server.reloads, syscall.SIGHUP)
+	go func() {
+		for range server.reloads {
+			server.reloadConfig(path)
+		}
+	}()
+}
+
+// reloadConfig reads the config of path again and resolves its secrets,
+// only secret_key and api_keys are replaced, changes of other settings
+// are logged as ignored; the running config is kept on errors
+func (server *Server) reloadConfig(path string) {
+	config, err := decodeConfig(path)
+	if err != nil {
+		log.Printf("Reload of %s raise error: %s", path, err)
+		return
+	}
+
+	server.setKeys(config.SecretKey, config.APIKeys)
+	log.Printf("Reloaded secret_key and api_keys of %s", path)
+
+	if server.config != nil {
+		if ignored := changedSettings(server.config, config); len(ignored) > 0 {
+			log.Warnf("Reload of %s ignored changed %s, they need a restart", path, strings.Join(ignored, ", "))
+		}
+	}
+}
+
+// reloadedSettings are replaced on reload, include is resolved into the others
+var reloadedSettings = map[string]bool{"include": true, "secret_key": true, "api_keys": true}
+
+// changedSettings returns toml names of settings which differ between
+// the running config and config, except the reloaded ones
+func changedSettings(running, config *Config) []string {
+	var changed []string
+
+	a, b := reflect.ValueOf(running).Elem(), reflect.ValueOf(config).Elem()
+	for i := 0; i < a.NumField(); i++ {
+		name := a.Type().Field(i).Tag.Get("toml")
+		if reloadedSettings[name] {
+			continue
+		}
+		if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			changed = append(changed, name)
+		}
+	}
+
+	return changed
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestServer_reloadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keyFile := writeCheckFile(t, dir, "api.key", []byte("old-key\n"))
+	path := writeCheckFile(t, dir, "config.toml", []byte(`
+secret_key = "backend"
+api_keys = ["${file:`+filepath.ToSlash(keyFile)+`}"]
+`))
+
+	server := NewServer(&Config{})
+	defer server.Close()
+	server.reloadConfig(path)
+
+	if !server.validAPIKey("old-key") || server.backendKey() != "backend" {
+		t.Fatalf("reloadConfig set api_keys %v and secret_key %q", server.apiKeys, server.backendKey())
+	}
+
+	// the secret is rotated
+	writeCheckFile(t, dir, "api.key", []byte("new-key\n"))
+	server.reloadConfig(path)
+	if server.validAPIKey("old-key") || !server.validAPIKey("new-key") {
+		t.Errorf("reloadConfig kept api_keys %v, want the rotated key", server.apiKeys)
+	}
+
+	// a broken config keeps the running keys
+	os.Remove(keyFile)
+	server.reloadConfig(path)
+	if !server.validAPIKey("new-key") {
+		t.Errorf("reloadConfig replaced api_keys %v with a broken config", server.apiKeys)
+	}
+}
+
+func TestChangedSettings(t *testing.T) {
+	running := &Config{
+		Port:      "8080",
+		SecretKey: "old",
+		APIKeys:   []string{"old-key"},
+		GCE:       []*GCEConfig{{BaseConfig: BaseConfig{ID: "app"}, Name: "web"}},
+	}
+
+	var changedTable = []struct {
+		config  *Config
+		changed []string
+	}{
+		{&Config{Port: "8080", GCE: []*GCEConfig{{BaseConfig: BaseConfig{ID: "app"}, Name: "web"}}}, nil},
+		{&Config{Port: "8080", SecretKey: "new", APIKeys: []string{"new-key"}, GCE: []*GCEConfig{{BaseConfig: BaseConfig{ID: "app"}, Name: "web"}}}, nil},
+		{&Config{Port: "9090", GCE: []*GCEConfig{{BaseConfig: BaseConfig{ID: "app"}, Name: "web", JWTPath: "/new.json"}}}, []string{"port", "gce"}},
+	}
+
+	for _, tt := range changedTable {
+		if changed := changedSettings(running, tt.config); !reflect.DeepEqual(changed, tt.changed) {
+			t.Errorf("changedSettings returned %v, want %v", changed, tt.changed)
+		}
+	}
+}
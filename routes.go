@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/silentsokolov/go-sleep/log"
+)
+
+// notRoutedError is returned for hosts without a route or an instance
+type notRoutedError struct {
+	message string
+}
+
+func (err *notRoutedError) Error() string {
+	return err.message
+}
+
+// notFoundContext is the context of the 404 page
+type notFoundContext struct {
+	Host string
+}
+
+// hostPattern compiles a hostname of a route: "*.example.com" matches
+// one label, captured as $1, and "~<regexp>" matches the whole host;
+// it returns nil for exact hostnames
+func hostPattern(hostname string) (*regexp.Regexp, error) {
+	switch {
+	case strings.HasPrefix(hostname, "~"):
+		return regexp.Compile(`^(?:` + strings.TrimPrefix(hostname, "~") + `)$`)
+	case strings.HasPrefix(hostname, "*."):
+		return regexp.Compile(`^([^.]+)` + regexp.QuoteMeta(strings.TrimPrefix(hostname, "*")) + `$`)
+	}
+	return nil, nil
+}
+
+// addHostPattern adds a wildcard or regexp route of address, wildcards are
+// matched before regexps and longer wildcards before shorter ones
+func (server *Server) addHostPattern(address string, route *serverRoute) {
+	patterns := append(server.hostPatterns[address], route)
+
+	sort.SliceStable(patterns, func(i, j int) bool {
+		wi, wj := !strings.HasPrefix(patterns[i].Hostname, "~"), !strings.HasPrefix(patterns[j].Hostname, "~")
+		if wi != wj {
+			return wi
+		}
+		return wi && len(patterns[i].Hostname) > len(patterns[j].Hostname)
+	})
+
+	server.hostPatterns[address] = patterns
+}
+
+// matchRoute returns the route of host on address and the key of its instance:
+// an exact hostname, a wildcard, a regexp and then the default route
+func (server *Server) matchRoute(address, host string) (*serverRoute, string, bool) {
+	if route, ok := server.serverRoutes[address][host]; ok {
+		return route, route.instanceKey(nil, host), true
+	}
+
+	for _, route := range server.hostPatterns[address] {
+		if match := route.pattern.FindStringSubmatchIndex(host); match != nil {
+			return route, route.instanceKey(match, host), true
+		}
+	}
+
+	if route, ok := server.defaultRoutes[address]; ok {
+		return route, route.instanceKey(nil, host), true
+	}
+
+	return nil, "", false
+}
+
+// instanceKey returns the hash of the instance of the route, or the id
+// expanded from the instance of the route config with groups of match
+func (route *serverRoute) instanceKey(match []int, host string) string {
+	switch {
+	case len(route.instanceTemplate) == 0:
+		return route.InstanceName
+	case route.pattern == nil || match == nil:
+		return route.instanceTemplate
+	}
+	return string(route.pattern.ExpandString(nil, route.instanceTemplate, host, match))
+}
+
+// addressRoutes returns HTTP routes of address
+func (server *Server) addressRoutes(address string) []*serverRoute {
+	var routes []*serverRoute
+	for _, route := range server.serverRoutes[address] {
+		routes = append(routes, route)
+	}
+	routes = append(routes, server.hostPatterns[address]...)
+	if route, ok := server.defaultRoutes[address]; ok {
+		routes = append(routes, route)
+	}
+	return routes
+}
+
+// loadNotFoundPage parses the template of the 404 page, the built-in page
+// is used without path
+func (server *Server) loadNotFoundPage(path string) {
+	if len(path) == 0 {
+		return
+	}
+
+	page, err := template.ParseFiles(path)
+	if err != nil {
+		log.Fatalf("Error loading not_found_page: %s", err)
+	}
+	server.notFoundPage = page
+}
+
+// responseNotFound serves the 404 page for host
+func (server *Server) responseNotFound(w http.ResponseWriter, host string) {
+	context := notFoundContext{Host: host}
+
+	if server.notFoundPage == nil {
+		responseHTML(w, http.StatusNotFound, "not_found.html", context)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusNotFound)
+	if err := server.notFoundPage.Execute(w, context); err != nil {
+		log.Printf("Error rendering not_found_page: %s", err)
+	}
+}
+
+// notRouted returns the error of host without a route or an instance
+func notRouted(format string, args ...interface{}) error {
+	return &notRoutedError{fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHostPattern(t *testing.T) {
+	var patternTable = []struct {
+		hostname string
+		host     string
+		match    bool
+	}{
+		{"*.preview.example.com", "pr-1.preview.example.com", true},
+		{"*.preview.example.com", "a.b.preview.example.com", false},
+		{"*.preview.example.com", "preview.example.com", false},
+		{"*.preview.example.com", "pr-1.previewXexample.com", false},
+		{`~pr-(\d+)\.example\.com`, "pr-42.example.com", true},
+		{`~pr-(\d+)\.example\.com`, "pr-42.example.com.evil.org", false},
+		{`~a|b`, "ab", false},
+	}
+
+	for _, test := range patternTable {
+		pattern, err := hostPattern(test.hostname)
+		if err != nil {
+			t.Fatalf("hostPattern(%q) returned unexpected error: %v", test.hostname, err)
+		}
+		if match := pattern.MatchString(test.host); match != test.match {
+			t.Errorf("hostPattern(%q) matches %s %v, want %v", test.hostname, test.host, match, test.match)
+		}
+	}
+
+	if pattern, err := hostPattern("example.com"); pattern != nil || err != nil {
+		t.Errorf("hostPattern(example.com) returned %v, %v, want nil", pattern, err)
+	}
+	if _, err := hostPattern("~pr-(\\d+"); err == nil {
+		t.Errorf("hostPattern returned no error for an invalid regexp")
+	}
+}
+
+// newRoutesServer returns a server with instances app, pr-42 and
+// fallback and top-level routes on :80
+func newRoutesServer() *Server {
+	server := NewServer(&Config{})
+
+	for _, id := range []string{"app", "pr-42", "fallback"} {
+		instance := NewComputeInstance(newDummyProvider(id, false), time.Minute)
+		instance.ID = id
+		server.InstanceStore.Set(instance.Hash(), instance)
+	}
+
+	server.buildServerRoutes([]*RouteConfig{
+		{Address: ":80", Hostnames: []string{"pr-42.preview.example.com"}, Instance: "app"},
+		{Address: ":80", Hostnames: []string{"*.example.com"}, Instance: "app"},
+		{Address: ":80", Hostnames: []string{"*.preview.example.com", `~(pr-\d+)\.example\.org`}, Instance: "$1"},
+		{Address: ":80", Default: true, Instance: "fallback"},
+		{Address: ":8080", Hostnames: []string{"*.example.com"}, Instance: "app"},
+	}, "", nil)
+
+	return server
+}
+
+func TestServer_matchRoute(t *testing.T) {
+	server := newRoutesServer()
+	defer server.Close()
+
+	var matchTable = []struct {
+		address  string
+		host     string
+		hostname string
+		key      string
+	}{
+		{":80", "pr-42.preview.example.com", "pr-42.preview.example.com", "app"},
+		{":80", "pr-7.preview.example.com", "*.preview.example.com", "pr-7"},
+		{":80", "www.example.com", "*.example.com", "app"},
+		{":80", "pr-42.example.org", `~(pr-\d+)\.example\.org`, "pr-42"},
+		{":80", "other.org", "", "fallback"},
+		{":8080", "www.example.com", "*.example.com", "app"},
+	}
+
+	for _, test := range matchTable {
+		route, key, ok := server.matchRoute(test.address, test.host)
+		if !ok {
+			t.Errorf("matchRoute(%s, %s) found no route", test.address, test.host)
+			continue
+		}
+		if route.Hostname != test.hostname || key != test.key {
+			t.Errorf("matchRoute(%s, %s) returned %s and %s, want %s and %s", test.address, test.host, route.Hostname, key, test.hostname, test.key)
+		}
+	}
+
+	if _, _, ok := server.matchRoute(":8080", "other.org"); ok {
+		t.Errorf("matchRoute(:8080, other.org) found a route without a default route")
+	}
+}
+
+func TestServer_middlewareWakeup_notFound(t *testing.T) {
+	server := newRoutesServer()
+	defer server.Close()
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := server.middlewareWakeup(next, ":8080")
+
+	var requestTable = []struct {
+		host   string
+		status int
+		body   string
+	}{
+		{"other.org:8080", http.StatusNotFound, "There is no server for other.org:8080"},
+		{"pr-7.example.com:8080", http.StatusOK, ""},
+	}
+
+	for _, test := range requestTable {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Host = test.host
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.status {
+			t.Errorf("GET %s returned status %d, want %d", test.host, w.Code, test.status)
+		}
+		if !strings.Contains(w.Body.String(), test.body) {
+			t.Errorf("GET %s returned %s, want %s", test.host, w.Body.String(), test.body)
+		}
+	}
+
+	// pr-7 has no instance
+	handler = server.middlewareWakeup(next, ":80")
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Host = "pr-7.preview.example.com:80"
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GET %s returned status %d, want %d", r.Host, w.Code, http.StatusNotFound)
+	}
+}
+
+func TestServer_loadNotFoundPage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "routes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeCheckFile(t, dir, "404.html", []byte("<h1>No preview at {{.Host}}</h1>"))
+
+	server := NewServer(&Config{})
+	defer server.Close()
+	server.loadNotFoundPage(path)
+
+	w := httptest.NewRecorder()
+	server.responseNotFound(w, "pr-1.example.com")
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("responseNotFound returned status %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if want := "<h1>No preview at pr-1.example.com</h1>"; w.Body.String() != want {
+		t.Errorf("responseNotFound returned %s, want %s", w.Body.String(), want)
+	}
+}
+
+func TestCheckConfig_routes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "check")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeCheckFile(t, dir, "config.toml", []byte(`
+[[ec2]]
+id = "app"
+  [[ec2.route]]
+  hostnames = ["*.example.com", "~pr-(\\d+"]
+  default = true
+
+[[route]]
+hostnames = ["*.example.com"]
+instance = "$1"
+
+[[route]]
+default = true
+instance = "db"
+
+[[route]]
+hostnames = ["www.example.org"]
+`))
+
+	problems, err := checkConfig(path, false)
+	if err != nil {
+		t.Fatalf("checkConfig returned unexpected error: %v", err)
+	}
+
+	want := []Problem{
+		{File: path, Line: 5, Message: `invalid hostname "~pr-(\\d+"`},
+		{File: path, Line: 9, Message: "hostname *.example.com on :80 is already used at line 5"},
+		{File: path, Line: 13, Message: "default route on :80 is already set at line 6"},
+		{File: path, Line: 14, Message: "[[route]] #2: unknown instance \"db\""},
+		{File: path, Line: 16, Message: "[[route]] #3: instance is required"},
+	}
+	if len(problems) != len(want) {
+		t.Fatalf("checkConfig returned %v, want %v", problems, want)
+	}
+	for i, p := range problems {
+		if p.File != want[i].File || p.Line != want[i].Line || !strings.Contains(p.Message, want[i].Message) {
+			t.Errorf("checkConfig returned %v, want %v", p, want[i])
+		}
+	}
+}
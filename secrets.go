@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// secretRef matches references embedded in a string, $${ is a literal ${
+var secretRef = regexp.MustCompile(`\$\$\{|\$\{(env|file|vault):([^}]*)\}`)
+
+// secretError is an error of the reference in the config key path
+type secretError struct {
+	path string
+	err  error
+}
+
+func (err *secretError) Error() string {
+	return fmt.Sprintf("%s: %s", err.path, err.err)
+}
+
+// secretResolver resolves secret references in strings of the config:
+// ${env:NAME}, ${file:/path}, ${vault:path#key}, file:///path and
+// vault://path#key; offline vault references are left as is
+type secretResolver struct {
+	vault   *vaultClient
+	offline bool
+	cache   map[string]map[string]interface{}
+}
+
+// resolveSecrets resolves secret references in config, the vault section
+// is resolved first without Vault to create the Vault client; offline
+// Vault is not called
+func resolveSecrets(config *Config, offline bool) []*secretError {
+	resolver := &secretResolver{offline: offline, cache: make(map[string]map[string]interface{})}
+
+	vaultConfig := config.Vault
+	if vaultConfig == nil {
+		vaultConfig = &VaultConfig{}
+	} else if errs := resolver.resolveValue(reflect.ValueOf(vaultConfig), "vault"); len(errs) > 0 {
+		return errs
+	}
+
+	if !offline {
+		vault, err := newVaultClient(vaultConfig)
+		if err != nil {
+			return []*secretError{{"vault", err}}
+		}
+		resolver.vault = vault
+	}
+
+	var errs []*secretError
+	value := reflect.ValueOf(config).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		tag := value.Type().Field(i).Tag.Get("toml")
+		if tag == "vault" {
+			continue
+		}
+		errs = append(errs, resolver.resolveValue(value.Field(i), tag)...)
+	}
+	return errs
+}
+
+// resolveValue resolves strings of value, path is the key of value
+// like ec2[0].route[1].address
+func (resolver *secretResolver) resolveValue(value reflect.Value, path string) []*secretError {
+	var errs []*secretError
+
+	switch value.Kind() {
+	case reflect.Ptr:
+		if !value.IsNil() {
+			errs = append(errs, resolver.resolveValue(value.Elem(), path)...)
+		}
+	case reflect.Interface:
+		if value.IsNil() {
+			break
+		}
+		// strings in interfaces are not settable, like items of []interface{}
+		if s, ok := value.Interface().(string); ok && value.CanSet() {
+			resolved, err := resolver.resolve(s)
+			if err != nil {
+				return []*secretError{{path, err}}
+			}
+			value.Set(reflect.ValueOf(resolved))
+			break
+		}
+		errs = append(errs, resolver.resolveValue(value.Elem(), path)...)
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			switch {
+			case field.Anonymous:
+				errs = append(errs, resolver.resolveValue(value.Field(i), path)...)
+			case len(field.Tag.Get("toml")) > 0:
+				errs = append(errs, resolver.resolveValue(value.Field(i), path+"."+field.Tag.Get("toml"))...)
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			errs = append(errs, resolver.resolveValue(value.Index(i), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	case reflect.Map:
+		for _, key := range value.MapKeys() {
+			item := value.MapIndex(key)
+			keyPath := fmt.Sprintf("%s.%v", path, key)
+
+			// map items are not addressable, strings are set back
+			if s, ok := item.Interface().(string); ok {
+				resolved, err := resolver.resolve(s)
+				if err != nil {
+					errs = append(errs, &secretError{keyPath, err})
+					continue
+				}
+				value.SetMapIndex(key, reflect.ValueOf(resolved))
+				continue
+			}
+			errs = append(errs, resolver.resolveValue(item, keyPath)...)
+		}
+	case reflect.String:
+		resolved, err := resolver.resolve(value.String())
+		if err != nil {
+			return []*secretError{{path, err}}
+		}
+		if value.CanSet() {
+			value.SetString(resolved)
+		}
+	}
+
+	return errs
+}
+
+// resolve returns s with secret references replaced by their values
+func (resolver *secretResolver) resolve(s string) (string, error) {
+	switch {
+	case strings.HasPrefix(s, "file://"):
+		return resolver.ref("file", strings.TrimPrefix(s, "file://"), s)
+	case strings.HasPrefix(s, "vault://"):
+		return resolver.ref("vault", strings.TrimPrefix(s, "vault://"), s)
+	}
+
+	var err error
+	resolved := secretRef.ReplaceAllStringFunc(s, func(ref string) string {
+		if ref == "$${" {
+			return "${"
+		}
+
+		m := secretRef.FindStringSubmatch(ref)
+		value, refErr := resolver.ref(m[1], m[2], ref)
+		if refErr != nil && err == nil {
+			err = refErr
+		}
+		return value
+	})
+
+	return resolved, err
+}
+
+// ref returns the secret of the reference ref of kind to name
+func (resolver *secretResolver) ref(kind, name, ref string) (string, error) {
+	switch kind {
+	case "env":
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("%s: environment variable %s is not set", ref, name)
+		}
+		return value, nil
+	case "file":
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			return "", fmt.Errorf("%s: %s", ref, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+
+	n := strings.LastIndex(name, "#")
+	if n <= 0 || n == len(name)-1 {
+		return "", fmt.Errorf("%s: want vault://<path>#<key>", ref)
+	}
+	path, key := name[:n], name[n+1:]
+
+	if resolver.vault == nil {
+		if resolver.offline {
+			return ref, nil
+		}
+		return "", fmt.Errorf("%s: Vault address is not set, set [vault] address or VAULT_ADDR", ref)
+	}
+
+	data, ok := resolver.cache[path]
+	if !ok {
+		var err error
+		if data, err = resolver.vault.Read(path); err != nil {
+			return "", fmt.Errorf("%s: %s", ref, err)
+		}
+		resolver.cache[path] = data
+	}
+
+	value, ok := data[key]
+	if !ok {
+		return "", fmt.Errorf("%s: no key %q in the secret", ref, key)
+	}
+	return fmt.Sprint(value), nil
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeVault serves KV version 1 at kv/ and version 2 at secret/,
+// with the token root or a token of the AppRole login
+func fakeVault(t *testing.T) (*httptest.Server, *int) {
+	reads := 0
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/auth/approle/login" {
+			login := map[string]string{}
+			json.NewDecoder(r.Body).Decode(&login)
+			if login["role_id"] != "role" || login["secret_id"] != "secret" {
+				responseJSON(w, http.StatusBadRequest, map[string][]string{"errors": {"invalid role or secret ID"}})
+				return
+			}
+			responseJSON(w, http.StatusOK, map[string]interface{}{"auth": map[string]string{"client_token": "approle-token"}})
+			return
+		}
+
+		if token := r.Header.Get("X-Vault-Token"); token != "root" && token != "approle-token" {
+			responseJSON(w, http.StatusForbidden, map[string][]string{"errors": {"permission denied"}})
+			return
+		}
+
+		reads++
+		switch r.URL.Path {
+		case "/v1/secret/data/go-sleep":
+			responseJSON(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{
+				"data":     map[string]interface{}{"aws_secret": "from-vault", "port": 8080},
+				"metadata": map[string]interface{}{"version": 1},
+			}})
+		case "/v1/kv/go-sleep":
+			responseJSON(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"password": "kv1"}})
+		default:
+			responseJSON(w, http.StatusNotFound, map[string][]string{"errors": {}})
+		}
+	})
+
+	return httptest.NewServer(handler), &reads
+}
+
+func TestResolveSecrets(t *testing.T) {
+	vault, reads := fakeVault(t)
+	defer vault.Close()
+
+	dir, err := ioutil.TempDir("", "secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keyFile := filepath.Join(dir, "key")
+	if err := ioutil.WriteFile(keyFile, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("GO_SLEEP_TEST_SECRET", "from-env")
+	defer os.Unsetenv("GO_SLEEP_TEST_SECRET")
+
+	config := &Config{
+		SecretKey: "file://" + keyFile,
+		Vault:     &VaultConfig{Address: "${env:GO_SLEEP_TEST_VAULT}", RoleID: "role", SecretID: "secret"},
+		EC2: []*EC2Config{{
+			AccessKeyID:     "${env:GO_SLEEP_TEST_SECRET}",
+			SecretAccessKey: "vault://secret/data/go-sleep#aws_secret",
+		}},
+		AuthBasic: map[string]*AuthGroup{"admins": {Users: []string{"admin:${vault:kv/go-sleep#password}", "test:$${env:NOT_A_REF}"}}},
+		Exec:      []*ExecConfig{{StartCommand: "start ${HOME}", Env: map[string]string{"PORT": "${vault:secret/data/go-sleep#port}"}}},
+		Plugin:    []*PluginConfig{{Options: map[string]interface{}{"tokens": []interface{}{"${env:GO_SLEEP_TEST_SECRET}"}}}},
+	}
+
+	os.Setenv("GO_SLEEP_TEST_VAULT", vault.URL)
+	defer os.Unsetenv("GO_SLEEP_TEST_VAULT")
+
+	if errs := resolveSecrets(config, false); len(errs) > 0 {
+		t.Fatalf("resolveSecrets returned unexpected errors: %v", errs)
+	}
+
+	var resolveTable = []struct {
+		name  string
+		value interface{}
+		want  interface{}
+	}{
+		{"secret_key", config.SecretKey, "from-file"},
+		{"vault.address", config.Vault.Address, vault.URL},
+		{"ec2[0].access_key_id", config.EC2[0].AccessKeyID, "from-env"},
+		{"ec2[0].secret_access_key", config.EC2[0].SecretAccessKey, "from-vault"},
+		{"auth.admins.users", config.AuthBasic["admins"].Users, []string{"admin:kv1", "test:${env:NOT_A_REF}"}},
+		{"exec[0].start", config.Exec[0].StartCommand, "start ${HOME}"},
+		{"exec[0].env.PORT", config.Exec[0].Env["PORT"], "8080"},
+		{"plugin[0].options.tokens", config.Plugin[0].Options["tokens"], []interface{}{"from-env"}},
+	}
+
+	for _, tt := range resolveTable {
+		if !reflect.DeepEqual(tt.value, tt.want) {
+			t.Errorf("resolveSecrets set %s to %v, want %v", tt.name, tt.value, tt.want)
+		}
+	}
+
+	if *reads != 2 {
+		t.Errorf("resolveSecrets read Vault %d times, want 2", *reads)
+	}
+}
+
+func TestResolveSecrets_errors(t *testing.T) {
+	vault, _ := fakeVault(t)
+	defer vault.Close()
+
+	for _, env := range []string{"VAULT_ADDR", "VAULT_TOKEN", "VAULT_ROLE_ID"} {
+		defer os.Setenv(env, os.Getenv(env))
+		os.Unsetenv(env)
+	}
+
+	var errorTable = []struct {
+		config  *Config
+		offline bool
+		errs    []string
+	}{
+		{
+			&Config{EC2: []*EC2Config{{SecretAccessKey: "${env:GO_SLEEP_TEST_MISSING}"}}, SecretKey: "file:///nonexistent/key"},
+			false,
+			[]string{
+				"secret_key: file:///nonexistent/key: open /nonexistent/key",
+				"ec2[0].secret_access_key: ${env:GO_SLEEP_TEST_MISSING}: environment variable GO_SLEEP_TEST_MISSING is not set",
+			},
+		},
+		{
+			&Config{SecretKey: "vault://secret/data/go-sleep#aws_secret"},
+			false,
+			[]string{"secret_key: vault://secret/data/go-sleep#aws_secret: Vault address is not set"},
+		},
+		{
+			&Config{SecretKey: "vault://secret/data/go-sleep#aws_secret"},
+			true,
+			nil,
+		},
+		{
+			&Config{SecretKey: "vault://secret/data/go-sleep", Vault: &VaultConfig{Address: vault.URL, Token: "root"}},
+			false,
+			[]string{"secret_key: vault://secret/data/go-sleep: want vault://<path>#<key>"},
+		},
+		{
+			&Config{SecretKey: "vault://secret/data/go-sleep#missing", Vault: &VaultConfig{Address: vault.URL, Token: "root"}},
+			false,
+			[]string{`no key "missing" in the secret`},
+		},
+		{
+			&Config{SecretKey: "vault://secret/data/other#key", Vault: &VaultConfig{Address: vault.URL, Token: "root"}},
+			false,
+			[]string{"no secret at secret/data/other"},
+		},
+		{
+			&Config{SecretKey: "vault://secret/data/go-sleep#aws_secret", Vault: &VaultConfig{Address: vault.URL, Token: "wrong"}},
+			false,
+			[]string{"Vault returned 403: permission denied"},
+		},
+		{
+			&Config{SecretKey: "vault://secret/data/go-sleep#aws_secret", Vault: &VaultConfig{Address: vault.URL, RoleID: "role", SecretID: "wrong"}},
+			false,
+			[]string{"AppRole login: Vault returned 400: invalid role or secret ID"},
+		},
+		{
+			&Config{Vault: &VaultConfig{Address: vault.URL}},
+			false,
+			[]string{"vault: Vault needs token or role_id"},
+		},
+	}
+
+	for i, tt := range errorTable {
+		errs := resolveSecrets(tt.config, tt.offline)
+		if len(errs) != len(tt.errs) {
+			t.Errorf("resolveSecrets #%d returned %v, want %v", i, errs, tt.errs)
+			continue
+		}
+		for j, err := range errs {
+			if !strings.Contains(err.Error(), tt.errs[j]) {
+				t.Errorf("resolveSecrets #%d returned %q, want %q", i, err, tt.errs[j])
+			}
+		}
+	}
+}
+
+func TestCheckConfig_secrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "check")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeCheckFile(t, dir, "config.toml", []byte(`
+secret_key = "${env:GO_SLEEP_TEST_MISSING}"
+
+[[ec2]]
+access_key_id = "vault://secret/data/go-sleep#key"
+[[ec2]]
+secret_access_key = "file://`+dir+`/missing"
+`))
+
+	problems, err := checkConfig(path, false)
+	if err != nil {
+		t.Fatalf("checkConfig returned unexpected error: %v", err)
+	}
+
+	want := []Problem{
+		{path, 2, "${env:GO_SLEEP_TEST_MISSING}: environment variable GO_SLEEP_TEST_MISSING is not set"},
+		{path, 7, "no such file or directory"},
+	}
+	if len(problems) != len(want) {
+		t.Fatalf("checkConfig returned %v, want %v", problems, want)
+	}
+	for i, p := range problems {
+		if p.File != want[i].File || p.Line != want[i].Line || !strings.Contains(p.Message, want[i].Message) {
+			t.Errorf("checkConfig returned %v, want %v", p, want[i])
+		}
+	}
+}
+
+// TestVaultClient_devServer runs against a Vault dev server:
+// vault server -dev -dev-root-token-id=root
+// VAULT_ADDR=http://127.0.0.1:8200 VAULT_TOKEN=root go test -run Vault
+func TestVaultClient_devServer(t *testing.T) {
+	if len(os.Getenv("VAULT_ADDR")) == 0 || len(os.Getenv("VAULT_TOKEN")) == 0 {
+		t.Skip("no Vault dev server, set VAULT_ADDR and VAULT_TOKEN")
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{"data": map[string]string{"key": "dev-secret"}})
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(os.Getenv("VAULT_ADDR"), "/")+"/v1/secret/data/go-sleep-test", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Vault-Token", os.Getenv("VAULT_TOKEN"))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("writing the secret returned %d", resp.StatusCode)
+	}
+
+	config := &Config{SecretKey: "vault://secret/data/go-sleep-test#key"}
+	if errs := resolveSecrets(config, false); len(errs) > 0 {
+		t.Fatalf("resolveSecrets returned unexpected errors: %v", errs)
+	}
+	if config.SecretKey != "dev-secret" {
+		t.Errorf("resolveSecrets set secret_key to %q, want dev-secret", config.SecretKey)
+	}
+}
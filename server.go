@@ -1,15 +1,19 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
+	"html/template"
 	"net"
 	"net/http"
 	"net/http/httputil"
 	"os"
 	"os/signal"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -24,9 +28,26 @@ type Server struct {
 	InstanceStore *InstanceStore
 	stopChan      chan bool
 	signals       chan os.Signal
+	reloads       chan os.Signal
 	portWeb       string
+	// keysMu guards secretKey and apiKeys, they are replaced on reload
+	keysMu        sync.RWMutex
 	secretKey     string
+	apiKeys       []string
+	config        *Config
 	serverRoutes  map[string]map[string]*serverRoute
+	hostPatterns  map[string][]*serverRoute
+	defaultRoutes map[string]*serverRoute
+	tcpRoutes     map[string]*serverRoute
+	notFoundPage  *template.Template
+	transport     *http.Transport
+	// proxyTransport sends requests of routes with backend_proxy_protocol
+	proxyTransport *http.Transport
+	trustedProxies trustedProxies
+	// proxyProtocol are addresses accepting the PROXY protocol
+	proxyProtocol map[string]bool
+	webhooks      []*Webhook
+	notifier      *notifier
 }
 
 type serverRoute struct {
@@ -35,13 +56,22 @@ type serverRoute struct {
 	InstanceName string
 	basicUsers   map[string]string
 	IsProxy      bool
+	SleepWarning time.Duration
 	basicAuth    *auth.BasicAuth
 	Certificates []tls.Certificate
+	TCPWait      time.Duration
+	BackendProxy string
+
+	// pattern matches wildcard and regexp hostnames, instanceTemplate
+	// selects the instance by id with groups of the pattern
+	pattern          *regexp.Regexp
+	instanceTemplate string
 }
 
 type pageContext struct {
 	Message      string     `json:"message,omitempty"`
 	StartRequest *time.Time `json:"request_start_at,omitempty"`
+	NextAttempt  *time.Time `json:"next_attempt_at,omitempty"`
 	Error        string     `json:"error,omitempty"`
 }
 
@@ -64,15 +94,38 @@ func NewServer(conf *Config) *Server {
 	server.signals = make(chan os.Signal, 1)
 	server.portWeb = conf.Port
 	server.serverRoutes = make(map[string]map[string]*serverRoute)
+	server.hostPatterns = make(map[string][]*serverRoute)
+	server.defaultRoutes = make(map[string]*serverRoute)
+	server.tcpRoutes = make(map[string]*serverRoute)
+	server.transport = newTransport()
+	server.proxyTransport = newProxyTransport()
+	server.proxyProtocol = make(map[string]bool)
 	signal.Notify(server.signals, syscall.SIGINT, syscall.SIGTERM)
+	server.reloads = make(chan os.Signal, 1)
 
 	return server
 }
 
+// newTransport returns a transport with the settings of http.DefaultTransport,
+// idle connections of its own are closed when addresses change
+func newTransport() *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
 // Start ...
 func (server *Server) Start() {
 	server.startServers()
-	go startWebServer(server.portWeb)
+	go startWebServer(server.portWeb, server.middlewareForwarded(server.apiHandler()), server.notifyHandler())
 	go server.listenSignals()
 }
 
@@ -86,6 +139,8 @@ func (server *Server) Close() {
 	server.InstanceStore.Close()
 	signal.Stop(server.signals)
 	close(server.signals)
+	signal.Stop(server.reloads)
+	close(server.reloads)
 	close(server.stopChan)
 }
 
@@ -95,15 +150,25 @@ func (server *Server) Stop() {
 }
 
 func (server *Server) loadConfig(config *Config) {
-	// TODO Hot-reload config
-	var (
-		instance     *ComputeInstance
-		sleep        time.Duration
-		instanceHash string
-		err          error
-	)
+	var err error
+
+	server.config = config
+	server.setKeys(config.SecretKey, config.APIKeys)
+	server.loadNotFoundPage(config.NotFound)
+
+	server.trustedProxies, err = parseTrustedProxies(config.Trusted)
+	if err != nil {
+		log.Fatal(err)
+	}
+	provider.SetRateLimit(config.RateLimit, config.RateBurst)
 
-	server.secretKey = config.SecretKey
+	if config.Notify != nil {
+		server.notifier = newNotifier(config.Notify)
+	}
+
+	for _, conf := range config.Webhook {
+		server.webhooks = append(server.webhooks, NewWebhook(conf))
+	}
 
 	serverBasicAuthUsers := make(map[string]map[string]string)
 	for groupName, group := range config.AuthBasic {
@@ -113,73 +178,175 @@ func (server *Server) loadConfig(config *Config) {
 		}
 	}
 
-	for _, conf := range config.EC2 {
-		log.Println("Initialization EC2 instances ...")
-		sleep = sleepDuration(conf.SleepAfter)
-		instance = NewComputeInstance(provider.NewEC2(conf.AccessKeyID, conf.SecretAccessKey, conf.Region, conf.InstanceID, conf.UseInternalIP), sleep)
-		instanceHash = instance.Hash()
-		server.InstanceStore.Set(instanceHash, instance)
+	// duplicate ids and cycles stop go-sleep before any instance is created
+	if id := config.duplicateID(); len(id) > 0 {
+		log.Fatalf("Instance id %q is used more than once", id)
+	}
+	if cycle := findDependencyCycle(config.dependencyGraph()); cycle != nil {
+		log.Fatalf("Dependency cycle: %s", strings.Join(cycle, " -> "))
+	}
 
-		log.Printf("Found... %s", instance.String())
-		server.buildServerRoutes(conf.Routes, instanceHash, serverBasicAuthUsers)
+	for _, inst := range config.instances() {
+		server.addInstance(inst.newProvider(), inst.base, serverBasicAuthUsers)
 	}
 
-	for _, conf := range config.GCE {
-		log.Println("Initialization GCE instances ...")
-		sleep = sleepDuration(conf.SleepAfter)
-		instance = NewComputeInstance(provider.NewGCE(conf.JWTPath, conf.ProjectID, conf.Zone, conf.Name, conf.UseInternalIP), sleep)
-		instanceHash = instance.Hash()
-		server.InstanceStore.Set(instanceHash, instance)
+	// routes of no instance select it by the instance setting
+	for _, route := range config.Routes {
+		if len(route.Instance) == 0 {
+			log.Fatalf("Route %s requires instance", route)
+		}
+	}
+	server.buildServerRoutes(config.Routes, "", serverBasicAuthUsers)
+
+	server.linkDependencies()
+}
+
+func (server *Server) addInstance(p provider.Provider, conf BaseConfig, authUsers map[string]map[string]string) *ComputeInstance {
+	instance := newComputeInstance(p, sleepDuration(conf.SleepAfter), callOptions(conf))
+	instance.SetStartPolicy(startPolicy(conf))
+	instance.SetBootPolicy(bootPolicy(conf))
+	instance.SetPollIntervals(time.Duration(conf.PollInterval)*time.Second, time.Duration(conf.PollFast)*time.Second)
+	instance.ID = conf.ID
+	instance.dependsOn = conf.DependsOn
+	instance.SetActivitySources(activitySources(conf.Activity, p))
+	// pooled connections may point to the previous address
+	instance.OnIPChange(server.transport.CloseIdleConnections)
+	for _, hook := range server.webhooks {
+		instance.OnEvent(hook.Notify)
+	}
+	for _, dnsConf := range conf.DNS {
+		watchDNS(instance, newDNSUpdater(dnsConf), dnsConf.SleepTarget)
+	}
+	instanceHash := instance.Hash()
+	server.InstanceStore.Set(instanceHash, instance)
+
+	log.Printf("Found... %s", instance.String())
+	server.buildServerRoutes(conf.Routes, instanceHash, authUsers)
+
+	if len(conf.Routes) > 0 {
+		instance.healthPort = conf.Routes[0].BackendPort
+		instance.healthHTTP = conf.Routes[0].Protocol != protocolTCP
+	}
+
+	return instance
+}
+
+func newExecProvider(conf *ExecConfig) *provider.Exec {
+	statusMap := make([]*provider.ExecStatusMatch, 0, len(conf.StatusMap))
+	for _, m := range conf.StatusMap {
+		match, err := provider.NewExecStatusMatch(m.Match, m.Status)
+		if err != nil {
+			log.Fatalf("Exec %s: invalid status_map: %v", conf.Name, err)
+		}
+		statusMap = append(statusMap, match)
+	}
 
-		log.Printf("Found... %s", instance.String())
-		server.buildServerRoutes(conf.Routes, instanceHash, serverBasicAuthUsers)
+	commands := provider.ExecCommands{
+		Start:  conf.StartCommand,
+		Stop:   conf.StopCommand,
+		Status: conf.StatusCommand,
+		IP:     conf.IPCommand,
 	}
+
+	return provider.NewExec(conf.Name, conf.Shell, commands, time.Duration(conf.CommandTimeout)*time.Second, conf.Env, statusMap)
 }
 
 func (server *Server) buildServerRoutes(routes []*RouteConfig, instanceKey string, authUsers map[string]map[string]string) {
 	var err error
 
 	for _, route := range routes {
-		for _, name := range route.Hostnames {
-			// Set default address if not set
-			if len(route.Address) == 0 {
-				route.Address = defaultAddress
-			}
-			// Set default backend port if not set
-			if route.BackendPort == 0 {
-				route.BackendPort, err = strconv.Atoi(strings.Replace(route.Address, ":", "", -1))
-				if err != nil {
-					log.Fatal(err)
-				}
+		switch route.BackendProxy {
+		case "", proxyProtocolV1, proxyProtocolV2:
+		default:
+			log.Fatalf("Unknown backend_proxy_protocol %q of route %s, want v1 or v2", route.BackendProxy, route)
+		}
+
+		if route.Protocol == protocolTCP {
+			server.buildTCPRoute(route, instanceKey)
+			continue
+		} else if route.Protocol != "" && route.Protocol != protocolHTTP {
+			log.Fatalf("Unknown protocol %q of route %s", route.Protocol, route)
+		}
+
+		if len(route.Hostnames) == 0 && !route.Default {
+			continue
+		}
+
+		// Set default address if not set
+		if len(route.Address) == 0 {
+			route.Address = defaultAddress
+		}
+		// Set default backend port if not set
+		if route.BackendPort == 0 {
+			route.BackendPort, err = strconv.Atoi(strings.Replace(route.Address, ":", "", -1))
+			if err != nil {
+				log.Fatal(err)
 			}
+		}
+
+		if _, ok := server.serverRoutes[route.Address]; !ok {
+			server.serverRoutes[route.Address] = make(map[string]*serverRoute)
+		}
+		if route.ProxyProto {
+			server.proxyProtocol[route.Address] = true
+		}
 
-			if _, ok := server.serverRoutes[route.Address]; !ok {
-				server.serverRoutes[route.Address] = make(map[string]*serverRoute)
+		if route.Default {
+			if _, ok := server.defaultRoutes[route.Address]; ok {
+				log.Fatalf("Default route of %s is already set", route.Address)
 			}
+			server.defaultRoutes[route.Address] = server.newServerRoute(route, "", instanceKey, authUsers)
+		}
 
-			srvRoute := serverRoute{
-				Hostname:     name,
-				BackendPort:  route.BackendPort,
-				InstanceName: instanceKey,
-				IsProxy:      route.IsProxy,
+		for _, name := range route.Hostnames {
+			// hosts are matched lowercased, regexps as they are
+			if !strings.HasPrefix(name, "~") {
+				name = normalizeHost(name)
 			}
-			// Init and add cret
-			for _, cretOptions := range route.Certificates {
-				cert, err := tls.LoadX509KeyPair(cretOptions.CertFile, cretOptions.KeyFile)
-				if err != nil {
-					log.Fatal("Error load certificate: ", err)
-				}
-				srvRoute.Certificates = append(srvRoute.Certificates, cert)
+			srvRoute := server.newServerRoute(route, name, instanceKey, authUsers)
+
+			srvRoute.pattern, err = hostPattern(name)
+			if err != nil {
+				log.Fatalf("Error parsing hostname %q: %s", name, err)
 			}
 
-			if users, ok := authUsers[route.AuthGroup]; ok {
-				srvRoute.basicUsers = users
-				srvRoute.basicAuth = auth.NewBasicAuthenticator("go-sleep", srvRoute.secretBasic)
+			if srvRoute.pattern != nil {
+				server.addHostPattern(route.Address, srvRoute)
+			} else {
+				server.serverRoutes[route.Address][name] = srvRoute
 			}
+		}
+	}
+}
 
-			server.serverRoutes[route.Address][name] = &srvRoute
+func (server *Server) newServerRoute(route *RouteConfig, name, instanceKey string, authUsers map[string]map[string]string) *serverRoute {
+	srvRoute := serverRoute{
+		Hostname:     name,
+		BackendPort:  route.BackendPort,
+		InstanceName: instanceKey,
+		IsProxy:      route.IsProxy,
+		SleepWarning: time.Duration(route.SleepWarning) * time.Minute,
+		BackendProxy: route.BackendProxy,
+	}
+	// Top-level routes select the instance by id
+	if len(instanceKey) == 0 {
+		srvRoute.instanceTemplate = route.Instance
+	}
+	// Init and add cret
+	for _, cretOptions := range route.Certificates {
+		cert, err := tls.LoadX509KeyPair(cretOptions.CertFile, cretOptions.KeyFile)
+		if err != nil {
+			log.Fatal("Error load certificate: ", err)
 		}
+		srvRoute.Certificates = append(srvRoute.Certificates, cert)
+	}
+
+	if users, ok := authUsers[route.AuthGroup]; ok {
+		srvRoute.basicUsers = users
+		srvRoute.basicAuth = auth.NewBasicAuthenticator("go-sleep", srvRoute.secretBasic)
 	}
+
+	return &srvRoute
 }
 
 func (server *Server) listenSignals() {
@@ -189,7 +356,7 @@ func (server *Server) listenSignals() {
 	server.Stop()
 }
 
-func (server *Server) createTLSConfig(routes map[string]*serverRoute) *tls.Config {
+func (server *Server) createTLSConfig(routes []*serverRoute) *tls.Config {
 	crets := []tls.Certificate{}
 
 	for _, route := range routes {
@@ -210,29 +377,58 @@ func (server *Server) createTLSConfig(routes map[string]*serverRoute) *tls.Confi
 }
 
 func (server *Server) startServers() {
-	for addr, routes := range server.serverRoutes {
-		tlsConfig := server.createTLSConfig(routes)
-		handler := server.middlewareAuth(server.middlewareWakeup(server.defaultReverseProxy(addr), addr), addr)
+	for addr := range server.serverRoutes {
+		tlsConfig := server.createTLSConfig(server.addressRoutes(addr))
+		handler := server.middlewareAuth(server.middlewareKeepAwake(server.middlewareBanner(server.middlewareWakeup(server.defaultReverseProxy(addr), addr), addr), addr), addr)
 
 		srv := &http.Server{
 			Addr:      addr,
-			Handler:   handler,
+			Handler:   server.middlewareForwarded(handler),
 			TLSConfig: tlsConfig,
 		}
 
-		go server.startServer(srv)
+		listener, err := server.listen(addr)
+		if err != nil {
+			log.Fatal("Error creating server: ", err)
+		}
+
+		go server.startServer(srv, listener)
+	}
+
+	for addr, route := range server.tcpRoutes {
+		listener, err := server.listen(addr)
+		if err != nil {
+			log.Fatal("Error creating TCP server: ", err)
+		}
+
+		log.Printf("Starting TCP server on %s", addr)
+		go server.serveTCP(listener, route)
 	}
 }
 
-func (server *Server) startServer(srv *http.Server) {
+// listen listens on addr, with the PROXY protocol if a route of addr accepts it
+func (server *Server) listen(addr string) (net.Listener, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if server.proxyProtocol[addr] {
+		log.Printf("Accepting PROXY protocol on %s", addr)
+		return &proxyListener{Listener: listener, trusted: server.trustedProxies}, nil
+	}
+	return listener, nil
+}
+
+func (server *Server) startServer(srv *http.Server, listener net.Listener) {
 	if srv.TLSConfig != nil {
 		log.Printf("Starting server on %s with TLS", srv.Addr)
-		if err := srv.ListenAndServeTLS("", ""); err != nil {
+		if err := srv.ServeTLS(listener, "", ""); err != nil {
 			log.Fatal("Error creating server with TLS: ", err)
 		}
 	} else {
 		log.Printf("Starting server on %s", srv.Addr)
-		if err := srv.ListenAndServe(); err != nil {
+		if err := srv.Serve(listener); err != nil {
 			log.Fatal("Error creating server: ", err)
 		}
 	}
@@ -240,13 +436,19 @@ func (server *Server) startServer(srv *http.Server) {
 
 func (server *Server) defaultReverseProxy(address string) *httputil.ReverseProxy {
 	return &httputil.ReverseProxy{
+		Transport:      backendTransport{server},
+		ModifyResponse: server.modifyResponse(address),
 		Director: func(r *http.Request) {
 			route, computer, err := server.routeComputer(r.Host, address)
 			if err == nil {
 				r.Header.Set("Host", r.Host)
-				r.Header.Set("X-Go-Sleep-Key", server.secretKey)
+				r.Header.Set("X-Go-Sleep-Key", server.backendKey())
+				setForwarded(r, requestClient(r))
+				if len(route.BackendProxy) > 0 {
+					*r = *r.WithContext(context.WithValue(r.Context(), proxyHeaderKey{}, requestProxyHeader(r, route.BackendProxy)))
+				}
 				r.URL.Scheme = "http"
-				r.URL.Host = fmt.Sprintf("%s:%d", computer.IP, route.BackendPort)
+				r.URL.Host = net.JoinHostPort(computer.BackendIP(), strconv.Itoa(route.BackendPort))
 				r.RequestURI = ""
 			} else {
 				log.Warnf("%q is not routed", r.Host)
@@ -257,13 +459,7 @@ func (server *Server) defaultReverseProxy(address string) *httputil.ReverseProxy
 
 func (server *Server) middlewareAuth(next http.Handler, address string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		host, _, err := net.SplitHostPort(r.Host)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		route, ok := server.serverRoutes[address][host]
+		route, _, ok := server.matchRoute(address, normalizeHost(r.Host))
 		if ok && route.basicAuth != nil {
 			if username := route.basicAuth.CheckAuth(r); username == "" {
 				log.Printf("Basic auth failed...")
@@ -281,14 +477,39 @@ func (server *Server) middlewareWakeup(next http.Handler, address string) http.H
 		context := pageContext{}
 
 		route, computer, err := server.routeComputer(r.Host, address)
-		if err != nil {
+		if _, ok := err.(*notRoutedError); ok {
+			server.responseNotFound(w, r.Host)
+			return
+		} else if err != nil {
 			context.Error = err.Error()
 			responseHTML(w, http.StatusInternalServerError, "wait.html", context)
 			return
 		}
 
-		if computer.lastError != nil {
-			context.Error = computer.lastError.Error()
+		if retry, pending := computer.StartRetry(); pending {
+			context.Message = startRetryMessage(retry)
+			context.Error = retry.Err.Error()
+			context.NextAttempt = &retry.NextAttempt
+			responseHTML(w, http.StatusOK, "wait.html", context)
+			return
+		}
+
+		if computer.BootRestarting() {
+			context.Message = "The server did not boot in time, we are restarting it"
+			responseHTML(w, http.StatusOK, "wait.html", context)
+			return
+		}
+
+		if lastError := computer.LastError(); lastError != nil {
+			context.Error = lastError.Error()
+			if computer.BootFailed() {
+				context.Message = "The server failed to boot"
+			}
+			// a single attempt after the cool-down of the circuit breaker
+			if retry, _ := computer.StartRetry(); retry.Failures > 0 && computer.Status() == provider.StatusInstanceError {
+				computer.RequestStart(r.Host, requestUser(r))
+				context.Message = "We sent a request to start the instance again"
+			}
 			responseHTML(w, http.StatusOK, "wait.html", context)
 			return
 		}
@@ -301,7 +522,7 @@ func (server *Server) middlewareWakeup(next http.Handler, address string) http.H
 		switch computer.Status() {
 		case provider.StatusInstanceRunning:
 			if !computer.HTTPHealth {
-				url := fmt.Sprintf("http://%s:%d", computer.IP, route.BackendPort)
+				url := fmt.Sprintf("http://%s", net.JoinHostPort(computer.BackendIP(), strconv.Itoa(route.BackendPort)))
 
 				status, err := ping(url, 3*time.Second)
 				if err != nil || status > http.StatusInternalServerError {
@@ -316,8 +537,10 @@ func (server *Server) middlewareWakeup(next http.Handler, address string) http.H
 			next.ServeHTTP(w, r)
 			return
 		case provider.StatusInstanceNotRun:
-			if computer.ToggleOnRequest() {
-				computer.Start()
+			if computer.WaitingDependencies() {
+				context.Message = "Waiting for the dependencies to start"
+			} else if computer.ToggleOnRequest() {
+				computer.RequestStart(r.Host, requestUser(r))
 				context.Message = "We sent a request to start the instance"
 			} else {
 				context.Message = "The server is stopped. Start on request is disabled"
@@ -326,8 +549,7 @@ func (server *Server) middlewareWakeup(next http.Handler, address string) http.H
 			context.Message = "Waiting for the server to start"
 			context.StartRequest = &computer.startRequest
 		case provider.StatusInstanceError:
-			computer.Start()
-			context.Error = computer.lastError.Error()
+			context.Error = "The server reports an error"
 		case provider.StatusInstanceStopping:
 			context.Message = "The server is stopped, we will launch it later"
 		}
@@ -336,22 +558,40 @@ func (server *Server) middlewareWakeup(next http.Handler, address string) http.H
 	})
 }
 
+// startRetryMessage explains when the next start attempt happens
+func startRetryMessage(retry StartRetry) string {
+	switch {
+	case retry.Permanent:
+		return "The server failed to start with a permanent error. Starting is paused, check the configuration"
+	case retry.BreakerOpen:
+		return fmt.Sprintf("The server failed to start %d times in a row. Starting is paused, the first request after the pause will try again", retry.Failures)
+	default:
+		return fmt.Sprintf("The server failed to start (attempt %d). We will retry automatically", retry.Failures)
+	}
+}
+
 func (server *Server) routeComputer(rawHost, address string) (*serverRoute, *ComputeInstance, error) {
-	host, _, err := net.SplitHostPort(rawHost)
-	if err != nil {
-		return nil, nil, err
+	host := normalizeHost(rawHost)
+	route, key, ok := server.matchRoute(address, host)
+	if !ok {
+		return nil, nil, notRouted("Not found hostname: %s", host)
 	}
-	route, ok := server.serverRoutes[address][host]
+	computer, ok := server.InstanceStore.Get(key)
 	if !ok {
-		return nil, nil, fmt.Errorf("Not found hostname: %s", host)
+		computer, ok = server.InstanceStore.Find(key)
 	}
-	computer, ok := server.InstanceStore.Get(route.InstanceName)
 	if !ok {
-		return nil, nil, fmt.Errorf("Not found instance for hostname: %s", host)
+		return nil, nil, notRouted("Not found instance %s for hostname: %s", key, host)
 	}
 	return route, computer, nil
 }
 
+// requestUser returns the basic auth user of r
+func requestUser(r *http.Request) string {
+	user, _, _ := r.BasicAuth()
+	return user
+}
+
 func parserBasicUsers(users []string) (map[string]string, error) {
 	userMap := make(map[string]string)
 	for _, user := range users {
@@ -373,6 +613,30 @@ func sleepDuration(currentSleep int64) time.Duration {
 	return defaultSleepAfter
 }
 
+func ipSelector(conf IPSelectorConfig) provider.IPSelector {
+	return provider.IPSelector{
+		Interface: conf.NetworkInterface,
+		IPv6:      conf.IPv6,
+		DNSName:   conf.UseDNSName,
+	}
+}
+
+func callOptions(conf BaseConfig) provider.CallOptions {
+	opts := provider.DefaultCallOptions
+
+	if conf.CallTimeout > 0 {
+		opts.Timeout = time.Duration(conf.CallTimeout) * time.Second
+	}
+
+	if conf.CallRetries > 0 {
+		opts.Retries = conf.CallRetries
+	} else if conf.CallRetries < 0 {
+		opts.Retries = 0
+	}
+
+	return opts
+}
+
 func ping(url string, timeout time.Duration) (int, error) {
 	client := http.Client{Timeout: timeout}
 	r, err := client.Head(url)
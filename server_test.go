@@ -1,9 +1,15 @@
 package main
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/silentsokolov/go-sleep/provider"
 )
 
 func TestSleepDuration(t *testing.T) {
@@ -61,3 +67,68 @@ func TestServerRoute_SecretBasic(t *testing.T) {
 		}
 	}
 }
+
+func TestCallOptions(t *testing.T) {
+	var optionsTable = []struct {
+		in      BaseConfig
+		timeout time.Duration
+		retries int
+	}{
+		{BaseConfig{}, provider.DefaultCallOptions.Timeout, provider.DefaultCallOptions.Retries},
+		{BaseConfig{CallTimeout: 5, CallRetries: 7}, 5 * time.Second, 7},
+		{BaseConfig{CallRetries: -1}, provider.DefaultCallOptions.Timeout, 0},
+	}
+
+	for _, test := range optionsTable {
+		opts := callOptions(test.in)
+		if opts.Timeout != test.timeout || opts.Retries != test.retries {
+			t.Errorf("callOptions returned %+v, want timeout %v and retries %v", opts, test.timeout, test.retries)
+		}
+	}
+}
+
+// stateErrorProvider reports the error status, with a state error unless err is nil
+type stateErrorProvider struct {
+	dummyProvider
+	err error
+}
+
+func (p *stateErrorProvider) Status(ctx context.Context) (provider.StatusInstance, error) {
+	return provider.StatusInstanceError, p.err
+}
+
+func TestServer_middlewareWakeup_providerError(t *testing.T) {
+	var errorTable = []struct {
+		err  error
+		body string
+	}{
+		{&provider.StateError{Message: "RDS db is storage-full"}, "RDS db is storage-full"},
+		{nil, "[dummyProvider] ID: plain reports an error"},
+	}
+
+	for _, test := range errorTable {
+		server := NewServer(&Config{})
+
+		p := &stateErrorProvider{dummyProvider{DummyID: "plain"}, test.err}
+		instance := NewComputeInstance(p, time.Minute)
+		instance.poll()
+		server.InstanceStore.Set(instance.Hash(), instance)
+		server.serverRoutes[":80"] = map[string]*serverRoute{
+			"db.example.com": {Hostname: "db.example.com", BackendPort: 5432, InstanceName: instance.Hash()},
+		}
+
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+		r := httptest.NewRequest("GET", "http://db.example.com/", nil)
+		w := httptest.NewRecorder()
+		server.middlewareWakeup(next, ":80").ServeHTTP(w, r)
+
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), test.body) {
+			t.Errorf("GET db.example.com returned %d %s, want 200 with %s", w.Code, w.Body.String(), test.body)
+		}
+		if len(instance.statusChan) != 0 {
+			t.Errorf("GET db.example.com requested a start of the failed instance")
+		}
+
+		server.Close()
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"time"
+
+	"github.com/silentsokolov/go-sleep/log"
+	"github.com/silentsokolov/go-sleep/provider"
+)
+
+const (
+	defaultStartRetries  = 3
+	defaultStartBackoff  = 10 * time.Second
+	defaultStartCooldown = 10 * time.Minute
+	maxStartBackoff      = 5 * time.Minute
+)
+
+// StartPolicy limits start attempts of an instance after failures: transient
+// errors are retried with exponential backoff, when the retries are exhausted
+// or the error is permanent the circuit breaker stops attempts for Cooldown
+type StartPolicy struct {
+	Retries  int
+	Backoff  time.Duration
+	Cooldown time.Duration
+}
+
+// DefaultStartPolicy ...
+var DefaultStartPolicy = StartPolicy{
+	Retries:  defaultStartRetries,
+	Backoff:  defaultStartBackoff,
+	Cooldown: defaultStartCooldown,
+}
+
+// StartRetry describes failed start attempts of an instance
+type StartRetry struct {
+	Failures    int
+	NextAttempt time.Time
+	Err         error
+	Permanent   bool
+	BreakerOpen bool
+}
+
+func startPolicy(conf BaseConfig) StartPolicy {
+	policy := DefaultStartPolicy
+
+	if conf.StartRetries > 0 {
+		policy.Retries = conf.StartRetries
+	} else if conf.StartRetries < 0 {
+		policy.Retries = 0
+	}
+
+	if conf.StartBackoff > 0 {
+		policy.Backoff = time.Duration(conf.StartBackoff) * time.Second
+	}
+
+	if conf.StartCooldown > 0 {
+		policy.Cooldown = time.Duration(conf.StartCooldown) * time.Second
+	}
+
+	return policy
+}
+
+// SetStartPolicy ...
+func (instance *ComputeInstance) SetStartPolicy(policy StartPolicy) {
+	instance.Lock()
+	defer instance.Unlock()
+	instance.startPolicy = policy
+}
+
+// startAllowed reports whether a start attempt may be made now
+func (instance *ComputeInstance) startAllowed() bool {
+	instance.RLock()
+	defer instance.RUnlock()
+	return !time.Now().Before(instance.startRetry.NextAttempt)
+}
+
+// startFailed records a failed start attempt and schedules the next one
+func (instance *ComputeInstance) startFailed(err error) {
+	instance.Lock()
+	policy := instance.startPolicy
+	retry := &instance.startRetry
+
+	retry.Failures++
+	retry.Err = err
+	retry.Permanent = provider.IsPermanent(err)
+	retry.BreakerOpen = retry.Permanent || retry.Failures > policy.Retries
+
+	delay := policy.Cooldown
+	if !retry.BreakerOpen {
+		delay = policy.Backoff << uint(retry.Failures-1)
+		if delay > maxStartBackoff || delay <= 0 {
+			delay = maxStartBackoff
+		}
+	}
+	retry.NextAttempt = time.Now().Add(delay)
+	failures, breakerOpen := retry.Failures, retry.BreakerOpen
+	instance.Unlock()
+
+	if breakerOpen {
+		// after the cool-down the next request makes a single attempt
+		log.Printf("Starting %s failed %d times: %s, no attempts for %s", instance.Provider, failures, err, delay)
+		return
+	}
+
+	log.Printf("Starting %s failed: %s, next attempt in %s", instance.Provider, err, delay)
+	time.AfterFunc(delay, func() {
+		if instance.ctx.Err() == nil {
+			instance.Start()
+		}
+	})
+}
+
+// startSucceeded resets failed start attempts
+func (instance *ComputeInstance) startSucceeded() {
+	instance.Lock()
+	defer instance.Unlock()
+	instance.startRetry = StartRetry{}
+}
+
+// StartRetry returns failed start attempts, while the next attempt is pending
+func (instance *ComputeInstance) StartRetry() (StartRetry, bool) {
+	instance.RLock()
+	defer instance.RUnlock()
+
+	retry := instance.startRetry
+	return retry, retry.Failures > 0 && time.Now().Before(retry.NextAttempt)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+func TestStartPolicy(t *testing.T) {
+	var policyTable = []struct {
+		in  BaseConfig
+		out StartPolicy
+	}{
+		{BaseConfig{}, DefaultStartPolicy},
+		{BaseConfig{StartRetries: -1}, StartPolicy{Retries: 0, Backoff: defaultStartBackoff, Cooldown: defaultStartCooldown}},
+		{BaseConfig{StartRetries: 5, StartBackoff: 30, StartCooldown: 3600}, StartPolicy{Retries: 5, Backoff: 30 * time.Second, Cooldown: time.Hour}},
+	}
+
+	for _, test := range policyTable {
+		if policy := startPolicy(test.in); policy != test.out {
+			t.Errorf("startPolicy returned %+v, want %+v", policy, test.out)
+		}
+	}
+}
+
+func TestComputeInstance_startFailed(t *testing.T) {
+	instance := NewComputeInstance(newDummyProvider("test", false), time.Minute)
+	instance.SetStartPolicy(StartPolicy{Retries: 2, Backoff: time.Hour, Cooldown: 24 * time.Hour})
+	capacity := awserr.New("InsufficientInstanceCapacity", "capacity", nil)
+
+	var attemptTable = []struct {
+		delay       time.Duration
+		breakerOpen bool
+	}{
+		{time.Hour, false},
+		{2 * time.Hour, false},
+		{24 * time.Hour, true},
+	}
+
+	for i, test := range attemptTable {
+		instance.startFailed(capacity)
+
+		retry, pending := instance.StartRetry()
+		if !pending || retry.Failures != i+1 || retry.BreakerOpen != test.breakerOpen || retry.Permanent {
+			t.Errorf("ComputeInstance.StartRetry returned %+v, want %d failures, breaker open %v", retry, i+1, test.breakerOpen)
+		}
+
+		// the backoff is capped
+		delay := test.delay
+		if !test.breakerOpen && delay > maxStartBackoff {
+			delay = maxStartBackoff
+		}
+		if left := time.Until(retry.NextAttempt); left > delay || left < delay-time.Minute {
+			t.Errorf("ComputeInstance.startFailed delayed the next attempt for %v, want %v", left, delay)
+		}
+	}
+
+	if instance.startAllowed() {
+		t.Error("ComputeInstance.startAllowed returned true while the breaker is open")
+	}
+
+	instance.Start()
+	select {
+	case status := <-instance.statusChan:
+		t.Errorf("ComputeInstance.Start sent %v while the breaker is open", status)
+	default:
+	}
+
+	instance.startSucceeded()
+	if _, pending := instance.StartRetry(); pending || !instance.startAllowed() {
+		t.Error("ComputeInstance.startSucceeded did not reset failed attempts")
+	}
+}
+
+func TestComputeInstance_startFailed_permanent(t *testing.T) {
+	instance := NewComputeInstance(newDummyProvider("test", false), time.Minute)
+	instance.startFailed(awserr.New("InvalidInstanceID.NotFound", "not found", nil))
+
+	retry, _ := instance.StartRetry()
+	if !retry.Permanent || !retry.BreakerOpen {
+		t.Errorf("ComputeInstance.StartRetry returned %+v, want open breaker for permanent error", retry)
+	}
+
+	instance.startSucceeded()
+	instance.startFailed(errors.New("connection reset"))
+	if retry, _ := instance.StartRetry(); retry.Permanent || retry.BreakerOpen {
+		t.Errorf("ComputeInstance.StartRetry returned %+v, want retry of transient error", retry)
+	}
+}
+
+func TestStartRetryMessage(t *testing.T) {
+	var retryTable = []struct {
+		in  StartRetry
+		out string
+	}{
+		{StartRetry{Failures: 1}, "The server failed to start (attempt 1). We will retry automatically"},
+		{StartRetry{Failures: 4, BreakerOpen: true}, "The server failed to start 4 times in a row. Starting is paused, the first request after the pause will try again"},
+		{StartRetry{Failures: 1, BreakerOpen: true, Permanent: true}, "The server failed to start with a permanent error. Starting is paused, check the configuration"},
+	}
+
+	for _, test := range retryTable {
+		if s := startRetryMessage(test.in); s != test.out {
+			t.Errorf("startRetryMessage returned %q, want %q", s, test.out)
+		}
+	}
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/silentsokolov/go-sleep/log"
@@ -12,37 +16,86 @@ import (
 // ComputeInstance ...
 type ComputeInstance struct {
 	sync.RWMutex
-	currentStatus provider.StatusInstance
-	sleepAfter    time.Duration
-	Provider      provider.Provider
-	IP            string
-	statusChan    chan provider.StatusInstance
-	stopChan      chan bool
-	lastAccess    time.Time
-	lastError     error
-	HTTPHealth    bool
-	startRequest  time.Time
+	ID             string
+	dependsOn      []string
+	dependencies   []*ComputeInstance
+	dependents     []*ComputeInstance
+	healthPort     int
+	healthHTTP     bool
+	waitingDeps    int32
+	activeConns    int32
+	ipChanged      []func()
+	statusChanged  []func(provider.StatusInstance)
+	eventHandlers  []func(Event)
+	wakeRequest    time.Time
+	wakeHost       string
+	wakeUser       string
+	stopRequest    time.Time
+	leases         map[string]Lease
+	activity       []ActivitySource
+	startPolicy    StartPolicy
+	startRetry     StartRetry
+	bootPolicy     BootPolicy
+	bootFailures   int
+	bootRestarting bool
+	bootGaveUp     bool
+	history        []Event
+	pollSteady     time.Duration
+	pollFast       time.Duration
+	currentStatus  provider.StatusInstance
+	sleepAfter     time.Duration
+	Provider       provider.Provider
+	IP             string
+	ips            []string
+	nextIP         uint32
+	statusChan     chan provider.StatusInstance
+	notifyChan     chan provider.StatusInstance
+	stopChan       chan bool
+	lastAccess     time.Time
+	lastError      error
+	HTTPHealth     bool
+	startRequest   time.Time
+	callOptions    provider.CallOptions
+	ctx            context.Context
+	cancel         context.CancelFunc
 }
 
 // NewComputeInstance ...
 func NewComputeInstance(p provider.Provider, sleepAfter time.Duration) *ComputeInstance {
-	status, err := p.Status()
-	if err != nil {
-		log.Fatal(err)
-	}
+	return newComputeInstance(p, sleepAfter, provider.DefaultCallOptions)
+}
+
+// newComputeInstance calls the provider with opts from the first status check
+func newComputeInstance(p provider.Provider, sleepAfter time.Duration, opts provider.CallOptions) *ComputeInstance {
+	ctx, cancel := context.WithCancel(context.Background())
 
 	instance := &ComputeInstance{
-		currentStatus: status,
-		sleepAfter:    sleepAfter,
-		Provider:      p,
-		statusChan:    make(chan provider.StatusInstance, 5),
-		stopChan:      make(chan bool),
+		sleepAfter:  sleepAfter,
+		Provider:    p,
+		statusChan:  make(chan provider.StatusInstance, 5),
+		notifyChan:  make(chan provider.StatusInstance, 5),
+		stopChan:    make(chan bool),
+		callOptions: opts,
+		activity:    []ActivitySource{&connectionsSource{}},
+		startPolicy: DefaultStartPolicy,
+		ctx:         ctx,
+		cancel:      cancel,
 	}
 
+	status, err := instance.providerStatus()
+	if stateErr, ok := err.(*provider.StateError); ok {
+		instance.lastError = stateErr
+	} else if err != nil {
+		log.Fatal(err)
+	}
+	instance.currentStatus = status
+
 	if status == provider.StatusInstanceRunning {
-		if instance.IP, err = p.IP(); err != nil {
+		ips, err := instance.providerIPs()
+		if err != nil {
 			log.Fatal(err)
 		}
+		instance.SetIPs(ips)
 		instance.SetLastAccess()
 		instance.SetHTTPHealth()
 	}
@@ -60,10 +113,18 @@ func (instance *ComputeInstance) Hash() string {
 }
 
 func (instance *ComputeInstance) startMonitor(wg *sync.WaitGroup) {
+	if instance.ctx == nil {
+		instance.ctx, instance.cancel = context.WithCancel(context.Background())
+	}
+
 	wg.Add(1)
 
 	go func() {
 		defer wg.Done()
+
+		timer := time.NewTimer(instance.pollInterval())
+		defer timer.Stop()
+
 		for {
 			select {
 			case status := <-instance.statusChan:
@@ -72,53 +133,57 @@ func (instance *ComputeInstance) startMonitor(wg *sync.WaitGroup) {
 				if instance.Status() != status {
 					switch status {
 					case provider.StatusInstanceStarting:
+						// requests queued before a failed attempt wait for the next one
+						if !instance.startAllowed() {
+							break
+						}
+
 						log.Printf("Starting %s", instance)
-						if err := instance.Provider.Start(); err != nil {
+						if err := instance.providerStart(); err != nil {
 							instance.SetError(err)
+							instance.startFailed(err)
 							instance.SetStatus(provider.StatusInstanceError)
 						} else {
+							instance.startSucceeded()
+							// the address is resolved again when the instance is running
+							instance.SetIPs(nil)
+							instance.Lock()
 							instance.startRequest = time.Now()
+							instance.Unlock()
 							instance.SetStatus(provider.StatusInstanceStarting)
+							pollNow(timer)
 						}
 					case provider.StatusInstanceStopping:
 						log.Printf("Stopping %s", instance)
-						if err := instance.Provider.Stop(); err != nil {
+						if err := instance.providerStop(); err != nil {
 							log.Printf("Stopping %s raise error: %s", instance, err)
+							instance.bootRestartFailed(err)
 						} else {
+							instance.Lock()
+							instance.stopRequest = time.Now()
+							idle := since(instance.lastAccess)
+							instance.Unlock()
+
 							instance.SetStatus(provider.StatusInstanceStopping)
+							if !instance.BootRestarting() {
+								instance.emit(EventSleeping, idle)
+							}
+							pollNow(timer)
 						}
 					}
 				}
-			case <-time.After(1 * time.Minute):
-				log.Printf("Check status for %s", instance.Provider)
-				providerStatus, err := instance.Provider.Status()
-
-				if err != nil {
-					log.Printf("Get status %s raise error: %s", instance, err)
-					break
+			case status := <-instance.notifyChan:
+				log.Printf("Notified status %s for %s", status, instance.Provider)
+				if cached, ok := instance.Provider.(provider.Cached); ok {
+					cached.Invalidate()
 				}
-
-				if providerStatus != instance.currentStatus {
-					switch providerStatus {
-					case provider.StatusInstanceRunning:
-						if instance.IP, err = instance.Provider.IP(); err != nil {
-							instance.SetError(err)
-							instance.SetStatus(provider.StatusInstanceError)
-							break
-						} else {
-							instance.SetLastAccess()
-						}
-					case provider.StatusInstanceNotRun:
-						instance.Reset()
-					}
-
-					instance.SetStatus(providerStatus)
-				} else if !instance.lastAccess.IsZero() && providerStatus == provider.StatusInstanceRunning {
-					duration := time.Since(instance.lastAccess)
-					if instance.ToggleOnRequest() && duration.Seconds() >= instance.sleepAfter.Seconds() {
-						instance.Stop()
-					}
+				if status != instance.Status() {
+					instance.observe(status)
 				}
+				pollIn(timer, instance.pollInterval())
+			case <-timer.C:
+				instance.poll()
+				timer.Reset(instance.pollInterval())
 			case <-instance.stopChan:
 				log.Printf("Stop monitor %s", instance.Provider)
 				return
@@ -127,12 +192,184 @@ func (instance *ComputeInstance) startMonitor(wg *sync.WaitGroup) {
 	}()
 }
 
+// poll checks the status of the instance at the provider
+func (instance *ComputeInstance) poll() {
+	log.Printf("Check status for %s", instance.Provider)
+	providerStatus, err := instance.providerStatus()
+
+	if stateErr, ok := err.(*provider.StateError); ok {
+		instance.SetError(stateErr)
+	} else if err != nil {
+		log.Printf("Get status %s raise error: %s", instance, err)
+		return
+	}
+
+	instance.observe(providerStatus)
+}
+
+// observe moves the instance to the status reported by the provider
+func (instance *ComputeInstance) observe(providerStatus provider.StatusInstance) {
+	// the error state of the provider ends with another status
+	if _, ok := instance.LastError().(*provider.StateError); ok && providerStatus != provider.StatusInstanceError {
+		instance.SetError(nil)
+	} else if providerStatus == provider.StatusInstanceError && instance.LastError() == nil {
+		instance.SetError(fmt.Errorf("%s reports an error", instance.Provider))
+	}
+
+	// the status is also set by the goroutine starting dependencies
+	instance.RLock()
+	currentStatus, startRequest, lastAccess := instance.currentStatus, instance.startRequest, instance.lastAccess
+	instance.RUnlock()
+
+	if providerStatus != currentStatus {
+		switch providerStatus {
+		case provider.StatusInstanceRunning:
+			ips, err := instance.providerIPs()
+			if err != nil {
+				instance.SetError(err)
+				instance.SetStatus(provider.StatusInstanceError)
+				break
+			}
+			instance.SetIPs(ips)
+			instance.SetLastAccess()
+
+			if startRequest.IsZero() && instance.autoStarted() {
+				log.Printf("%s was started by the provider itself, stopping", instance)
+				instance.Stop()
+			}
+		case provider.StatusInstanceNotRun:
+			instance.Reset()
+		}
+
+		instance.SetStatus(providerStatus)
+
+		if providerStatus == provider.StatusInstanceNotRun && instance.finishBootRestart() {
+			instance.Start()
+		}
+	} else if !lastAccess.IsZero() && providerStatus == provider.StatusInstanceRunning {
+		// addresses may drift, e.g. members of a group are replaced
+		// or an instance without static IP is restarted outside
+		if ips, err := instance.providerIPs(); err == nil {
+			instance.SetIPs(ips)
+		} else {
+			log.Printf("Get IP %s raise error: %s", instance, err)
+		}
+
+		// activity besides proxied requests extends the idle timer
+		if instance.busy() {
+			instance.SetLastAccess()
+		}
+
+		// the group is stopped from dependents to dependencies,
+		// only when all members are idle, live leases keep an instance awake
+		if instance.ToggleOnRequest() && instance.idle() && !instance.HasLeases() && instance.dependenciesIdle() && !instance.dependentAwake() {
+			instance.Stop()
+		}
+	}
+
+	instance.checkBoot()
+}
+
 func (instance *ComputeInstance) stopMonitor() {
+	if instance.cancel != nil {
+		instance.cancel()
+	}
+
+	if closer, ok := instance.Provider.(io.Closer); ok {
+		closer.Close()
+	}
+
 	go func() {
 		instance.stopChan <- true
 	}()
 }
 
+func (instance *ComputeInstance) providerStatus() (provider.StatusInstance, error) {
+	status := provider.StatusInstanceNotAvailable
+	err := provider.Call(instance.ctx, instance.calls(), func(ctx context.Context) error {
+		var err error
+		status, err = instance.Provider.Status(ctx)
+		return err
+	})
+	return status, err
+}
+
+func (instance *ComputeInstance) providerIP() (string, error) {
+	var ip string
+	err := provider.Call(instance.ctx, instance.calls(), func(ctx context.Context) error {
+		var err error
+		ip, err = instance.Provider.IP(ctx)
+		return err
+	})
+	return ip, err
+}
+
+// providerIPs returns all backend addresses of the instance
+func (instance *ComputeInstance) providerIPs() ([]string, error) {
+	group, ok := instance.Provider.(provider.MultiIPProvider)
+	if !ok {
+		ip, err := instance.providerIP()
+		if err != nil {
+			return nil, err
+		}
+		return []string{ip}, nil
+	}
+
+	var ips []string
+	err := provider.Call(instance.ctx, instance.calls(), func(ctx context.Context) error {
+		var err error
+		ips, err = group.IPs(ctx)
+		return err
+	})
+	if err == nil && len(ips) == 0 {
+		err = fmt.Errorf("No backend addresses of %s", instance.Provider)
+	}
+	return ips, err
+}
+
+// autoStarted reports whether the provider started the instance by itself,
+// e.g. RDS starts databases stopped for more than 7 days
+func (instance *ComputeInstance) autoStarted() bool {
+	starter, ok := instance.Provider.(provider.AutoStarter)
+	if !ok {
+		return false
+	}
+
+	var started bool
+	err := provider.Call(instance.ctx, instance.calls(), func(ctx context.Context) error {
+		var err error
+		started, err = starter.AutoStarted(ctx)
+		return err
+	})
+	if err != nil {
+		log.Printf("Check auto start of %s raise error: %s", instance, err)
+		return false
+	}
+	return started
+}
+
+func (instance *ComputeInstance) providerStart() error {
+	return provider.Call(instance.ctx, instance.calls(), instance.Provider.Start)
+}
+
+func (instance *ComputeInstance) providerStop() error {
+	return provider.Call(instance.ctx, instance.calls(), instance.Provider.Stop)
+}
+
+// SetCallOptions ...
+func (instance *ComputeInstance) SetCallOptions(opts provider.CallOptions) {
+	instance.Lock()
+	defer instance.Unlock()
+	instance.callOptions = opts
+}
+
+// calls returns the options of provider calls
+func (instance *ComputeInstance) calls() provider.CallOptions {
+	instance.RLock()
+	defer instance.RUnlock()
+	return instance.callOptions
+}
+
 // Status ...
 func (instance *ComputeInstance) Status() provider.StatusInstance {
 	instance.RLock()
@@ -143,15 +380,125 @@ func (instance *ComputeInstance) Status() provider.StatusInstance {
 // SetStatus ...
 func (instance *ComputeInstance) SetStatus(s provider.StatusInstance) {
 	instance.Lock()
-	defer instance.Unlock()
+	changed := instance.currentStatus != s
 	instance.currentStatus = s
+	callbacks := instance.statusChanged
+	instance.Unlock()
+
+	if changed {
+		for _, fn := range callbacks {
+			fn(s)
+		}
+		instance.emitStatus(s)
+	}
 }
 
-// SetHTTPHealth ...
-func (instance *ComputeInstance) SetHTTPHealth() {
+// OnStatusChange registers fn to call when the status changes
+func (instance *ComputeInstance) OnStatusChange(fn func(provider.StatusInstance)) {
 	instance.Lock()
 	defer instance.Unlock()
+	instance.statusChanged = append(instance.statusChanged, fn)
+}
+
+// Address returns the primary backend address
+func (instance *ComputeInstance) Address() string {
+	instance.RLock()
+	defer instance.RUnlock()
+	return instance.IP
+}
+
+// SetHTTPHealth marks the instance as booted, a slow boot after giving up
+// clears the boot error
+func (instance *ComputeInstance) SetHTTPHealth() {
+	instance.Lock()
+	passed := !instance.HTTPHealth
 	instance.HTTPHealth = true
+	if instance.bootGaveUp {
+		instance.lastError = nil
+	}
+	instance.bootFailures = 0
+	instance.bootGaveUp = false
+	wakeRequest := instance.wakeRequest
+	instance.Unlock()
+
+	if passed {
+		instance.emit(EventHealthPassed, since(wakeRequest))
+	}
+}
+
+// SetIPs sets backend addresses of the instance, when they drift
+// from the previous ones the OnIPChange functions are called
+func (instance *ComputeInstance) SetIPs(ips []string) {
+	instance.Lock()
+	old := instance.ips
+	instance.ips = ips
+	instance.IP = ""
+	if len(ips) > 0 {
+		instance.IP = ips[0]
+	}
+
+	drift := len(old) > 0 && len(ips) > 0 && !sameIPs(old, ips)
+	if drift {
+		instance.HTTPHealth = false
+	}
+	callbacks := instance.ipChanged
+	instance.Unlock()
+
+	if drift {
+		log.Printf("Address of %s changed from %v to %v", instance.Provider, old, ips)
+		for _, fn := range callbacks {
+			fn()
+		}
+	}
+}
+
+// OnIPChange registers fn to call when backend addresses change
+func (instance *ComputeInstance) OnIPChange(fn func()) {
+	instance.Lock()
+	defer instance.Unlock()
+	instance.ipChanged = append(instance.ipChanged, fn)
+}
+
+func sameIPs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	a = append([]string{}, a...)
+	b = append([]string{}, b...)
+	sort.Strings(a)
+	sort.Strings(b)
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// BackendIP returns the address for the next request,
+// requests are spread over all addresses of the instance
+func (instance *ComputeInstance) BackendIP() string {
+	instance.RLock()
+	defer instance.RUnlock()
+
+	if len(instance.ips) == 0 {
+		return instance.IP
+	}
+
+	n := atomic.AddUint32(&instance.nextIP, 1)
+	return instance.ips[int(n-1)%len(instance.ips)]
+}
+
+// AddConnection changes the number of open TCP connections by delta
+func (instance *ComputeInstance) AddConnection(delta int32) {
+	atomic.AddInt32(&instance.activeConns, delta)
+}
+
+// ActiveConnections ...
+func (instance *ComputeInstance) ActiveConnections() int32 {
+	return atomic.LoadInt32(&instance.activeConns)
 }
 
 // SetLastAccess ...
@@ -168,18 +515,28 @@ func (instance *ComputeInstance) SetError(err error) {
 	instance.lastError = err
 }
 
+// LastError returns the error of the last start, boot or status of the provider
+func (instance *ComputeInstance) LastError() error {
+	instance.RLock()
+	defer instance.RUnlock()
+	return instance.lastError
+}
+
 // Reset ...
 func (instance *ComputeInstance) Reset() {
 	instance.Lock()
 	defer instance.Unlock()
 	instance.IP = ""
+	instance.ips = nil
 	instance.lastAccess = time.Time{}
 	instance.lastError = nil
 	instance.startRequest = time.Time{}
+	instance.wakeRequest = time.Time{}
+	instance.wakeHost = ""
+	instance.wakeUser = ""
 	instance.HTTPHealth = false
 }
 
-//
 func (instance *ComputeInstance) ToggleOnRequest() bool {
 	if instance.sleepAfter.Seconds() >= 0 {
 		return true
@@ -187,9 +544,38 @@ func (instance *ComputeInstance) ToggleOnRequest() bool {
 	return false
 }
 
-// Start ...
+// Start starts dependencies of the instance, waits until they are healthy
+// and then starts the instance itself, nothing is done until the next attempt
+// after a failed one
 func (instance *ComputeInstance) Start() {
-	instance.statusChan <- provider.StatusInstanceStarting
+	if !instance.startAllowed() {
+		return
+	}
+
+	instance.RLock()
+	hasDependencies := len(instance.dependencies) > 0
+	instance.RUnlock()
+
+	if !hasDependencies {
+		instance.statusChan <- provider.StatusInstanceStarting
+		return
+	}
+
+	if !atomic.CompareAndSwapInt32(&instance.waitingDeps, 0, 1) {
+		return
+	}
+
+	go func() {
+		defer atomic.StoreInt32(&instance.waitingDeps, 0)
+
+		if err := instance.startDependencies(dependencyTimeout); err != nil {
+			instance.SetError(err)
+			instance.SetStatus(provider.StatusInstanceError)
+			return
+		}
+
+		instance.statusChan <- provider.StatusInstanceStarting
+	}()
 }
 
 // Stop ...
@@ -234,6 +620,19 @@ func (store *InstanceStore) Get(k string) (*ComputeInstance, bool) {
 	return nil, false
 }
 
+// Find returns the instance with the given id or hash
+func (store *InstanceStore) Find(id string) (*ComputeInstance, bool) {
+	store.RLock()
+	defer store.RUnlock()
+
+	for key, instance := range store.values {
+		if key == id || (instance.ID != "" && instance.ID == id) {
+			return instance, true
+		}
+	}
+	return nil, false
+}
+
 // Close ...
 func (store *InstanceStore) Close() {
 	for _, i := range store.values {
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"reflect"
@@ -29,19 +30,19 @@ func (p *dummyProvider) Hash() string {
 	return fmt.Sprintf("dummy-%s", p.DummyID)
 }
 
-func (p *dummyProvider) Status() (provider.StatusInstance, error) {
+func (p *dummyProvider) Status(ctx context.Context) (provider.StatusInstance, error) {
 	return provider.StatusInstanceRunning, nil
 }
 
-func (p *dummyProvider) IP() (string, error) {
+func (p *dummyProvider) IP(ctx context.Context) (string, error) {
 	return "www.example.org", nil
 }
 
-func (p *dummyProvider) Start() error {
+func (p *dummyProvider) Start(ctx context.Context) error {
 	return nil
 }
 
-func (p *dummyProvider) Stop() error {
+func (p *dummyProvider) Stop(ctx context.Context) error {
 	return nil
 }
 
@@ -99,7 +100,7 @@ func TestComputeInstance_Status(t *testing.T) {
 	p := newDummyProvider("test", false)
 	ci := NewComputeInstance(p, time.Duration(100)*time.Second)
 
-	providerStatus, _ := p.Status()
+	providerStatus, _ := p.Status(context.Background())
 	if ci.Status() != providerStatus {
 		t.Errorf("ComputeInstance.Status returned %+v, want %+v", ci.Status(), providerStatus)
 	}
@@ -108,7 +109,7 @@ func TestComputeInstance_Status(t *testing.T) {
 func TestComputeInstance_SetStatus(t *testing.T) {
 	p := newDummyProvider("test", false)
 	ci := NewComputeInstance(p, time.Duration(100)*time.Second)
-	providerStatus, _ := p.Status()
+	providerStatus, _ := p.Status(context.Background())
 
 	if ci.currentStatus != providerStatus {
 		t.Error("ComputeInstance.SetStatus init status not correct")
@@ -185,3 +186,95 @@ func TestComputeInstance_ToggleOnRequest(t *testing.T) {
 		}
 	}
 }
+
+type dummyGroupProvider struct {
+	dummyProvider
+}
+
+func (p *dummyGroupProvider) IPs(ctx context.Context) ([]string, error) {
+	return []string{"10.0.0.1", "10.0.0.2"}, nil
+}
+
+func TestComputeInstance_BackendIP(t *testing.T) {
+	p := &dummyGroupProvider{dummyProvider{DummyID: "group"}}
+	ci := NewComputeInstance(p, time.Duration(100)*time.Second)
+
+	if ci.IP != "10.0.0.1" {
+		t.Errorf("ComputeInstance.IP returned %+v, want %+v", ci.IP, "10.0.0.1")
+	}
+
+	var ips []string
+	for i := 0; i < 3; i++ {
+		ips = append(ips, ci.BackendIP())
+	}
+
+	want := []string{"10.0.0.1", "10.0.0.2", "10.0.0.1"}
+	if !reflect.DeepEqual(ips, want) {
+		t.Errorf("ComputeInstance.BackendIP returned %+v, want %+v", ips, want)
+	}
+}
+
+func TestInstanceStore_Find(t *testing.T) {
+	store := NewInstanceStore()
+	instance := NewComputeInstance(newDummyProvider("db", false), time.Duration(100)*time.Second)
+	instance.ID = "db"
+	store.values[instance.Hash()] = instance
+
+	for _, id := range []string{"db", "dummy-db"} {
+		if inst, ok := store.Find(id); !ok || inst != instance {
+			t.Errorf("InstanceStore.Find(%q) returned %+v, want %+v", id, inst, instance)
+		}
+	}
+
+	if _, ok := store.Find("cache"); ok {
+		t.Error("InstanceStore.Find found unknown instance")
+	}
+}
+
+func TestComputeInstance_SetIPs(t *testing.T) {
+	p := newDummyProvider("test", false)
+	ci := NewComputeInstance(p, time.Duration(100)*time.Second)
+
+	changed := 0
+	ci.OnIPChange(func() { changed++ })
+
+	ci.SetIPs([]string{"www.example.org"})
+	if changed != 0 {
+		t.Errorf("ComputeInstance.SetIPs called OnIPChange %d times for same address, want 0", changed)
+	}
+
+	ci.SetIPs([]string{"10.0.0.2"})
+	if changed != 1 || ci.IP != "10.0.0.2" || ci.HTTPHealth {
+		t.Errorf("ComputeInstance.SetIPs on drift: changed %d, IP %q, HTTPHealth %v", changed, ci.IP, ci.HTTPHealth)
+	}
+
+	ci.SetIPs(nil)
+	if changed != 1 || ci.IP != "" {
+		t.Errorf("ComputeInstance.SetIPs(nil): changed %d, IP %q", changed, ci.IP)
+	}
+}
+
+// deadlineProvider records the deadline of the first status call
+type deadlineProvider struct {
+	dummyProvider
+	deadline time.Time
+}
+
+func (p *deadlineProvider) Status(ctx context.Context) (provider.StatusInstance, error) {
+	if p.deadline.IsZero() {
+		p.deadline, _ = ctx.Deadline()
+	}
+	return provider.StatusInstanceNotRun, nil
+}
+
+func TestNewComputeInstance_callOptions(t *testing.T) {
+	p := &deadlineProvider{dummyProvider: dummyProvider{DummyID: "deadline"}}
+	opts := provider.CallOptions{Timeout: 5 * time.Second}
+
+	start := time.Now()
+	newComputeInstance(p, time.Minute, opts)
+
+	if p.deadline.IsZero() || p.deadline.Sub(start) > opts.Timeout+time.Second {
+		t.Errorf("first status call has deadline %v, want within %v", p.deadline.Sub(start), opts.Timeout)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/silentsokolov/go-sleep/log"
+	"github.com/silentsokolov/go-sleep/provider"
+)
+
+// tcpDialTimeout is the timeout of connecting to a backend
+const tcpDialTimeout = 10 * time.Second
+
+func (server *Server) buildTCPRoute(route *RouteConfig, instanceKey string) {
+	if len(route.Address) == 0 {
+		log.Fatalf("TCP route of %s requires address", instanceKey)
+	}
+
+	if _, ok := server.tcpRoutes[route.Address]; ok {
+		log.Fatalf("TCP address %s is already used", route.Address)
+	}
+
+	backendPort := route.BackendPort
+	if backendPort == 0 {
+		_, port, err := net.SplitHostPort(route.Address)
+		if err != nil {
+			log.Fatal(err)
+		}
+		backendPort, err = strconv.Atoi(port)
+		if err != nil {
+			log.Fatal(err)
+		}
+		route.BackendPort = backendPort
+	}
+
+	tcpWait := defaultTCPWait
+	if route.TCPWait > 0 {
+		tcpWait = time.Duration(route.TCPWait) * time.Second
+	}
+
+	server.tcpRoutes[route.Address] = &serverRoute{
+		BackendPort:  backendPort,
+		InstanceName: instanceKey,
+		IsProxy:      route.IsProxy,
+		TCPWait:      tcpWait,
+		BackendProxy: route.BackendProxy,
+	}
+	if route.ProxyProto {
+		server.proxyProtocol[route.Address] = true
+	}
+}
+
+func (server *Server) serveTCP(listener net.Listener, route *serverRoute) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Printf("TCP server on %s stopped: %s", listener.Addr(), err)
+			return
+		}
+
+		go server.proxyTCP(conn, route)
+	}
+}
+
+// closeWriter is a connection which can be half-closed
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// proxyTCP wakes the instance of route if needed and pipes conn to it
+func (server *Server) proxyTCP(conn net.Conn, route *serverRoute) {
+	defer conn.Close()
+
+	computer, ok := server.InstanceStore.Get(route.InstanceName)
+	if !ok {
+		log.Warnf("Not found instance for TCP connection from %s", conn.RemoteAddr())
+		return
+	}
+
+	if !route.IsProxy {
+		if err := waitRunning(computer, route.TCPWait, conn.RemoteAddr().String()); err != nil {
+			log.Printf("TCP connection from %s dropped: %s", conn.RemoteAddr(), err)
+			return
+		}
+	}
+
+	backend, err := net.DialTimeout("tcp", net.JoinHostPort(computer.BackendIP(), strconv.Itoa(route.BackendPort)), tcpDialTimeout)
+	if err != nil {
+		log.Printf("TCP connection to %s raise error: %s", computer, err)
+		return
+	}
+	defer backend.Close()
+
+	if len(route.BackendProxy) > 0 {
+		if err := writeProxyHeader(backend, route.BackendProxy, conn.RemoteAddr(), conn.LocalAddr()); err != nil {
+			log.Printf("TCP connection to %s raise error: %s", computer, err)
+			return
+		}
+	}
+
+	computer.AddConnection(1)
+	computer.SetLastAccess()
+	defer func() {
+		computer.AddConnection(-1)
+		computer.SetLastAccess()
+	}()
+
+	done := make(chan struct{}, 2)
+	pipe := func(dst, src net.Conn) {
+		io.Copy(dst, src)
+		if conn, ok := dst.(closeWriter); ok {
+			conn.CloseWrite()
+		}
+		done <- struct{}{}
+	}
+
+	go pipe(backend, conn)
+	go pipe(conn, backend)
+
+	// wait for both directions, a half-closed connection may still send data
+	<-done
+	<-done
+}
+
+// waitRunning starts the instance on behalf of client if needed
+// and waits until it is running
+func waitRunning(computer *ComputeInstance, timeout time.Duration, client string) error {
+	deadline := time.Now().Add(timeout)
+	started := false
+
+	for {
+		switch computer.Status() {
+		case provider.StatusInstanceRunning:
+			return nil
+		case provider.StatusInstanceNotRun, provider.StatusInstanceError:
+			if !computer.ToggleOnRequest() {
+				return fmt.Errorf("%s is stopped, start on request is disabled", computer.Provider)
+			}
+			if !started {
+				computer.RequestStart(client, "")
+				started = true
+			}
+		}
+
+		if retry, pending := computer.StartRetry(); pending && retry.BreakerOpen {
+			return fmt.Errorf("%s failed to start: %s", computer.Provider, retry.Err)
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s is not running after %s", computer.Provider, timeout)
+		}
+
+		time.Sleep(time.Second)
+	}
+}
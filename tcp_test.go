@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/silentsokolov/go-sleep/provider"
+)
+
+func TestServer_proxyTCP(t *testing.T) {
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+
+	go func() {
+		conn, err := backend.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		fmt.Fprintf(conn, "echo: %s", line)
+	}()
+
+	server := NewServer(&Config{})
+	defer server.Close()
+	instance := NewComputeInstance(newDummyProvider("db", false), time.Duration(100)*time.Second)
+	instance.SetIPs([]string{"127.0.0.1"})
+	server.InstanceStore.Set(instance.Hash(), instance)
+
+	server.buildTCPRoute(&RouteConfig{Address: backend.Addr().String(), Protocol: protocolTCP}, instance.Hash())
+	route := server.tcpRoutes[backend.Addr().String()]
+
+	client, conn := net.Pipe()
+	go server.proxyTCP(conn, route)
+
+	fmt.Fprint(client, "ping\n")
+	line, err := bufio.NewReader(client).ReadString('\n')
+	if err != nil || line != "echo: ping\n" {
+		t.Errorf("proxyTCP returned %q (%v), want %q", line, err, "echo: ping\n")
+	}
+	client.Close()
+}
+
+func TestWaitRunning(t *testing.T) {
+	instance := NewComputeInstance(newDummyProvider("db", false), time.Duration(-1)*time.Second)
+	instance.SetStatus(provider.StatusInstanceNotRun)
+
+	if err := waitRunning(instance, time.Second, "127.0.0.1:5000"); err == nil {
+		t.Error("waitRunning returned no error for instance without start on request")
+	}
+
+	instance.SetStatus(provider.StatusInstanceRunning)
+	if err := waitRunning(instance, time.Second, "127.0.0.1:5000"); err != nil {
+		t.Errorf("waitRunning returned unexpected error: %v", err)
+	}
+}
+
+func TestServer_proxyTCP_halfCloseProxyProtocol(t *testing.T) {
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+
+	// the backend answers and closes while the client keeps writing open
+	go func() {
+		conn, err := backend.Accept()
+		if err != nil {
+			return
+		}
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		fmt.Fprintf(conn, "echo: %s", line)
+		conn.Close()
+	}()
+
+	server := NewServer(&Config{})
+	defer server.Close()
+	instance := NewComputeInstance(newDummyProvider("db", false), time.Duration(100)*time.Second)
+	instance.SetIPs([]string{"127.0.0.1"})
+	server.InstanceStore.Set(instance.Hash(), instance)
+
+	server.buildTCPRoute(&RouteConfig{Address: backend.Addr().String(), Protocol: protocolTCP}, instance.Hash())
+	route := server.tcpRoutes[backend.Addr().String()]
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxied := &proxyListener{Listener: listener}
+	defer proxied.Close()
+
+	go func() {
+		conn, err := proxied.Accept()
+		if err == nil {
+			server.proxyTCP(conn, route)
+		}
+	}()
+
+	client, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	src := &net.TCPAddr{IP: net.ParseIP("198.51.100.1"), Port: 5000}
+	writeProxyHeader(client, proxyProtocolV1, src, listener.Addr())
+	fmt.Fprint(client, "ping\n")
+
+	client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	data, err := ioutil.ReadAll(client)
+	if err != nil || string(data) != "echo: ping\n" {
+		t.Errorf("proxyTCP returned %q (%v), want %q and EOF", data, err, "echo: ping\n")
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultVaultAppRole = "approle"
+	vaultTimeout        = 10 * time.Second
+)
+
+// vaultClient reads secrets of HashiCorp Vault with a token or an AppRole login
+type vaultClient struct {
+	address   string
+	namespace string
+	token     string
+	roleID    string
+	secretID  string
+	authPath  string
+	client    *http.Client
+}
+
+// newVaultClient returns a client of config, unset settings are taken from
+// VAULT_ADDR, VAULT_TOKEN, VAULT_ROLE_ID, VAULT_SECRET_ID, VAULT_NAMESPACE
+// and VAULT_CACERT; it returns nil without an address
+func newVaultClient(config *VaultConfig) (*vaultClient, error) {
+	setting := func(value, env string) string {
+		if len(value) > 0 {
+			return value
+		}
+		return os.Getenv(env)
+	}
+
+	client := &vaultClient{
+		address:   strings.TrimRight(setting(config.Address, "VAULT_ADDR"), "/"),
+		namespace: setting(config.Namespace, "VAULT_NAMESPACE"),
+		token:     setting(config.Token, "VAULT_TOKEN"),
+		roleID:    setting(config.RoleID, "VAULT_ROLE_ID"),
+		secretID:  setting(config.SecretID, "VAULT_SECRET_ID"),
+		authPath:  strings.Trim(config.AppRolePath, "/"),
+		client:    &http.Client{Timeout: vaultTimeout},
+	}
+
+	if len(client.address) == 0 {
+		return nil, nil
+	}
+	if len(client.authPath) == 0 {
+		client.authPath = defaultVaultAppRole
+	}
+	// an explicit AppRole takes precedence over VAULT_TOKEN of the environment
+	if len(config.RoleID) > 0 && len(config.Token) == 0 {
+		client.token = ""
+	}
+	if len(client.token) == 0 && len(client.roleID) == 0 {
+		return nil, errors.New("Vault needs token or role_id, or VAULT_TOKEN or VAULT_ROLE_ID")
+	}
+
+	if caCert := setting(config.CACert, "VAULT_CACERT"); len(caCert) > 0 {
+		pem, err := ioutil.ReadFile(caCert)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no certificates found", caCert)
+		}
+		client.client.Transport = &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+		}
+	}
+
+	return client, nil
+}
+
+// vaultResponse is a response of the Vault HTTP API
+type vaultResponse struct {
+	Data map[string]interface{} `json:"data"`
+	Auth struct {
+		ClientToken string `json:"client_token"`
+	} `json:"auth"`
+	Errors []string `json:"errors"`
+}
+
+func (client *vaultClient) do(method, path string, body interface{}) (*vaultResponse, error) {
+	var reader *bytes.Reader
+	if body != nil {
+		js, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(js)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequest(method, client.address+"/v1/"+strings.TrimLeft(path, "/"), reader)
+	if err != nil {
+		return nil, err
+	}
+	if len(client.token) > 0 {
+		req.Header.Set("X-Vault-Token", client.token)
+	}
+	if len(client.namespace) > 0 {
+		req.Header.Set("X-Vault-Namespace", client.namespace)
+	}
+
+	resp, err := client.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := &vaultResponse{}
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+	decodeErr := decoder.Decode(result)
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound && len(result.Errors) == 0:
+		return nil, fmt.Errorf("no secret at %s", path)
+	case resp.StatusCode >= 300 && len(result.Errors) > 0:
+		return nil, fmt.Errorf("Vault returned %d: %s", resp.StatusCode, strings.Join(result.Errors, "; "))
+	case resp.StatusCode >= 300:
+		return nil, fmt.Errorf("Vault returned %d", resp.StatusCode)
+	case decodeErr != nil:
+		return nil, decodeErr
+	}
+	return result, nil
+}
+
+// login gets a token with the AppRole when there is no token
+func (client *vaultClient) login() error {
+	if len(client.token) > 0 {
+		return nil
+	}
+
+	resp, err := client.do(http.MethodPost, "auth/"+client.authPath+"/login", map[string]string{
+		"role_id":   client.roleID,
+		"secret_id": client.secretID,
+	})
+	if err != nil {
+		return fmt.Errorf("AppRole login: %s", err)
+	}
+	if len(resp.Auth.ClientToken) == 0 {
+		return errors.New("AppRole login: no token in the response")
+	}
+
+	client.token = resp.Auth.ClientToken
+	return nil
+}
+
+// Read returns keys of the secret path, KV version 2 secrets are read
+// at <mount>/data/<path> and their data is unwrapped
+func (client *vaultClient) Read(path string) (map[string]interface{}, error) {
+	if err := client.login(); err != nil {
+		return nil, err
+	}
+
+	resp, err := client.do(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if data, ok := resp.Data["data"].(map[string]interface{}); ok {
+		if _, ok := resp.Data["metadata"]; ok {
+			return data, nil
+		}
+	}
+	if resp.Data == nil {
+		return nil, fmt.Errorf("no secret at %s", path)
+	}
+	return resp.Data, nil
+}
@@ -1,23 +1,300 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/silentsokolov/go-sleep/log"
+	"github.com/silentsokolov/go-sleep/provider"
 )
 
+// apiPrefix is the path prefix of the management API
+const apiPrefix = "/api/"
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+type leaseRequest struct {
+	TTL    int64  `json:"ttl"`
+	Holder string `json:"holder"`
+}
+
 func indexHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "OK")
 }
 
-func startWebServer(addr string) {
+func startWebServer(addr string, api, notify http.Handler) {
 	srv := http.NewServeMux()
 
 	srv.HandleFunc("/", indexHandler)
+	srv.Handle(apiPrefix, api)
+	srv.Handle(notifyPrefix, notify)
 
 	log.Printf("Starting web server on %s", addr)
 	if err := http.ListenAndServe(addr, srv); err != nil {
 		log.Fatal("Error creating web server: ", err)
 	}
 }
+
+// apiHandler serves the management API, requests are authenticated
+// by one of api_keys in the X-Go-Sleep-Key header
+func (server *Server) apiHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !server.validAPIKey(r.Header.Get("X-Go-Sleep-Key")) {
+			responseJSON(w, http.StatusUnauthorized, apiError{"Invalid key"})
+			return
+		}
+
+		// routes, instances[/<id>[/<resource>[/<name>]]]
+		parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, apiPrefix), "/"), "/")
+		switch {
+		case len(parts) == 1 && parts[0] == "routes":
+			server.routesHandler(w, r)
+			return
+		case len(parts) == 1 && parts[0] == "instances":
+			server.instancesHandler(w, r)
+			return
+		case len(parts) < 2 || len(parts) > 4 || parts[0] != "instances":
+			responseJSON(w, http.StatusNotFound, apiError{"Not found"})
+			return
+		}
+
+		computer, ok := server.findInstance(parts[1])
+		if !ok {
+			responseJSON(w, http.StatusNotFound, apiError{fmt.Sprintf("Not found instance: %s", parts[1])})
+			return
+		}
+
+		switch {
+		case len(parts) == 2 && r.Method == http.MethodGet:
+			responseJSON(w, http.StatusOK, server.instanceState(computer))
+		case len(parts) == 2:
+			responseJSON(w, http.StatusMethodNotAllowed, apiError{"Method not allowed"})
+		case parts[2] == "leases" && len(parts) == 4:
+			server.leaseHandler(w, r, computer, parts[3])
+		case len(parts) == 4:
+			responseJSON(w, http.StatusNotFound, apiError{"Not found"})
+		case parts[2] == "start" || parts[2] == "stop":
+			server.controlHandler(w, r, computer, parts[2])
+		case parts[2] != "leases" && parts[2] != "history":
+			responseJSON(w, http.StatusNotFound, apiError{"Not found"})
+		case r.Method != http.MethodGet:
+			responseJSON(w, http.StatusMethodNotAllowed, apiError{"Method not allowed"})
+		case parts[2] == "leases":
+			responseJSON(w, http.StatusOK, computer.Leases())
+		default:
+			responseJSON(w, http.StatusOK, computer.History())
+		}
+	})
+}
+
+// instanceState is the state of an instance in the management API
+type instanceState struct {
+	ID         string     `json:"id,omitempty"`
+	Hash       string     `json:"hash"`
+	Provider   string     `json:"provider"`
+	Status     string     `json:"status"`
+	Ready      bool       `json:"ready"`
+	IPs        []string   `json:"ips,omitempty"`
+	Hostnames  []string   `json:"hostnames,omitempty"`
+	LastAccess *time.Time `json:"last_access,omitempty"`
+	SleepIn    *int64     `json:"sleep_in,omitempty"`
+	Leases     []Lease    `json:"leases,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// routeState is a route in the management API
+type routeState struct {
+	Address     string `json:"address"`
+	Hostname    string `json:"hostname,omitempty"`
+	Protocol    string `json:"protocol"`
+	BackendPort int    `json:"backend_port"`
+	Instance    string `json:"instance"`
+	Proxy       bool   `json:"proxy,omitempty"`
+	Default     bool   `json:"default,omitempty"`
+}
+
+func (server *Server) instanceState(computer *ComputeInstance) instanceState {
+	status := computer.Status()
+	leases := computer.Leases()
+	sleepIn := computer.SleepIn()
+
+	computer.RLock()
+	defer computer.RUnlock()
+
+	state := instanceState{
+		ID:        computer.ID,
+		Hash:      computer.Hash(),
+		Provider:  computer.Provider.String(),
+		Status:    status.String(),
+		Ready:     status == provider.StatusInstanceRunning && computer.HTTPHealth,
+		IPs:       append([]string{}, computer.ips...),
+		Hostnames: server.hostnames(computer.Hash()),
+		Leases:    leases,
+	}
+
+	if !computer.lastAccess.IsZero() {
+		lastAccess := computer.lastAccess
+		state.LastAccess = &lastAccess
+	}
+	if status == provider.StatusInstanceRunning && computer.sleepAfter >= 0 {
+		seconds := int64(sleepIn / time.Second)
+		state.SleepIn = &seconds
+	}
+	if computer.lastError != nil {
+		state.Error = computer.lastError.Error()
+	}
+
+	return state
+}
+
+// hostnames returns hostnames of all HTTP routes of the instance hash,
+// wildcards and regexps included
+func (server *Server) hostnames(hash string) []string {
+	var hostnames []string
+	for address := range server.serverRoutes {
+		for _, route := range server.addressRoutes(address) {
+			if route.InstanceName == hash && len(route.Hostname) > 0 {
+				hostnames = append(hostnames, route.Hostname)
+			}
+		}
+	}
+	sort.Strings(hostnames)
+	return hostnames
+}
+
+// findInstance returns the instance by its id, hash or a hostname routed
+// to it, default routes are not used
+func (server *Server) findInstance(name string) (*ComputeInstance, bool) {
+	if computer, ok := server.InstanceStore.Find(name); ok {
+		return computer, true
+	}
+
+	for address := range server.serverRoutes {
+		if route, key, ok := server.matchRoute(address, name); ok && len(route.Hostname) > 0 {
+			return server.InstanceStore.Find(key)
+		}
+	}
+	return nil, false
+}
+
+func (server *Server) instancesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		responseJSON(w, http.StatusMethodNotAllowed, apiError{"Method not allowed"})
+		return
+	}
+
+	server.InstanceStore.RLock()
+	states := make([]instanceState, 0, len(server.InstanceStore.values))
+	for _, computer := range server.InstanceStore.values {
+		states = append(states, server.instanceState(computer))
+	}
+	server.InstanceStore.RUnlock()
+
+	sort.Slice(states, func(i, j int) bool {
+		if states[i].ID != states[j].ID {
+			return states[i].ID < states[j].ID
+		}
+		return states[i].Hash < states[j].Hash
+	})
+	responseJSON(w, http.StatusOK, states)
+}
+
+func (server *Server) routesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		responseJSON(w, http.StatusMethodNotAllowed, apiError{"Method not allowed"})
+		return
+	}
+
+	instanceName := func(route *serverRoute) string {
+		if len(route.instanceTemplate) > 0 {
+			return route.instanceTemplate
+		}
+		if computer, ok := server.InstanceStore.Get(route.InstanceName); ok && len(computer.ID) > 0 {
+			return computer.ID
+		}
+		return route.InstanceName
+	}
+
+	routes := make([]routeState, 0)
+	for address := range server.serverRoutes {
+		for _, route := range server.addressRoutes(address) {
+			routes = append(routes, routeState{address, route.Hostname, protocolHTTP, route.BackendPort, instanceName(route), route.IsProxy, len(route.Hostname) == 0})
+		}
+	}
+	for address, route := range server.tcpRoutes {
+		routes = append(routes, routeState{address, "", protocolTCP, route.BackendPort, instanceName(route), route.IsProxy, false})
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Address != routes[j].Address {
+			return routes[i].Address < routes[j].Address
+		}
+		return routes[i].Hostname < routes[j].Hostname
+	})
+	responseJSON(w, http.StatusOK, routes)
+}
+
+// controlHandler starts or stops the instance like a request or the idle timer
+func (server *Server) controlHandler(w http.ResponseWriter, r *http.Request, computer *ComputeInstance, action string) {
+	if r.Method != http.MethodPost {
+		responseJSON(w, http.StatusMethodNotAllowed, apiError{"Method not allowed"})
+		return
+	}
+
+	switch action {
+	case "start":
+		switch computer.Status() {
+		case provider.StatusInstanceNotRun, provider.StatusInstanceError:
+			computer.RequestStart("", r.Header.Get("X-Go-Sleep-User"))
+		}
+	case "stop":
+		switch computer.Status() {
+		case provider.StatusInstanceRunning, provider.StatusInstanceStarting:
+			computer.Stop()
+		}
+	}
+
+	responseJSON(w, http.StatusAccepted, server.instanceState(computer))
+}
+
+func (server *Server) leaseHandler(w http.ResponseWriter, r *http.Request, computer *ComputeInstance, name string) {
+	switch r.Method {
+	case http.MethodPut:
+		req := leaseRequest{}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				responseJSON(w, http.StatusBadRequest, apiError{err.Error()})
+				return
+			}
+		}
+
+		if req.TTL < 0 {
+			responseJSON(w, http.StatusBadRequest, apiError{"ttl must be positive"})
+			return
+		}
+
+		ttl := defaultLeaseTTL
+		if req.TTL > 0 {
+			ttl = time.Duration(req.TTL) * time.Second
+		}
+		if len(req.Holder) == 0 {
+			req.Holder = requestClient(r).IP
+		}
+
+		responseJSON(w, http.StatusOK, computer.AcquireLease(name, req.Holder, ttl))
+	case http.MethodDelete:
+		if !computer.RevokeLease(name) {
+			responseJSON(w, http.StatusNotFound, apiError{fmt.Sprintf("Not found lease: %s", name)})
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		responseJSON(w, http.StatusMethodNotAllowed, apiError{"Method not allowed"})
+	}
+}
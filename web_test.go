@@ -3,7 +3,11 @@ package main
 import (
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/silentsokolov/go-sleep/provider"
 )
 
 func TestIndexHandler(t *testing.T) {
@@ -26,3 +30,102 @@ func TestIndexHandler(t *testing.T) {
 		t.Errorf("indexHandler returned unexpected body: got %v want %v", recorder.Body.String(), expected)
 	}
 }
+
+func TestServer_apiHandler_leases(t *testing.T) {
+	server := NewServer(&Config{})
+	defer server.Close()
+	server.apiKeys = []string{"other", "secret"}
+	server.secretKey = "backend"
+
+	instance := NewComputeInstance(newDummyProvider("test", false), time.Minute)
+	instance.ID = "app"
+	server.InstanceStore.Set(instance.Hash(), instance)
+	handler := server.apiHandler()
+
+	var requestTable = []struct {
+		method string
+		path   string
+		key    string
+		body   string
+		status int
+		leases int
+	}{
+		{"GET", "/api/instances/app/leases", "", "", http.StatusUnauthorized, 0},
+		{"GET", "/api/instances/app/leases", "backend", "", http.StatusUnauthorized, 0},
+		{"GET", "/api/instances/db/leases", "secret", "", http.StatusNotFound, 0},
+		{"PUT", "/api/instances/app/leases/backup", "secret", `{"ttl": "soon"}`, http.StatusBadRequest, 0},
+		{"PUT", "/api/instances/app/leases/backup", "secret", `{"ttl": 600, "holder": "cron"}`, http.StatusOK, 1},
+		{"PUT", "/api/instances/" + instance.Hash() + "/leases/deploy", "secret", "", http.StatusOK, 2},
+		{"GET", "/api/instances/app/leases", "secret", "", http.StatusOK, 2},
+		{"POST", "/api/instances/app/leases", "secret", "", http.StatusMethodNotAllowed, 2},
+		{"DELETE", "/api/instances/app/leases/deploy", "secret", "", http.StatusNoContent, 1},
+		{"DELETE", "/api/instances/app/leases/deploy", "secret", "", http.StatusNotFound, 1},
+	}
+
+	for _, test := range requestTable {
+		r := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+		r.Header.Set("X-Go-Sleep-Key", test.key)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.status {
+			t.Errorf("%s %s returned status %d, want %d", test.method, test.path, w.Code, test.status)
+		}
+		if leases := instance.Leases(); len(leases) != test.leases {
+			t.Errorf("%s %s left %d leases, want %d", test.method, test.path, len(leases), test.leases)
+		}
+	}
+}
+
+func TestServer_apiHandler_instances(t *testing.T) {
+	server := NewServer(&Config{})
+	defer server.Close()
+	server.apiKeys = []string{"secret"}
+
+	instance := NewComputeInstance(newDummyProvider("test", false), time.Minute)
+	instance.ID = "app"
+	server.InstanceStore.Set(instance.Hash(), instance)
+	server.serverRoutes[":80"] = map[string]*serverRoute{
+		"app.example.com": {Hostname: "app.example.com", BackendPort: 8080, InstanceName: instance.Hash()},
+	}
+	server.tcpRoutes[":5432"] = &serverRoute{BackendPort: 5432, InstanceName: instance.Hash()}
+	handler := server.apiHandler()
+
+	var requestTable = []struct {
+		method string
+		path   string
+		status int
+		body   string
+	}{
+		{"GET", "/api/instances", http.StatusOK, `[{"id":"app","hash":"dummy-test","provider":"[dummyProvider] ID: test","status":"running","ready":true,"ips":["www.example.org"],"hostnames":["app.example.com"]`},
+		{"GET", "/api/instances/app.example.com", http.StatusOK, `"hostnames":["app.example.com"]`},
+		{"GET", "/api/instances/db.example.com", http.StatusNotFound, `"error"`},
+		{"PUT", "/api/instances/app", http.StatusMethodNotAllowed, `"error"`},
+		{"GET", "/api/instances/app/start", http.StatusMethodNotAllowed, `"error"`},
+		{"POST", "/api/instances/app/restart", http.StatusNotFound, `"error"`},
+		{"POST", "/api/instances/app/start", http.StatusAccepted, `"status":"running"`},
+		{"POST", "/api/instances/app/stop", http.StatusAccepted, `"id":"app"`},
+		{"GET", "/api/routes", http.StatusOK, `[{"address":":5432","protocol":"tcp","backend_port":5432,"instance":"app"},{"address":":80","hostname":"app.example.com","protocol":"http","backend_port":8080,"instance":"app"}]`},
+		{"GET", "/api/routes/:80", http.StatusNotFound, `"error"`},
+	}
+
+	for _, test := range requestTable {
+		r := httptest.NewRequest(test.method, test.path, nil)
+		r.Header.Set("X-Go-Sleep-Key", "secret")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.status {
+			t.Errorf("%s %s returned status %d, want %d", test.method, test.path, w.Code, test.status)
+		}
+		if !strings.Contains(w.Body.String(), test.body) {
+			t.Errorf("%s %s returned %s, want %s", test.method, test.path, w.Body.String(), test.body)
+		}
+	}
+
+	if len(instance.statusChan) != 1 {
+		t.Errorf("stop sent %d statuses, want 1", len(instance.statusChan))
+	} else if status := <-instance.statusChan; status != provider.StatusInstanceStopping {
+		t.Errorf("stop sent %v, want %v", status, provider.StatusInstanceStopping)
+	}
+}
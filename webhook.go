@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"text/template"
+	"time"
+
+	"github.com/silentsokolov/go-sleep/log"
+)
+
+// Webhook formats
+const (
+	webhookFormatJSON     = "json"
+	webhookFormatSlack    = "slack"
+	webhookFormatTemplate = "template"
+)
+
+const (
+	defaultWebhookRetries = 3
+	defaultWebhookTimeout = 10 * time.Second
+	webhookQueueSize      = 100
+)
+
+// webhookBackoff is the delay before the first retry, doubled on each retry
+var webhookBackoff = time.Second
+
+// Webhook posts lifecycle events to an URL
+type Webhook struct {
+	URL         string
+	Format      string
+	ContentType string
+	Events      map[string]bool
+	Retries     int
+	secret      []byte
+	template    *template.Template
+	client      *http.Client
+	queue       chan Event
+}
+
+// NewWebhook ...
+func NewWebhook(conf *WebhookConfig) *Webhook {
+	hook := &Webhook{
+		URL:         conf.URL,
+		Format:      conf.Format,
+		ContentType: conf.ContentType,
+		Events:      make(map[string]bool),
+		Retries:     conf.Retries,
+		secret:      []byte(conf.Secret),
+		client:      &http.Client{Timeout: defaultWebhookTimeout},
+		queue:       make(chan Event, webhookQueueSize),
+	}
+
+	if len(hook.URL) == 0 {
+		log.Fatal("Webhook requires url")
+	}
+
+	if conf.Timeout > 0 {
+		hook.client.Timeout = time.Duration(conf.Timeout) * time.Second
+	}
+
+	if hook.Retries == 0 {
+		hook.Retries = defaultWebhookRetries
+	} else if hook.Retries < 0 {
+		hook.Retries = 0
+	}
+
+	switch hook.Format {
+	case "", webhookFormatJSON:
+		hook.Format = webhookFormatJSON
+		hook.setContentType("application/json")
+	case webhookFormatSlack:
+		hook.setContentType("application/json")
+	case webhookFormatTemplate:
+		tmpl, err := template.New("webhook").Funcs(template.FuncMap{"json": jsonString}).Parse(conf.Template)
+		if err != nil {
+			log.Fatalf("Webhook %s: invalid template: %v", hook.URL, err)
+		}
+		hook.template = tmpl
+		hook.setContentType("text/plain")
+	default:
+		log.Fatalf("Webhook %s: unknown format %q", hook.URL, hook.Format)
+	}
+
+	events := conf.Events
+	if len(events) == 0 {
+		events = allEvents
+	}
+	for _, name := range events {
+		if !isEvent(name) {
+			log.Fatalf("Webhook %s: unknown event %q", hook.URL, name)
+		}
+		hook.Events[name] = true
+	}
+
+	go hook.run()
+
+	return hook
+}
+
+func (hook *Webhook) setContentType(contentType string) {
+	if len(hook.ContentType) == 0 {
+		hook.ContentType = contentType
+	}
+}
+
+// Notify queues event, events are dropped when the queue is full
+func (hook *Webhook) Notify(event Event) {
+	if !hook.Events[event.Event] {
+		return
+	}
+
+	select {
+	case hook.queue <- event:
+	default:
+		log.Warnf("Webhook %s: queue is full, %s of %s dropped", hook.URL, event.Event, event.Instance)
+	}
+}
+
+func (hook *Webhook) run() {
+	for event := range hook.queue {
+		if err := hook.deliver(event); err != nil {
+			log.Printf("Webhook %s: %s of %s raise error: %s", hook.URL, event.Event, event.Instance, err)
+		}
+	}
+}
+
+// deliver posts event, failed requests are retried with exponential backoff
+func (hook *Webhook) deliver(event Event) error {
+	body, err := hook.body(event)
+	if err != nil {
+		return err
+	}
+
+	backoff := webhookBackoff
+	for attempt := 0; ; attempt++ {
+		retry, err := hook.post(body)
+		if err == nil || !retry || attempt >= hook.Retries {
+			return err
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post sends body and reports whether a failed request may be retried
+func (hook *Webhook) post(body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Set("Content-Type", hook.ContentType)
+	req.Header.Set("User-Agent", "go-sleep")
+	if len(hook.secret) > 0 {
+		req.Header.Set("X-Go-Sleep-Signature", "sha256="+signBody(hook.secret, body))
+	}
+
+	resp, err := hook.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return retry, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return false, nil
+}
+
+func (hook *Webhook) body(event Event) ([]byte, error) {
+	switch hook.Format {
+	case webhookFormatSlack:
+		return json.Marshal(map[string]string{"text": eventMessage(event)})
+	case webhookFormatTemplate:
+		var buf bytes.Buffer
+		err := hook.template.Execute(&buf, event)
+		return buf.Bytes(), err
+	default:
+		return json.Marshal(event)
+	}
+}
+
+// signBody returns hex HMAC-SHA256 of body
+func signBody(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// eventMessage returns a human readable description of event
+func eventMessage(event Event) string {
+	var b bytes.Buffer
+
+	switch event.Event {
+	case EventWakeRequested:
+		fmt.Fprintf(&b, "Wake of %s requested", event.Provider)
+	case EventRunning:
+		fmt.Fprintf(&b, "%s is running", event.Provider)
+	case EventHealthPassed:
+		fmt.Fprintf(&b, "%s passed HTTP health", event.Provider)
+	case EventSleeping:
+		fmt.Fprintf(&b, "%s goes to sleep", event.Provider)
+	case EventStopped:
+		fmt.Fprintf(&b, "%s is stopped", event.Provider)
+	case EventError:
+		fmt.Fprintf(&b, "%s failed: %s", event.Provider, event.Error)
+	case EventBootFailed:
+		fmt.Fprintf(&b, "%s failed to boot: %s", event.Provider, event.Error)
+	}
+
+	if event.Duration > 0 {
+		d := time.Duration(event.Duration * float64(time.Second)).Round(time.Second)
+		if event.Event == EventSleeping {
+			fmt.Fprintf(&b, " after %s of inactivity", d)
+		} else {
+			fmt.Fprintf(&b, " after %s", d)
+		}
+	}
+
+	if len(event.User) > 0 {
+		fmt.Fprintf(&b, ", requested by %s", event.User)
+	}
+
+	if len(event.Hostname) > 0 {
+		fmt.Fprintf(&b, " via %s", event.Hostname)
+	}
+
+	return b.String()
+}
+
+func isEvent(name string) bool {
+	for _, e := range allEvents {
+		if e == name {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonString(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWebhook_deliver(t *testing.T) {
+	webhookBackoff = time.Millisecond
+
+	var mu sync.Mutex
+	var attempts int
+	var body []byte
+	var signature string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		body, _ = ioutil.ReadAll(r.Body)
+		signature = r.Header.Get("X-Go-Sleep-Signature")
+	}))
+	defer server.Close()
+
+	hook := NewWebhook(&WebhookConfig{URL: server.URL, Secret: "secret"})
+	event := Event{Event: EventRunning, Instance: "dummy-test", Duration: 42}
+
+	if err := hook.deliver(event); err != nil {
+		t.Fatalf("Webhook.deliver returned unexpected error: %v", err)
+	}
+
+	if attempts != 3 {
+		t.Errorf("Webhook.deliver made %d attempts, want %d", attempts, 3)
+	}
+
+	var got Event
+	if err := json.Unmarshal(body, &got); err != nil || got.Event != EventRunning || got.Duration != 42 {
+		t.Errorf("Webhook.deliver sent %s (%v), want %+v", body, err, event)
+	}
+
+	if want := "sha256=" + signBody([]byte("secret"), body); signature != want {
+		t.Errorf("Webhook.deliver signed %q, want %q", signature, want)
+	}
+}
+
+func TestWebhook_deliverNotRetried(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	hook := NewWebhook(&WebhookConfig{URL: server.URL})
+	if err := hook.deliver(Event{Event: EventError}); err == nil {
+		t.Error("Webhook.deliver returned no error for bad request")
+	}
+
+	if attempts != 1 {
+		t.Errorf("Webhook.deliver made %d attempts, want %d", attempts, 1)
+	}
+}
+
+func TestWebhook_body(t *testing.T) {
+	event := Event{
+		Event:    EventRunning,
+		Instance: "dummy-test",
+		Provider: "[dummyProvider] ID: test",
+		Hostname: "app.example.org",
+		User:     "alice",
+		Duration: 65,
+	}
+
+	var bodyTable = []struct {
+		conf *WebhookConfig
+		out  string
+	}{
+		{
+			&WebhookConfig{URL: "http://localhost", Format: webhookFormatSlack},
+			`{"text":"[dummyProvider] ID: test is running after 1m5s, requested by alice via app.example.org"}`,
+		},
+		{
+			&WebhookConfig{URL: "http://localhost", Format: webhookFormatTemplate, Template: `{{.Instance}} {{.Event}} {{json .Hostname}}`},
+			`dummy-test running "app.example.org"`,
+		},
+	}
+
+	for _, test := range bodyTable {
+		body, err := NewWebhook(test.conf).body(event)
+		if err != nil || string(body) != test.out {
+			t.Errorf("Webhook.body returned %s (%v), want %s", body, err, test.out)
+		}
+	}
+}
+
+func TestWebhook_Notify(t *testing.T) {
+	hook := &Webhook{Events: map[string]bool{EventError: true}, queue: make(chan Event, 1)}
+
+	hook.Notify(Event{Event: EventRunning})
+	hook.Notify(Event{Event: EventError})
+
+	if len(hook.queue) != 1 {
+		t.Errorf("Webhook.Notify queued %d events, want %d", len(hook.queue), 1)
+	}
+}